@@ -0,0 +1,157 @@
+// Copyright (c) 2018-2019 Sylabs, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"sync"
+	"syscall"
+
+	"github.com/golang/glog"
+	syunix "github.com/sylabs/singularity/pkg/util/unix"
+)
+
+// listenFDsStart is the first file descriptor passed
+// with socket activation, see sd_listen_fds(3).
+const listenFDsStart = 3
+
+// activated holds listeners passed by systemd socket activation
+// that are not yet taken by any of servers.
+var activated struct {
+	sync.Mutex
+	listeners []net.Listener
+}
+
+// loadActivatedListeners takes over listeners passed by systemd socket
+// activation, if any. Environment variables set by systemd are unset
+// so that they are not inherited by child processes.
+func loadActivatedListeners() error {
+	listeners, err := listenFDs(listenFDsStart)
+	if err != nil {
+		return err
+	}
+	for _, lis := range listeners {
+		glog.Infof("Received activated listener on %v", lis.Addr())
+	}
+
+	activated.Lock()
+	activated.listeners = listeners
+	activated.Unlock()
+	return nil
+}
+
+// listenFDs returns listeners created from file descriptors passed
+// starting from start as specified in LISTEN_PID and LISTEN_FDS.
+func listenFDs(start int) ([]net.Listener, error) {
+	defer os.Unsetenv("LISTEN_PID")
+	defer os.Unsetenv("LISTEN_FDS")
+	defer os.Unsetenv("LISTEN_FDNAMES")
+
+	pidStr := os.Getenv("LISTEN_PID")
+	if pidStr == "" {
+		return nil, nil
+	}
+	pid, err := strconv.Atoi(pidStr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid LISTEN_PID value: %v", err)
+	}
+	if pid != os.Getpid() {
+		return nil, nil
+	}
+	n, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid LISTEN_FDS value: %v", err)
+	}
+
+	listeners := make([]net.Listener, 0, n)
+	for fd := start; fd < start+n; fd++ {
+		syscall.CloseOnExec(fd)
+		f := os.NewFile(uintptr(fd), "LISTEN_FD_"+strconv.Itoa(fd))
+		lis, err := net.FileListener(f)
+		f.Close()
+		if err != nil {
+			for _, lis := range listeners {
+				lis.Close()
+			}
+			return nil, fmt.Errorf("could not use file descriptor %d as listener: %v", fd, err)
+		}
+		listeners = append(listeners, lis)
+	}
+	return listeners, nil
+}
+
+// takeActivated returns activated listener that matches passed
+// address and removes it from the list. It returns nil if there
+// is no such listener.
+func takeActivated(match func(addr net.Addr) bool) net.Listener {
+	activated.Lock()
+	defer activated.Unlock()
+
+	for i, lis := range activated.listeners {
+		if match(lis.Addr()) {
+			activated.listeners = append(activated.listeners[:i], activated.listeners[i+1:]...)
+			return lis
+		}
+	}
+	return nil
+}
+
+// closeUnusedActivated closes activated listeners
+// that do not match any of configured addresses.
+func closeUnusedActivated() {
+	activated.Lock()
+	defer activated.Unlock()
+
+	for _, lis := range activated.listeners {
+		glog.Warningf("Activated listener on %v is not configured to be served, closing", lis.Addr())
+		lis.Close()
+	}
+	activated.listeners = nil
+}
+
+// listenUnix returns activated listener on path if there is one,
+// otherwise it creates new unix socket at path.
+func listenUnix(path string) (net.Listener, error) {
+	lis := takeActivated(func(addr net.Addr) bool {
+		return addr.Network() == "unix" && addr.String() == path
+	})
+	if lis != nil {
+		return lis, nil
+	}
+	return syunix.CreateSocket(path)
+}
+
+// listenTCP returns activated listener on address if there is one,
+// otherwise it starts listening on address.
+func listenTCP(address string) (net.Listener, error) {
+	tcpAddr, err := net.ResolveTCPAddr("tcp", address)
+	if err != nil {
+		return nil, fmt.Errorf("could not resolve %s: %v", address, err)
+	}
+	lis := takeActivated(func(addr net.Addr) bool {
+		a, ok := addr.(*net.TCPAddr)
+		if !ok || a.Port != tcpAddr.Port {
+			return false
+		}
+		return a.IP.Equal(tcpAddr.IP) || (a.IP.IsUnspecified() && (tcpAddr.IP == nil || tcpAddr.IP.IsUnspecified()))
+	})
+	if lis != nil {
+		return lis, nil
+	}
+	return net.Listen("tcp", address)
+}
@@ -0,0 +1,129 @@
+// Copyright (c) 2018-2019 Sylabs, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestListenFDs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "activation-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	socket := filepath.Join(dir, "cri.sock")
+	unixLis, err := net.Listen("unix", socket)
+	require.NoError(t, err)
+	defer unixLis.Close()
+	tcpLis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer tcpLis.Close()
+
+	// pass listeners on high file descriptors to not clash with open files
+	const start = 100
+	for i, lis := range []net.Listener{unixLis, tcpLis} {
+		f, err := lis.(interface {
+			File() (*os.File, error)
+		}).File()
+		require.NoError(t, err)
+		require.NoError(t, syscall.Dup2(int(f.Fd()), start+i))
+		f.Close()
+	}
+
+	tt := []struct {
+		name        string
+		pid         string
+		fds         string
+		expectAddrs []string
+		expectError bool
+	}{
+		{
+			name: "not activated",
+		},
+		{
+			name: "other process",
+			pid:  "1",
+			fds:  "2",
+		},
+		{
+			name:        "invalid fds",
+			pid:         strconv.Itoa(os.Getpid()),
+			fds:         "two",
+			expectError: true,
+		},
+		{
+			name:        "activated",
+			pid:         strconv.Itoa(os.Getpid()),
+			fds:         "2",
+			expectAddrs: []string{socket, tcpLis.Addr().String()},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			os.Setenv("LISTEN_PID", tc.pid)
+			os.Setenv("LISTEN_FDS", tc.fds)
+			listeners, err := listenFDs(start)
+			_, pidSet := os.LookupEnv("LISTEN_PID")
+			require.False(t, pidSet, "LISTEN_PID should be unset")
+			if tc.expectError {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+
+			var addrs []string
+			for _, lis := range listeners {
+				addrs = append(addrs, lis.Addr().String())
+				lis.Close()
+			}
+			require.Equal(t, tc.expectAddrs, addrs)
+		})
+	}
+}
+
+func TestTakeActivated(t *testing.T) {
+	dir, err := ioutil.TempDir("", "activation-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	socket := filepath.Join(dir, "cri.sock")
+	unixLis, err := net.Listen("unix", socket)
+	require.NoError(t, err)
+	tcpLis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	activated.listeners = []net.Listener{unixLis, tcpLis}
+	defer closeUnusedActivated()
+
+	lis, err := listenTCP(tcpLis.Addr().String())
+	require.NoError(t, err)
+	require.True(t, lis == tcpLis, "activated TCP listener should be used")
+	lis.Close()
+
+	lis, err = listenUnix(socket)
+	require.NoError(t, err)
+	require.True(t, lis == unixLis, "activated unix listener should be used")
+	lis.Close()
+	require.Empty(t, activated.listeners)
+}
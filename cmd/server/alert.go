@@ -0,0 +1,138 @@
+// Copyright (c) 2018-2019 Sylabs, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// defaultPanicAlertWindow is used when PanicAlert window is not set.
+const defaultPanicAlertWindow = time.Minute
+
+// alertEvent is sent to webhook when panic rate exceeds threshold.
+type alertEvent struct {
+	Method string `json:"method"`
+	Panics int    `json:"panics"`
+	Window string `json:"window"`
+}
+
+// panicAlert tracks recovered panics and triggers configured hooks when
+// number of panics within window exceeds threshold. Hooks are triggered
+// at most once per window. Nil panicAlert ignores all panics.
+type panicAlert struct {
+	threshold int
+	window    time.Duration
+	fire      func(event alertEvent)
+
+	mu        sync.Mutex
+	panics    []time.Time
+	lastFired time.Time
+}
+
+// newPanicAlert returns panicAlert that calls hooks from config
+// or nil when no hooks are configured.
+func newPanicAlert(config PanicAlert) *panicAlert {
+	if config.Webhook == "" && config.Exec == "" {
+		return nil
+	}
+	window := config.Window
+	if window == 0 {
+		window = defaultPanicAlertWindow
+	}
+	return &panicAlert{
+		threshold: config.Threshold,
+		window:    window,
+		fire: func(event alertEvent) {
+			if config.Webhook != "" {
+				if err := postAlert(config.Webhook, event); err != nil {
+					glog.Errorf("Could not send panic alert: %v", err)
+				}
+			}
+			if config.Exec != "" {
+				if err := execAlert(config.Exec, event); err != nil {
+					glog.Errorf("Could not execute panic alert hook: %v", err)
+				}
+			}
+		},
+	}
+}
+
+// observe records panic caught in method at passed time.
+func (a *panicAlert) observe(method string, now time.Time) {
+	if a == nil {
+		return
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.panics = append(a.panics, now)
+	for len(a.panics) > 0 && now.Sub(a.panics[0]) > a.window {
+		a.panics = a.panics[1:]
+	}
+	if len(a.panics) <= a.threshold || now.Sub(a.lastFired) < a.window {
+		return
+	}
+
+	a.lastFired = now
+	event := alertEvent{
+		Method: method,
+		Panics: len(a.panics),
+		Window: a.window.String(),
+	}
+	glog.Warningf("Panic rate exceeded threshold: %d panics within %s", event.Panics, event.Window)
+	go a.fire(event)
+}
+
+func postAlert(url string, event alertEvent) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("could not encode alert: %v", err)
+	}
+	client := http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("unexpected webhook response: %s", resp.Status)
+	}
+	return nil
+}
+
+func execAlert(command string, event alertEvent) error {
+	cmd := exec.Command("/bin/sh", "-c", command)
+	cmd.Env = append(os.Environ(),
+		"SYCRI_PANIC_METHOD="+event.Method,
+		"SYCRI_PANIC_COUNT="+strconv.Itoa(event.Panics),
+		"SYCRI_PANIC_WINDOW="+event.Window,
+	)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%v: %s", err, out)
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+// Copyright (c) 2018-2019 Sylabs, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPanicAlert(t *testing.T) {
+	fired := make(chan alertEvent, 10)
+	alert := &panicAlert{
+		threshold: 2,
+		window:    time.Minute,
+		fire: func(event alertEvent) {
+			fired <- event
+		},
+	}
+
+	start := time.Now()
+	tt := []struct {
+		name        string
+		after       time.Duration
+		expectFired bool
+	}{
+		{name: "first", after: 0},
+		{name: "second", after: 10 * time.Second},
+		{name: "third exceeds", after: 20 * time.Second, expectFired: true},
+		{name: "fourth within same window", after: 30 * time.Second},
+		{name: "first in next window", after: 95 * time.Second},
+		{name: "second in next window", after: 100 * time.Second},
+		{name: "third in next window exceeds", after: 105 * time.Second, expectFired: true},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			alert.observe("/runtime.v1alpha2.RuntimeService/CreateContainer", start.Add(tc.after))
+			if !tc.expectFired {
+				select {
+				case <-fired:
+					t.Fatalf("unexpected alert")
+				case <-time.After(10 * time.Millisecond):
+				}
+				return
+			}
+			select {
+			case event := <-fired:
+				require.Equal(t, "/runtime.v1alpha2.RuntimeService/CreateContainer", event.Method)
+				require.Equal(t, "1m0s", event.Window)
+			case <-time.After(time.Second):
+				t.Fatalf("alert was not fired")
+			}
+		})
+	}
+
+	var nilAlert *panicAlert
+	nilAlert.observe("method", time.Now())
+}
+
+func TestPostAlert(t *testing.T) {
+	var received alertEvent
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, http.MethodPost, r.Method)
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&received))
+	}))
+	defer srv.Close()
+
+	event := alertEvent{
+		Method: "/runtime.v1alpha2.ImageService/PullImage",
+		Panics: 3,
+		Window: "1m0s",
+	}
+	require.NoError(t, postAlert(srv.URL, event))
+	require.Equal(t, event, received)
+}
@@ -0,0 +1,184 @@
+// Copyright (c) 2018-2019 Sylabs, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/syslog"
+	"os"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	k8s "k8s.io/kubernetes/pkg/kubelet/apis/cri/runtime/v1alpha2"
+)
+
+// auditSyslog is a special audit log destination that
+// makes audit records to be sent to the system logger.
+const auditSyslog = "syslog"
+
+// auditedMethods are names of CRI methods that are recorded in audit log.
+var auditedMethods = map[string]bool{
+	"RunPodSandbox":   true,
+	"CreateContainer": true,
+	"ExecSync":        true,
+	"Exec":            true,
+	"PullImage":       true,
+	"RemoveImage":     true,
+}
+
+// auditRecord is a single audit log entry.
+type auditRecord struct {
+	Time     time.Time         `json:"time"`
+	Method   string            `json:"method"`
+	Caller   string            `json:"caller,omitempty"`
+	Args     map[string]string `json:"args,omitempty"`
+	Code     string            `json:"code"`
+	Error    string            `json:"error,omitempty"`
+	Duration string            `json:"duration"`
+}
+
+// auditLog records mutating CRI requests as JSON lines into
+// an append-only file or system logger.
+type auditLog struct {
+	mu sync.Mutex
+	w  io.WriteCloser
+}
+
+// newAuditLog opens audit log at dest, which is either
+// path to a file or auditSyslog to use system logger.
+func newAuditLog(dest string) (*auditLog, error) {
+	if dest == auditSyslog {
+		w, err := syslog.New(syslog.LOG_NOTICE|syslog.LOG_AUTH, "sycri")
+		if err != nil {
+			return nil, fmt.Errorf("could not connect to syslog: %v", err)
+		}
+		return &auditLog{w: w}, nil
+	}
+
+	f, err := os.OpenFile(dest, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("could not open audit log: %v", err)
+	}
+	return &auditLog{w: f}, nil
+}
+
+// Close closes underlying audit log file or syslog connection.
+func (a *auditLog) Close() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.w.Close()
+}
+
+// intercept is a gRPC interceptor that records audited methods.
+func (a *auditLog) intercept(ctx context.Context, req interface{},
+	info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	method := path.Base(info.FullMethod)
+	if !auditedMethods[method] {
+		return handler(ctx, req)
+	}
+
+	start := time.Now()
+	resp, err := handler(ctx, req)
+	record := auditRecord{
+		Time:     start.UTC(),
+		Method:   method,
+		Caller:   auditCaller(ctx),
+		Args:     auditArgs(req, resp),
+		Code:     status.Code(err).String(),
+		Duration: time.Since(start).String(),
+	}
+	if err != nil {
+		record.Error = err.Error()
+	}
+	if err := a.write(record); err != nil {
+		glog.Errorf("Could not write audit record: %v", err)
+	}
+	return resp, err
+}
+
+func (a *auditLog) write(record auditRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("could not encode record: %v", err)
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	_, err = a.w.Write(append(data, '\n'))
+	return err
+}
+
+// auditCaller returns address of the client and common name
+// from its certificate when request is received over TLS.
+func auditCaller(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return ""
+	}
+	caller := p.Addr.String()
+	if tlsInfo, ok := p.AuthInfo.(credentials.TLSInfo); ok && len(tlsInfo.State.PeerCertificates) != 0 {
+		caller = fmt.Sprintf("%s (CN=%s)", caller, tlsInfo.State.PeerCertificates[0].Subject.CommonName)
+	}
+	return caller
+}
+
+// auditArgs returns summary of request arguments that is enough to tell
+// which objects were affected without recording any sensitive data.
+func auditArgs(req, resp interface{}) map[string]string {
+	args := make(map[string]string)
+	switch r := req.(type) {
+	case *k8s.RunPodSandboxRequest:
+		args["pod"] = r.GetConfig().GetMetadata().GetNamespace() + "/" + r.GetConfig().GetMetadata().GetName()
+		if resp, ok := resp.(*k8s.RunPodSandboxResponse); ok {
+			args["pod_id"] = resp.GetPodSandboxId()
+		}
+	case *k8s.CreateContainerRequest:
+		args["pod_id"] = r.GetPodSandboxId()
+		args["container"] = r.GetConfig().GetMetadata().GetName()
+		args["image"] = r.GetConfig().GetImage().GetImage()
+		if resp, ok := resp.(*k8s.CreateContainerResponse); ok {
+			args["container_id"] = resp.GetContainerId()
+		}
+	case *k8s.ExecSyncRequest:
+		args["container_id"] = r.GetContainerId()
+		args["cmd"] = fmt.Sprintf("%q", r.GetCmd())
+	case *k8s.ExecRequest:
+		args["container_id"] = r.GetContainerId()
+		args["cmd"] = fmt.Sprintf("%q", r.GetCmd())
+		args["tty"] = fmt.Sprintf("%t", r.GetTty())
+	case *k8s.PullImageRequest:
+		args["image"] = r.GetImage().GetImage()
+		if resp, ok := resp.(*k8s.PullImageResponse); ok {
+			args["image_ref"] = resp.GetImageRef()
+		}
+	case *k8s.RemoveImageRequest:
+		args["image"] = r.GetImage().GetImage()
+	}
+	for k, v := range args {
+		if v == "" || v == "/" {
+			delete(args, k)
+		}
+	}
+	return args
+}
@@ -0,0 +1,129 @@
+// Copyright (c) 2018-2019 Sylabs, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	k8s "k8s.io/kubernetes/pkg/kubelet/apis/cri/runtime/v1alpha2"
+)
+
+func TestAuditLog(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audit-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	logPath := filepath.Join(dir, "audit.log")
+	audit, err := newAuditLog(logPath)
+	require.NoError(t, err)
+
+	tt := []struct {
+		name    string
+		method  string
+		req     interface{}
+		resp    interface{}
+		err     error
+		audited bool
+		expect  auditRecord
+	}{
+		{
+			name:   "run pod",
+			method: "/runtime.v1alpha2.RuntimeService/RunPodSandbox",
+			req: &k8s.RunPodSandboxRequest{
+				Config: &k8s.PodSandboxConfig{
+					Metadata: &k8s.PodSandboxMetadata{
+						Name:      "nginx",
+						Namespace: "default",
+					},
+				},
+			},
+			resp:    &k8s.RunPodSandboxResponse{PodSandboxId: "pod1"},
+			audited: true,
+			expect: auditRecord{
+				Method: "RunPodSandbox",
+				Args: map[string]string{
+					"pod":    "default/nginx",
+					"pod_id": "pod1",
+				},
+				Code: "OK",
+			},
+		},
+		{
+			name:   "failed exec",
+			method: "/runtime.v1alpha2.RuntimeService/ExecSync",
+			req: &k8s.ExecSyncRequest{
+				ContainerId: "cont1",
+				Cmd:         []string{"ls", "-la"},
+			},
+			err:     status.Error(codes.NotFound, "container not found"),
+			audited: true,
+			expect: auditRecord{
+				Method: "ExecSync",
+				Args: map[string]string{
+					"container_id": "cont1",
+					"cmd":          `["ls" "-la"]`,
+				},
+				Code:  "NotFound",
+				Error: "rpc error: code = NotFound desc = container not found",
+			},
+		},
+		{
+			name:   "not audited",
+			method: "/runtime.v1alpha2.RuntimeService/ListContainers",
+			req:    &k8s.ListContainersRequest{},
+			resp:   &k8s.ListContainersResponse{},
+		},
+	}
+
+	var expect []auditRecord
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+				return tc.resp, tc.err
+			}
+			resp, err := audit.intercept(context.Background(), tc.req, &grpc.UnaryServerInfo{FullMethod: tc.method}, handler)
+			require.Equal(t, tc.err, err)
+			require.Equal(t, tc.resp, resp)
+			if tc.audited {
+				expect = append(expect, tc.expect)
+			}
+		})
+	}
+	require.NoError(t, audit.Close())
+
+	data, err := ioutil.ReadFile(logPath)
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	require.Len(t, lines, len(expect))
+	for i, line := range lines {
+		var record auditRecord
+		require.NoError(t, json.Unmarshal([]byte(line), &record))
+		require.False(t, record.Time.IsZero())
+		require.NotEmpty(t, record.Duration)
+		record.Time = expect[i].Time
+		record.Duration = expect[i].Duration
+		require.Equal(t, expect[i], record)
+	}
+}
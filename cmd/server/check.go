@@ -0,0 +1,243 @@
+// Copyright (c) 2018-2019 Sylabs, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/sylabs/singularity-cri/pkg/network"
+	"github.com/sylabs/singularity-cri/pkg/server/device"
+	"github.com/sylabs/singularity-cri/pkg/singularity"
+	snetwork "github.com/sylabs/singularity/pkg/network"
+	"golang.org/x/sys/unix"
+)
+
+// minSingularityVersion is the oldest Singularity version with OCI support.
+var minSingularityVersion = [2]int{3, 1}
+
+type checkStatus int
+
+const (
+	checkOK checkStatus = iota
+	checkWarn
+	checkFail
+)
+
+func (s checkStatus) String() string {
+	switch s {
+	case checkOK:
+		return " OK "
+	case checkWarn:
+		return "WARN"
+	default:
+		return "FAIL"
+	}
+}
+
+// preflightCheck is a single check of node environment. Optional features
+// should report checkWarn when they are unavailable, so that node is still
+// considered to be able to run Singularity-CRI.
+type preflightCheck struct {
+	name string
+	run  func(config Config) (checkStatus, string)
+}
+
+var preflightChecks = []preflightCheck{
+	{name: "privileges", run: checkPrivileges},
+	{name: "singularity", run: checkSingularity},
+	{name: "cgroups", run: checkCgroups},
+	{name: "cni", run: checkCNI},
+	{name: "storage dir", run: func(config Config) (checkStatus, string) {
+		return checkDirWritable(config.StorageDir)
+	}},
+	{name: "run dir", run: func(config Config) (checkStatus, string) {
+		return checkDirWritable(config.BaseRunDir)
+	}},
+	{name: "gpu", run: checkGPU},
+}
+
+// runCheck implements sycri check subcommand that validates node
+// environment and prints a report. It returns process exit code,
+// which is non-zero when node cannot run Singularity-CRI.
+func runCheck(w io.Writer, args []string) int {
+	if err := flag.CommandLine.Parse(args); err != nil {
+		return 2
+	}
+	config, err := parseConfig(configPath)
+	if err != nil {
+		fmt.Fprintf(w, "[%s] config: %v\n", checkFail, err)
+		return 1
+	}
+	setupSingularity(config)
+	if !reportChecks(w, config, preflightChecks) {
+		return 1
+	}
+	return 0
+}
+
+// reportChecks runs checks and writes their results to w.
+// It returns false when any of checks failed.
+func reportChecks(w io.Writer, config Config, checks []preflightCheck) bool {
+	ok := true
+	for _, check := range checks {
+		status, detail := check.run(config)
+		if status == checkFail {
+			ok = false
+		}
+		fmt.Fprintf(w, "[%s] %s: %s\n", status, check.name, detail)
+	}
+	return ok
+}
+
+func checkPrivileges(Config) (checkStatus, string) {
+	if os.Geteuid() != 0 {
+		return checkFail, "sycri should be run as root"
+	}
+	return checkOK, "running as root"
+}
+
+func checkSingularity(Config) (checkStatus, string) {
+	sing, err := exec.LookPath(singularity.BinaryPath())
+	if err != nil {
+		return checkFail, fmt.Sprintf("could not find %s: %v", singularity.BinaryPath(), err)
+	}
+	out, err := exec.Command(sing, "version").Output()
+	if err != nil {
+		return checkFail, fmt.Sprintf("could not get %s version: %v", singularity.RuntimeName, err)
+	}
+	version := strings.TrimSpace(string(out))
+	major, minor, err := parseVersion(version)
+	if err != nil {
+		return checkFail, err.Error()
+	}
+	if major < minSingularityVersion[0] || (major == minSingularityVersion[0] && minor < minSingularityVersion[1]) {
+		return checkFail, fmt.Sprintf("%s %s is too old, %d.%d+ is required",
+			sing, version, minSingularityVersion[0], minSingularityVersion[1])
+	}
+	if err := exec.Command(sing, singularity.OCISubcommand(), "--help").Run(); err != nil {
+		return checkFail, fmt.Sprintf("%s %s has no OCI support: %v", sing, version, err)
+	}
+	return checkOK, fmt.Sprintf("%s %s with OCI support", sing, version)
+}
+
+// parseVersion returns major and minor parts of version string, e.g. 3.1.0-1.el7.
+func parseVersion(version string) (int, int, error) {
+	parts := strings.SplitN(version, ".", 3)
+	if len(parts) < 2 {
+		return 0, 0, fmt.Errorf("unexpected version %q", version)
+	}
+	major, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, 0, fmt.Errorf("unexpected version %q", version)
+	}
+	minorEnd := strings.IndexFunc(parts[1], func(r rune) bool {
+		return r < '0' || r > '9'
+	})
+	if minorEnd == -1 {
+		minorEnd = len(parts[1])
+	}
+	minor, err := strconv.Atoi(parts[1][:minorEnd])
+	if err != nil {
+		return 0, 0, fmt.Errorf("unexpected version %q", version)
+	}
+	return major, minor, nil
+}
+
+func checkCgroups(Config) (checkStatus, string) {
+	var fs unix.Statfs_t
+	if err := unix.Statfs("/sys/fs/cgroup", &fs); err != nil {
+		return checkFail, fmt.Sprintf("could not check cgroup filesystem: %v", err)
+	}
+	if fs.Type == unix.CGROUP2_SUPER_MAGIC {
+		return checkFail, "unified cgroup v2 hierarchy is not supported, kubelet should use cgroupfs driver with cgroup v1"
+	}
+	return checkOK, "cgroup v1 hierarchy, kubelet should use cgroupfs driver"
+}
+
+func checkCNI(config Config) (checkStatus, string) {
+	cniPath := &snetwork.CNIPath{
+		Conf:   config.CNIConfDir,
+		Plugin: config.CNIBinDir,
+	}
+	if cniPath.Conf == "" {
+		cniPath.Conf = network.CNIConfDir
+	}
+	if cniPath.Plugin == "" {
+		cniPath.Plugin = network.CNIBinDir
+	}
+
+	netConfList, err := snetwork.GetAllNetworkConfigList(cniPath)
+	if err != nil {
+		return checkFail, fmt.Sprintf("could not get networks: %v", err)
+	}
+	if len(netConfList) == 0 {
+		return checkFail, fmt.Sprintf("no CNI network configuration found in %s", cniPath.Conf)
+	}
+	defaultNetwork := netConfList[0]
+	for _, plugin := range defaultNetwork.Plugins {
+		if _, err := os.Stat(filepath.Join(cniPath.Plugin, plugin.Network.Type)); err != nil {
+			return checkFail, fmt.Sprintf("plugin %s of network %s is not found in %s",
+				plugin.Network.Type, defaultNetwork.Name, cniPath.Plugin)
+		}
+	}
+	return checkOK, fmt.Sprintf("network %s is used for pods", defaultNetwork.Name)
+}
+
+// checkDirWritable checks that dir or its nearest existing
+// parent, where dir will be created, is writable.
+func checkDirWritable(dir string) (checkStatus, string) {
+	path := dir
+	for {
+		fi, err := os.Stat(path)
+		if err == nil {
+			if !fi.IsDir() {
+				return checkFail, fmt.Sprintf("%s is not a directory", path)
+			}
+			break
+		}
+		if !os.IsNotExist(err) || path == filepath.Dir(path) {
+			return checkFail, fmt.Sprintf("could not check %s: %v", dir, err)
+		}
+		path = filepath.Dir(path)
+	}
+	if err := unix.Access(path, unix.W_OK|unix.X_OK); err != nil {
+		return checkFail, fmt.Sprintf("%s is not writable: %v", path, err)
+	}
+	if path != dir {
+		return checkOK, fmt.Sprintf("%s will be created", dir)
+	}
+	return checkOK, fmt.Sprintf("%s is writable", dir)
+}
+
+func checkGPU(config Config) (checkStatus, string) {
+	devicePlugin, err := device.NewSingularityDevicePlugin(
+		device.WithSingularityConfDir(config.SingularityConfDir),
+	)
+	if err == device.ErrUnableToLoad || err == device.ErrNoGPUs {
+		return checkWarn, fmt.Sprintf("GPU support is not enabled: %v", err)
+	}
+	if err != nil {
+		return checkFail, fmt.Sprintf("could not create device plugin: %v", err)
+	}
+	defer devicePlugin.Shutdown()
+	return checkOK, fmt.Sprintf("GPUs are advertised as %s", devicePlugin.ResourceName())
+}
@@ -0,0 +1,153 @@
+// Copyright (c) 2018-2019 Sylabs, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReportChecks(t *testing.T) {
+	check := func(name string, status checkStatus) preflightCheck {
+		return preflightCheck{
+			name: name,
+			run: func(Config) (checkStatus, string) {
+				return status, name + " details"
+			},
+		}
+	}
+
+	tt := []struct {
+		name         string
+		checks       []preflightCheck
+		expectOK     bool
+		expectReport string
+	}{
+		{
+			name: "all ok",
+			checks: []preflightCheck{
+				check("first", checkOK),
+				check("second", checkWarn),
+			},
+			expectOK:     true,
+			expectReport: "[ OK ] first: first details\n[WARN] second: second details\n",
+		},
+		{
+			name: "failed",
+			checks: []preflightCheck{
+				check("first", checkFail),
+				check("second", checkOK),
+			},
+			expectOK:     false,
+			expectReport: "[FAIL] first: first details\n[ OK ] second: second details\n",
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			ok := reportChecks(&buf, Config{}, tc.checks)
+			require.Equal(t, tc.expectOK, ok)
+			require.Equal(t, tc.expectReport, buf.String())
+		})
+	}
+}
+
+func TestParseVersion(t *testing.T) {
+	tt := []struct {
+		version     string
+		expectMajor int
+		expectMinor int
+		expectError error
+	}{
+		{
+			version:     "3.1.0",
+			expectMajor: 3,
+			expectMinor: 1,
+		},
+		{
+			version:     "3.2.0-1.el7",
+			expectMajor: 3,
+			expectMinor: 2,
+		},
+		{
+			version:     "3.5-rc1",
+			expectMajor: 3,
+			expectMinor: 5,
+		},
+		{
+			version:     "unknown",
+			expectError: fmt.Errorf(`unexpected version "unknown"`),
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.version, func(t *testing.T) {
+			major, minor, err := parseVersion(tc.version)
+			require.Equal(t, tc.expectError, err)
+			require.Equal(t, tc.expectMajor, major)
+			require.Equal(t, tc.expectMinor, minor)
+		})
+	}
+}
+
+func TestCheckDirWritable(t *testing.T) {
+	dir, err := ioutil.TempDir("", "check-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "file")
+	require.NoError(t, ioutil.WriteFile(file, nil, 0644))
+
+	tt := []struct {
+		name         string
+		dir          string
+		expectStatus checkStatus
+		expectDetail string
+	}{
+		{
+			name:         "existing",
+			dir:          dir,
+			expectStatus: checkOK,
+			expectDetail: dir + " is writable",
+		},
+		{
+			name:         "not existing",
+			dir:          filepath.Join(dir, "run", "sycri"),
+			expectStatus: checkOK,
+			expectDetail: filepath.Join(dir, "run", "sycri") + " will be created",
+		},
+		{
+			name:         "file",
+			dir:          file,
+			expectStatus: checkFail,
+			expectDetail: file + " is not a directory",
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			status, detail := checkDirWritable(tc.dir)
+			require.Equal(t, tc.expectStatus, status)
+			require.Equal(t, tc.expectDetail, detail)
+		})
+	}
+}
@@ -15,11 +15,27 @@
 package main
 
 import (
+	"encoding/json"
+	"flag"
 	"fmt"
+	"io/ioutil"
+	"math"
 	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+	"unicode"
 
 	"github.com/golang/glog"
+	"github.com/sylabs/singularity-cri/pkg/kube"
+	"github.com/sylabs/singularity-cri/pkg/singularity"
+	sRuntime "github.com/sylabs/singularity-cri/pkg/singularity/runtime"
+	"github.com/sylabs/singularity/pkg/util/capabilities"
 	"gopkg.in/yaml.v2"
+	"k8s.io/apimachinery/pkg/api/resource"
 )
 
 // Config hold all possible parameters that are used to
@@ -27,31 +43,441 @@ import (
 type Config struct {
 	// ListenSocket is a unix socket to serve CRI requests on.
 	ListenSocket string `yaml:"listenSocket"`
+	// ImageListenSocket is an optional unix socket to serve CRI ImageService on.
+	// When set, ListenSocket serves RuntimeService only, so that kubelet's
+	// --image-service-endpoint should point to ImageListenSocket.
+	ImageListenSocket string `yaml:"imageListenSocket"`
+	// SocketMode is an optional octal mode of CRI unix sockets, e.g. 0660.
+	SocketMode string `yaml:"socketMode"`
+	// SocketOwner is an optional owner of CRI unix sockets, name or ID.
+	SocketOwner string `yaml:"socketOwner"`
+	// SocketGroup is an optional group of CRI unix sockets, name or ID.
+	SocketGroup string `yaml:"socketGroup"`
+	// ListenAddress is an optional TCP address to serve CRI requests on.
+	// Requests are served over mutual TLS only, so TLSCertFile, TLSKeyFile
+	// and TLSClientCAFile should be set as well.
+	ListenAddress string `yaml:"listenAddress"`
+	// TLSCertFile is a server certificate file used for ListenAddress.
+	TLSCertFile string `yaml:"tlsCertFile"`
+	// TLSKeyFile is a server private key file used for ListenAddress.
+	TLSKeyFile string `yaml:"tlsKeyFile"`
+	// TLSClientCAFile is a CA certificate file that is used
+	// to verify client certificates on ListenAddress.
+	TLSClientCAFile string `yaml:"tlsClientCAFile"`
+	// Singularity is Singularity installation used to run containers and pull
+	// images. When not set, singularity binary is looked up in PATH.
+	Singularity Singularity `yaml:"singularity"`
 	// StorageDir is a directory to store all pulled images in.
 	StorageDir string `yaml:"storageDir"`
+	// ScratchDir is a directory temporary files of image pulls are created in.
+	// When empty, tmp directory inside StorageDir is used.
+	ScratchDir string `yaml:"scratchDir"`
+	// LayerCache is a node-local cache of OCI blobs that builds of images
+	// pulled from docker registries reuse. When its dir is empty, images
+	// are built from scratch.
+	LayerCache LayerCache `yaml:"layerCache"`
+	// LibraryCacheTTL is how long library image metadata is cached
+	// for. When zero, defaultLibraryCacheTTL is used. Negative value,
+	// e.g. -1s, disables caching.
+	LibraryCacheTTL time.Duration `yaml:"libraryCacheTTL"`
+	// DefinitionDirs are directories Singularity definition files images
+	// are built from on the node are allowed to be located in. When empty,
+	// images cannot be built from definition files.
+	DefinitionDirs []string `yaml:"definitionDirs"`
 	// StreamingURL is an address to serve streaming requests on (exec, attach, portforward).
 	StreamingURL string `yaml:"streamingURL"`
 	// CNIBinDir is a directory to look for CNI plugin binaries.
 	CNIBinDir string `yaml:"cniBinDir"`
 	// CNIConfDir is a directory to look for CNI network configuration files.
 	CNIConfDir string `yaml:"cniConfDir"`
+	// HostNetDevices is a node-local pool of host network devices (e.g. SR-IOV VFs)
+	// that may be moved into pod's network namespace on pod's request.
+	HostNetDevices []string `yaml:"hostNetDevices"`
+	// DefaultCapabilities is a set of capabilities every container starts
+	// with before capabilities from its security context are added and dropped.
+	// When not set, default capabilities of OCI runtime spec generator are used.
+	DefaultCapabilities []string `yaml:"defaultCapabilities"`
+	// SeccompProfileRoot is a directory relative localhost seccomp profiles
+	// are loaded from. When empty, kubelet's default directory is used.
+	SeccompProfileRoot string `yaml:"seccompProfileRoot"`
+	// DefaultSeccompProfile is a path to seccomp profile file in JSON format
+	// that is used instead of the built-in runtime default profile and for
+	// pods and containers that don't set any profile.
+	DefaultSeccompProfile string `yaml:"defaultSeccompProfile"`
+	// AppArmorProfileDir is a directory to load requested AppArmor profiles
+	// from when they are not loaded yet. Profile file should be named after profile.
+	AppArmorProfileDir string `yaml:"appArmorProfileDir"`
+	// ShmSize is a default size of /dev/shm of containers written as
+	// Kubernetes quantity, e.g. 1Gi. When empty, 64Mi is used.
+	ShmSize string `yaml:"shmSize"`
+	// SIFVolumes is a list of SIF images from image store that are mounted into
+	// all containers as read-only volumes, each one is written as image=path pair.
+	SIFVolumes []string `yaml:"sifVolumes"`
+	// Hooks are OCI lifecycle hooks that may be applied to containers.
+	Hooks []HookConfig `yaml:"hooks"`
+	// Rlimits are default resource limits of container processes,
+	// each one is written as name=soft[:hard], e.g. memlock=unlimited.
+	Rlimits []string `yaml:"rlimits"`
+	// AllowRealtime allows containers to request realtime
+	// scheduling parameters of their cgroups with annotations.
+	AllowRealtime bool `yaml:"allowRealtime"`
+	// NUMAAwareCpuset enables setting cpuset mems of containers with
+	// exclusive CPUs to NUMA nodes these CPUs belong to.
+	NUMAAwareCpuset bool `yaml:"numaAwareCpuset"`
+	// Timezone is a default timezone of containers, either host
+	// or zoneinfo name. When empty, containers use their own localtime.
+	Timezone string `yaml:"timezone"`
+	// BundleWorkers is a maximum number of container bundles that are
+	// created concurrently. When 0, number of bundles is not limited.
+	BundleWorkers int `yaml:"bundleWorkers"`
+	// StopSignal is a signal sent to containers on graceful stop
+	// when image doesn't specify one, SIGTERM by default.
+	StopSignal string `yaml:"stopSignal"`
+	// ForceEngineCLI makes containers started and signalled with
+	// Singularity CLI instead of talking to the OCI engine directly.
+	ForceEngineCLI bool `yaml:"forceEngineCLI"`
+	// RuntimeHandlers are runc compatible OCI runtimes that run pods
+	// with RuntimeClass handler of the same name instead of Singularity.
+	RuntimeHandlers []RuntimeHandler `yaml:"runtimeHandlers"`
+	// ExecSyncMaxOutput is a maximum size of each output stream returned by
+	// ExecSync written as Kubernetes quantity, 16Mi by default.
+	ExecSyncMaxOutput string `yaml:"execSyncMaxOutput"`
+	// ExecEnvDeny is a list of names or shell patterns of environment
+	// variables that are not passed to exec sessions, e.g. AWS_*.
+	ExecEnvDeny []string `yaml:"execEnvDeny"`
+	// ExecEnv is a list of KEY=VALUE environment variables that are
+	// added to exec sessions overriding the ones from image and container.
+	ExecEnv []string `yaml:"execEnv"`
+	// ProjectQuotaBaseID is the first project ID assigned to containers
+	// to account their fs usage with project quotas. When 0, usage
+	// is calculated by walking container directories.
+	ProjectQuotaBaseID int `yaml:"projectQuotaBaseID"`
+	// PauseSandbox makes pods run a minimal built-in pause process holding
+	// their namespaces instead of a Singularity OCI engine instance.
+	PauseSandbox bool `yaml:"pauseSandbox"`
+	// PodOverhead is a resource overhead of pod sandboxes that is added
+	// to aggregate limits of pod cgroups, see kube.PodOverhead.
+	PodOverhead PodOverheadConfig `yaml:"podOverhead"`
+	// AllowUnsafeSysctls is a list of node-level sysctls that pods are
+	// allowed to set, each one is either a name or a prefix ending with *.
+	AllowUnsafeSysctls []string `yaml:"allowUnsafeSysctls"`
+	// HostResolvConf is a path to the host's resolv.conf that is used when
+	// pod's DNS config is empty. When empty, only pod's DNS config is used.
+	HostResolvConf string `yaml:"hostResolvConf"`
+	// GPUReplicas is a number of times each GPU is advertised to kubelet so
+	// that multiple containers may share it. Values less than 2 disable sharing.
+	GPUReplicas int `yaml:"gpuReplicas"`
+	// GPURecoveryInterval is how often GPUs that reported critical errors
+	// are checked for reset. When zero, 1 minute is used.
+	GPURecoveryInterval time.Duration `yaml:"gpuRecoveryInterval"`
+	// SingularityConfDir is a Singularity config directory that is used to look for
+	// NVIDIA libraries list. When empty, it is detected automatically.
+	SingularityConfDir string `yaml:"singularityConfDir"`
+	// MetricsAddress is an optional TCP address to serve
+	// metrics in Prometheus format on, under /metrics path.
+	MetricsAddress string `yaml:"metricsAddress"`
+	// DebugAddress is an optional TCP address to serve profiling data
+	// (net/http/pprof), exported variables (expvar), exec sessions and runtime
+	// state on. It should never be exposed outside of the node.
+	DebugAddress string `yaml:"debugAddress"`
+	// AuditLog is an optional file to append records about mutating CRI
+	// requests to. When set to syslog, records are sent to system logger.
+	AuditLog string `yaml:"auditLog"`
+	// ConcurrencyLimits limits numbers of heavy CRI requests that are
+	// handled concurrently, requests above limits are queued.
+	ConcurrencyLimits ConcurrencyLimits `yaml:"concurrencyLimits"`
+	// RPCTimeouts are deadlines of long CRI requests
+	// that are used when client doesn't set one.
+	RPCTimeouts RPCTimeouts `yaml:"rpcTimeouts"`
+	// PanicAlert configures hooks that are triggered
+	// when CRI requests handling panics too often.
+	PanicAlert PanicAlert `yaml:"panicAlert"`
+	// ShutdownTimeout is how long in-flight CRI requests are waited for
+	// on shutdown before they are cancelled. When zero, 30 seconds is used.
+	ShutdownTimeout time.Duration `yaml:"shutdownTimeout"`
+	// ContainerLogDriver is a default driver that ships container logs,
+	// either file or journald. Container logs are always written to files,
+	// journald driver additionally sends them to systemd-journald.
+	ContainerLogDriver string `yaml:"containerLogDriver"`
+	// ContainerLogMaxSize is a size in megabytes after which container log
+	// is rotated. When zero, container logs are not rotated by sycri.
+	ContainerLogMaxSize int `yaml:"containerLogMaxSize"`
+	// ContainerLogMaxFiles is a number of log files, including the active
+	// one, that are kept for each container. When zero, 5 files are kept.
+	ContainerLogMaxFiles int `yaml:"containerLogMaxFiles"`
 	// BaseRunDir is a directory to store currently running pods and containers.
 	BaseRunDir string `yaml:"baseRunDir"`
 	// TrashDir is a directory where all container logs and configs will
 	// be stored upon removal. Useful for debugging.
 	TrashDir string `yaml:"trashDir"`
+	// Retention limits exited containers and trash directories
+	// that are kept, the rest are removed in background.
+	Retention Retention `yaml:"retention"`
 	// When Debug is true all CRI requests and responses will be logged. When false
 	// only requests with error responses will be logged.
 	Debug bool `yaml:"debug"`
+	// LogFormat is a format of CRI request logs, either text or json. JSON
+	// logs have rpc, pod_id, container_id and image fields when applicable.
+	LogFormat string `yaml:"logFormat"`
+	// LogLevel is a verbosity level of logs. Value of -v flag takes precedence.
+	LogLevel int `yaml:"logLevel"`
+	// LogDir is a directory to write log files to. Value of -log_dir flag takes
+	// precedence. When empty, system temporary directory is used.
+	LogDir string `yaml:"logDir"`
+	// LogMaxSize is a size in megabytes after which log file is rotated.
+	// When zero, glog default of 1800 megabytes is used.
+	LogMaxSize int `yaml:"logMaxSize"`
+	// LogMaxAge is how long rotated log files are kept. When zero,
+	// log files are not removed because of their age.
+	LogMaxAge time.Duration `yaml:"logMaxAge"`
+	// LogMaxTotalSize is a total size in megabytes of log files to keep,
+	// the oldest rotated files are removed first. When zero, total size
+	// is not limited.
+	LogMaxTotalSize int `yaml:"logMaxTotalSize"`
 }
 
+// PodOverheadConfig describes resource overhead of pod sandboxes.
+type PodOverheadConfig struct {
+	// CPU is written as Kubernetes quantity, e.g. 250m.
+	CPU string `yaml:"cpu"`
+	// Memory is written as Kubernetes quantity, e.g. 120Mi.
+	Memory string `yaml:"memory"`
+}
+
+// HookConfig describes OCI lifecycle hook, see kube.Hook.
+type HookConfig struct {
+	// Name identifies hook in sycri.sylabs.io/hooks annotation.
+	Name string `yaml:"name"`
+	// Stage is either prestart, poststart or poststop.
+	Stage string `yaml:"stage"`
+	// Path is an absolute path to hook binary on the host.
+	Path string `yaml:"path"`
+	// Args are hook arguments including argv[0].
+	Args []string `yaml:"args"`
+	// Env are hook environment variables in KEY=VALUE format.
+	Env []string `yaml:"env"`
+	// Timeout is a number of seconds after which hook is aborted.
+	Timeout int `yaml:"timeout"`
+	// Default hooks are applied to containers that don't select hooks explicitly.
+	Default bool `yaml:"default"`
+}
+
+// kubeHooks converts configured hooks into hooks applied to containers.
+func kubeHooks(hooks []HookConfig) []kube.Hook {
+	var kubeHooks []kube.Hook
+	for _, hook := range hooks {
+		kubeHook := kube.Hook{
+			Name:    hook.Name,
+			Stage:   hook.Stage,
+			Default: hook.Default,
+		}
+		kubeHook.Path = hook.Path
+		kubeHook.Args = hook.Args
+		kubeHook.Env = hook.Env
+		if hook.Timeout != 0 {
+			timeout := hook.Timeout
+			kubeHook.Timeout = &timeout
+		}
+		kubeHooks = append(kubeHooks, kubeHook)
+	}
+	return kubeHooks
+}
+
+// validHooks checks that hooks have unique names, known stages and absolute paths.
+func validHooks(hooks []HookConfig) error {
+	names := make(map[string]bool, len(hooks))
+	for _, hook := range hooks {
+		if hook.Name == "" {
+			return fmt.Errorf("hook name cannot be empty")
+		}
+		if hook.Name == kube.HooksNone {
+			return fmt.Errorf("hook name %q is reserved", kube.HooksNone)
+		}
+		if names[hook.Name] {
+			return fmt.Errorf("hook %s is defined more than once", hook.Name)
+		}
+		names[hook.Name] = true
+		switch hook.Stage {
+		case kube.HookPrestart, kube.HookPoststart, kube.HookPoststop:
+		default:
+			return fmt.Errorf("unknown stage %q of hook %s", hook.Stage, hook.Name)
+		}
+		if !filepath.IsAbs(hook.Path) {
+			return fmt.Errorf("path of hook %s should be absolute", hook.Name)
+		}
+		if hook.Timeout < 0 {
+			return fmt.Errorf("timeout of hook %s cannot be negative", hook.Name)
+		}
+	}
+	return nil
+}
+
+// RuntimeHandler describes runc compatible OCI runtime, e.g. runc or crun.
+type RuntimeHandler struct {
+	// Name is a RuntimeClass handler that selects runtime.
+	Name string `yaml:"name"`
+	// Path is an absolute path to runtime binary on the host.
+	Path string `yaml:"path"`
+}
+
+// runtimeHandlers returns configured runtime binaries by handler names.
+func runtimeHandlers(handlers []RuntimeHandler) map[string]string {
+	paths := make(map[string]string, len(handlers))
+	for _, handler := range handlers {
+		paths[handler.Name] = handler.Path
+	}
+	return paths
+}
+
+// validRuntimeHandlers checks that runtime handlers have unique
+// names that differ from Singularity one and absolute paths.
+func validRuntimeHandlers(handlers []RuntimeHandler) error {
+	names := map[string]bool{singularity.RuntimeName: true}
+	for _, handler := range handlers {
+		if handler.Name == "" {
+			return fmt.Errorf("runtime handler name cannot be empty")
+		}
+		if names[handler.Name] {
+			return fmt.Errorf("runtime handler %s is defined more than once", handler.Name)
+		}
+		names[handler.Name] = true
+		if !filepath.IsAbs(handler.Path) {
+			return fmt.Errorf("path of runtime handler %s should be absolute", handler.Name)
+		}
+	}
+	return nil
+}
+
+// ConcurrencyLimits holds maximum numbers of heavy CRI requests
+// that are handled concurrently. Zero means no limit.
+type ConcurrencyLimits struct {
+	// PullImage limits concurrent image pulls.
+	PullImage int `yaml:"pullImage"`
+	// CreateContainer limits concurrent container creations.
+	CreateContainer int `yaml:"createContainer"`
+	// ExecSync limits concurrent synchronous execs, e.g. exec probes.
+	ExecSync int `yaml:"execSync"`
+}
+
+// RPCTimeouts holds deadlines of long CRI requests. Zero means default.
+type RPCTimeouts struct {
+	// PullImage is a deadline of image pulls, 1 hour by default.
+	PullImage time.Duration `yaml:"pullImage"`
+	// CreateContainer is a deadline of container creations, 10 minutes by default.
+	CreateContainer time.Duration `yaml:"createContainer"`
+	// StopPodSandbox is a deadline of pod stops, 10 minutes by default.
+	StopPodSandbox time.Duration `yaml:"stopPodSandbox"`
+}
+
+// PanicAlert configures hooks that are triggered when number
+// of recovered panics within Window exceeds Threshold.
+type PanicAlert struct {
+	// Threshold is a number of panics that is tolerated within Window.
+	Threshold int `yaml:"threshold"`
+	// Window is a period panics are counted within, 1 minute by default.
+	Window time.Duration `yaml:"window"`
+	// Webhook is an optional URL alert is posted to in JSON format.
+	Webhook string `yaml:"webhook"`
+	// Exec is an optional shell command that is executed on alert.
+	Exec string `yaml:"exec"`
+}
+
+// LayerCache holds location and size limit of layer cache, see image.LayerCache.
+type LayerCache struct {
+	// Dir is a directory to cache OCI blobs in.
+	Dir string `yaml:"dir"`
+	// MaxSize is a size in megabytes after which least recently used
+	// blobs are pruned. When zero, cache grows without limits.
+	MaxSize int `yaml:"maxSize"`
+}
+
+// Singularity holds location and global flags of Singularity binary
+// as well as limits of Singularity commands. Zero limits mean default.
+type Singularity struct {
+	// Path is a path to Singularity binary.
+	Path string `yaml:"path"`
+	// Flags are global flags passed to every Singularity command.
+	Flags []string `yaml:"flags"`
+	// OCISubcommand is a subcommand that manages OCI containers, oci by default.
+	OCISubcommand string `yaml:"ociSubcommand"`
+	// Timeout is a maximum duration of a single command, 2 minutes by default.
+	Timeout time.Duration `yaml:"timeout"`
+	// Retries is a number of times state queries and signals
+	// are retried after they timed out, 1 by default. Value of -1
+	// disables retries.
+	Retries int `yaml:"retries"`
+}
+
+// Retention holds limits of exited containers and
+// container trash directories. Zero means no limit.
+type Retention struct {
+	// MaxExitedContainers is a number of exited containers that are kept.
+	MaxExitedContainers int `yaml:"maxExitedContainers"`
+	// ExitedContainerMaxAge is how long containers are kept after they exit.
+	ExitedContainerMaxAge time.Duration `yaml:"exitedContainerMaxAge"`
+	// MaxTrashDirs is a number of container trash directories that are kept.
+	MaxTrashDirs int `yaml:"maxTrashDirs"`
+	// TrashMaxAge is how long container trash directories are kept.
+	TrashMaxAge time.Duration `yaml:"trashMaxAge"`
+}
+
+// debugLogging is non-zero when Debug is set in currently applied config.
+var debugLogging int32
+
 var defaultConfig = Config{
 	ListenSocket: "/var/run/singularity.sock",
 	StorageDir:   "/var/lib/singularity",
 	BaseRunDir:   "/var/run/singularity",
 }
 
+// cmdlineFlags holds names of flags that were set on command line. Such flags
+// take precedence over both environment variables and config file.
+var cmdlineFlags map[string]bool
+
+// parsedFlags returns names of flags that were set on command line.
+// It should be called right after flag.Parse.
+func parsedFlags() map[string]bool {
+	set := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+	return set
+}
+
+// parseConfig reads config located at path and overrides its values with
+// environment variables, see applyEnv, and then with command line flags,
+// see applyFlags. When there is no config file, default config is used instead.
 func parseConfig(path string) (Config, error) {
+	config, err := readConfig(path)
+	if err != nil {
+		return Config{}, err
+	}
+	if err := applyEnv(&config); err != nil {
+		return Config{}, err
+	}
+	if err := applyFlags(&config, cmdlineFlags); err != nil {
+		return Config{}, err
+	}
+	return validConfig(config)
+}
+
+// applyFlags overrides config fields with values of corresponding flags
+// that were set on command line, i.e. LogLevel with -v and LogDir with -log_dir.
+func applyFlags(config *Config, set map[string]bool) error {
+	if set["v"] {
+		level, err := strconv.Atoi(flag.Lookup("v").Value.String())
+		if err != nil {
+			return fmt.Errorf("could not parse -v flag: %v", err)
+		}
+		config.LogLevel = level
+	}
+	if set["log_dir"] {
+		config.LogDir = flag.Lookup("log_dir").Value.String()
+	}
+	return nil
+}
+
+func readConfig(path string) (Config, error) {
 	var config Config
 
 	f, err := os.Open(path)
@@ -68,18 +494,313 @@ func parseConfig(path string) (Config, error) {
 	if err != nil {
 		return config, fmt.Errorf("could not decode config: %v", err)
 	}
-	return validConfig(config)
+	return config, nil
+}
+
+// applyEnv overrides config fields with values of corresponding environment
+// variables. Variable name is made of SYCRI_ prefix and field's yaml name in
+// upper snake case, e.g. SYCRI_LISTEN_SOCKET for listenSocket. Lists are
+// specified as comma-separated values, durations are specified in
+// time.ParseDuration format, e.g. 30s. Fields of nested sections are named
+// after the section, e.g. SYCRI_CONCURRENCY_LIMITS_PULL_IMAGE.
+func applyEnv(config *Config) error {
+	return applyEnvFields(reflect.ValueOf(config).Elem(), "")
+}
+
+func applyEnvFields(v reflect.Value, section string) error {
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		name := envName(field.Tag.Get("yaml"))
+		if section != "" {
+			name = section + strings.TrimPrefix(name, "SYCRI")
+		}
+		if v.Field(i).Kind() == reflect.Struct {
+			if err := applyEnvFields(v.Field(i), name); err != nil {
+				return err
+			}
+			continue
+		}
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			continue
+		}
+
+		glog.V(3).Infof("Overriding %s with %s", field.Name, name)
+		switch f := v.Field(i); f.Kind() {
+		case reflect.String:
+			f.SetString(value)
+		case reflect.Bool:
+			b, err := strconv.ParseBool(value)
+			if err != nil {
+				return fmt.Errorf("invalid %s value: %v", name, err)
+			}
+			f.SetBool(b)
+		case reflect.Int64:
+			if f.Type() != reflect.TypeOf(time.Duration(0)) {
+				return fmt.Errorf("%s cannot be set from environment", name)
+			}
+			d, err := time.ParseDuration(value)
+			if err != nil {
+				return fmt.Errorf("invalid %s value: %v", name, err)
+			}
+			f.SetInt(int64(d))
+		case reflect.Int:
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				return fmt.Errorf("invalid %s value: %v", name, err)
+			}
+			f.SetInt(int64(n))
+		case reflect.Slice:
+			if f.Type() != reflect.TypeOf([]string(nil)) {
+				return fmt.Errorf("%s cannot be set from environment", name)
+			}
+			var list []string
+			for _, item := range strings.Split(value, ",") {
+				if item = strings.TrimSpace(item); item != "" {
+					list = append(list, item)
+				}
+			}
+			f.Set(reflect.ValueOf(list))
+		default:
+			return fmt.Errorf("%s cannot be set from environment", name)
+		}
+	}
+	return nil
+}
+
+// envName returns environment variable name for a config field
+// with the passed yaml name, e.g. SYCRI_STREAMING_URL for streamingURL.
+func envName(yamlName string) string {
+	var name []rune
+	prev := ' '
+	for _, r := range yamlName {
+		if unicode.IsUpper(r) && unicode.IsLower(prev) {
+			name = append(name, '_')
+		}
+		name = append(name, unicode.ToUpper(r))
+		prev = r
+	}
+	return "SYCRI_" + string(name)
 }
 
 func validConfig(config Config) (Config, error) {
 	if config.ListenSocket == "" {
 		return Config{}, fmt.Errorf("socket to serve cannot be empty")
 	}
+	if config.ImageListenSocket == config.ListenSocket {
+		return Config{}, fmt.Errorf("image service socket should differ from runtime service socket")
+	}
+	if config.SocketMode != "" {
+		if _, err := parseSocketMode(config.SocketMode); err != nil {
+			return Config{}, err
+		}
+	}
+	if config.ListenAddress != "" &&
+		(config.TLSCertFile == "" || config.TLSKeyFile == "" || config.TLSClientCAFile == "") {
+		return Config{}, fmt.Errorf("TLS certificate, key and client CA are required to serve on TCP address")
+	}
+	if strings.TrimSpace(config.Singularity.Path) != config.Singularity.Path {
+		return Config{}, fmt.Errorf("invalid singularity path %q", config.Singularity.Path)
+	}
+	if sub := config.Singularity.OCISubcommand; sub != "" &&
+		(strings.HasPrefix(sub, "-") || strings.IndexFunc(sub, unicode.IsSpace) != -1) {
+		return Config{}, fmt.Errorf("invalid singularity OCI subcommand %q", sub)
+	}
+	if config.Singularity.Timeout < 0 {
+		return Config{}, fmt.Errorf("singularity command timeout cannot be negative")
+	}
+	if config.Singularity.Retries < -1 {
+		return Config{}, fmt.Errorf("singularity command retries should be -1 or more, got %d",
+			config.Singularity.Retries)
+	}
 	if config.StorageDir == "" {
 		return Config{}, fmt.Errorf("directory to pull images cannot be empty")
 	}
+	if config.LayerCache.MaxSize < 0 {
+		return Config{}, fmt.Errorf("layer cache max size cannot be negative")
+	}
+	for _, dir := range config.DefinitionDirs {
+		if !filepath.IsAbs(dir) {
+			return Config{}, fmt.Errorf("definition files directory %s should be absolute", dir)
+		}
+	}
 	if config.BaseRunDir == "" {
 		return Config{}, fmt.Errorf("directory to run containers cannot be empty")
 	}
+	if config.LogFormat != "" && config.LogFormat != logFormatText && config.LogFormat != logFormatJSON {
+		return Config{}, fmt.Errorf("unknown log format %q", config.LogFormat)
+	}
+	if config.LogLevel < 0 {
+		return Config{}, fmt.Errorf("log level cannot be negative")
+	}
+	if config.LogMaxSize < 0 || config.LogMaxAge < 0 || config.LogMaxTotalSize < 0 {
+		return Config{}, fmt.Errorf("log files limits cannot be negative")
+	}
+	if _, err := kube.NewLogDriver(config.ContainerLogDriver); err != nil {
+		return Config{}, err
+	}
+	if config.ContainerLogMaxSize < 0 {
+		return Config{}, fmt.Errorf("container log max size cannot be negative")
+	}
+	if config.ContainerLogMaxFiles < 0 || config.ContainerLogMaxFiles == 1 {
+		return Config{}, fmt.Errorf("at least 2 container log files should be kept")
+	}
+	if config.DefaultCapabilities != nil {
+		caps, unknown := capabilities.Normalize(config.DefaultCapabilities)
+		if len(unknown) != 0 {
+			return Config{}, fmt.Errorf("unknown default capabilities %v", unknown)
+		}
+		// keep empty set non-nil, so that containers start without capabilities
+		config.DefaultCapabilities = append([]string{}, caps...)
+	}
+	if config.DefaultSeccompProfile != "" {
+		data, err := ioutil.ReadFile(config.DefaultSeccompProfile)
+		if err != nil {
+			return Config{}, fmt.Errorf("could not read default seccomp profile: %v", err)
+		}
+		if !json.Valid(data) {
+			return Config{}, fmt.Errorf("default seccomp profile is not valid JSON")
+		}
+	}
+	if config.ShmSize != "" {
+		if _, err := kube.ParseShmSize(config.ShmSize); err != nil {
+			return Config{}, err
+		}
+	}
+	if _, _, err := kube.ParseSIFVolumes(strings.Join(config.SIFVolumes, ",")); err != nil {
+		return Config{}, err
+	}
+	if _, err := kube.ParseRlimits(strings.Join(config.Rlimits, ",")); err != nil {
+		return Config{}, err
+	}
+	if _, err := kube.TimezoneFile(config.Timezone); err != nil {
+		return Config{}, err
+	}
+	if err := validHooks(config.Hooks); err != nil {
+		return Config{}, err
+	}
+	if err := validRuntimeHandlers(config.RuntimeHandlers); err != nil {
+		return Config{}, err
+	}
+	if config.StopSignal != "" {
+		if _, err := kube.ParseStopSignal(config.StopSignal); err != nil {
+			return Config{}, err
+		}
+	}
+	if _, err := parseExecSyncMaxOutput(config.ExecSyncMaxOutput); err != nil {
+		return Config{}, err
+	}
+	if err := kube.ValidateExecEnv(config.ExecEnvDeny, config.ExecEnv); err != nil {
+		return Config{}, err
+	}
+	if _, err := kube.ParsePodOverhead(config.PodOverhead.CPU, config.PodOverhead.Memory); err != nil {
+		return Config{}, err
+	}
+	if err := kube.ValidateSysctlPatterns(config.AllowUnsafeSysctls); err != nil {
+		return Config{}, err
+	}
+	if config.ProjectQuotaBaseID < 0 || int64(config.ProjectQuotaBaseID) > math.MaxUint32 {
+		return Config{}, fmt.Errorf("project quota base ID should be in range [0, %d]", uint32(math.MaxUint32))
+	}
+	if config.BundleWorkers < 0 {
+		return Config{}, fmt.Errorf("number of bundle workers cannot be negative")
+	}
+	if config.GPUReplicas < 0 {
+		return Config{}, fmt.Errorf("number of GPU replicas cannot be negative")
+	}
+	if config.GPURecoveryInterval < 0 {
+		return Config{}, fmt.Errorf("GPU recovery interval cannot be negative")
+	}
+	limits := config.ConcurrencyLimits
+	if limits.PullImage < 0 || limits.CreateContainer < 0 || limits.ExecSync < 0 {
+		return Config{}, fmt.Errorf("concurrency limits cannot be negative")
+	}
+	timeouts := config.RPCTimeouts
+	if timeouts.PullImage < 0 || timeouts.CreateContainer < 0 || timeouts.StopPodSandbox < 0 {
+		return Config{}, fmt.Errorf("request timeouts cannot be negative")
+	}
+	if config.PanicAlert.Threshold < 0 || config.PanicAlert.Window < 0 {
+		return Config{}, fmt.Errorf("panic alert threshold and window cannot be negative")
+	}
+	if config.ShutdownTimeout < 0 {
+		return Config{}, fmt.Errorf("shutdown timeout cannot be negative")
+	}
+	retention := config.Retention
+	if retention.MaxExitedContainers < 0 || retention.ExitedContainerMaxAge < 0 ||
+		retention.MaxTrashDirs < 0 || retention.TrashMaxAge < 0 {
+		return Config{}, fmt.Errorf("retention limits cannot be negative")
+	}
 	return config, nil
 }
+
+// setupSingularity makes Singularity installation and command limits from
+// config used for all Singularity commands. They cannot be changed without restart.
+func setupSingularity(config Config) {
+	singularity.SetBinary(singularity.Binary{
+		Path:          config.Singularity.Path,
+		Flags:         config.Singularity.Flags,
+		OCISubcommand: config.Singularity.OCISubcommand,
+	})
+	sRuntime.SetCallPolicy(sRuntime.CallPolicy{
+		Timeout: config.Singularity.Timeout,
+		Retries: config.Singularity.Retries,
+	})
+}
+
+// applyConfig applies settings that can be changed without restart.
+func applyConfig(config Config) {
+	var debug int32
+	if config.Debug {
+		debug = 1
+	}
+	atomic.StoreInt32(&debugLogging, debug)
+
+	// level set with -v flag is already in config, see applyFlags
+	if err := flag.Set("v", strconv.Itoa(config.LogLevel)); err != nil {
+		glog.Errorf("Could not set log level: %v", err)
+	}
+	setSingularityLogLevel()
+}
+
+// isDebug reports whether all CRI requests and responses should be logged.
+func isDebug() bool {
+	return atomic.LoadInt32(&debugLogging) != 0
+}
+
+// reloadConfig parses config located at path and applies settings that
+// can be changed without restart. Changes of other settings are ignored
+// with a warning. Returned config is the one that is currently in effect.
+func reloadConfig(path string, current Config) (Config, error) {
+	config, err := parseConfig(path)
+	if err != nil {
+		return current, err
+	}
+
+	static := config
+	static.Debug = current.Debug
+	static.LogLevel = current.LogLevel
+	if !reflect.DeepEqual(static, current) {
+		glog.Warningf("Some of changed settings require restart to take effect")
+	}
+
+	current.Debug = config.Debug
+	current.LogLevel = config.LogLevel
+	applyConfig(current)
+	return current, nil
+}
+
+// parseExecSyncMaxOutput parses maximum ExecSync output size written as
+// Kubernetes quantity, e.g. 1Mi, into number of bytes. Empty size is parsed as 0.
+func parseExecSyncMaxOutput(size string) (int64, error) {
+	if size == "" {
+		return 0, nil
+	}
+	q, err := resource.ParseQuantity(size)
+	if err != nil {
+		return 0, fmt.Errorf("invalid exec sync max output %q: %v", size, err)
+	}
+	if q.Value() <= 0 {
+		return 0, fmt.Errorf("exec sync max output should be positive, got %q", size)
+	}
+	return q.Value(), nil
+}
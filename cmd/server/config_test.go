@@ -15,12 +15,15 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
+	sRuntime "github.com/sylabs/singularity-cri/pkg/singularity/runtime"
 )
 
 func TestParseConfig(t *testing.T) {
@@ -92,6 +95,13 @@ baseRunDir: /var/run/cri
 }
 
 func TestValidConfig(t *testing.T) {
+	invalidProfile, err := ioutil.TempFile("", "")
+	require.NoError(t, err, "could not create invalid profile file")
+	defer os.Remove(invalidProfile.Name())
+	_, err = invalidProfile.WriteString(`defaultAction: SCMP_ACT_ERRNO`)
+	require.NoError(t, err, "could not write invalid profile")
+	require.NoError(t, invalidProfile.Close(), "could not close invalid profile file")
+
 	tt := []struct {
 		name         string
 		input        Config
@@ -134,6 +144,345 @@ func TestValidConfig(t *testing.T) {
 			expectConfig: Config{},
 			expectError:  fmt.Errorf("directory to run containers cannot be empty"),
 		},
+		{
+			name: "TCP address without TLS",
+			input: Config{
+				ListenSocket:  "/var/run/sycri.sock",
+				ListenAddress: "0.0.0.0:9443",
+				TLSCertFile:   "/etc/sycri/server.crt",
+				TLSKeyFile:    "/etc/sycri/server.key",
+				StorageDir:    "/var/lib/singularity",
+				BaseRunDir:    "/var/run/cri",
+			},
+			expectConfig: Config{},
+			expectError:  fmt.Errorf("TLS certificate, key and client CA are required to serve on TCP address"),
+		},
+		{
+			name: "negative GPU replicas",
+			input: Config{
+				ListenSocket: "/var/run/sycri.sock",
+				StorageDir:   "/var/lib/singularity",
+				BaseRunDir:   "/var/run/cri",
+				GPUReplicas:  -1,
+			},
+			expectConfig: Config{},
+			expectError:  fmt.Errorf("number of GPU replicas cannot be negative"),
+		},
+		{
+			name: "negative GPU recovery interval",
+			input: Config{
+				ListenSocket:        "/var/run/sycri.sock",
+				StorageDir:          "/var/lib/singularity",
+				BaseRunDir:          "/var/run/cri",
+				GPURecoveryInterval: -time.Minute,
+			},
+			expectConfig: Config{},
+			expectError:  fmt.Errorf("GPU recovery interval cannot be negative"),
+		},
+		{
+			name: "negative exec sync max output",
+			input: Config{
+				ListenSocket:      "/var/run/sycri.sock",
+				StorageDir:        "/var/lib/singularity",
+				BaseRunDir:        "/var/run/cri",
+				ExecSyncMaxOutput: "-1Mi",
+			},
+			expectConfig: Config{},
+			expectError:  fmt.Errorf(`exec sync max output should be positive, got "-1Mi"`),
+		},
+		{
+			name: "negative pod overhead",
+			input: Config{
+				ListenSocket: "/var/run/sycri.sock",
+				StorageDir:   "/var/lib/singularity",
+				BaseRunDir:   "/var/run/cri",
+				PodOverhead: PodOverheadConfig{
+					CPU: "-100m",
+				},
+			},
+			expectConfig: Config{},
+			expectError:  fmt.Errorf(`cpu overhead should not be negative, got "-100m"`),
+		},
+		{
+			name: "same image socket",
+			input: Config{
+				ListenSocket:      "/var/run/sycri.sock",
+				ImageListenSocket: "/var/run/sycri.sock",
+				StorageDir:        "/var/lib/singularity",
+				BaseRunDir:        "/var/run/cri",
+			},
+			expectConfig: Config{},
+			expectError:  fmt.Errorf("image service socket should differ from runtime service socket"),
+		},
+		{
+			name: "invalid socket mode",
+			input: Config{
+				ListenSocket: "/var/run/sycri.sock",
+				SocketMode:   "rw-rw----",
+				StorageDir:   "/var/lib/singularity",
+				BaseRunDir:   "/var/run/cri",
+			},
+			expectConfig: Config{},
+			expectError:  fmt.Errorf(`invalid socket mode "rw-rw----"`),
+		},
+		{
+			name: "negative log max age",
+			input: Config{
+				ListenSocket: "/var/run/sycri.sock",
+				StorageDir:   "/var/lib/singularity",
+				BaseRunDir:   "/var/run/cri",
+				LogMaxAge:    -time.Hour,
+			},
+			expectConfig: Config{},
+			expectError:  fmt.Errorf("log files limits cannot be negative"),
+		},
+		{
+			name: "negative concurrency limit",
+			input: Config{
+				ListenSocket: "/var/run/sycri.sock",
+				StorageDir:   "/var/lib/singularity",
+				BaseRunDir:   "/var/run/cri",
+				ConcurrencyLimits: ConcurrencyLimits{
+					PullImage: -1,
+				},
+			},
+			expectConfig: Config{},
+			expectError:  fmt.Errorf("concurrency limits cannot be negative"),
+		},
+		{
+			name: "unknown default capability",
+			input: Config{
+				ListenSocket:        "/var/run/sycri.sock",
+				StorageDir:          "/var/lib/singularity",
+				BaseRunDir:          "/var/run/cri",
+				DefaultCapabilities: []string{"chown", "CAP_FLY"},
+			},
+			expectConfig: Config{},
+			expectError:  fmt.Errorf("unknown default capabilities [CAP_FLY]"),
+		},
+		{
+			name: "normalized default capabilities",
+			input: Config{
+				ListenSocket:        "/var/run/sycri.sock",
+				StorageDir:          "/var/lib/singularity",
+				BaseRunDir:          "/var/run/cri",
+				DefaultCapabilities: []string{"chown", "CAP_KILL"},
+			},
+			expectConfig: Config{
+				ListenSocket:        "/var/run/sycri.sock",
+				StorageDir:          "/var/lib/singularity",
+				BaseRunDir:          "/var/run/cri",
+				DefaultCapabilities: []string{"CAP_CHOWN", "CAP_KILL"},
+			},
+		},
+		{
+			name: "empty default capabilities",
+			input: Config{
+				ListenSocket:        "/var/run/sycri.sock",
+				StorageDir:          "/var/lib/singularity",
+				BaseRunDir:          "/var/run/cri",
+				DefaultCapabilities: []string{},
+			},
+			expectConfig: Config{
+				ListenSocket:        "/var/run/sycri.sock",
+				StorageDir:          "/var/lib/singularity",
+				BaseRunDir:          "/var/run/cri",
+				DefaultCapabilities: []string{},
+			},
+		},
+		{
+			name: "missing default seccomp profile",
+			input: Config{
+				ListenSocket:          "/var/run/sycri.sock",
+				StorageDir:            "/var/lib/singularity",
+				BaseRunDir:            "/var/run/cri",
+				DefaultSeccompProfile: "/foo/bar/seccomp.json",
+			},
+			expectConfig: Config{},
+			expectError:  fmt.Errorf("could not read default seccomp profile: open /foo/bar/seccomp.json: no such file or directory"),
+		},
+		{
+			name: "invalid default seccomp profile",
+			input: Config{
+				ListenSocket:          "/var/run/sycri.sock",
+				StorageDir:            "/var/lib/singularity",
+				BaseRunDir:            "/var/run/cri",
+				DefaultSeccompProfile: invalidProfile.Name(),
+			},
+			expectConfig: Config{},
+			expectError:  fmt.Errorf("default seccomp profile is not valid JSON"),
+		},
+		{
+			name: "duplicate hook",
+			input: Config{
+				ListenSocket: "/var/run/sycri.sock",
+				StorageDir:   "/var/lib/singularity",
+				BaseRunDir:   "/var/run/cri",
+				Hooks: []HookConfig{
+					{Name: "gpu-setup", Stage: "prestart", Path: "/usr/libexec/gpu-setup"},
+					{Name: "gpu-setup", Stage: "poststop", Path: "/usr/libexec/gpu-cleanup"},
+				},
+			},
+			expectConfig: Config{},
+			expectError:  fmt.Errorf("hook gpu-setup is defined more than once"),
+		},
+		{
+			name: "reserved hook name",
+			input: Config{
+				ListenSocket: "/var/run/sycri.sock",
+				StorageDir:   "/var/lib/singularity",
+				BaseRunDir:   "/var/run/cri",
+				Hooks: []HookConfig{
+					{Name: "none", Stage: "prestart", Path: "/usr/libexec/gpu-setup"},
+				},
+			},
+			expectConfig: Config{},
+			expectError:  fmt.Errorf(`hook name "none" is reserved`),
+		},
+		{
+			name: "unknown hook stage",
+			input: Config{
+				ListenSocket: "/var/run/sycri.sock",
+				StorageDir:   "/var/lib/singularity",
+				BaseRunDir:   "/var/run/cri",
+				Hooks: []HookConfig{
+					{Name: "gpu-setup", Stage: "createRuntime", Path: "/usr/libexec/gpu-setup"},
+				},
+			},
+			expectConfig: Config{},
+			expectError:  fmt.Errorf(`unknown stage "createRuntime" of hook gpu-setup`),
+		},
+		{
+			name: "relative hook path",
+			input: Config{
+				ListenSocket: "/var/run/sycri.sock",
+				StorageDir:   "/var/lib/singularity",
+				BaseRunDir:   "/var/run/cri",
+				Hooks: []HookConfig{
+					{Name: "gpu-setup", Stage: "prestart", Path: "gpu-setup"},
+				},
+			},
+			expectConfig: Config{},
+			expectError:  fmt.Errorf("path of hook gpu-setup should be absolute"),
+		},
+		{
+			name: "singularity runtime handler",
+			input: Config{
+				ListenSocket: "/var/run/sycri.sock",
+				StorageDir:   "/var/lib/singularity",
+				BaseRunDir:   "/var/run/cri",
+				RuntimeHandlers: []RuntimeHandler{
+					{Name: "singularity", Path: "/usr/bin/runc"},
+				},
+			},
+			expectConfig: Config{},
+			expectError:  fmt.Errorf("runtime handler singularity is defined more than once"),
+		},
+		{
+			name: "relative runtime handler path",
+			input: Config{
+				ListenSocket: "/var/run/sycri.sock",
+				StorageDir:   "/var/lib/singularity",
+				BaseRunDir:   "/var/run/cri",
+				RuntimeHandlers: []RuntimeHandler{
+					{Name: "crun", Path: "crun"},
+				},
+			},
+			expectConfig: Config{},
+			expectError:  fmt.Errorf("path of runtime handler crun should be absolute"),
+		},
+		{
+			name: "unknown log driver",
+			input: Config{
+				ListenSocket:       "/var/run/sycri.sock",
+				StorageDir:         "/var/lib/singularity",
+				BaseRunDir:         "/var/run/cri",
+				ContainerLogDriver: "fluentd",
+			},
+			expectConfig: Config{},
+			expectError:  fmt.Errorf(`unknown log driver "fluentd"`),
+		},
+		{
+			name: "negative shutdown timeout",
+			input: Config{
+				ListenSocket:    "/var/run/sycri.sock",
+				StorageDir:      "/var/lib/singularity",
+				BaseRunDir:      "/var/run/cri",
+				ShutdownTimeout: -time.Second,
+			},
+			expectConfig: Config{},
+			expectError:  fmt.Errorf("shutdown timeout cannot be negative"),
+		},
+		{
+			name: "disabled library cache",
+			input: Config{
+				ListenSocket:    "/var/run/sycri.sock",
+				StorageDir:      "/var/lib/singularity",
+				BaseRunDir:      "/var/run/cri",
+				LibraryCacheTTL: -time.Second,
+			},
+			expectConfig: Config{
+				ListenSocket:    "/var/run/sycri.sock",
+				StorageDir:      "/var/lib/singularity",
+				BaseRunDir:      "/var/run/cri",
+				LibraryCacheTTL: -time.Second,
+			},
+			expectError: nil,
+		},
+		{
+			name: "negative retention",
+			input: Config{
+				ListenSocket: "/var/run/sycri.sock",
+				StorageDir:   "/var/lib/singularity",
+				BaseRunDir:   "/var/run/cri",
+				Retention: Retention{
+					MaxExitedContainers: 10,
+					TrashMaxAge:         -time.Hour,
+				},
+			},
+			expectConfig: Config{},
+			expectError:  fmt.Errorf("retention limits cannot be negative"),
+		},
+		{
+			name: "invalid singularity OCI subcommand",
+			input: Config{
+				ListenSocket: "/var/run/sycri.sock",
+				StorageDir:   "/var/lib/singularity",
+				BaseRunDir:   "/var/run/cri",
+				Singularity: Singularity{
+					Path:          "/opt/singularity/bin/singularity",
+					OCISubcommand: "oci --debug",
+				},
+			},
+			expectConfig: Config{},
+			expectError:  fmt.Errorf("invalid singularity OCI subcommand %q", "oci --debug"),
+		},
+		{
+			name: "negative singularity timeout",
+			input: Config{
+				ListenSocket: "/var/run/sycri.sock",
+				StorageDir:   "/var/lib/singularity",
+				BaseRunDir:   "/var/run/cri",
+				Singularity: Singularity{
+					Timeout: -time.Second,
+				},
+			},
+			expectConfig: Config{},
+			expectError:  fmt.Errorf("singularity command timeout cannot be negative"),
+		},
+		{
+			name: "invalid singularity retries",
+			input: Config{
+				ListenSocket: "/var/run/sycri.sock",
+				StorageDir:   "/var/lib/singularity",
+				BaseRunDir:   "/var/run/cri",
+				Singularity: Singularity{
+					Retries: -2,
+				},
+			},
+			expectConfig: Config{},
+			expectError:  fmt.Errorf("singularity command retries should be -1 or more, got -2"),
+		},
 		{
 			name: "minimum valid",
 			input: Config{
@@ -179,3 +528,216 @@ func TestValidConfig(t *testing.T) {
 		})
 	}
 }
+
+func TestReloadConfig(t *testing.T) {
+	current := Config{
+		ListenSocket: "/var/run/sycri.sock",
+		StorageDir:   "/var/lib/singularity",
+		BaseRunDir:   "/var/run/cri",
+	}
+
+	tempConfig, err := ioutil.TempFile("", "")
+	require.NoError(t, err, "could not create temp file")
+	defer os.Remove(tempConfig.Name())
+	defer tempConfig.Close()
+
+	_, err = tempConfig.WriteString(`
+listenSocket: /home/user/singularity.sock
+storageDir: /var/lib/singularity
+baseRunDir: /var/run/cri
+debug: true
+`)
+	require.NoError(t, err, "could not write test YAML config")
+	require.NoError(t, tempConfig.Close(), "could not close test config file")
+
+	actual, err := reloadConfig(tempConfig.Name(), current)
+	require.NoError(t, err)
+	require.Equal(t, Config{
+		ListenSocket: "/var/run/sycri.sock",
+		StorageDir:   "/var/lib/singularity",
+		BaseRunDir:   "/var/run/cri",
+		Debug:        true,
+	}, actual)
+	require.True(t, isDebug())
+
+	applyConfig(current)
+	require.False(t, isDebug())
+}
+
+func TestApplyConfig_LogLevel(t *testing.T) {
+	defer flag.Set("v", flag.Lookup("v").Value.String())
+	defer os.Unsetenv(sRuntime.LogLevelEnv)
+
+	// level from file is applied and lowered on reload
+	applyConfig(Config{LogLevel: 6})
+	require.Equal(t, "6", flag.Lookup("v").Value.String())
+	require.Equal(t, sRuntime.LogLevelDebug, os.Getenv(sRuntime.LogLevelEnv))
+
+	applyConfig(Config{LogLevel: 2})
+	require.Equal(t, "2", flag.Lookup("v").Value.String())
+	_, ok := os.LookupEnv(sRuntime.LogLevelEnv)
+	require.False(t, ok, "Singularity debug logs are not disabled")
+
+	// level set with -v flag is kept
+	require.NoError(t, flag.Set("v", "3"))
+	config := Config{LogLevel: 6}
+	require.NoError(t, applyFlags(&config, map[string]bool{"v": true}))
+	applyConfig(config)
+	require.Equal(t, "3", flag.Lookup("v").Value.String())
+	_, ok = os.LookupEnv(sRuntime.LogLevelEnv)
+	require.False(t, ok, "Singularity debug logs are enabled")
+}
+
+func TestParseConfig_Precedence(t *testing.T) {
+	tempConfig, err := ioutil.TempFile("", "")
+	require.NoError(t, err, "could not create temp file")
+	defer os.Remove(tempConfig.Name())
+	_, err = tempConfig.WriteString(`
+listenSocket: /var/run/sycri.sock
+storageDir: /var/lib/singularity
+baseRunDir: /var/run/cri
+logLevel: 1
+logDir: /var/log/file
+`)
+	require.NoError(t, err, "could not write test YAML config")
+	require.NoError(t, tempConfig.Close(), "could not close test config file")
+
+	defer func(flags map[string]bool) {
+		cmdlineFlags = flags
+	}(cmdlineFlags)
+	defer flag.Set("v", flag.Lookup("v").Value.String())
+	defer flag.Set("log_dir", flag.Lookup("log_dir").Value.String())
+
+	tt := []struct {
+		name           string
+		env            map[string]string
+		flags          map[string]string
+		expectLogLevel int
+		expectLogDir   string
+	}{
+		{
+			name:           "file",
+			expectLogLevel: 1,
+			expectLogDir:   "/var/log/file",
+		},
+		{
+			name: "env over file",
+			env: map[string]string{
+				"SYCRI_LOG_LEVEL": "2",
+				"SYCRI_LOG_DIR":   "/var/log/env",
+			},
+			expectLogLevel: 2,
+			expectLogDir:   "/var/log/env",
+		},
+		{
+			name: "flag over env",
+			env: map[string]string{
+				"SYCRI_LOG_LEVEL": "2",
+				"SYCRI_LOG_DIR":   "/var/log/env",
+			},
+			flags: map[string]string{
+				"v":       "3",
+				"log_dir": "/var/log/flag",
+			},
+			expectLogLevel: 3,
+			expectLogDir:   "/var/log/flag",
+		},
+		{
+			name: "flag over file",
+			flags: map[string]string{
+				"v": "3",
+			},
+			expectLogLevel: 3,
+			expectLogDir:   "/var/log/file",
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			for k, v := range tc.env {
+				require.NoError(t, os.Setenv(k, v))
+				defer os.Unsetenv(k)
+			}
+			cmdlineFlags = make(map[string]bool)
+			for k, v := range tc.flags {
+				require.NoError(t, flag.Set(k, v))
+				cmdlineFlags[k] = true
+			}
+
+			config, err := parseConfig(tempConfig.Name())
+			require.NoError(t, err)
+			require.Equal(t, tc.expectLogLevel, config.LogLevel)
+			require.Equal(t, tc.expectLogDir, config.LogDir)
+		})
+	}
+}
+
+func TestApplyEnv(t *testing.T) {
+	tt := []struct {
+		name         string
+		env          map[string]string
+		expectConfig Config
+		expectError  error
+	}{
+		{
+			name: "all types",
+			env: map[string]string{
+				"SYCRI_LISTEN_SOCKET":    "/var/run/env.sock",
+				"SYCRI_STREAMING_URL":    "127.0.0.1:8080",
+				"SYCRI_HOST_NET_DEVICES": "ib0, ib1,",
+				"SYCRI_GPU_REPLICAS":     "4",
+				"SYCRI_DEBUG":            "true",
+				"SYCRI_SHUTDOWN_TIMEOUT": "1m30s",
+			},
+			expectConfig: Config{
+				ListenSocket:    "/var/run/env.sock",
+				StorageDir:      "/var/lib/singularity",
+				StreamingURL:    "127.0.0.1:8080",
+				HostNetDevices:  []string{"ib0", "ib1"},
+				GPUReplicas:     4,
+				ShutdownTimeout: 90 * time.Second,
+				Debug:           true,
+			},
+		},
+		{
+			name: "invalid bool",
+			env: map[string]string{
+				"SYCRI_DEBUG": "yes please",
+			},
+			expectError: fmt.Errorf(`invalid SYCRI_DEBUG value: strconv.ParseBool: parsing "yes please": invalid syntax`),
+		},
+		{
+			name: "invalid int",
+			env: map[string]string{
+				"SYCRI_GPU_REPLICAS": "many",
+			},
+			expectError: fmt.Errorf(`invalid SYCRI_GPU_REPLICAS value: strconv.Atoi: parsing "many": invalid syntax`),
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			for k, v := range tc.env {
+				require.NoError(t, os.Setenv(k, v))
+				defer os.Unsetenv(k)
+			}
+
+			config := Config{
+				ListenSocket: "/var/run/sycri.sock",
+				StorageDir:   "/var/lib/singularity",
+			}
+			err := applyEnv(&config)
+			require.Equal(t, tc.expectError, err)
+			if err == nil {
+				require.Equal(t, tc.expectConfig, config)
+			}
+		})
+	}
+}
+
+func TestEnvName(t *testing.T) {
+	require.Equal(t, "SYCRI_LISTEN_SOCKET", envName("listenSocket"))
+	require.Equal(t, "SYCRI_STREAMING_URL", envName("streamingURL"))
+	require.Equal(t, "SYCRI_CNI_BIN_DIR", envName("cniBinDir"))
+	require.Equal(t, "SYCRI_DEBUG", envName("debug"))
+}
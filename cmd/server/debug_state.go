@@ -0,0 +1,73 @@
+// Copyright (c) 2018-2019 Sylabs, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/golang/glog"
+	"github.com/sylabs/singularity-cri/pkg/server/image"
+	"github.com/sylabs/singularity-cri/pkg/server/runtime"
+)
+
+// stateDumper takes snapshots of runtime internal state.
+type stateDumper interface {
+	DebugState() runtime.DebugState
+}
+
+// debugStateHandler returns handler that serves snapshot of images, pods,
+// containers, their network attachments and exec sessions in JSON on GET request.
+func debugStateHandler(d stateDumper) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", "GET")
+			http.Error(w, "method is not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(d.DebugState()); err != nil {
+			glog.Errorf("Could not write runtime state: %v", err)
+		}
+	})
+}
+
+// storageChecker reconciles image registry with storage directory.
+type storageChecker interface {
+	Fsck() (*image.FsckReport, error)
+}
+
+// fsckHandler returns handler that checks image storage consistency
+// on POST request and responds with report in JSON.
+func fsckHandler(c storageChecker) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", "POST")
+			http.Error(w, "method is not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		report, err := c.Fsck()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(report); err != nil {
+			glog.Errorf("Could not write storage check report: %v", err)
+		}
+	})
+}
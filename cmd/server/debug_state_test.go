@@ -0,0 +1,126 @@
+// Copyright (c) 2018-2019 Sylabs, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/sylabs/singularity-cri/pkg/network"
+	"github.com/sylabs/singularity-cri/pkg/server/image"
+	"github.com/sylabs/singularity-cri/pkg/server/runtime"
+)
+
+type fakeStateDumper runtime.DebugState
+
+func (f fakeStateDumper) DebugState() runtime.DebugState {
+	return runtime.DebugState(f)
+}
+
+func TestDebugStateHandler(t *testing.T) {
+	state := runtime.DebugState{
+		Pods: []runtime.PodDebugState{
+			{
+				ID:         "pod1",
+				Name:       "nginx",
+				Namespace:  "default",
+				State:      "SANDBOX_READY",
+				Containers: []string{"cont1"},
+				Network: &network.Attachment{
+					Network: "bridge",
+					NsPath:  "/proc/42/ns/net",
+					IP:      "10.22.0.5",
+				},
+			},
+		},
+		Containers: []runtime.ContainerDebugState{
+			{
+				ID:    "cont1",
+				PodID: "pod1",
+				Name:  "nginx",
+				State: "CONTAINER_RUNNING",
+			},
+		},
+	}
+	handler := debugStateHandler(fakeStateDumper(state))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/state", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+	var actual runtime.DebugState
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &actual))
+	require.Equal(t, state, actual)
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/debug/state", nil))
+	require.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+	require.Equal(t, "GET", rec.Header().Get("Allow"))
+}
+
+type fakeStorageChecker struct {
+	report *image.FsckReport
+	err    error
+}
+
+func (f fakeStorageChecker) Fsck() (*image.FsckReport, error) {
+	return f.report, f.err
+}
+
+func TestFsckHandler(t *testing.T) {
+	tt := []struct {
+		name         string
+		method       string
+		checker      fakeStorageChecker
+		expectStatus int
+		expectBody   string
+	}{
+		{
+			name:   "check",
+			method: http.MethodPost,
+			checker: fakeStorageChecker{
+				report: &image.FsckReport{Missing: []string{"busybox"}},
+			},
+			expectStatus: http.StatusOK,
+			expectBody:   `{"missing":["busybox"],"reindexed":null,"orphans":null}`,
+		},
+		{
+			name:         "check failed",
+			method:       http.MethodPost,
+			checker:      fakeStorageChecker{err: fmt.Errorf("permission denied")},
+			expectStatus: http.StatusInternalServerError,
+		},
+		{
+			name:         "wrong method",
+			method:       http.MethodGet,
+			expectStatus: http.StatusMethodNotAllowed,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			fsckHandler(tc.checker).ServeHTTP(rec, httptest.NewRequest(tc.method, "/debug/fsck", nil))
+			require.Equal(t, tc.expectStatus, rec.Code)
+			if tc.expectBody != "" {
+				require.JSONEq(t, tc.expectBody, rec.Body.String())
+			}
+		})
+	}
+}
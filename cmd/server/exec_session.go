@@ -0,0 +1,60 @@
+// Copyright (c) 2018-2019 Sylabs, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/golang/glog"
+	"github.com/sylabs/singularity-cri/pkg/kube"
+)
+
+// execSessionManager lists and kills exec sessions running in containers.
+type execSessionManager interface {
+	ExecSessions() map[string][]kube.ExecSession
+	KillExecSession(containerID, sessionID string) error
+}
+
+// execSessionsHandler returns handler that lists running exec sessions grouped
+// by container ID on GET request and kills exec session on DELETE request
+// with container and session query parameters, e.g.
+// DELETE /debug/exec-sessions?container=<id>&session=<id>.
+func execSessionsHandler(m execSessionManager) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			w.Header().Set("Content-Type", "application/json")
+			if err := json.NewEncoder(w).Encode(m.ExecSessions()); err != nil {
+				glog.Errorf("Could not write exec sessions: %v", err)
+			}
+		case http.MethodDelete:
+			containerID := r.URL.Query().Get("container")
+			sessionID := r.URL.Query().Get("session")
+			if containerID == "" || sessionID == "" {
+				http.Error(w, "container and session are required", http.StatusBadRequest)
+				return
+			}
+			if err := m.KillExecSession(containerID, sessionID); err != nil {
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.Header().Set("Allow", "GET, DELETE")
+			http.Error(w, "method is not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+}
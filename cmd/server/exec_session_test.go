@@ -0,0 +1,109 @@
+// Copyright (c) 2018-2019 Sylabs, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/sylabs/singularity-cri/pkg/kube"
+)
+
+type fakeExecSessions map[string][]kube.ExecSession
+
+func (f fakeExecSessions) ExecSessions() map[string][]kube.ExecSession {
+	return f
+}
+
+func (f fakeExecSessions) KillExecSession(containerID, sessionID string) error {
+	for i, session := range f[containerID] {
+		if session.ID == sessionID {
+			f[containerID] = append(f[containerID][:i], f[containerID][i+1:]...)
+			return nil
+		}
+	}
+	return kube.ErrExecSessionNotFound
+}
+
+func TestExecSessionsHandler(t *testing.T) {
+	sessions := fakeExecSessions{
+		"cont1": {
+			{
+				ID:        "sess1",
+				Command:   []string{"sh"},
+				User:      "0:0",
+				TTY:       true,
+				StartedAt: time.Date(2019, 9, 20, 10, 10, 10, 0, time.UTC),
+			},
+		},
+	}
+	handler := execSessionsHandler(sessions)
+
+	tt := []struct {
+		name         string
+		method       string
+		url          string
+		expectStatus int
+	}{
+		{
+			name:         "list",
+			method:       http.MethodGet,
+			url:          "/debug/exec-sessions",
+			expectStatus: http.StatusOK,
+		},
+		{
+			name:         "kill without session",
+			method:       http.MethodDelete,
+			url:          "/debug/exec-sessions?container=cont1",
+			expectStatus: http.StatusBadRequest,
+		},
+		{
+			name:         "kill unknown session",
+			method:       http.MethodDelete,
+			url:          "/debug/exec-sessions?container=cont1&session=sess2",
+			expectStatus: http.StatusNotFound,
+		},
+		{
+			name:         "kill",
+			method:       http.MethodDelete,
+			url:          "/debug/exec-sessions?container=cont1&session=sess1",
+			expectStatus: http.StatusNoContent,
+		},
+		{
+			name:         "not allowed",
+			method:       http.MethodPost,
+			url:          "/debug/exec-sessions",
+			expectStatus: http.StatusMethodNotAllowed,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, httptest.NewRequest(tc.method, tc.url, nil))
+			require.Equal(t, tc.expectStatus, w.Code)
+			if tc.method == http.MethodGet {
+				var listed map[string][]kube.ExecSession
+				require.NoError(t, json.NewDecoder(w.Body).Decode(&listed))
+				require.Equal(t, map[string][]kube.ExecSession(sessions), listed)
+			}
+		})
+	}
+	require.Empty(t, sessions["cont1"])
+}
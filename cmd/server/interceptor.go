@@ -0,0 +1,71 @@
+// Copyright (c) 2018-2019 Sylabs, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/sylabs/singularity-cri/pkg/metrics"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	rpcRequestsMetric = metrics.NewCounterVec("sycri_grpc_requests_total",
+		"Number of handled gRPC requests.", "method", "code")
+	rpcDurationMetric = metrics.NewHistogramVec("sycri_grpc_request_duration_seconds",
+		"Duration of gRPC requests handling.", metrics.DefaultBuckets, "method")
+	rpcPanicsMetric = metrics.NewCounterVec("sycri_grpc_panics_total",
+		"Number of panics recovered while handling gRPC requests.", "method")
+	rpcInternalErrorsMetric = metrics.NewCounterVec("sycri_grpc_internal_errors_total",
+		"Number of gRPC requests failed with Internal error.", "method")
+)
+
+func init() {
+	metrics.Register(
+		rpcRequestsMetric,
+		rpcDurationMetric,
+		rpcPanicsMetric,
+		rpcInternalErrorsMetric,
+	)
+}
+
+// chainUnaryInterceptors returns interceptor that calls passed interceptors in
+// order, so that the first one is the outermost. Vendored gRPC version doesn't
+// support multiple unary interceptors out of the box.
+func chainUnaryInterceptors(interceptors ...grpc.UnaryServerInterceptor) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{},
+		info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		chained := handler
+		for i := len(interceptors) - 1; i >= 0; i-- {
+			interceptor, next := interceptors[i], chained
+			chained = func(ctx context.Context, req interface{}) (interface{}, error) {
+				return interceptor(ctx, req, info, next)
+			}
+		}
+		return chained(ctx, req)
+	}
+}
+
+// observeRPC collects number and duration of handled requests per method.
+func observeRPC(ctx context.Context, req interface{},
+	info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	start := time.Now()
+	resp, err := handler(ctx, req)
+	rpcDurationMetric.Observe(time.Since(start).Seconds(), info.FullMethod)
+	rpcRequestsMetric.Inc(info.FullMethod, status.Code(err).String())
+	return resp, err
+}
@@ -0,0 +1,71 @@
+// Copyright (c) 2018-2019 Sylabs, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"path"
+
+	"github.com/sylabs/singularity-cri/pkg/metrics"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+var queuedRequestsMetric = metrics.NewGaugeVec("sycri_grpc_queued_requests",
+	"Number of gRPC requests waiting for concurrency limit.", "method")
+
+func init() {
+	metrics.Register(queuedRequestsMetric)
+}
+
+// limitConcurrency returns interceptor that queues requests to methods that
+// already have the configured number of requests in flight. Queued requests
+// fail once their context is done.
+func limitConcurrency(limits ConcurrencyLimits) grpc.UnaryServerInterceptor {
+	slots := make(map[string]chan struct{})
+	for method, limit := range map[string]int{
+		"PullImage":       limits.PullImage,
+		"CreateContainer": limits.CreateContainer,
+		"ExecSync":        limits.ExecSync,
+	} {
+		if limit > 0 {
+			slots[method] = make(chan struct{}, limit)
+		}
+	}
+
+	return func(ctx context.Context, req interface{},
+		info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		method := path.Base(info.FullMethod)
+		slot, ok := slots[method]
+		if !ok {
+			return handler(ctx, req)
+		}
+
+		select {
+		case slot <- struct{}{}:
+		default:
+			queuedRequestsMetric.Add(1, method)
+			select {
+			case slot <- struct{}{}:
+				queuedRequestsMetric.Add(-1, method)
+			case <-ctx.Done():
+				queuedRequestsMetric.Add(-1, method)
+				return nil, status.FromContextError(ctx.Err()).Err()
+			}
+		}
+		defer func() { <-slot }()
+		return handler(ctx, req)
+	}
+}
@@ -0,0 +1,68 @@
+// Copyright (c) 2018-2019 Sylabs, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestLimitConcurrency(t *testing.T) {
+	limit := limitConcurrency(ConcurrencyLimits{PullImage: 1})
+	pullInfo := &grpc.UnaryServerInfo{FullMethod: "/runtime.v1alpha2.ImageService/PullImage"}
+	listInfo := &grpc.UnaryServerInfo{FullMethod: "/runtime.v1alpha2.ImageService/ListImages"}
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	blocking := func(ctx context.Context, req interface{}) (interface{}, error) {
+		close(started)
+		<-release
+		return "pulled", nil
+	}
+	instant := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return "done", nil
+	}
+
+	firstDone := make(chan error)
+	go func() {
+		_, err := limit(context.Background(), nil, pullInfo, blocking)
+		firstDone <- err
+	}()
+	<-started
+
+	resp, err := limit(context.Background(), nil, listInfo, instant)
+	require.NoError(t, err)
+	require.Equal(t, "done", resp, "unlimited method should not be queued")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err = limit(ctx, nil, pullInfo, instant)
+	require.Equal(t, codes.DeadlineExceeded, status.Code(err), "request above limit should be queued")
+
+	secondDone := make(chan interface{})
+	go func() {
+		resp, _ := limit(context.Background(), nil, pullInfo, instant)
+		secondDone <- resp
+	}()
+	close(release)
+	require.NoError(t, <-firstDone)
+	require.Equal(t, "done", <-secondDone, "queued request should be handled once slot is free")
+}
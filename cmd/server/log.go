@@ -0,0 +1,94 @@
+// Copyright (c) 2018-2019 Sylabs, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"os"
+
+	"github.com/golang/glog"
+	"github.com/sirupsen/logrus"
+	k8s "k8s.io/kubernetes/pkg/kubelet/apis/cri/runtime/v1alpha2"
+)
+
+const (
+	logFormatText = "text"
+	logFormatJSON = "json"
+)
+
+// requestLogger logs handled gRPC request. It is called for failed requests
+// and, when debug is enabled, for all requests with full request and response.
+type requestLogger func(method string, req, resp interface{}, err error)
+
+// newRequestLogger returns requestLogger that writes logs in passed format.
+// Unknown format falls back to plain text glog output.
+func newRequestLogger(format string) requestLogger {
+	if format != logFormatJSON {
+		return glogRequest
+	}
+
+	logger := logrus.New()
+	logger.Out = os.Stderr
+	logger.Formatter = &logrus.JSONFormatter{}
+	return func(method string, req, resp interface{}, err error) {
+		entry := logger.WithFields(requestFields(method, req, resp, err))
+		if err != nil {
+			entry.Error("request failed")
+			return
+		}
+		entry.Info("request handled")
+	}
+}
+
+func glogRequest(method string, req, resp interface{}, err error) {
+	jsonReq, _ := json.Marshal(req)
+	jsonResp, _ := json.Marshal(resp)
+	logFunc := glog.Infof
+	if err != nil {
+		logFunc = glog.Errorf
+	}
+	logFunc("%s\n\tRequest: %s\n\tResponse: %s\n\tError: %v", method, jsonReq, jsonResp, err)
+}
+
+// requestFields returns structured log fields describing handled request.
+// Objects the request refers to are looked up in both request and response,
+// e.g. pod ID is known only after RunPodSandbox is handled.
+func requestFields(method string, req, resp interface{}, err error) logrus.Fields {
+	fields := logrus.Fields{
+		"rpc": method,
+	}
+	for _, obj := range []interface{}{req, resp} {
+		if r, ok := obj.(interface{ GetPodSandboxId() string }); ok && r.GetPodSandboxId() != "" {
+			fields["pod_id"] = r.GetPodSandboxId()
+		}
+		if r, ok := obj.(interface{ GetContainerId() string }); ok && r.GetContainerId() != "" {
+			fields["container_id"] = r.GetContainerId()
+		}
+		if r, ok := obj.(interface{ GetImage() *k8s.ImageSpec }); ok && r.GetImage().GetImage() != "" {
+			fields["image"] = r.GetImage().GetImage()
+		}
+	}
+	if r, ok := req.(*k8s.CreateContainerRequest); ok && r.GetConfig().GetImage().GetImage() != "" {
+		fields["image"] = r.GetConfig().GetImage().GetImage()
+	}
+	if err != nil {
+		fields["error"] = err.Error()
+	}
+	if isDebug() {
+		fields["request"] = req
+		fields["response"] = resp
+	}
+	return fields
+}
@@ -0,0 +1,81 @@
+// Copyright (c) 2018-2019 Sylabs, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+	k8s "k8s.io/kubernetes/pkg/kubelet/apis/cri/runtime/v1alpha2"
+)
+
+func TestRequestFields(t *testing.T) {
+	tt := []struct {
+		name         string
+		method       string
+		req          interface{}
+		resp         interface{}
+		err          error
+		expectFields logrus.Fields
+	}{
+		{
+			name:   "run pod",
+			method: "/runtime.v1alpha2.RuntimeService/RunPodSandbox",
+			req:    &k8s.RunPodSandboxRequest{},
+			resp:   &k8s.RunPodSandboxResponse{PodSandboxId: "pod1"},
+			expectFields: logrus.Fields{
+				"rpc":    "/runtime.v1alpha2.RuntimeService/RunPodSandbox",
+				"pod_id": "pod1",
+			},
+		},
+		{
+			name:   "create container",
+			method: "/runtime.v1alpha2.RuntimeService/CreateContainer",
+			req: &k8s.CreateContainerRequest{
+				PodSandboxId: "pod1",
+				Config: &k8s.ContainerConfig{
+					Image: &k8s.ImageSpec{Image: "busybox"},
+				},
+			},
+			err: fmt.Errorf("not enough space"),
+			expectFields: logrus.Fields{
+				"rpc":    "/runtime.v1alpha2.RuntimeService/CreateContainer",
+				"pod_id": "pod1",
+				"image":  "busybox",
+				"error":  "not enough space",
+			},
+		},
+		{
+			name:   "pull image",
+			method: "/runtime.v1alpha2.ImageService/PullImage",
+			req: &k8s.PullImageRequest{
+				Image: &k8s.ImageSpec{Image: "alpine"},
+			},
+			resp: &k8s.PullImageResponse{ImageRef: "sha256:1"},
+			expectFields: logrus.Fields{
+				"rpc":   "/runtime.v1alpha2.ImageService/PullImage",
+				"image": "alpine",
+			},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			require.Equal(t, tc.expectFields, requestFields(tc.method, tc.req, tc.resp, tc.err))
+		})
+	}
+}
@@ -0,0 +1,155 @@
+// Copyright (c) 2018-2019 Sylabs, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// logRetentionInterval is how often old log files are removed.
+const logRetentionInterval = 10 * time.Minute
+
+// setupLogFiles applies log files settings, it should be called before
+// anything is logged since glog creates log files on the first write.
+func setupLogFiles(config Config) error {
+	if config.LogDir != "" {
+		if err := os.MkdirAll(config.LogDir, 0755); err != nil {
+			return fmt.Errorf("could not create log directory: %v", err)
+		}
+		if err := flag.Set("log_dir", config.LogDir); err != nil {
+			return fmt.Errorf("could not set log directory: %v", err)
+		}
+	}
+	if config.LogMaxSize != 0 {
+		glog.MaxSize = uint64(config.LogMaxSize) * 1024 * 1024
+	}
+	return nil
+}
+
+// logRetention removes log files created by glog that are older than
+// maxAge or don't fit into maxTotalSize, oldest first. Files that are
+// currently written to are never removed.
+type logRetention struct {
+	dir          string
+	program      string
+	maxAge       time.Duration
+	maxTotalSize int64
+}
+
+func newLogRetention(config Config) logRetention {
+	dir := config.LogDir
+	if dir == "" {
+		dir = flag.Lookup("log_dir").Value.String()
+	}
+	if dir == "" {
+		dir = os.TempDir()
+	}
+	return logRetention{
+		dir:          dir,
+		program:      filepath.Base(os.Args[0]),
+		maxAge:       config.LogMaxAge,
+		maxTotalSize: int64(config.LogMaxTotalSize) * 1024 * 1024,
+	}
+}
+
+// start removes old log files periodically until ctx is done.
+func (r logRetention) start(ctx context.Context, wg *sync.WaitGroup) {
+	if r.maxAge == 0 && r.maxTotalSize == 0 {
+		return
+	}
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		ticker := time.NewTicker(logRetentionInterval)
+		defer ticker.Stop()
+		for {
+			if err := r.clean(time.Now()); err != nil {
+				glog.Errorf("Could not remove old log files: %v", err)
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+func (r logRetention) clean(now time.Time) error {
+	files, err := ioutil.ReadDir(r.dir)
+	if err != nil {
+		return fmt.Errorf("could not read log directory: %v", err)
+	}
+
+	// glog maintains symlinks named after program and severity,
+	// e.g. sycri.INFO, that point to files currently written to
+	inUse := make(map[string]bool)
+	var logs []os.FileInfo
+	for _, fi := range files {
+		if !strings.HasPrefix(fi.Name(), r.program+".") {
+			continue
+		}
+		if fi.Mode()&os.ModeSymlink != 0 {
+			target, err := os.Readlink(filepath.Join(r.dir, fi.Name()))
+			if err == nil {
+				inUse[filepath.Base(target)] = true
+			}
+			continue
+		}
+		if fi.Mode().IsRegular() {
+			logs = append(logs, fi)
+		}
+	}
+	sort.Slice(logs, func(i, j int) bool {
+		return logs[i].ModTime().After(logs[j].ModTime())
+	})
+
+	var total int64
+	for _, fi := range logs {
+		if inUse[fi.Name()] {
+			total += fi.Size()
+		}
+	}
+	full := false
+	for _, fi := range logs {
+		if inUse[fi.Name()] {
+			continue
+		}
+		expired := r.maxAge != 0 && now.Sub(fi.ModTime()) > r.maxAge
+		full = full || (r.maxTotalSize != 0 && total+fi.Size() > r.maxTotalSize)
+		if !expired && !full {
+			total += fi.Size()
+			continue
+		}
+		glog.V(4).Infof("Removing old log file %s", fi.Name())
+		if err := os.Remove(filepath.Join(r.dir, fi.Name())); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("could not remove %s: %v", fi.Name(), err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+// Copyright (c) 2018-2019 Sylabs, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLogRetention(t *testing.T) {
+	now := time.Now()
+
+	tt := []struct {
+		name         string
+		maxAge       time.Duration
+		maxTotalSize int64
+		expectFiles  []string
+	}{
+		{
+			name:   "max age",
+			maxAge: 3 * time.Hour,
+			expectFiles: []string{
+				"other.log",
+				"sycri.INFO",
+				"sycri.host.log.INFO.1",
+				"sycri.host.log.INFO.3",
+				"sycri.host.log.INFO.4",
+			},
+		},
+		{
+			name:         "max total size",
+			maxTotalSize: 25,
+			expectFiles: []string{
+				"other.log",
+				"sycri.INFO",
+				"sycri.host.log.INFO.1",
+				"sycri.host.log.INFO.4",
+			},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "logs-")
+			require.NoError(t, err)
+			defer os.RemoveAll(dir)
+
+			// files are 10 bytes each, file 1 is in use and is the oldest
+			for i, age := range []time.Duration{10, 5, 2, 1} {
+				name := filepath.Join(dir, "sycri.host.log.INFO."+strconv.Itoa(i+1))
+				require.NoError(t, ioutil.WriteFile(name, make([]byte, 10), 0644))
+				mtime := now.Add(-age * time.Hour)
+				require.NoError(t, os.Chtimes(name, mtime, mtime))
+			}
+			require.NoError(t, os.Symlink("sycri.host.log.INFO.1", filepath.Join(dir, "sycri.INFO")))
+			old := filepath.Join(dir, "other.log")
+			require.NoError(t, ioutil.WriteFile(old, make([]byte, 100), 0644))
+			require.NoError(t, os.Chtimes(old, now.Add(-24*time.Hour), now.Add(-24*time.Hour)))
+
+			r := logRetention{
+				dir:          dir,
+				program:      "sycri",
+				maxAge:       tc.maxAge,
+				maxTotalSize: tc.maxTotalSize,
+			}
+			require.NoError(t, r.clean(now))
+
+			files, err := ioutil.ReadDir(dir)
+			require.NoError(t, err)
+			var names []string
+			for _, fi := range files {
+				names = append(names, fi.Name())
+			}
+			sort.Strings(names)
+			require.Equal(t, tc.expectFiles, names)
+		})
+	}
+}
@@ -16,36 +16,56 @@ package main
 
 import (
 	"context"
-	"encoding/json"
+	"crypto/tls"
+	"crypto/x509"
+	"expvar"
 	"flag"
 	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/pprof"
 	"os"
 	"os/signal"
 	"path/filepath"
 	"strconv"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/golang/glog"
 	"github.com/sylabs/singularity-cri/pkg/fs"
+	sImage "github.com/sylabs/singularity-cri/pkg/image"
 	"github.com/sylabs/singularity-cri/pkg/index"
+	"github.com/sylabs/singularity-cri/pkg/kube"
+	"github.com/sylabs/singularity-cri/pkg/metrics"
 	"github.com/sylabs/singularity-cri/pkg/server/device"
 	"github.com/sylabs/singularity-cri/pkg/server/image"
 	"github.com/sylabs/singularity-cri/pkg/server/runtime"
 	sRuntime "github.com/sylabs/singularity-cri/pkg/singularity/runtime"
-	syunix "github.com/sylabs/singularity/pkg/util/unix"
 	useragent "github.com/sylabs/singularity/pkg/util/user-agent"
 	"golang.org/x/sys/unix"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/status"
 	"k8s.io/kubernetes/pkg/kubectl/util/logs"
 	k8s "k8s.io/kubernetes/pkg/kubelet/apis/cri/runtime/v1alpha2"
 	k8sDP "k8s.io/kubernetes/pkg/kubelet/apis/deviceplugin/v1beta1"
 )
 
+// defaultShutdownTimeout is how long in-flight CRI requests
+// are waited for on shutdown when it is not configured.
+const defaultShutdownTimeout = 30 * time.Second
+
+// defaultLibraryCacheTTL is how long library image metadata
+// is cached for when it is not configured.
+const defaultLibraryCacheTTL = time.Minute
+
 var (
 	errGPUNotSupported = fmt.Errorf("GPU device plugin is not supported on this host")
 
 	configPath string
-	version    = "unknown"
 )
 
 func init() {
@@ -53,16 +73,29 @@ func init() {
 	// compiled from TestRunMain. Otherwise we won't be able to pass this flag to the
 	// test binary b/c it won't be initialized before main() is called and we will have
 	// 'flag provided but not defined' error.
-	flag.StringVar(&configPath, "config", "/usr/local/etc/sycri/sycri.yaml", "path to config file")
+	defaultConfigPath := "/usr/local/etc/sycri/sycri.yaml"
+	if path, ok := os.LookupEnv("SYCRI_CONFIG"); ok {
+		defaultConfigPath = path
+	}
+	flag.StringVar(&configPath, "config", defaultConfigPath, "path to config file, may be set with SYCRI_CONFIG env as well")
 }
 
 func main() {
 	if len(os.Args) > 1 && os.Args[1] == "version" {
-		fmt.Println(version)
-		return
+		os.Exit(runVersion(os.Stdout, os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "check" {
+		os.Exit(runCheck(os.Stdout, os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == kube.PauseCommand {
+		os.Exit(runPause(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == sRuntime.MonitorCommand {
+		os.Exit(sRuntime.RunMonitor(os.Args[2:]))
 	}
 
 	flag.Parse()
+	cmdlineFlags = parsedFlags()
 	logs.InitLogs()
 	defer logs.FlushLogs()
 
@@ -73,6 +106,12 @@ func main() {
 		glog.Errorf("Could not parse config: %v", err)
 		return
 	}
+	if err := setupLogFiles(config); err != nil {
+		glog.Errorf("Could not set up log files: %v", err)
+		return
+	}
+	applyConfig(config)
+	setupSingularity(config)
 
 	// initialize user agent strings
 	useragent.InitValue("singularity", "3.1.0")
@@ -80,6 +119,8 @@ func main() {
 
 	exitCh := make(chan os.Signal, 1)
 	signal.Notify(exitCh, unix.SIGINT, unix.SIGTERM, unix.SIGQUIT)
+	reloadCh := make(chan os.Signal, 1)
+	signal.Notify(reloadCh, unix.SIGHUP)
 
 	// the next defer calls will be executed in reverse order
 	// each defer is specified separately to prevent weird runtime behavior when
@@ -101,13 +142,36 @@ func main() {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	if err := startCRI(ctx, criWG, config); err != nil {
+	newLogRetention(config).start(ctx, criWG)
+
+	if err := loadActivatedListeners(); err != nil {
+		glog.Errorf("Could not load activated listeners: %v", err)
+		return
+	}
+
+	syRuntime, syImage, err := startCRI(ctx, criWG, config)
+	if err != nil {
 		glog.Errorf("Could not start Singularity-CRI server: %v", err)
 		return
 	}
 
+	if config.MetricsAddress != "" {
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", metrics.DefaultRegistry)
+		if err := startHTTP(ctx, criWG, "Metrics", config.MetricsAddress, mux); err != nil {
+			glog.Errorf("Could not start metrics server: %v", err)
+			return
+		}
+	}
+	if config.DebugAddress != "" {
+		if err := startHTTP(ctx, criWG, "Debug", config.DebugAddress, debugHandler(syRuntime, syImage)); err != nil {
+			glog.Errorf("Could not start debug server: %v", err)
+			return
+		}
+	}
+
 	dpCtx, dpCancel := context.WithCancel(ctx)
-	err = startDevicePlugin(dpCtx, dpWG, config)
+	err = startDevicePlugin(dpCtx, dpWG, config, syRuntime)
 	devicePluginEnabled := err == nil
 	if err != nil && err != errGPUNotSupported {
 		glog.Errorf("Could not start Singularity device plugin: %v", err)
@@ -126,6 +190,20 @@ func main() {
 		defer watcher.Close()
 		fsEvents = watcher.Watch(ctx)
 	}
+	closeUnusedActivated()
+
+	interval, err := watchdogInterval()
+	if err != nil {
+		glog.Errorf("Could not configure systemd watchdog: %v", err)
+		return
+	}
+	if interval != 0 {
+		if err := startWatchdog(ctx, criWG, interval, config.ListenSocket); err != nil {
+			glog.Errorf("Could not start systemd watchdog: %v", err)
+			return
+		}
+	}
+	notifySystemd(sdReady)
 
 	for {
 		select {
@@ -137,70 +215,243 @@ func main() {
 
 				dpCtx, dpCancel = context.WithCancel(ctx)
 				dpWG = new(sync.WaitGroup)
-				if err := startDevicePlugin(dpCtx, dpWG, config); err != nil {
+				if err := startDevicePlugin(dpCtx, dpWG, config, syRuntime); err != nil {
 					glog.Errorf("Could not restart Singularity device plugin: %v", err)
 					return
 				}
 			}
+		case <-reloadCh:
+			glog.Infof("Received SIGHUP signal, reloading config...")
+			notifySystemd(sdReloading)
+			config, err = reloadConfig(configPath, config)
+			if err != nil {
+				glog.Errorf("Could not reload config: %v", err)
+			}
+			notifySystemd(sdReady)
 		case s := <-exitCh:
 			glog.Infof("Received %s signal, shutting down...", s)
+			notifySystemd(sdStopping)
 			return
 		}
 	}
 
 }
 
-func startCRI(ctx context.Context, wg *sync.WaitGroup, config Config) error {
+func startCRI(ctx context.Context, wg *sync.WaitGroup, config Config) (*runtime.SingularityRuntime, *image.SingularityRegistry, error) {
 	imageIndex := index.NewImageIndex()
-	syImage, err := image.NewSingularityRegistry(config.StorageDir, imageIndex)
+	var layerCache *sImage.LayerCache
+	if config.LayerCache.Dir != "" {
+		var err error
+		layerCache, err = sImage.NewLayerCache(config.LayerCache.Dir, int64(config.LayerCache.MaxSize)*1024*1024)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	var libraryCache *sImage.LibraryCache
+	switch ttl := config.LibraryCacheTTL; {
+	case ttl == 0:
+		libraryCache = sImage.NewLibraryCache(defaultLibraryCacheTTL)
+	case ttl > 0:
+		libraryCache = sImage.NewLibraryCache(ttl)
+	}
+	syImage, err := image.NewSingularityRegistry(config.StorageDir, imageIndex,
+		image.WithScratchDir(config.ScratchDir),
+		image.WithLayerCache(layerCache),
+		image.WithLibraryCache(libraryCache),
+		image.WithDefinitionDirs(config.DefinitionDirs),
+	)
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not create Singularity image service: %v", err)
+	}
+	var shmSize int64
+	if config.ShmSize != "" {
+		shmSize, err = kube.ParseShmSize(config.ShmSize)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	rlimits, err := kube.ParseRlimits(strings.Join(config.Rlimits, ","))
+	if err != nil {
+		return nil, nil, err
+	}
+	execSyncMaxOutput, err := parseExecSyncMaxOutput(config.ExecSyncMaxOutput)
+	if err != nil {
+		return nil, nil, err
+	}
+	var stopSignal string
+	if config.StopSignal != "" {
+		stopSignal, err = kube.ParseStopSignal(config.StopSignal)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	podOverhead, err := kube.ParsePodOverhead(config.PodOverhead.CPU, config.PodOverhead.Memory)
 	if err != nil {
-		return fmt.Errorf("could not create Singularity image service: %v", err)
+		return nil, nil, err
 	}
 	syRuntime, err := runtime.NewSingularityRuntime(
 		imageIndex,
 		runtime.WithStreaming(config.StreamingURL),
 		runtime.WithNetwork(config.CNIBinDir, config.CNIConfDir),
+		runtime.WithHostNetDevices(config.HostNetDevices),
 		runtime.WithBaseRunDir(config.BaseRunDir),
 		runtime.WithTrashDir(config.TrashDir),
+		runtime.WithHostResolvConf(config.HostResolvConf),
+		runtime.WithSeccompProfileRoot(config.SeccompProfileRoot),
+		runtime.WithDefaultSeccompProfile(config.DefaultSeccompProfile),
+		runtime.WithDefaultCapabilities(config.DefaultCapabilities),
+		runtime.WithAppArmorProfileDir(config.AppArmorProfileDir),
+		runtime.WithShmSize(shmSize),
+		runtime.WithPauseSandbox(config.PauseSandbox),
+		runtime.WithPodOverhead(podOverhead),
+		runtime.WithAllowedUnsafeSysctls(config.AllowUnsafeSysctls),
+		runtime.WithSIFVolumes(config.SIFVolumes),
+		runtime.WithHooks(kubeHooks(config.Hooks)),
+		runtime.WithRlimits(rlimits),
+		runtime.WithRealtimeAllowed(config.AllowRealtime),
+		runtime.WithNUMAAwareCpuset(config.NUMAAwareCpuset),
+		runtime.WithTimezone(config.Timezone),
+		runtime.WithBundleWorkers(config.BundleWorkers),
+		runtime.WithStopSignal(stopSignal),
+		runtime.WithDirectEngine(!config.ForceEngineCLI),
+		runtime.WithRuntimeHandlers(runtimeHandlers(config.RuntimeHandlers)),
+		runtime.WithExecSyncMaxOutput(execSyncMaxOutput),
+		runtime.WithExecEnv(config.ExecEnvDeny, config.ExecEnv),
+		runtime.WithProjectQuota(uint32(config.ProjectQuotaBaseID)),
+		runtime.WithContainerLogDriver(config.ContainerLogDriver),
+		runtime.WithContainerLogRotation(int64(config.ContainerLogMaxSize)*1024*1024, config.ContainerLogMaxFiles),
+		runtime.WithRetention(runtime.RetentionPolicy{
+			MaxExitedContainers:   config.Retention.MaxExitedContainers,
+			ExitedContainerMaxAge: config.Retention.ExitedContainerMaxAge,
+			MaxTrashDirs:          config.Retention.MaxTrashDirs,
+			TrashMaxAge:           config.Retention.TrashMaxAge,
+		}),
 	)
 	if err != nil {
-		return fmt.Errorf("could not create Singularity runtime service: %v", err)
+		return nil, nil, fmt.Errorf("could not create Singularity runtime service: %v", err)
 	}
+	metrics.Register(imageIndex.Metrics()...)
+	metrics.Register(syRuntime.IndexMetrics()...)
 
-	lis, err := syunix.CreateSocket(config.ListenSocket)
+	interceptors := []grpc.UnaryServerInterceptor{observeRPC}
+	var audit *auditLog
+	if config.AuditLog != "" {
+		audit, err = newAuditLog(config.AuditLog)
+		if err != nil {
+			return nil, nil, fmt.Errorf("could not start audit log: %v", err)
+		}
+		interceptors = append(interceptors, audit.intercept)
+	}
+	interceptors = append(interceptors,
+		enforceTimeouts(config.RPCTimeouts),
+		limitConcurrency(config.ConcurrencyLimits),
+		logAndRecover(newRequestLogger(config.LogFormat), newPanicAlert(config.PanicAlert)),
+	)
+	unaryInterceptor := grpc.UnaryInterceptor(chainUnaryInterceptors(interceptors...))
+
+	// servers are started only when all listeners are created successfully
+	type criServer struct {
+		lis    net.Listener
+		server *grpc.Server
+	}
+	var servers []criServer
+	closeListeners := func() {
+		for _, s := range servers {
+			s.lis.Close()
+		}
+	}
+
+	lis, err := listenUnix(config.ListenSocket)
 	if err != nil {
-		return fmt.Errorf("could not start CRI listener: %v ", err)
+		return nil, nil, fmt.Errorf("could not start CRI listener: %v ", err)
+	}
+	if err := setSocketPermissions(config.ListenSocket, config); err != nil {
+		lis.Close()
+		return nil, nil, fmt.Errorf("could not set CRI socket permissions: %v", err)
 	}
-	grpcServer := grpc.NewServer(grpc.UnaryInterceptor(logAndRecover(config.Debug)))
+	grpcServer := grpc.NewServer(unaryInterceptor)
 	k8s.RegisterRuntimeServiceServer(grpcServer, syRuntime)
-	k8s.RegisterImageServiceServer(grpcServer, syImage)
+	if config.ImageListenSocket == "" {
+		k8s.RegisterImageServiceServer(grpcServer, syImage)
+	}
+	servers = append(servers, criServer{lis, grpcServer})
+
+	if config.ImageListenSocket != "" {
+		imageLis, err := listenUnix(config.ImageListenSocket)
+		if err != nil {
+			closeListeners()
+			return nil, nil, fmt.Errorf("could not start CRI image service listener: %v", err)
+		}
+		if err := setSocketPermissions(config.ImageListenSocket, config); err != nil {
+			imageLis.Close()
+			closeListeners()
+			return nil, nil, fmt.Errorf("could not set CRI image service socket permissions: %v", err)
+		}
+		imageServer := grpc.NewServer(unaryInterceptor)
+		k8s.RegisterImageServiceServer(imageServer, syImage)
+		servers = append(servers, criServer{imageLis, imageServer})
+	}
+
+	if config.ListenAddress != "" {
+		tlsConfig, err := mutualTLSConfig(config.TLSCertFile, config.TLSKeyFile, config.TLSClientCAFile)
+		if err != nil {
+			closeListeners()
+			return nil, nil, fmt.Errorf("could not configure TLS: %v", err)
+		}
+		tcpLis, err := listenTCP(config.ListenAddress)
+		if err != nil {
+			closeListeners()
+			return nil, nil, fmt.Errorf("could not start CRI TCP listener: %v", err)
+		}
+		tcpServer := grpc.NewServer(
+			grpc.Creds(credentials.NewTLS(tlsConfig)),
+			unaryInterceptor,
+		)
+		k8s.RegisterRuntimeServiceServer(tcpServer, syRuntime)
+		k8s.RegisterImageServiceServer(tcpServer, syImage)
+		servers = append(servers, criServer{tcpLis, tcpServer})
+	}
 
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		defer lis.Close()
+		defer closeListeners()
 
-		go grpcServer.Serve(lis)
+		grpcServers := make([]*grpc.Server, 0, len(servers))
+		for _, s := range servers {
+			go s.server.Serve(s.lis)
+			glog.Infof("Singularity-CRI server started on %v", s.lis.Addr())
+			grpcServers = append(grpcServers, s.server)
+		}
 
-		glog.Infof("Singularity-CRI server started on %v", lis.Addr())
 		<-ctx.Done()
 
 		glog.Info("Singularity-CRI service exiting...")
-		grpcServer.Stop()
+		stopGracefully(config.ShutdownTimeout, grpcServers...)
 		if err := syRuntime.Shutdown(); err != nil {
 			glog.Errorf("Error during singularity runtime service shutdown: %v", err)
 		}
 		if err := syImage.Shutdown(); err != nil {
 			glog.Errorf("Error during singularity image service shutdown: %v", err)
 		}
+		if audit != nil {
+			if err := audit.Close(); err != nil {
+				glog.Errorf("Could not close audit log: %v", err)
+			}
+		}
 	}()
-	return nil
+	return syRuntime, syImage, nil
 }
 
-func startDevicePlugin(ctx context.Context, wg *sync.WaitGroup, config Config) error {
+func startDevicePlugin(ctx context.Context, wg *sync.WaitGroup, config Config, syRuntime *runtime.SingularityRuntime) error {
 	const devicePluginSocket = k8sDP.DevicePluginPath + "singularity.sock"
 
-	devicePlugin, err := device.NewSingularityDevicePlugin()
+	devicePlugin, err := device.NewSingularityDevicePlugin(
+		device.WithReplicas(config.GPUReplicas),
+		device.WithRecoveryInterval(config.GPURecoveryInterval),
+		device.WithSingularityConfDir(config.SingularityConfDir),
+		device.WithActivePods(syRuntime.ActivePods),
+	)
 	if err == device.ErrUnableToLoad || err == device.ErrNoGPUs {
 		glog.Warningf("GPU support is not enabled: %v", err)
 		return errGPUNotSupported
@@ -215,13 +466,13 @@ func startDevicePlugin(ctx context.Context, wg *sync.WaitGroup, config Config) e
 		}
 	}
 
-	lis, err := syunix.CreateSocket(devicePluginSocket)
+	lis, err := listenUnix(devicePluginSocket)
 	if err != nil {
 		cleanup()
 		return fmt.Errorf("could not start device plugin listener: %v ", err)
 	}
 
-	grpcServer := grpc.NewServer(grpc.UnaryInterceptor(logAndRecover(config.Debug)))
+	grpcServer := grpc.NewServer(grpc.UnaryInterceptor(chainUnaryInterceptors(observeRPC, logAndRecover(newRequestLogger(config.LogFormat), newPanicAlert(config.PanicAlert)))))
 	k8sDP.RegisterDevicePluginServer(grpcServer, devicePlugin)
 
 	register := make(chan error)
@@ -232,7 +483,7 @@ func startDevicePlugin(ctx context.Context, wg *sync.WaitGroup, config Config) e
 
 		go grpcServer.Serve(lis)
 
-		err := device.RegisterInKubelet(filepath.Base(devicePluginSocket))
+		err := device.RegisterInKubelet(filepath.Base(devicePluginSocket), devicePlugin.ResourceName())
 		if err != nil {
 			cleanup()
 			register <- fmt.Errorf("could not register Singularity device plugin: %v", err)
@@ -250,35 +501,150 @@ func startDevicePlugin(ctx context.Context, wg *sync.WaitGroup, config Config) e
 	return <-register
 }
 
-func logAndRecover(debug bool) grpc.UnaryServerInterceptor {
+// stopGracefully stops servers from accepting new requests and waits for
+// in-flight ones to finish. Requests that are still running after timeout
+// are cancelled. When timeout is zero, defaultShutdownTimeout is used.
+func stopGracefully(timeout time.Duration, servers ...*grpc.Server) {
+	if timeout == 0 {
+		timeout = defaultShutdownTimeout
+	}
+
+	done := make(chan struct{})
+	go func() {
+		var wg sync.WaitGroup
+		for _, s := range servers {
+			wg.Add(1)
+			go func(s *grpc.Server) {
+				defer wg.Done()
+				s.GracefulStop()
+			}(s)
+		}
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(timeout):
+		glog.Warningf("In-flight requests did not finish within %v, cancelling them", timeout)
+		for _, s := range servers {
+			s.Stop()
+		}
+		<-done
+	}
+}
+
+// startHTTP starts HTTP server with passed handler on addr until ctx
+// is done. Name is used to distinguish servers in logs and errors.
+func startHTTP(ctx context.Context, wg *sync.WaitGroup, name, addr string, handler http.Handler) error {
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("could not start %s listener: %v", name, err)
+	}
+	srv := &http.Server{Handler: handler}
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		go func() {
+			err := srv.Serve(lis)
+			if err != nil && err != http.ErrServerClosed {
+				glog.Errorf("%s server error: %v", name, err)
+			}
+		}()
+
+		glog.Infof("%s server started on %v", name, lis.Addr())
+		<-ctx.Done()
+
+		glog.Infof("%s server exiting...", name)
+		if err := srv.Close(); err != nil {
+			glog.Errorf("Error during %s server shutdown: %v", name, err)
+		}
+	}()
+	return nil
+}
+
+// debugRuntime is a runtime that is inspected with debug handler.
+type debugRuntime interface {
+	execSessionManager
+	stateDumper
+}
+
+// debugHandler returns handler that serves runtime profiling data, exported
+// variables, exec sessions and internal state of runtime under /debug/ path.
+// Image storage consistency check is triggered under /debug/fsck.
+func debugHandler(r debugRuntime, images storageChecker) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.Handle("/debug/vars", expvar.Handler())
+	mux.Handle("/debug/exec-sessions", execSessionsHandler(r))
+	mux.Handle("/debug/state", debugStateHandler(r))
+	mux.Handle("/debug/fsck", fsckHandler(images))
+	return mux
+}
+
+// mutualTLSConfig returns TLS config that requires clients
+// to present certificates signed by CA from caFile.
+func mutualTLSConfig(certFile, keyFile, caFile string) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("could not load server key pair: %v", err)
+	}
+	ca, err := ioutil.ReadFile(caFile)
+	if err != nil {
+		return nil, fmt.Errorf("could not read client CA: %v", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return nil, fmt.Errorf("no certificates found in %s", caFile)
+	}
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    pool,
+		MinVersion:   tls.VersionTLS12,
+	}, nil
+}
+
+func logAndRecover(logRequest requestLogger, alert *panicAlert) grpc.UnaryServerInterceptor {
 	return func(ctx context.Context, req interface{},
 		info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, e error) {
 		defer func() {
 			if err := recover(); err != nil {
 				glog.Errorf("Caught panic in %s: %v", info.FullMethod, err)
+				rpcPanicsMetric.Inc(info.FullMethod)
+				alert.observe(info.FullMethod, time.Now())
 				e = fmt.Errorf("panic: %v", err)
 			}
 		}()
 
 		resp, err := handler(ctx, req)
-		if debug || err != nil {
+		if status.Code(err) == codes.Internal {
+			rpcInternalErrorsMetric.Inc(info.FullMethod)
+		}
+		if isDebug() || err != nil {
 			// mask any credentials received before logging
 			r, ok := req.(*k8s.PullImageRequest)
 			if ok && r.Auth != nil {
 				r.Auth.Reset()
 			}
-			jsonReq, _ := json.Marshal(req)
-			jsonResp, _ := json.Marshal(resp)
-			logFunc := glog.Infof
-			if err != nil {
-				logFunc = glog.Errorf
-			}
-			logFunc("%s\n\tRequest: %s\n\tResponse: %s\n\tError: %v", info.FullMethod, jsonReq, jsonResp, err)
+			logRequest(info.FullMethod, req, resp, err)
 		}
 		return resp, err
 	}
 }
 
+// singularityDebugSet is true when Singularity debug logs
+// are enabled by setSingularityLogLevel.
+var singularityDebugSet bool
+
+// setSingularityLogLevel enables Singularity debug logs when verbosity level
+// is 6 or higher and disables them when level is lowered afterwards.
 func setSingularityLogLevel() {
 	f := flag.Lookup("v")
 	if f == nil {
@@ -295,6 +661,16 @@ func setSingularityLogLevel() {
 		err := os.Setenv(sRuntime.LogLevelEnv, sRuntime.LogLevelDebug)
 		if err != nil {
 			glog.Errorf("Could not set env log level %s", err)
+			return
+		}
+		singularityDebugSet = true
+		return
+	}
+	if singularityDebugSet {
+		if err := os.Unsetenv(sRuntime.LogLevelEnv); err != nil {
+			glog.Errorf("Could not unset env log level %s", err)
+			return
 		}
+		singularityDebugSet = false
 	}
 }
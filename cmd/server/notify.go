@@ -0,0 +1,134 @@
+// Copyright (c) 2018-2019 Sylabs, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"google.golang.org/grpc"
+	k8s "k8s.io/kubernetes/pkg/kubelet/apis/cri/runtime/v1alpha2"
+)
+
+// systemd notification states, see sd_notify(3).
+const (
+	sdReady     = "READY=1"
+	sdReloading = "RELOADING=1"
+	sdStopping  = "STOPPING=1"
+	sdWatchdog  = "WATCHDOG=1"
+)
+
+// sdNotify sends state to systemd over socket set in NOTIFY_SOCKET.
+// It is a no-op when sycri is not started by systemd with Type=notify.
+func sdNotify(state string) error {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" {
+		return nil
+	}
+
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		return fmt.Errorf("could not connect to notify socket: %v", err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.Write([]byte(state)); err != nil {
+		return fmt.Errorf("could not send notification: %v", err)
+	}
+	return nil
+}
+
+// notifySystemd sends state to systemd and logs failures,
+// since they should never prevent sycri from running.
+func notifySystemd(state string) {
+	if err := sdNotify(state); err != nil {
+		glog.Warningf("Could not notify systemd with %s: %v", state, err)
+	}
+}
+
+// watchdogInterval returns interval systemd expects watchdog pings within,
+// as set in WATCHDOG_USEC. Zero is returned when watchdog is disabled or
+// is meant for a different process.
+func watchdogInterval() (time.Duration, error) {
+	usecStr := os.Getenv("WATCHDOG_USEC")
+	if usecStr == "" {
+		return 0, nil
+	}
+	if pidStr := os.Getenv("WATCHDOG_PID"); pidStr != "" {
+		pid, err := strconv.Atoi(pidStr)
+		if err != nil {
+			return 0, fmt.Errorf("invalid WATCHDOG_PID value: %v", err)
+		}
+		if pid != os.Getpid() {
+			return 0, nil
+		}
+	}
+	usec, err := strconv.ParseInt(usecStr, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid WATCHDOG_USEC value: %v", err)
+	}
+	if usec <= 0 {
+		return 0, fmt.Errorf("WATCHDOG_USEC should be positive")
+	}
+	return time.Duration(usec) * time.Microsecond, nil
+}
+
+// startWatchdog pings systemd watchdog every half of interval as long as
+// CRI server listening on socket responds to Version request. When server
+// hangs pings stop and systemd restarts sycri according to the unit's settings.
+func startWatchdog(ctx context.Context, wg *sync.WaitGroup, interval time.Duration, socket string) error {
+	conn, err := grpc.Dial(socket,
+		grpc.WithInsecure(),
+		grpc.WithDialer(func(addr string, timeout time.Duration) (net.Conn, error) {
+			return net.DialTimeout("unix", addr, timeout)
+		}),
+	)
+	if err != nil {
+		return fmt.Errorf("could not connect to CRI server: %v", err)
+	}
+	client := k8s.NewRuntimeServiceClient(conn)
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer conn.Close()
+
+		glog.Infof("Systemd watchdog enabled with %v interval", interval)
+		ticker := time.NewTicker(interval / 2)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				checkCtx, cancel := context.WithTimeout(ctx, interval/2)
+				_, err := client.Version(checkCtx, &k8s.VersionRequest{})
+				cancel()
+				if err != nil {
+					glog.Errorf("Health check failed, skipping watchdog ping: %v", err)
+					continue
+				}
+				notifySystemd(sdWatchdog)
+			}
+		}
+	}()
+	return nil
+}
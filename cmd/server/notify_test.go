@@ -0,0 +1,107 @@
+// Copyright (c) 2018-2019 Sylabs, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSdNotify(t *testing.T) {
+	dir, err := ioutil.TempDir("", "notify-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	socket := filepath.Join(dir, "notify.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: socket, Net: "unixgram"})
+	require.NoError(t, err)
+	defer conn.Close()
+
+	os.Unsetenv("NOTIFY_SOCKET")
+	require.NoError(t, sdNotify(sdReady), "should be no-op without NOTIFY_SOCKET")
+
+	os.Setenv("NOTIFY_SOCKET", socket)
+	defer os.Unsetenv("NOTIFY_SOCKET")
+	require.NoError(t, sdNotify(sdReady))
+
+	buf := make([]byte, 64)
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(time.Second)))
+	n, err := conn.Read(buf)
+	require.NoError(t, err)
+	require.Equal(t, sdReady, string(buf[:n]))
+}
+
+func TestWatchdogInterval(t *testing.T) {
+	tt := []struct {
+		name        string
+		usec        string
+		pid         string
+		expect      time.Duration
+		expectError bool
+	}{
+		{
+			name: "disabled",
+		},
+		{
+			name:   "enabled",
+			usec:   "30000000",
+			expect: 30 * time.Second,
+		},
+		{
+			name:   "own pid",
+			usec:   "30000000",
+			pid:    strconv.Itoa(os.Getpid()),
+			expect: 30 * time.Second,
+		},
+		{
+			name: "other pid",
+			usec: "30000000",
+			pid:  "1",
+		},
+		{
+			name:        "invalid usec",
+			usec:        "30s",
+			expectError: true,
+		},
+		{
+			name:        "zero usec",
+			usec:        "0",
+			expectError: true,
+		},
+	}
+
+	defer os.Unsetenv("WATCHDOG_USEC")
+	defer os.Unsetenv("WATCHDOG_PID")
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			os.Setenv("WATCHDOG_USEC", tc.usec)
+			os.Setenv("WATCHDOG_PID", tc.pid)
+			interval, err := watchdogInterval()
+			if tc.expectError {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.expect, interval)
+		})
+	}
+}
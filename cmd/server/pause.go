@@ -0,0 +1,104 @@
+// Copyright (c) 2018-2019 Sylabs, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+
+	"github.com/sylabs/singularity-cri/pkg/kube"
+	"golang.org/x/sys/unix"
+)
+
+// procSys is where sysctls are set.
+const procSys = "/proc/sys"
+
+// runPause implements hidden sycri pause subcommand that is run as a pod
+// sandbox process holding pod namespaces. It sets passed sysctls in its
+// namespaces before reporting readiness, reaps orphaned processes when
+// run as init of pod PID namespace and exits on SIGTERM or SIGINT.
+// It returns process exit code.
+func runPause(sysctls []string) int {
+	ready := os.NewFile(kube.PauseReadyFD, "ready")
+	if err := applySysctls(procSys, sysctls); err != nil {
+		fmt.Fprint(ready, err)
+		return 1
+	}
+	ready.Close()
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, unix.SIGTERM, unix.SIGINT, unix.SIGCHLD)
+	return pause(sigs, reapChildren)
+}
+
+// pause waits for signals received from sigs calling reap on each SIGCHLD
+// until a terminating signal is received.
+func pause(sigs <-chan os.Signal, reap func()) int {
+	for sig := range sigs {
+		if sig == unix.SIGCHLD {
+			reap()
+			continue
+		}
+		return 0
+	}
+	return 1
+}
+
+// applySysctls sets sysctls passed as name=value under root directory.
+// Names are either dot or slash separated.
+func applySysctls(root string, sysctls []string) error {
+	for _, sysctl := range sysctls {
+		i := strings.Index(sysctl, "=")
+		if i <= 0 {
+			return fmt.Errorf("invalid sysctl %q", sysctl)
+		}
+		name, value := sysctl[:i], sysctl[i+1:]
+		path := name
+		if !strings.Contains(name, "/") {
+			path = strings.Replace(name, ".", "/", -1)
+		}
+		if err := writeSysctl(filepath.Join(root, path), value); err != nil {
+			return fmt.Errorf("could not set sysctl %s: %v", name, err)
+		}
+	}
+	return nil
+}
+
+// writeSysctl writes value to the existing sysctl file.
+func writeSysctl(path, value string) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_TRUNC, 0)
+	if err != nil {
+		return err
+	}
+	_, err = f.WriteString(value)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// reapChildren waits for all exited children without blocking.
+func reapChildren() {
+	for {
+		var status unix.WaitStatus
+		pid, err := unix.Wait4(-1, &status, unix.WNOHANG, nil)
+		if pid <= 0 || err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,117 @@
+// Copyright (c) 2018-2019 Sylabs, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+)
+
+func TestPause(t *testing.T) {
+	tt := []struct {
+		name        string
+		signals     []os.Signal
+		expectReaps int
+		expectCode  int
+	}{
+		{
+			name:        "terminate",
+			signals:     []os.Signal{unix.SIGTERM},
+			expectReaps: 0,
+			expectCode:  0,
+		},
+		{
+			name:        "reap and interrupt",
+			signals:     []os.Signal{unix.SIGCHLD, unix.SIGCHLD, unix.SIGINT, unix.SIGCHLD},
+			expectReaps: 2,
+			expectCode:  0,
+		},
+		{
+			name:        "closed channel",
+			signals:     []os.Signal{unix.SIGCHLD},
+			expectReaps: 1,
+			expectCode:  1,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			sigs := make(chan os.Signal, len(tc.signals))
+			for _, sig := range tc.signals {
+				sigs <- sig
+			}
+			close(sigs)
+
+			var reaps int
+			code := pause(sigs, func() { reaps++ })
+			require.Equal(t, tc.expectCode, code)
+			require.Equal(t, tc.expectReaps, reaps)
+		})
+	}
+}
+
+func TestApplySysctls(t *testing.T) {
+	root, err := ioutil.TempDir("", "proc-sys-")
+	require.NoError(t, err, "could not create temp dir")
+	defer os.RemoveAll(root)
+
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "net/ipv4"), 0755))
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "kernel"), 0755))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(root, "net/ipv4/ip_forward"), []byte("0"), 0644))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(root, "kernel/shmmax"), []byte("0"), 0644))
+
+	tt := []struct {
+		name        string
+		sysctls     []string
+		expectFiles map[string]string
+		expectError bool
+	}{
+		{
+			name:    "dot and slash separated",
+			sysctls: []string{"net.ipv4.ip_forward=1", "kernel/shmmax=65536"},
+			expectFiles: map[string]string{
+				"net/ipv4/ip_forward": "1",
+				"kernel/shmmax":       "65536",
+			},
+		},
+		{
+			name:        "unknown sysctl",
+			sysctls:     []string{"net.ipv4.unknown=1"},
+			expectError: true,
+		},
+		{
+			name:        "no value",
+			sysctls:     []string{"kernel.shmmax"},
+			expectError: true,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			err := applySysctls(root, tc.sysctls)
+			require.Equal(t, tc.expectError, err != nil, "unexpected error: %v", err)
+			for path, expect := range tc.expectFiles {
+				data, err := ioutil.ReadFile(filepath.Join(root, path))
+				require.NoError(t, err)
+				require.Equal(t, expect, string(data))
+			}
+		})
+	}
+}
@@ -0,0 +1,90 @@
+// Copyright (c) 2018-2019 Sylabs, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"strconv"
+)
+
+// parseSocketMode parses octal socket mode, e.g. 0660.
+func parseSocketMode(mode string) (os.FileMode, error) {
+	m, err := strconv.ParseUint(mode, 8, 32)
+	if err != nil || m&^uint64(os.ModePerm) != 0 {
+		return 0, fmt.Errorf("invalid socket mode %q", mode)
+	}
+	return os.FileMode(m), nil
+}
+
+// lookupID returns numeric ID of user or group that is specified either by
+// name or by ID. Lookup is used to find ID by name, it should return
+// user.UnknownUserError or user.UnknownGroupError when name is not found.
+func lookupID(nameOrID string, lookup func(string) (string, error)) (int, error) {
+	if id, err := strconv.Atoi(nameOrID); err == nil {
+		return id, nil
+	}
+	id, err := lookup(nameOrID)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(id)
+}
+
+// setSocketPermissions applies configured mode, owner and group to socket at path.
+func setSocketPermissions(path string, config Config) error {
+	if config.SocketOwner != "" || config.SocketGroup != "" {
+		uid, gid := -1, -1
+		var err error
+		if config.SocketOwner != "" {
+			uid, err = lookupID(config.SocketOwner, func(name string) (string, error) {
+				u, err := user.Lookup(name)
+				if err != nil {
+					return "", err
+				}
+				return u.Uid, nil
+			})
+			if err != nil {
+				return fmt.Errorf("could not find socket owner: %v", err)
+			}
+		}
+		if config.SocketGroup != "" {
+			gid, err = lookupID(config.SocketGroup, func(name string) (string, error) {
+				g, err := user.LookupGroup(name)
+				if err != nil {
+					return "", err
+				}
+				return g.Gid, nil
+			})
+			if err != nil {
+				return fmt.Errorf("could not find socket group: %v", err)
+			}
+		}
+		if err := os.Chown(path, uid, gid); err != nil {
+			return fmt.Errorf("could not change socket owner: %v", err)
+		}
+	}
+	if config.SocketMode != "" {
+		mode, err := parseSocketMode(config.SocketMode)
+		if err != nil {
+			return err
+		}
+		if err := os.Chmod(path, mode); err != nil {
+			return fmt.Errorf("could not change socket mode: %v", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+// Copyright (c) 2018-2019 Sylabs, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/user"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSocketMode(t *testing.T) {
+	tt := []struct {
+		mode        string
+		expectMode  os.FileMode
+		expectError error
+	}{
+		{
+			mode:       "0660",
+			expectMode: 0660,
+		},
+		{
+			mode:       "600",
+			expectMode: 0600,
+		},
+		{
+			mode:        "4755",
+			expectError: fmt.Errorf(`invalid socket mode "4755"`),
+		},
+		{
+			mode:        "0990",
+			expectError: fmt.Errorf(`invalid socket mode "0990"`),
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.mode, func(t *testing.T) {
+			mode, err := parseSocketMode(tc.mode)
+			require.Equal(t, tc.expectError, err)
+			require.Equal(t, tc.expectMode, mode)
+		})
+	}
+}
+
+func TestLookupID(t *testing.T) {
+	lookup := func(name string) (string, error) {
+		if name == "kubelet" {
+			return "990", nil
+		}
+		return "", user.UnknownGroupError(name)
+	}
+
+	id, err := lookupID("42", lookup)
+	require.NoError(t, err)
+	require.Equal(t, 42, id)
+
+	id, err = lookupID("kubelet", lookup)
+	require.NoError(t, err)
+	require.Equal(t, 990, id)
+
+	_, err = lookupID("nobody-here", lookup)
+	require.Equal(t, user.UnknownGroupError("nobody-here"), err)
+}
+
+func TestSetSocketPermissions(t *testing.T) {
+	dir, err := ioutil.TempDir("", "socket-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	socket := filepath.Join(dir, "cri.sock")
+	lis, err := net.Listen("unix", socket)
+	require.NoError(t, err)
+	defer lis.Close()
+
+	config := Config{
+		SocketMode:  "0660",
+		SocketOwner: fmt.Sprint(os.Getuid()),
+		SocketGroup: fmt.Sprint(os.Getgid()),
+	}
+	require.NoError(t, setSocketPermissions(socket, config))
+	fi, err := os.Stat(socket)
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0660), fi.Mode().Perm())
+}
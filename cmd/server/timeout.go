@@ -0,0 +1,89 @@
+// Copyright (c) 2018-2019 Sylabs, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"path"
+	"time"
+
+	"github.com/golang/glog"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// defaultRPCTimeouts are used for requests that have no configured timeout.
+var defaultRPCTimeouts = RPCTimeouts{
+	PullImage:       time.Hour,
+	CreateContainer: 10 * time.Minute,
+	StopPodSandbox:  10 * time.Minute,
+}
+
+// byMethod returns timeouts keyed by CRI method name.
+func (t RPCTimeouts) byMethod() map[string]time.Duration {
+	return map[string]time.Duration{
+		"PullImage":       t.PullImage,
+		"CreateContainer": t.CreateContainer,
+		"StopPodSandbox":  t.StopPodSandbox,
+	}
+}
+
+// enforceTimeouts returns interceptor that sets deadline for long requests
+// when client didn't set one. Since not all of handlers respect context,
+// client is answered with DeadlineExceeded once deadline passes even when
+// handler is still running; its late result is logged and discarded.
+func enforceTimeouts(timeouts RPCTimeouts) grpc.UnaryServerInterceptor {
+	durations := timeouts.byMethod()
+	defaults := defaultRPCTimeouts.byMethod()
+	for method, timeout := range durations {
+		if timeout == 0 {
+			durations[method] = defaults[method]
+		}
+	}
+
+	return func(ctx context.Context, req interface{},
+		info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		method := path.Base(info.FullMethod)
+		timeout, ok := durations[method]
+		if _, hasDeadline := ctx.Deadline(); !ok || hasDeadline {
+			return handler(ctx, req)
+		}
+
+		ctx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+
+		type result struct {
+			resp interface{}
+			err  error
+		}
+		done := make(chan result, 1)
+		go func() {
+			resp, err := handler(ctx, req)
+			done <- result{resp, err}
+		}()
+
+		select {
+		case res := <-done:
+			return res.resp, res.err
+		case <-ctx.Done():
+			go func() {
+				res := <-done
+				glog.Warningf("%s finished after %v timeout: %v", method, timeout, res.err)
+			}()
+			return nil, status.Errorf(codes.DeadlineExceeded, "%s did not finish within %v", method, timeout)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+// Copyright (c) 2018-2019 Sylabs, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestEnforceTimeouts(t *testing.T) {
+	enforce := enforceTimeouts(RPCTimeouts{PullImage: 50 * time.Millisecond})
+	release := make(chan struct{})
+	defer close(release)
+	hung := func(ctx context.Context, req interface{}) (interface{}, error) {
+		<-release
+		return "pulled", nil
+	}
+	requireDeadline := func(ctx context.Context, req interface{}) (interface{}, error) {
+		if _, ok := ctx.Deadline(); !ok {
+			return nil, status.Error(codes.Unknown, "no deadline")
+		}
+		return "done", nil
+	}
+
+	tt := []struct {
+		name       string
+		method     string
+		timeout    time.Duration
+		handler    grpc.UnaryHandler
+		expectCode codes.Code
+	}{
+		{
+			name:       "hung handler",
+			method:     "/runtime.v1alpha2.ImageService/PullImage",
+			handler:    hung,
+			expectCode: codes.DeadlineExceeded,
+		},
+		{
+			name:       "default timeout",
+			method:     "/runtime.v1alpha2.RuntimeService/StopPodSandbox",
+			handler:    requireDeadline,
+			expectCode: codes.OK,
+		},
+		{
+			name:       "client deadline",
+			method:     "/runtime.v1alpha2.ImageService/PullImage",
+			timeout:    time.Hour,
+			handler:    requireDeadline,
+			expectCode: codes.OK,
+		},
+		{
+			name:       "no timeout",
+			method:     "/runtime.v1alpha2.RuntimeService/ListContainers",
+			handler:    requireDeadline,
+			expectCode: codes.Unknown,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tc.timeout != 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, tc.timeout)
+				defer cancel()
+			}
+			_, err := enforce(ctx, nil, &grpc.UnaryServerInfo{FullMethod: tc.method}, tc.handler)
+			require.Equal(t, tc.expectCode, status.Code(err))
+		})
+	}
+}
@@ -0,0 +1,52 @@
+// Copyright (c) 2018-2019 Sylabs, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+
+	"github.com/sylabs/singularity-cri/pkg/version"
+)
+
+// runVersion implements sycri version subcommand that prints build
+// information either as text or as JSON. It returns process exit code.
+func runVersion(w io.Writer, args []string) int {
+	flags := flag.NewFlagSet("version", flag.ContinueOnError)
+	output := flags.String("o", "text", "output format, either text or json")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	info := version.Get()
+	var err error
+	switch *output {
+	case "text":
+		err = info.WriteText(w)
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(info)
+	default:
+		err = fmt.Errorf("unknown output format %q", *output)
+	}
+	if err != nil {
+		fmt.Fprintf(flags.Output(), "Could not print version: %v\n", err)
+		return 1
+	}
+	return 0
+}
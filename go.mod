@@ -25,12 +25,15 @@ require (
 	github.com/opencontainers/runtime-spec v0.1.2-0.20181111125026-1722abf79c2f
 	github.com/opencontainers/runtime-tools v0.9.0
 	github.com/opencontainers/selinux v1.3.0
-	github.com/sirupsen/logrus v1.2.0 // indirect
+	github.com/sirupsen/logrus v1.2.0
 	github.com/stretchr/testify v1.4.0
 	github.com/sylabs/scs-library-client v0.4.4
+	github.com/sylabs/sif v1.0.8
 	github.com/sylabs/singularity v0.0.0-20190918134918-5d9975e95fa7
 	github.com/syndtr/gocapability v0.0.0-20180916011248-d98352740cb2 // indirect
 	github.com/tchap/go-patricia v2.2.6+incompatible
+	github.com/vishvananda/netlink v1.0.1-0.20190618143317-99a56c251ae6
+	github.com/vishvananda/netns v0.0.0-20180720170159-13995c7128cc
 	github.com/xeipuuv/gojsonschema v0.0.0-20180816142147-da425ebb7609 // indirect
 	golang.org/x/crypto v0.0.0 // indirect
 	golang.org/x/sys v0.0.0-20190616124812-15dcb6c0061f
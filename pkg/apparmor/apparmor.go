@@ -0,0 +1,104 @@
+// Copyright (c) 2018-2019 Sylabs, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package apparmor allows to check whether AppArmor profiles are loaded
+// into the kernel and to load missing ones with apparmor_parser.
+package apparmor
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// Unconfined is a name of the profile that disables AppArmor confinement.
+const Unconfined = "unconfined"
+
+// securityDir is where AppArmor exposes its state in securityfs.
+var securityDir = "/sys/kernel/security/apparmor"
+
+// Enabled reports whether AppArmor is enabled on the host.
+func Enabled() bool {
+	_, err := os.Stat(securityDir)
+	return err == nil
+}
+
+// IsLoaded reports whether profile with the passed name is loaded into the kernel.
+func IsLoaded(name string) (bool, error) {
+	f, err := os.Open(filepath.Join(securityDir, "profiles"))
+	if err != nil {
+		return false, fmt.Errorf("could not open loaded profiles: %v", err)
+	}
+	defer f.Close()
+
+	// each line is a profile name followed by its mode, e.g. sycri-default (enforce)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.LastIndex(line, " ("); i != -1 {
+			line = line[:i]
+		}
+		if line == name {
+			return true, nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return false, fmt.Errorf("could not read loaded profiles: %v", err)
+	}
+	return false, nil
+}
+
+// Load loads profile file located at path into the kernel
+// replacing profile with the same name if any.
+func Load(path string) error {
+	out, err := exec.Command("apparmor_parser", "--replace", path).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("could not load profile %s: %v: %s", path, err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// Ensure makes sure profile with the passed name is loaded. When it is not,
+// a profile file with the same name is looked up in profilesDir and loaded,
+// if profilesDir is not empty. An empty name and Unconfined are always valid.
+func Ensure(name, profilesDir string) error {
+	if name == "" || name == Unconfined {
+		return nil
+	}
+	if !Enabled() {
+		return fmt.Errorf("AppArmor is not enabled on the host")
+	}
+	loaded, err := IsLoaded(name)
+	if err != nil {
+		return err
+	}
+	if loaded {
+		return nil
+	}
+	if profilesDir != "" {
+		path := filepath.Join(profilesDir, filepath.Base(name))
+		if _, err := os.Stat(path); err == nil {
+			if err := Load(path); err != nil {
+				return err
+			}
+			if loaded, err = IsLoaded(name); err != nil || loaded {
+				return err
+			}
+		}
+	}
+	return fmt.Errorf("AppArmor profile %q is not loaded", name)
+}
@@ -0,0 +1,86 @@
+// Copyright (c) 2018-2019 Sylabs, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apparmor
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestEnsure(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	require.NoError(t, err, "could not create temp dir")
+	defer os.RemoveAll(dir)
+
+	err = ioutil.WriteFile(filepath.Join(dir, "profiles"), []byte(
+		"/usr/sbin/ntpd (enforce)\n"+
+			"sycri-default (complain)\n"), 0644)
+	require.NoError(t, err, "could not write profiles")
+
+	defer func(dir string) { securityDir = dir }(securityDir)
+
+	tt := []struct {
+		name        string
+		securityDir string
+		profile     string
+		expectError error
+	}{
+		{
+			name:        "empty profile",
+			securityDir: filepath.Join(dir, "not-exist"),
+			profile:     "",
+		},
+		{
+			name:        "unconfined",
+			securityDir: filepath.Join(dir, "not-exist"),
+			profile:     Unconfined,
+		},
+		{
+			name:        "AppArmor disabled",
+			securityDir: filepath.Join(dir, "not-exist"),
+			profile:     "sycri-default",
+			expectError: fmt.Errorf("AppArmor is not enabled on the host"),
+		},
+		{
+			name:        "loaded profile",
+			securityDir: dir,
+			profile:     "sycri-default",
+		},
+		{
+			name:        "loaded path profile",
+			securityDir: dir,
+			profile:     "/usr/sbin/ntpd",
+		},
+		{
+			name:        "missing profile",
+			securityDir: dir,
+			profile:     "sycri-strict",
+			expectError: fmt.Errorf(`AppArmor profile "sycri-strict" is not loaded`),
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			securityDir = tc.securityDir
+			err := Ensure(tc.profile, filepath.Join(dir, "not-exist"))
+			require.Equal(t, tc.expectError, err)
+		})
+	}
+}
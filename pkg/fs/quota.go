@@ -0,0 +1,211 @@
+// Copyright (c) 2018-2019 Sylabs, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fs
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// ioctl requests and flags from linux/fs.h.
+	fsIocFsgetxattr    = 0x801c581f
+	fsIocFssetxattr    = 0x401c5820
+	fsXflagProjinherit = 0x200
+
+	// quotactl command and quota type from linux/quota.h.
+	qGetquota = 0x800007
+	prjQuota  = 2
+)
+
+// mountInfoPath is a path to mountinfo, overridden in tests.
+var mountInfoPath = "/proc/self/mountinfo"
+
+// fsxattr mirrors struct fsxattr from linux/fs.h.
+type fsxattr struct {
+	xflags     uint32
+	extsize    uint32
+	nextents   uint32
+	projid     uint32
+	cowextsize uint32
+	pad        [8]byte
+}
+
+// dqblk mirrors struct if_dqblk from linux/quota.h.
+type dqblk struct {
+	bhardlimit uint64
+	bsoftlimit uint64
+	curspace   uint64
+	ihardlimit uint64
+	isoftlimit uint64
+	curinodes  uint64
+	btime      uint64
+	itime      uint64
+	valid      uint32
+}
+
+// ProjectIDs allocates unique project IDs starting from base.
+// It is safe for concurrent use.
+type ProjectIDs struct {
+	mu   sync.Mutex
+	base uint32
+	used map[uint32]bool
+}
+
+// NewProjectIDs returns allocator of project IDs starting from base.
+func NewProjectIDs(base uint32) *ProjectIDs {
+	return &ProjectIDs{
+		base: base,
+		used: make(map[uint32]bool),
+	}
+}
+
+// Allocate returns the lowest project ID that is not in use.
+func (p *ProjectIDs) Allocate() uint32 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	id := p.base
+	for p.used[id] {
+		id++
+	}
+	p.used[id] = true
+	return id
+}
+
+// Release makes id available for allocation again.
+func (p *ProjectIDs) Release(id uint32) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.used, id)
+}
+
+// ProjectQuotaSupported reports whether project quota accounting
+// is enabled on filesystem path is located on.
+func ProjectQuotaSupported(path string) bool {
+	_, err := ProjectUsage(path, 0)
+	return err == nil
+}
+
+// SetProjectID assigns project id to directory at path. Files created
+// in it later inherit id, so that their usage is accounted to the project.
+func SetProjectID(path string, id uint32) error {
+	dir, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("could not open %s: %v", path, err)
+	}
+	defer dir.Close()
+
+	var attr fsxattr
+	if err := ioctl(dir.Fd(), fsIocFsgetxattr, unsafe.Pointer(&attr)); err != nil {
+		return fmt.Errorf("could not get attributes of %s: %v", path, err)
+	}
+	attr.projid = id
+	attr.xflags |= fsXflagProjinherit
+	if err := ioctl(dir.Fd(), fsIocFssetxattr, unsafe.Pointer(&attr)); err != nil {
+		return fmt.Errorf("could not set project id of %s: %v", path, err)
+	}
+	return nil
+}
+
+// ProjectUsage returns fs usage accounted to project id on filesystem
+// path is located on. Unlike Usage, it doesn't walk directories, but
+// requires project quota accounting to be enabled on filesystem.
+func ProjectUsage(path string, id uint32) (*UsageInfo, error) {
+	mount, device, err := mountDevice(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not get mount device: %v", err)
+	}
+	devicePtr, err := unix.BytePtrFromString(device)
+	if err != nil {
+		return nil, fmt.Errorf("invalid device %q: %v", device, err)
+	}
+
+	var quota dqblk
+	cmd := qGetquota<<8 | prjQuota
+	_, _, errno := unix.Syscall6(unix.SYS_QUOTACTL, uintptr(cmd), uintptr(unsafe.Pointer(devicePtr)),
+		uintptr(id), uintptr(unsafe.Pointer(&quota)), 0, 0)
+	if errno != 0 {
+		return nil, fmt.Errorf("could not get project %d quota on %s: %v", id, device, errno)
+	}
+	return &UsageInfo{
+		MountPoint: mount,
+		Bytes:      int64(quota.curspace),
+		Inodes:     int64(quota.curinodes),
+	}, nil
+}
+
+// mountDevice returns mount point path is located on and its source device.
+func mountDevice(path string) (string, string, error) {
+	resolved, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return "", "", err
+	}
+
+	f, err := os.Open(mountInfoPath)
+	if err != nil {
+		return "", "", fmt.Errorf("could not open mountinfo: %v", err)
+	}
+	defer f.Close()
+
+	var mount, device string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// 36 35 98:0 /mnt1 /mnt2 rw,noatime master:1 - ext3 /dev/root rw,errors=continue
+		fields := strings.Fields(scanner.Text())
+		sep := -1
+		for i, field := range fields {
+			if field == "-" {
+				sep = i
+				break
+			}
+		}
+		if len(fields) < 5 || sep == -1 || sep+2 >= len(fields) {
+			continue
+		}
+		point := fields[4]
+		if !isWithin(resolved, point) || len(point) < len(mount) {
+			continue
+		}
+		// later mounts over the same point shadow earlier ones
+		mount, device = point, fields[sep+2]
+	}
+	if err := scanner.Err(); err != nil {
+		return "", "", fmt.Errorf("could not read mountinfo: %v", err)
+	}
+	if mount == "" {
+		return "", "", fmt.Errorf("mount point of %s is not found", path)
+	}
+	return mount, device, nil
+}
+
+// isWithin reports whether path is located under dir.
+func isWithin(path, dir string) bool {
+	return dir == "/" || path == dir || strings.HasPrefix(path, dir+"/")
+}
+
+func ioctl(fd uintptr, req uint, arg unsafe.Pointer) error {
+	_, _, errno := unix.Syscall(unix.SYS_IOCTL, fd, uintptr(req), uintptr(arg))
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+// Copyright (c) 2018-2019 Sylabs, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fs
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestProjectIDs(t *testing.T) {
+	ids := NewProjectIDs(1000)
+	require.Equal(t, uint32(1000), ids.Allocate())
+	require.Equal(t, uint32(1001), ids.Allocate())
+	require.Equal(t, uint32(1002), ids.Allocate())
+
+	ids.Release(1001)
+	require.Equal(t, uint32(1001), ids.Allocate())
+	require.Equal(t, uint32(1003), ids.Allocate())
+}
+
+func TestMountDevice(t *testing.T) {
+	root, err := ioutil.TempDir("", "")
+	require.NoError(t, err, "could not create temp dir")
+	defer os.RemoveAll(root)
+	root, err = filepath.EvalSymlinks(root)
+	require.NoError(t, err)
+
+	data := filepath.Join(root, "data")
+	dataRun := filepath.Join(data, "run")
+	require.NoError(t, os.MkdirAll(dataRun, 0755))
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "database"), 0755))
+
+	mountInfo := filepath.Join(root, "mountinfo")
+	content := fmt.Sprintf(`18 1 8:1 / / rw,relatime shared:1 - ext4 /dev/sda1 rw
+25 18 8:16 / %[1]s rw,relatime shared:2 - xfs /dev/sdb rw,prjquota
+26 18 8:17 / %[1]s rw,relatime shared:3 - xfs /dev/sdc rw,prjquota
+27 25 0:45 / %[2]s rw,relatime shared:4 - tmpfs tmpfs rw
+`, data, dataRun)
+	require.NoError(t, ioutil.WriteFile(mountInfo, []byte(content), 0644))
+
+	defer func(path string) { mountInfoPath = path }(mountInfoPath)
+	mountInfoPath = mountInfo
+
+	tt := []struct {
+		name         string
+		path         string
+		expectMount  string
+		expectDevice string
+	}{
+		{
+			name:         "shadowed mount",
+			path:         data,
+			expectMount:  data,
+			expectDevice: "/dev/sdc",
+		},
+		{
+			name:         "nested mount",
+			path:         dataRun,
+			expectMount:  dataRun,
+			expectDevice: "tmpfs",
+		},
+		{
+			name:         "similar prefix",
+			path:         filepath.Join(root, "database"),
+			expectMount:  "/",
+			expectDevice: "/dev/sda1",
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			mount, device, err := mountDevice(tc.path)
+			require.NoError(t, err)
+			require.Equal(t, tc.expectMount, mount)
+			require.Equal(t, tc.expectDevice, device)
+		})
+	}
+}
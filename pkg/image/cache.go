@@ -0,0 +1,141 @@
+// Copyright (c) 2018-2019 Sylabs, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package image
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// LayerCache is a node-local cache of OCI blobs that Singularity keeps in OCI
+// layout while building SIF images from docker registries. Builds of images
+// that share layers reuse cached blobs instead of downloading them again.
+// LayerCache is thread safe to use.
+type LayerCache struct {
+	dir     string
+	maxSize int64
+
+	// builds hold read lock so that prune doesn't remove blobs being used
+	mu sync.RWMutex
+}
+
+// layoutFiles are OCI layout metadata files that are never pruned.
+var layoutFiles = map[string]bool{
+	"index.json": true,
+	"oci-layout": true,
+}
+
+// NewLayerCache returns LayerCache located at passed dir, creating it if
+// needed. When maxSize is positive, least recently used blobs are pruned
+// once cache size exceeds it. Otherwise cache grows without limits.
+func NewLayerCache(dir string, maxSize int64) (*LayerCache, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, fmt.Errorf("could not get absolute layer cache path: %v", err)
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("could not create layer cache directory: %v", err)
+	}
+	return &LayerCache{
+		dir:     dir,
+		maxSize: maxSize,
+	}, nil
+}
+
+// Dir returns path to the cache directory.
+func (c *LayerCache) Dir() string {
+	return c.dir
+}
+
+// use marks cache as used by a build until returned func is called.
+func (c *LayerCache) use() func() {
+	c.mu.RLock()
+	return c.mu.RUnlock
+}
+
+type cachedFile struct {
+	path   string
+	size   int64
+	usedAt time.Time
+}
+
+// Prune removes least recently used files from the cache until its size
+// doesn't exceed maximum size. Builds wait for prune to complete.
+func (c *LayerCache) Prune() error {
+	if c.maxSize <= 0 {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var files []cachedFile
+	var total int64
+	err := filepath.Walk(c.dir, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !fi.Mode().IsRegular() || layoutFiles[fi.Name()] {
+			return nil
+		}
+		files = append(files, cachedFile{
+			path:   path,
+			size:   fi.Size(),
+			usedAt: usedAt(fi),
+		})
+		total += fi.Size()
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("could not walk layer cache: %v", err)
+	}
+	if total <= c.maxSize {
+		return nil
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].usedAt.Before(files[j].usedAt)
+	})
+	for _, f := range files {
+		if total <= c.maxSize {
+			break
+		}
+		if err := os.Remove(f.path); err != nil {
+			return fmt.Errorf("could not remove cached file: %v", err)
+		}
+		glog.V(4).Infof("Pruned %s from layer cache", f.path)
+		total -= f.size
+	}
+	return nil
+}
+
+// usedAt returns time file was last used at, i.e. the latest
+// of its access and modification times.
+func usedAt(fi os.FileInfo) time.Time {
+	usedAt := fi.ModTime()
+	if st, ok := fi.Sys().(*syscall.Stat_t); ok {
+		accessedAt := time.Unix(st.Atim.Unix())
+		if accessedAt.After(usedAt) {
+			usedAt = accessedAt
+		}
+	}
+	return usedAt
+}
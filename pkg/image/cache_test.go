@@ -0,0 +1,93 @@
+// Copyright (c) 2018-2019 Sylabs, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package image
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLayerCache_Prune(t *testing.T) {
+	now := time.Now()
+	files := []struct {
+		name   string
+		size   int
+		usedAt time.Time
+	}{
+		{name: "oci/index.json", size: 100, usedAt: now.Add(-time.Hour * 3)},
+		{name: "oci/oci-layout", size: 30, usedAt: now.Add(-time.Hour * 3)},
+		{name: "oci/blobs/sha256/old", size: 400, usedAt: now.Add(-time.Hour * 2)},
+		{name: "oci/blobs/sha256/recent", size: 400, usedAt: now.Add(-time.Hour)},
+		{name: "oci/blobs/sha256/new", size: 400, usedAt: now},
+	}
+
+	tt := []struct {
+		name         string
+		maxSize      int64
+		expectPruned []string
+	}{
+		{
+			name:    "no limit",
+			maxSize: 0,
+		},
+		{
+			name:    "within limit",
+			maxSize: 1400,
+		},
+		{
+			name:         "least recently used",
+			maxSize:      1000,
+			expectPruned: []string{"oci/blobs/sha256/old"},
+		},
+		{
+			name:         "metadata is kept",
+			maxSize:      100,
+			expectPruned: []string{"oci/blobs/sha256/old", "oci/blobs/sha256/recent", "oci/blobs/sha256/new"},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "")
+			require.NoError(t, err, "could not create temp dir")
+			defer os.RemoveAll(dir)
+
+			for _, f := range files {
+				path := filepath.Join(dir, f.name)
+				require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+				require.NoError(t, ioutil.WriteFile(path, make([]byte, f.size), 0644))
+				require.NoError(t, os.Chtimes(path, f.usedAt, f.usedAt))
+			}
+
+			cache, err := NewLayerCache(dir, tc.maxSize)
+			require.NoError(t, err, "could not create layer cache")
+			require.NoError(t, cache.Prune())
+
+			pruned := make(map[string]bool)
+			for _, name := range tc.expectPruned {
+				pruned[name] = true
+			}
+			for _, f := range files {
+				_, err := os.Stat(filepath.Join(dir, f.name))
+				require.Equal(t, pruned[f.name], os.IsNotExist(err), f.name)
+			}
+		})
+	}
+}
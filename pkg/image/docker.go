@@ -0,0 +1,234 @@
+// Copyright (c) 2018-2019 Sylabs, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package image
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/sylabs/singularity-cri/pkg/singularity"
+	k8s "k8s.io/kubernetes/pkg/kubelet/apis/cri/runtime/v1alpha2"
+)
+
+const (
+	// dockerHubRegistry is a registry host of docker hub images.
+	dockerHubRegistry = "registry-1.docker.io"
+
+	// registryTimeout limits duration of a single registry request.
+	registryTimeout = 30 * time.Second
+)
+
+// ErrNotDocker is used when digest of non docker image is requested.
+var ErrNotDocker = fmt.Errorf("not docker image")
+
+// manifestMediaTypes are media types of image manifests that
+// registry may respond with when it is asked for image digest.
+var manifestMediaTypes = []string{
+	"application/vnd.docker.distribution.manifest.list.v2+json",
+	"application/vnd.docker.distribution.manifest.v2+json",
+	"application/vnd.oci.image.index.v1+json",
+	"application/vnd.oci.image.manifest.v1+json",
+}
+
+var registryClient = &http.Client{Timeout: registryTimeout}
+
+// DockerDigest queries docker registry for digest of the image manifest
+// ref tag points to and returns repo digest, e.g. busybox@sha256:<hash>,
+// that image built from it may be found by. For references other than
+// docker ones ErrNotDocker is returned.
+func DockerDigest(ctx context.Context, ref *Reference, auth *k8s.AuthConfig) (string, error) {
+	if ref.URI() != singularity.DockerDomain || len(ref.tags) == 0 {
+		return "", ErrNotDocker
+	}
+	name, tag := splitTag(ref.tags[0])
+
+	remote := name
+	if addr := auth.GetServerAddress(); addr != "" {
+		addr = strings.TrimPrefix(strings.TrimPrefix(addr, "https://"), "http://")
+		remote = fmt.Sprintf("%s/%s", strings.TrimSuffix(addr, "/"), remote)
+	}
+	host, repo := splitDockerName(remote)
+	digest, err := manifestDigest(ctx, "https://"+host, repo, tag, auth)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s@%s", name, digest), nil
+}
+
+// splitTag splits docker image reference into name and tag.
+func splitTag(imgRef string) (string, string) {
+	i := strings.LastIndexByte(imgRef, ':')
+	if i == -1 || i < strings.LastIndexByte(imgRef, '/') {
+		return imgRef, "latest"
+	}
+	return imgRef[:i], imgRef[i+1:]
+}
+
+// splitDockerName splits docker image name into registry host
+// and repository, e.g. busybox into docker hub and library/busybox.
+func splitDockerName(name string) (string, string) {
+	parts := strings.SplitN(name, "/", 2)
+	if len(parts) == 2 && (strings.ContainsAny(parts[0], ".:") || parts[0] == "localhost") {
+		return parts[0], parts[1]
+	}
+	if len(parts) == 1 {
+		return dockerHubRegistry, "library/" + name
+	}
+	return dockerHubRegistry, name
+}
+
+// manifestDigest sends HEAD manifest request to registry at baseURL
+// and returns digest registry reported. Registry token authentication
+// is performed when registry requests it.
+func manifestDigest(ctx context.Context, baseURL, repo, tag string, auth *k8s.AuthConfig) (string, error) {
+	manifestURL := fmt.Sprintf("%s/v2/%s/manifests/%s", baseURL, repo, tag)
+	head := func(authorization string) (*http.Response, error) {
+		req, err := http.NewRequest(http.MethodHead, manifestURL, nil)
+		if err != nil {
+			return nil, fmt.Errorf("could not create request: %v", err)
+		}
+		req = req.WithContext(ctx)
+		req.Header.Set("Accept", strings.Join(manifestMediaTypes, ", "))
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		resp, err := registryClient.Do(req)
+		if err != nil {
+			return nil, fmt.Errorf("could not query manifest: %v", err)
+		}
+		resp.Body.Close()
+		return resp, nil
+	}
+
+	resp, err := head("")
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode == http.StatusUnauthorized {
+		authorization, err := registryAuthorization(ctx, resp.Header.Get("WWW-Authenticate"), auth)
+		if err != nil {
+			return "", err
+		}
+		resp, err = head(authorization)
+		if err != nil {
+			return "", err
+		}
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected manifest response status: %s", resp.Status)
+	}
+	digest := resp.Header.Get("Docker-Content-Digest")
+	if !strings.HasPrefix(digest, "sha256:") {
+		return "", fmt.Errorf("registry didn't report manifest digest")
+	}
+	return digest, nil
+}
+
+// registryAuthorization returns Authorization header value
+// that satisfies passed registry authentication challenge.
+func registryAuthorization(ctx context.Context, challenge string, auth *k8s.AuthConfig) (string, error) {
+	scheme, params := parseChallenge(challenge)
+	switch strings.ToLower(scheme) {
+	case "basic":
+		req, _ := http.NewRequest(http.MethodGet, "/", nil)
+		req.SetBasicAuth(auth.GetUsername(), auth.GetPassword())
+		return req.Header.Get("Authorization"), nil
+	case "bearer":
+	default:
+		return "", fmt.Errorf("unsupported registry authentication scheme %q", scheme)
+	}
+
+	realm, err := url.Parse(params["realm"])
+	if err != nil || realm.Host == "" {
+		return "", fmt.Errorf("invalid registry token realm %q", params["realm"])
+	}
+	query := realm.Query()
+	for _, key := range []string{"service", "scope"} {
+		if params[key] != "" {
+			query.Set(key, params[key])
+		}
+	}
+	realm.RawQuery = query.Encode()
+
+	req, err := http.NewRequest(http.MethodGet, realm.String(), nil)
+	if err != nil {
+		return "", fmt.Errorf("could not create token request: %v", err)
+	}
+	req = req.WithContext(ctx)
+	if auth.GetUsername() != "" {
+		req.SetBasicAuth(auth.GetUsername(), auth.GetPassword())
+	}
+	resp, err := registryClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("could not request registry token: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected token response status: %s", resp.Status)
+	}
+	var token struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return "", fmt.Errorf("could not decode registry token: %v", err)
+	}
+	if token.Token == "" {
+		token.Token = token.AccessToken
+	}
+	return "Bearer " + token.Token, nil
+}
+
+// parseChallenge parses WWW-Authenticate header value, e.g.
+// Bearer realm="https://auth.docker.io/token",service="registry.docker.io".
+func parseChallenge(challenge string) (string, map[string]string) {
+	params := make(map[string]string)
+	parts := strings.SplitN(strings.TrimSpace(challenge), " ", 2)
+	if len(parts) < 2 {
+		return parts[0], params
+	}
+	rest := parts[1]
+	for rest != "" {
+		eq := strings.IndexByte(rest, '=')
+		if eq == -1 {
+			break
+		}
+		key := strings.ToLower(strings.TrimSpace(rest[:eq]))
+		rest = strings.TrimSpace(rest[eq+1:])
+		var value string
+		if strings.HasPrefix(rest, `"`) {
+			end := strings.IndexByte(rest[1:], '"')
+			if end == -1 {
+				value, rest = rest[1:], ""
+			} else {
+				value, rest = rest[1:end+1], rest[end+2:]
+			}
+		} else {
+			end := strings.IndexByte(rest, ',')
+			if end == -1 {
+				end = len(rest)
+			}
+			value, rest = strings.TrimSpace(rest[:end]), rest[end:]
+		}
+		params[key] = value
+		rest = strings.TrimLeft(rest, ", ")
+	}
+	return parts[0], params
+}
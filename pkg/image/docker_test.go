@@ -0,0 +1,128 @@
+// Copyright (c) 2018-2019 Sylabs, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package image
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	k8s "k8s.io/kubernetes/pkg/kubelet/apis/cri/runtime/v1alpha2"
+)
+
+func TestSplitDockerName(t *testing.T) {
+	tt := []struct {
+		name       string
+		expectHost string
+		expectRepo string
+	}{
+		{name: "busybox", expectHost: dockerHubRegistry, expectRepo: "library/busybox"},
+		{name: "sylabs/singularity", expectHost: dockerHubRegistry, expectRepo: "sylabs/singularity"},
+		{name: "gcr.io/google-containers/pause", expectHost: "gcr.io", expectRepo: "google-containers/pause"},
+		{name: "localhost:5000/app", expectHost: "localhost:5000", expectRepo: "app"},
+		{name: "localhost/app", expectHost: "localhost", expectRepo: "app"},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			host, repo := splitDockerName(tc.name)
+			require.Equal(t, tc.expectHost, host)
+			require.Equal(t, tc.expectRepo, repo)
+		})
+	}
+}
+
+func TestParseChallenge(t *testing.T) {
+	scheme, params := parseChallenge(`Bearer realm="https://auth.docker.io/token",service="registry.docker.io",scope="repository:library/busybox:pull"`)
+	require.Equal(t, "Bearer", scheme)
+	require.Equal(t, map[string]string{
+		"realm":   "https://auth.docker.io/token",
+		"service": "registry.docker.io",
+		"scope":   "repository:library/busybox:pull",
+	}, params)
+
+	scheme, params = parseChallenge(`Basic realm=registry`)
+	require.Equal(t, "Basic", scheme)
+	require.Equal(t, map[string]string{"realm": "registry"}, params)
+}
+
+func TestManifestDigest(t *testing.T) {
+	const digest = "sha256:e004c2cc521c95383aebb1fb5893719aa7a8eae2e7a71f316a4410784edb00a9"
+
+	mux := http.NewServeMux()
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		user, pass, _ := r.BasicAuth()
+		if user != "user" || pass != "secret" || r.URL.Query().Get("scope") != "repository:library/busybox:pull" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		fmt.Fprint(w, `{"token":"abc"}`)
+	})
+	mux.HandleFunc("/v2/library/busybox/manifests/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer abc" {
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="test",scope="repository:library/busybox:pull"`, srv.URL))
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.Method != http.MethodHead || r.URL.Path != "/v2/library/busybox/manifests/1.28" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Docker-Content-Digest", digest)
+	})
+
+	tt := []struct {
+		name        string
+		tag         string
+		auth        *k8s.AuthConfig
+		expectError bool
+	}{
+		{
+			name: "authorized",
+			tag:  "1.28",
+			auth: &k8s.AuthConfig{Username: "user", Password: "secret"},
+		},
+		{
+			name:        "invalid credentials",
+			tag:         "1.28",
+			auth:        &k8s.AuthConfig{Username: "user", Password: "wrong"},
+			expectError: true,
+		},
+		{
+			name:        "unknown tag",
+			tag:         "1.29",
+			auth:        &k8s.AuthConfig{Username: "user", Password: "secret"},
+			expectError: true,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			actual, err := manifestDigest(context.Background(), srv.URL, "library/busybox", tc.tag, tc.auth)
+			if tc.expectError {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, digest, actual)
+		})
+	}
+}
@@ -0,0 +1,114 @@
+// Copyright (c) 2018-2019 Sylabs, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package image
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+
+	"github.com/sylabs/sif/pkg/sif"
+	k8s "k8s.io/kubernetes/pkg/kubelet/apis/cri/runtime/v1alpha2"
+)
+
+// maxDownloadRedirects is a number of redirects followed when image is downloaded.
+const maxDownloadRedirects = 10
+
+// downloadClient is used to download SIF images from web servers,
+// downloads are limited by pull request context only.
+var downloadClient = &http.Client{
+	CheckRedirect: checkDownloadRedirect,
+}
+
+// checkDownloadRedirect refuses redirects to anything but https, otherwise
+// image that is not pinned to a checksum would be downloaded unverified.
+func checkDownloadRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= maxDownloadRedirects {
+		return fmt.Errorf("stopped after %d redirects", maxDownloadRedirects)
+	}
+	if req.URL.Scheme != "https" {
+		return fmt.Errorf("refusing redirect to insecure %s://%s", req.URL.Scheme, req.URL.Host)
+	}
+	return nil
+}
+
+// downloadImage downloads SIF image referenced by imgRef, e.g.
+// https://images.example.com/app.sif#sha256=<hash>, to pullPath.
+// Registry token from auth is sent as a bearer token, username and
+// password are sent with basic authentication. When imgRef is pinned
+// to a checksum, downloaded image is checked to match it.
+func downloadImage(ctx context.Context, imgRef string, auth *k8s.AuthConfig, pullPath string) error {
+	imgURL, checksum, err := httpsURL(imgRef)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodGet, imgURL, nil)
+	if err != nil {
+		return fmt.Errorf("could not create request: %v", err)
+	}
+	req = req.WithContext(ctx)
+	switch {
+	case auth.GetRegistryToken() != "":
+		req.Header.Set("Authorization", "Bearer "+auth.GetRegistryToken())
+	case auth.GetUsername() != "":
+		req.SetBasicAuth(auth.GetUsername(), auth.GetPassword())
+	}
+
+	resp, err := downloadClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("could not download image: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected download response status: %s", resp.Status)
+	}
+
+	w, err := os.Create(pullPath)
+	if err != nil {
+		return fmt.Errorf("could not create file to pull image: %v", err)
+	}
+	h := sha256.New()
+	_, err = io.Copy(io.MultiWriter(w, h), resp.Body)
+	_ = w.Close()
+	if err != nil {
+		return fmt.Errorf("could not download image: %v", err)
+	}
+	if sum := fmt.Sprintf("%x", h.Sum(nil)); checksum != "" && sum != checksum {
+		return fmt.Errorf("image checksum %s doesn't match expected %s", sum, checksum)
+	}
+	return checkSIFMagic(pullPath)
+}
+
+// checkSIFMagic makes sure file at path is a SIF image.
+func checkSIFMagic(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("could not open image: %v", err)
+	}
+	defer f.Close()
+
+	header := make([]byte, sif.HdrLaunchLen+sif.HdrMagicLen)
+	if _, err := io.ReadFull(f, header); err != nil {
+		return fmt.Errorf("downloaded file is not SIF image: %v", err)
+	}
+	if !bytes.HasPrefix(header[sif.HdrLaunchLen:], []byte(sif.HdrMagic)) {
+		return fmt.Errorf("downloaded file is not SIF image")
+	}
+	return nil
+}
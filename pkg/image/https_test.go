@@ -0,0 +1,141 @@
+// Copyright (c) 2018-2019 Sylabs, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package image
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/sylabs/sif/pkg/sif"
+	k8s "k8s.io/kubernetes/pkg/kubelet/apis/cri/runtime/v1alpha2"
+)
+
+func TestDownloadImage(t *testing.T) {
+	sifContent := []byte(fmt.Sprintf("%-32s%s\x00 rest of the image", sif.HdrLaunch, sif.HdrMagic))
+	sifChecksum := fmt.Sprintf("%x", sha256.Sum256(sifContent))
+
+	insecureSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(sifContent)
+	}))
+	defer insecureSrv.Close()
+
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/app.sif":
+			w.Write(sifContent)
+		case "/moved.sif":
+			http.Redirect(w, r, "/app.sif", http.StatusFound)
+		case "/insecure.sif":
+			http.Redirect(w, r, insecureSrv.URL+"/app.sif", http.StatusFound)
+		case "/private.sif":
+			if r.Header.Get("Authorization") != "Bearer secret" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			w.Write(sifContent)
+		case "/index.html":
+			w.Write([]byte("<html></html>"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	client := downloadClient
+	downloadClient = &http.Client{
+		Transport:     srv.Client().Transport,
+		CheckRedirect: client.CheckRedirect,
+	}
+	defer func() { downloadClient = client }()
+
+	dir, err := ioutil.TempDir("", "")
+	require.NoError(t, err, "could not create temp dir")
+	defer os.RemoveAll(dir)
+
+	tt := []struct {
+		name        string
+		path        string
+		auth        *k8s.AuthConfig
+		expectError string
+	}{
+		{
+			name: "SIF image",
+			path: "/app.sif",
+		},
+		{
+			name: "pinned SIF image",
+			path: "/app.sif#sha256=" + sifChecksum,
+		},
+		{
+			name:        "checksum mismatch",
+			path:        "/app.sif#sha256=" + strings.Repeat("0", 64),
+			expectError: "doesn't match expected",
+		},
+		{
+			name: "authorized",
+			path: "/private.sif",
+			auth: &k8s.AuthConfig{RegistryToken: "secret"},
+		},
+		{
+			name:        "unauthorized",
+			path:        "/private.sif",
+			expectError: "401 Unauthorized",
+		},
+		{
+			name:        "not SIF image",
+			path:        "/index.html",
+			expectError: "not SIF image",
+		},
+		{
+			name: "redirect",
+			path: "/moved.sif",
+		},
+		{
+			name:        "insecure redirect",
+			path:        "/insecure.sif",
+			expectError: "refusing redirect to insecure http://",
+		},
+		{
+			name:        "not found",
+			path:        "/missing.sif",
+			expectError: "404 Not Found",
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			pullPath := filepath.Join(dir, "image.sif")
+			err := downloadImage(context.Background(), srv.URL+tc.path, tc.auth, pullPath)
+			if tc.expectError != "" {
+				require.Error(t, err)
+				require.Contains(t, err.Error(), tc.expectError)
+				return
+			}
+			require.NoError(t, err)
+			content, err := ioutil.ReadFile(pullPath)
+			require.NoError(t, err)
+			require.Equal(t, sifContent, content)
+		})
+	}
+}
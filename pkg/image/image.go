@@ -18,6 +18,7 @@ import (
 	"bytes"
 	"context"
 	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -28,6 +29,7 @@ import (
 	"runtime"
 	"strings"
 	"sync"
+	"syscall"
 
 	"github.com/golang/glog"
 	specs "github.com/opencontainers/image-spec/specs-go/v1"
@@ -64,28 +66,80 @@ type Info struct {
 	Ref       *Reference         `json:"ref"`
 	OciConfig *specs.ImageConfig `json:"ociConfig,omitempty"`
 
-	mu     sync.RWMutex
-	usedBy []string
+	mu      sync.RWMutex
+	usedBy  []string
+	onUsage func()
 }
 
-// Borrow notifies that image is used by some container and should
-// not be removed until Return with the same parameters is called.
+// jsonInfo is used to encode Info along with its users
+// so that they survive restarts.
+type jsonInfo Info
+
+// MarshalJSON implements json.Marshaler interface.
+func (i *Info) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		*jsonInfo
+		UsedBy []string `json:"usedBy,omitempty"`
+	}{
+		jsonInfo: (*jsonInfo)(i),
+		UsedBy:   i.UsedBy(),
+	})
+}
+
+// UnmarshalJSON implements json.Unmarshaler interface.
+func (i *Info) UnmarshalJSON(data []byte) error {
+	decoded := struct {
+		*jsonInfo
+		UsedBy []string `json:"usedBy,omitempty"`
+	}{
+		jsonInfo: (*jsonInfo)(i),
+	}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return err
+	}
+	i.usedBy = decoded.UsedBy
+	return nil
+}
+
+// OnUsageChange sets func that is called each time list of image users
+// is changed by Borrow or Return. Passing nil removes previously set func.
 // This method is thread-safe to use.
-func (i *Info) Borrow(who string) {
+func (i *Info) OnUsageChange(f func()) {
 	i.mu.Lock()
 	defer i.mu.Unlock()
 
-	i.usedBy = slice.MergeString(i.usedBy, who)
+	i.onUsage = f
+}
+
+// Borrow notifies that image is used by some container and should
+// not be removed until Return with the same parameters is called.
+// This method is thread-safe to use.
+func (i *Info) Borrow(who string) {
+	i.updateUsage(func(usedBy []string) []string {
+		return slice.MergeString(usedBy, who)
+	})
 }
 
 // Return notifies that image is no longer used by a container and
 // may be safely removed if no one else needs it anymore.
 // This method is thread-safe to use.
 func (i *Info) Return(who string) {
-	i.mu.Lock()
-	defer i.mu.Unlock()
+	i.updateUsage(func(usedBy []string) []string {
+		return slice.RemoveFromString(usedBy, who)
+	})
+}
 
-	i.usedBy = slice.RemoveFromString(i.usedBy, who)
+func (i *Info) updateUsage(update func([]string) []string) {
+	i.mu.Lock()
+	n := len(i.usedBy)
+	i.usedBy = update(i.usedBy)
+	changed := len(i.usedBy) != n
+	onUsage := i.onUsage
+	i.mu.Unlock()
+
+	if changed && onUsage != nil {
+		onUsage()
+	}
 }
 
 // UsedBy returns list of container ids that use this image.
@@ -98,8 +152,60 @@ func (i *Info) UsedBy() []string {
 	return usedBy
 }
 
+// PullOption is run before image is pulled and may be used to tune pulling.
+type PullOption func(o *pullOptions)
+
+type pullOptions struct {
+	layerCache     *LayerCache
+	digest         string
+	digestResolved bool
+	scratchDir     string
+	definitionPath string
+}
+
+// WithLayerCache makes images built from docker registries reuse
+// OCI blobs cached in c. When c is nil, blobs are not cached.
+func WithLayerCache(c *LayerCache) PullOption {
+	return func(o *pullOptions) {
+		o.layerCache = c
+	}
+}
+
+// WithScratchDir makes temporary files of pulls and builds be created in dir
+// instead of image storage location, so that partially pulled images never
+// appear there. When dir is on another filesystem, pulled images are copied
+// to storage location. Leftovers of interrupted pulls may be removed from
+// dir with CleanScratchDir.
+func WithScratchDir(dir string) PullOption {
+	return func(o *pullOptions) {
+		o.scratchDir = dir
+	}
+}
+
+// WithDigest sets repo digest, e.g. busybox@sha256:<hash>, that docker image
+// tag was resolved to beforehand. Image is built from that digest rather than
+// from the tag, so that digest recorded in image reference always matches the
+// built image even when the tag is moved during the pull. Empty digest means
+// that it could not be resolved, so image is pulled by tag without another
+// lookup. When this option is not passed, Pull resolves digest on its own.
+func WithDigest(digest string) PullOption {
+	return func(o *pullOptions) {
+		o.digest = digest
+		o.digestResolved = true
+	}
+}
+
+// WithDefinitionPath sets path to Singularity definition file that image
+// referenced as local.def is built from, e.g. the path that was resolved
+// and checked beforehand. When not set, path from reference is used.
+func WithDefinitionPath(path string) PullOption {
+	return func(o *pullOptions) {
+		o.definitionPath = path
+	}
+}
+
 // Pull pulls image referenced by ref and saves it to the passed location.
-func Pull(ctx context.Context, location string, ref *Reference, auth *k8s.AuthConfig) (*Info, error) {
+func Pull(ctx context.Context, location string, ref *Reference, auth *k8s.AuthConfig, opts ...PullOption) (*Info, error) {
 	if ref.URI() == singularity.LocalFileDomain {
 		info, err := sifInfo(strings.TrimPrefix(ref.tags[0], singularity.LocalFileDomain))
 		if err != nil {
@@ -109,15 +215,30 @@ func Pull(ctx context.Context, location string, ref *Reference, auth *k8s.AuthCo
 		return info, nil
 	}
 
-	pullPath := filepath.Join(location, "."+rand.GenerateID(64))
+	var options pullOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	tmpDir := location
+	if options.scratchDir != "" {
+		tmpDir = options.scratchDir
+	}
+	pullPath := filepath.Join(tmpDir, "."+rand.GenerateID(64))
 	glog.V(5).Infof("Pulling %s to temporary file %s", ref, pullPath)
 	cleanup := func() {
 		if err := os.Remove(pullPath); err != nil && !os.IsNotExist(err) {
 			glog.Errorf("Could not remove %s: %v", pullPath, err)
 		}
 	}
-
-	err := pullImage(ctx, ref, auth, pullPath)
+	if ref.URI() == singularity.DockerDomain && !options.digestResolved {
+		digest, err := DockerDigest(ctx, ref, auth)
+		if err != nil && err != ErrNotDocker {
+			glog.Warningf("Could not get %s image digest, pulling by tag: %v", ref, err)
+		}
+		options.digest = digest
+	}
+	err := pullImage(ctx, ref, auth, pullPath, options)
 	if err != nil {
 		cleanup()
 		return nil, fmt.Errorf("could not pull image: %v", err)
@@ -129,8 +250,8 @@ func Pull(ctx context.Context, location string, ref *Reference, auth *k8s.AuthCo
 	}
 
 	path := filepath.Join(location, info.Sha256)
-	glog.V(5).Infof("Renaming %s to %s", pullPath, path)
-	err = os.Rename(pullPath, path)
+	glog.V(5).Infof("Moving %s to %s", pullPath, path)
+	err = moveFile(pullPath, path)
 	if err != nil {
 		cleanup()
 		return nil, fmt.Errorf("could not save pulled image: %v", err)
@@ -138,9 +259,75 @@ func Pull(ctx context.Context, location string, ref *Reference, auth *k8s.AuthCo
 
 	info.Path = path
 	info.Ref = ref
+	if options.digest != "" {
+		info.Ref.AddDigests([]string{options.digest})
+	}
 	return info, nil
 }
 
+// CleanScratchDir removes leftovers of interrupted pulls from
+// dir passed to WithScratchDir. Other files in dir are kept.
+func CleanScratchDir(dir string) error {
+	fii, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("could not read scratch directory: %v", err)
+	}
+	for _, fi := range fii {
+		if !isPullTemp(fi.Name()) {
+			continue
+		}
+		path := filepath.Join(dir, fi.Name())
+		glog.V(2).Infof("Removing leftover %s of interrupted pull", path)
+		if err := os.RemoveAll(path); err != nil {
+			return fmt.Errorf("could not remove %s: %v", path, err)
+		}
+	}
+	return nil
+}
+
+// isPullTemp checks whether file with passed name is a temporary
+// file created by Pull, i.e. its name is a dot followed by random ID.
+func isPullTemp(name string) bool {
+	if len(name) < 65 || name[0] != '.' {
+		return false
+	}
+	_, err := hex.DecodeString(name[1:65])
+	return err == nil
+}
+
+// moveFile renames src to dst. When they are located on different
+// filesystems, src is copied next to dst first and then renamed,
+// so that incomplete dst never appears.
+func moveFile(src, dst string) error {
+	err := os.Rename(src, dst)
+	if linkErr, ok := err.(*os.LinkError); !ok || linkErr.Err != syscall.EXDEV {
+		return err
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	tmp := filepath.Join(filepath.Dir(dst), filepath.Base(src))
+	out, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(out, in)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp, dst)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Remove(src)
+}
+
 // LibraryInfo queries remote library to get info about the image.
 // If image is not found returns ErrNotFound. For references other than
 // library returns ErrNotLibrary.
@@ -201,7 +388,9 @@ func (i *Info) Remove() error {
 
 // Verify verifies image signatures.
 func (i *Info) Verify() error {
-	if i.Ref.URI() == singularity.DockerDomain {
+	switch i.Ref.URI() {
+	case singularity.DockerDomain, singularity.LocalOCIDomain, singularity.LocalDefinitionDomain:
+		// images built by sycri itself are never signed
 		return nil
 	}
 
@@ -238,7 +427,7 @@ func (i *Info) Matches(filter *k8s.ImageFilter) bool {
 	return false
 }
 
-func pullImage(ctx context.Context, ref *Reference, auth *k8s.AuthConfig, pullPath string) error {
+func pullImage(ctx context.Context, ref *Reference, auth *k8s.AuthConfig, pullPath string, options pullOptions) error {
 	pullURL := strings.TrimPrefix(ref.String(), ref.URI()+"/")
 	switch ref.URI() {
 	case singularity.LibraryDomain:
@@ -262,31 +451,92 @@ func pullImage(ctx context.Context, ref *Reference, auth *k8s.AuthConfig, pullPa
 			return fmt.Errorf("could not pull library image: %v", err)
 		}
 	case singularity.DockerDomain:
-		var errMsg bytes.Buffer
+		if options.digest != "" {
+			pullURL = options.digest
+		}
 		if auth.GetServerAddress() != "" {
 			pullURL = fmt.Sprintf("%s/%s", auth.GetServerAddress(), pullURL)
 		}
 		remote := fmt.Sprintf("%s://%s", singularity.DockerProtocol, pullURL)
-		buildCmd := exec.CommandContext(ctx, singularity.RuntimeName, "build", "-F", pullPath, remote)
-		buildCmd.Env = []string{
-			fmt.Sprintf("PATH=%s", os.Getenv("PATH")),
+		return buildImage(ctx, remote, pullPath, options,
 			// assume auth.Auth is not needed b/c k8s decodes it into username and password,
 			// see https://github.com/kubernetes/kubernetes/blob/master/pkg/credentialprovider/config.go#L284
 			fmt.Sprintf("%s=%s", singularity.EnvDockerUsername, auth.GetUsername()),
 			fmt.Sprintf("%s=%s", singularity.EnvDockerPassword, auth.GetPassword()),
+		)
+	case singularity.LocalDefinitionDomain:
+		path := options.definitionPath
+		if path == "" {
+			path = ref.DefinitionPath()
 		}
-		buildCmd.Stderr = &errMsg
-		buildCmd.Stdout = ioutil.Discard
-		err := buildCmd.Run()
-		if err != nil {
-			return fmt.Errorf("could not build image: %s", &errMsg)
+		return buildImage(ctx, path, pullPath, options)
+	case singularity.HTTPSScheme:
+		return downloadImage(ctx, ref.String(), auth, pullPath)
+	case singularity.LocalOCIDomain:
+		path, tag := ociLayoutPath(ref.String())
+		if _, err := os.Stat(filepath.Join(path, "oci-layout")); err != nil {
+			return fmt.Errorf("could not find OCI layout: %v", err)
 		}
+		source := fmt.Sprintf("%s:%s", singularity.OCILayoutScheme, path)
+		if tag != "" {
+			source += ":" + tag
+		}
+		return buildImage(ctx, source, pullPath, options)
 	default:
 		return fmt.Errorf("unknown image registry: %s", ref.URI())
 	}
 	return nil
 }
 
+// buildImage builds SIF image at pullPath from passed build source, e.g.
+// docker://busybox, passing env to Singularity along with PATH.
+func buildImage(ctx context.Context, source, pullPath string, options pullOptions, env ...string) error {
+	var errMsg bytes.Buffer
+	build := singularity.Command("build", "-F", pullPath, source)
+	buildCmd := exec.CommandContext(ctx, build[0], build[1:]...)
+	buildCmd.Env = append([]string{fmt.Sprintf("PATH=%s", os.Getenv("PATH"))}, env...)
+	if cache := options.layerCache; cache != nil {
+		defer cache.use()()
+		buildCmd.Env = append(buildCmd.Env, fmt.Sprintf("%s=%s", singularity.EnvCacheDir, cache.Dir()))
+	}
+	if options.scratchDir != "" {
+		tmpDir := pullPath + ".build"
+		if err := os.Mkdir(tmpDir, 0700); err != nil {
+			return fmt.Errorf("could not create build directory: %v", err)
+		}
+		defer os.RemoveAll(tmpDir)
+		buildCmd.Env = append(buildCmd.Env, fmt.Sprintf("%s=%s", singularity.EnvTmpDir, tmpDir))
+	}
+	buildCmd.Stderr = &errMsg
+	buildCmd.Stdout = ioutil.Discard
+	err := buildCmd.Run()
+	if err != nil {
+		return fmt.Errorf("could not build image: %s", &errMsg)
+	}
+	return nil
+}
+
+// ReadInfo reads info of SIF image located at sifPath, e.g. the one that is
+// found in storage directory but is not registered. Since image origin
+// is unknown, returned info has reference without tags and digests.
+func ReadInfo(sifPath string) (*Info, error) {
+	img, err := image.Init(sifPath, false)
+	if err != nil {
+		return nil, fmt.Errorf("could not load image: %v", err)
+	}
+	img.File.Close()
+	if img.Type != image.SIF {
+		return nil, fmt.Errorf("not a SIF image")
+	}
+
+	info, err := sifInfo(sifPath)
+	if err != nil {
+		return nil, err
+	}
+	info.Ref = &Reference{}
+	return info, nil
+}
+
 func sifInfo(sifPath string) (*Info, error) {
 	sif, err := os.Open(sifPath)
 	if err != nil {
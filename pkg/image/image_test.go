@@ -205,6 +205,32 @@ func TestPullImage(t *testing.T) {
 	}
 }
 
+func TestCleanScratchDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	require.NoError(t, err, "could not create temp dir")
+	defer os.RemoveAll(dir)
+
+	pullTemp := ".3c2fa3d0f3b8d5b4d9ba5cfe1ee0b4f24f0e2b0c9f87b7d87b0ed1ab7c2f6a55"
+	files := map[string]bool{
+		pullTemp:                          false,
+		"unrelated":                       true,
+		".hidden":                         true,
+		".3c2fa3d0f3b8d5b4d9ba5cfe1ee0b4": true,
+	}
+	for name := range files {
+		require.NoError(t, ioutil.WriteFile(filepath.Join(dir, name), nil, 0644))
+	}
+	buildDir := filepath.Join(dir, pullTemp+".build")
+	require.NoError(t, os.MkdirAll(filepath.Join(buildDir, "rootfs"), 0755))
+	files[pullTemp+".build"] = false
+
+	require.NoError(t, CleanScratchDir(dir))
+	for name, kept := range files {
+		_, err := os.Stat(filepath.Join(dir, name))
+		require.Equal(t, kept, err == nil, "unexpected state of %s", name)
+	}
+}
+
 func TestLibraryInfo(t *testing.T) {
 	tt := []struct {
 		name        string
@@ -409,6 +435,26 @@ func TestInfo_BorrowReturn(t *testing.T) {
 	}
 }
 
+func TestInfo_OnUsageChange(t *testing.T) {
+	var image Info
+	var changes int
+	image.OnUsageChange(func() {
+		changes++
+	})
+
+	image.Borrow("first_container")
+	image.Borrow("first_container")
+	image.Borrow("second_container")
+	image.Return("third_container")
+	image.Return("first_container")
+	require.Equal(t, 3, changes)
+
+	image.OnUsageChange(nil)
+	image.Return("second_container")
+	require.Equal(t, 3, changes)
+	require.Empty(t, image.UsedBy())
+}
+
 func TestInfo_Remove(t *testing.T) {
 	f, err := ioutil.TempFile("", "")
 	require.NoError(t, err, "could not create temp image file")
@@ -584,7 +630,8 @@ func TestInfo_UnmarshalJSON(t *testing.T) {
 						"User":"sasha",
 						"WorkingDir":"/opt/go",
 						"Cmd":["./my-server"]
-					}
+					},
+					"usedBy":["first_container","second_container"]
 				}`,
 			expect: &Info{
 				ID:     "0d408f32cc56b16509f30ae3dfa56ffb01269b2100036991d49af645a7b717a0",
@@ -600,6 +647,7 @@ func TestInfo_UnmarshalJSON(t *testing.T) {
 					Cmd:        []string{"./my-server"},
 					WorkingDir: "/opt/go",
 				},
+				usedBy: []string{"first_container", "second_container"},
 			},
 		},
 		{
@@ -661,7 +709,7 @@ func TestInfo_MarshalJSON(t *testing.T) {
 					Cmd:        []string{"./my-server"},
 					WorkingDir: "/opt/go",
 				},
-				usedBy: []string{"should-not-marshal"},
+				usedBy: []string{"first_container"},
 			},
 			expect: `
 				{
@@ -678,7 +726,8 @@ func TestInfo_MarshalJSON(t *testing.T) {
 						"User":"sasha",
 						"WorkingDir":"/opt/go",
 						"Cmd":["./my-server"]
-					}
+					},
+					"usedBy":["first_container"]
 				}`,
 		},
 		{
@@ -692,7 +741,6 @@ func TestInfo_MarshalJSON(t *testing.T) {
 					uri:  singularity.DockerDomain,
 					tags: []string{"busybox:1.28"},
 				},
-				usedBy: []string{"should-not-marshal"},
 			},
 			expect: `
 				{
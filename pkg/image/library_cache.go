@@ -0,0 +1,109 @@
+// Copyright (c) 2018-2019 Sylabs, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package image
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/sylabs/singularity-cri/pkg/singularity"
+	k8s "k8s.io/kubernetes/pkg/kubelet/apis/cri/runtime/v1alpha2"
+)
+
+// LibraryCache caches library image metadata returned by LibraryInfo so
+// that the library is not queried on every pull of the same image. When
+// the library cannot be reached, expired metadata is still used for one
+// more ttl, which lets pulls survive short network blips.
+type LibraryCache struct {
+	ttl   time.Duration
+	fetch func(ctx context.Context, ref *Reference, auth *k8s.AuthConfig) (*Info, error)
+
+	mu      sync.Mutex
+	entries map[string]libraryEntry
+}
+
+type libraryEntry struct {
+	id        string
+	size      uint64
+	fetchedAt time.Time
+}
+
+// NewLibraryCache returns new LibraryCache that keeps
+// library image metadata for ttl.
+func NewLibraryCache(ttl time.Duration) *LibraryCache {
+	return &LibraryCache{
+		ttl:     ttl,
+		fetch:   LibraryInfo,
+		entries: make(map[string]libraryEntry),
+	}
+}
+
+// Info returns info about library image just like LibraryInfo does
+// except that cached metadata is used when it is available.
+func (c *LibraryCache) Info(ctx context.Context, ref *Reference, auth *k8s.AuthConfig) (*Info, error) {
+	if ref.URI() != singularity.LibraryDomain {
+		return nil, ErrNotLibrary
+	}
+
+	key := auth.GetServerAddress() + "|" + ref.String()
+	c.mu.Lock()
+	entry, ok := c.entries[key]
+	c.mu.Unlock()
+	age := time.Since(entry.fetchedAt)
+	if ok && age < c.ttl {
+		return entry.info(ref), nil
+	}
+
+	info, err := c.fetch(ctx, ref, auth)
+	if err == ErrNotFound {
+		c.mu.Lock()
+		delete(c.entries, key)
+		c.mu.Unlock()
+		return nil, err
+	}
+	if err != nil {
+		if ok && age < 2*c.ttl {
+			glog.Warningf("Could not get %s image metadata, using cached one: %v", ref, err)
+			return entry.info(ref), nil
+		}
+		return nil, err
+	}
+
+	now := time.Now()
+	c.mu.Lock()
+	for k, e := range c.entries {
+		if now.Sub(e.fetchedAt) >= 2*c.ttl {
+			delete(c.entries, k)
+		}
+	}
+	c.entries[key] = libraryEntry{
+		id:        info.ID,
+		size:      info.Size,
+		fetchedAt: now,
+	}
+	c.mu.Unlock()
+	return info, nil
+}
+
+func (e libraryEntry) info(ref *Reference) *Info {
+	return &Info{
+		ID:     e.id,
+		Sha256: e.id,
+		Size:   e.size,
+		Ref:    ref,
+	}
+}
@@ -0,0 +1,113 @@
+// Copyright (c) 2018-2019 Sylabs, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package image
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/sylabs/singularity-cri/pkg/singularity"
+	k8s "k8s.io/kubernetes/pkg/kubelet/apis/cri/runtime/v1alpha2"
+)
+
+func TestLibraryCache_Info(t *testing.T) {
+	const id = "8b5478b0f2962eba3982be245986eb0ea54f5164d90a65c078af5b83147009ba"
+	ref := &Reference{
+		uri:  singularity.LibraryDomain,
+		tags: []string{"cloud.sylabs.io/sylabs/tests/busybox:1.0.0"},
+	}
+	expectInfo := &Info{
+		ID:     id,
+		Sha256: id,
+		Size:   672699,
+		Ref:    ref,
+	}
+
+	tt := []struct {
+		name        string
+		fetchedAgo  time.Duration
+		fetchErr    error
+		expectFetch bool
+		expectInfo  *Info
+		expectError error
+	}{
+		{
+			name:        "fresh entry",
+			fetchedAgo:  time.Second,
+			expectInfo:  expectInfo,
+			expectFetch: false,
+		},
+		{
+			name:        "expired entry",
+			fetchedAgo:  time.Minute + time.Second,
+			expectInfo:  expectInfo,
+			expectFetch: true,
+		},
+		{
+			name:        "expired entry during network failure",
+			fetchedAgo:  time.Minute + time.Second,
+			fetchErr:    fmt.Errorf("network is unreachable"),
+			expectInfo:  expectInfo,
+			expectFetch: true,
+		},
+		{
+			name:        "stale entry during network failure",
+			fetchedAgo:  2*time.Minute + time.Second,
+			fetchErr:    fmt.Errorf("network is unreachable"),
+			expectError: fmt.Errorf("network is unreachable"),
+			expectFetch: true,
+		},
+		{
+			name:        "removed image",
+			fetchedAgo:  time.Minute + time.Second,
+			fetchErr:    ErrNotFound,
+			expectError: ErrNotFound,
+			expectFetch: true,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			var fetched bool
+			c := NewLibraryCache(time.Minute)
+			c.fetch = func(_ context.Context, ref *Reference, _ *k8s.AuthConfig) (*Info, error) {
+				fetched = true
+				if tc.fetchErr != nil {
+					return nil, tc.fetchErr
+				}
+				return &Info{ID: id, Sha256: id, Size: 672699, Ref: ref}, nil
+			}
+			c.entries["|"+ref.String()] = libraryEntry{
+				id:        id,
+				size:      672699,
+				fetchedAt: time.Now().Add(-tc.fetchedAgo),
+			}
+
+			info, err := c.Info(context.Background(), ref, nil)
+			require.Equal(t, tc.expectError, err)
+			require.Equal(t, tc.expectInfo, info)
+			require.Equal(t, tc.expectFetch, fetched)
+		})
+	}
+
+	t.Run("not library", func(t *testing.T) {
+		c := NewLibraryCache(time.Minute)
+		_, err := c.Info(context.Background(), &Reference{uri: singularity.DockerDomain}, nil)
+		require.Equal(t, ErrNotLibrary, err)
+	})
+}
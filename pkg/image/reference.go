@@ -15,7 +15,12 @@
 package image
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"fmt"
+	"net/url"
+	"path/filepath"
 	"strings"
 	"sync"
 
@@ -33,12 +38,16 @@ type Reference struct {
 }
 
 // String returns first tag or digest found with origin domain as a prefix.
+// Reference without tags and digests is represented with an empty string.
 func (r *Reference) String() string {
 	var ref string
-	if len(r.tags) > 0 {
+	switch {
+	case len(r.tags) > 0:
 		ref = r.tags[0]
-	} else {
+	case len(r.digests) > 0:
 		ref = r.digests[0]
+	default:
+		return ""
 	}
 	if r.uri == singularity.DockerDomain {
 		ref = singularity.DockerDomain + "/" + ref
@@ -83,6 +92,28 @@ func ParseRef(imgRef string) (*Reference, error) {
 			tags: []string{imgRef},
 		}, nil
 	}
+	if strings.HasPrefix(imgRef, singularity.LocalDefinitionDomain+"/") {
+		return &Reference{
+			uri:  singularity.LocalDefinitionDomain,
+			tags: []string{imgRef},
+		}, nil
+	}
+	if isOCILayoutRef(imgRef) {
+		return &Reference{
+			uri:  singularity.LocalOCIDomain,
+			tags: []string{imgRef},
+		}, nil
+	}
+
+	if isHTTPSRef(imgRef) {
+		if _, _, err := httpsURL(imgRef); err != nil {
+			return nil, err
+		}
+		return &Reference{
+			uri:  singularity.HTTPSScheme,
+			tags: []string{imgRef},
+		}, nil
+	}
 
 	uri := singularity.DockerDomain
 	if strings.HasPrefix(imgRef, singularity.LibraryDomain) {
@@ -165,9 +196,17 @@ func (r *Reference) RemoveTag(tag string) {
 // does not have any tag or digest already. It also trims
 // default docker domain prefix if present.
 func NormalizedImageRef(imgRef string) string {
+	if isOCILayoutRef(imgRef) {
+		// layout without tag is expected to hold a single image
+		return imgRef
+	}
+	if isHTTPSRef(imgRef) {
+		return imgRef
+	}
 	imgRef = strings.TrimPrefix(imgRef, singularity.DockerDomain+"/")
 	i := strings.LastIndexByte(imgRef, ':')
-	if strings.HasPrefix(imgRef, singularity.LocalFileDomain) {
+	if strings.HasPrefix(imgRef, singularity.LocalFileDomain) ||
+		strings.HasPrefix(imgRef, singularity.LocalDefinitionDomain+"/") {
 		if i == -1 {
 			return imgRef
 		}
@@ -179,3 +218,71 @@ func NormalizedImageRef(imgRef string) string {
 	}
 	return imgRef
 }
+
+// DefinitionPath returns path to Singularity definition file that image
+// built on the node is referenced with, e.g. /srv/recipes/app.def for
+// local.def/srv/recipes/app.def. For other references empty string is returned.
+func (r *Reference) DefinitionPath() string {
+	if r.URI() != singularity.LocalDefinitionDomain || len(r.tags) == 0 {
+		return ""
+	}
+	return strings.TrimPrefix(r.tags[0], singularity.LocalDefinitionDomain)
+}
+
+// isOCILayoutRef checks whether imgRef references local OCI image layout.
+func isOCILayoutRef(imgRef string) bool {
+	return strings.HasPrefix(imgRef, singularity.LocalOCIDomain+"/")
+}
+
+// ociLayoutPath splits reference of local OCI image layout, e.g.
+// local.oci/srv/images/busybox:1.30, into layout directory and optional tag.
+func ociLayoutPath(imgRef string) (string, string) {
+	path := strings.TrimPrefix(imgRef, singularity.LocalOCIDomain)
+	var tag string
+	if i := strings.LastIndexByte(path, ':'); i > strings.LastIndexByte(path, '/') {
+		path, tag = path[:i], path[i+1:]
+	}
+	return filepath.Clean(path), tag
+}
+
+// Checksum returns sha256 checksum that SIF image downloaded from a web server
+// is pinned to, e.g. <hash> for https://images.example.com/app.sif#sha256=<hash>.
+// For other references and references without checksum empty string is returned.
+func (r *Reference) Checksum() string {
+	if r.URI() != singularity.HTTPSScheme || len(r.tags) == 0 {
+		return ""
+	}
+	_, checksum, _ := httpsURL(r.tags[0])
+	return checksum
+}
+
+// isHTTPSRef checks whether imgRef references SIF image on a web server.
+func isHTTPSRef(imgRef string) bool {
+	return strings.HasPrefix(imgRef, singularity.HTTPSScheme+"://")
+}
+
+// httpsURL splits reference of SIF image on a web server, e.g.
+// https://images.example.com/app.sif#sha256=<hash>, into URL
+// to download image from and optional sha256 checksum.
+func httpsURL(imgRef string) (string, string, error) {
+	u, err := url.Parse(imgRef)
+	if err != nil {
+		return "", "", fmt.Errorf("could not parse image URL: %v", err)
+	}
+	if u.Host == "" {
+		return "", "", fmt.Errorf("image URL %q has no host", imgRef)
+	}
+	checksum := u.Fragment
+	u.Fragment = ""
+	if checksum == "" {
+		return u.String(), "", nil
+	}
+	if !strings.HasPrefix(checksum, "sha256=") {
+		return "", "", fmt.Errorf("unsupported image checksum %q, only sha256 is supported", checksum)
+	}
+	checksum = strings.ToLower(strings.TrimPrefix(checksum, "sha256="))
+	if _, err := hex.DecodeString(checksum); err != nil || len(checksum) != sha256.Size*2 {
+		return "", "", fmt.Errorf("invalid sha256 checksum %q", checksum)
+	}
+	return u.String(), checksum, nil
+}
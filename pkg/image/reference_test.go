@@ -15,6 +15,7 @@
 package image
 
 import (
+	"fmt"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -97,6 +98,63 @@ func TestParseImageRef(t *testing.T) {
 			},
 			expectError: nil,
 		},
+		{
+			name: "local definition file",
+			ref:  "local.def/srv/recipes/app.def:latest",
+			expect: &Reference{
+				uri:  singularity.LocalDefinitionDomain,
+				tags: []string{"local.def/srv/recipes/app.def"},
+			},
+			expectError: nil,
+		},
+		{
+			name: "OCI layout with tag",
+			ref:  "local.oci/srv/images/busybox:1.30",
+			expect: &Reference{
+				uri:  singularity.LocalOCIDomain,
+				tags: []string{"local.oci/srv/images/busybox:1.30"},
+			},
+			expectError: nil,
+		},
+		{
+			name: "OCI layout without tag",
+			ref:  "local.oci/srv/images/busybox",
+			expect: &Reference{
+				uri:  singularity.LocalOCIDomain,
+				tags: []string{"local.oci/srv/images/busybox"},
+			},
+			expectError: nil,
+		},
+		{
+			name: "web server SIF",
+			ref:  "https://images.example.com/app.sif",
+			expect: &Reference{
+				uri:  singularity.HTTPSScheme,
+				tags: []string{"https://images.example.com/app.sif"},
+			},
+			expectError: nil,
+		},
+		{
+			name: "web server SIF with checksum",
+			ref:  "https://images.example.com/app.sif#sha256=9327532a05078d7efd5a0ef9ace1ee5cd278653d8df53590e2fb7a4a34cb0bb8",
+			expect: &Reference{
+				uri:  singularity.HTTPSScheme,
+				tags: []string{"https://images.example.com/app.sif#sha256=9327532a05078d7efd5a0ef9ace1ee5cd278653d8df53590e2fb7a4a34cb0bb8"},
+			},
+			expectError: nil,
+		},
+		{
+			name:        "web server SIF with md5 checksum",
+			ref:         "https://images.example.com/app.sif#md5=d41d8cd98f00b204e9800998ecf8427e",
+			expect:      nil,
+			expectError: fmt.Errorf(`unsupported image checksum "md5=d41d8cd98f00b204e9800998ecf8427e", only sha256 is supported`),
+		},
+		{
+			name:        "web server SIF with short checksum",
+			ref:         "https://images.example.com/app.sif#sha256=9327532a",
+			expect:      nil,
+			expectError: fmt.Errorf(`invalid sha256 checksum "9327532a"`),
+		},
 	}
 
 	for _, tc := range tt {
@@ -159,6 +217,11 @@ func TestNormalizedImageRef(t *testing.T) {
 			ref:    "local.file/home/sasha/my.sif:latest",
 			expect: "local.file/home/sasha/my.sif",
 		},
+		{
+			name:   "OCI layout without tag",
+			ref:    "local.oci/srv/images/busybox",
+			expect: "local.oci/srv/images/busybox",
+		},
 	}
 
 	for _, tc := range tt {
@@ -231,3 +294,67 @@ func TestReferenceTags(t *testing.T) {
 	}, ref.Tags())
 
 }
+
+func TestReferenceDefinitionPath(t *testing.T) {
+	tt := []struct {
+		name   string
+		ref    string
+		expect string
+	}{
+		{
+			name:   "local definition file",
+			ref:    "local.def/srv/recipes/app.def",
+			expect: "/srv/recipes/app.def",
+		},
+		{
+			name:   "docker image",
+			ref:    "busybox",
+			expect: "",
+		},
+		{
+			name:   "local SIF",
+			ref:    "local.file/srv/images/app.sif",
+			expect: "",
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			ref, err := ParseRef(tc.ref)
+			require.NoError(t, err)
+			require.Equal(t, tc.expect, ref.DefinitionPath())
+		})
+	}
+}
+
+func TestReferenceChecksum(t *testing.T) {
+	tt := []struct {
+		name   string
+		ref    string
+		expect string
+	}{
+		{
+			name:   "web server SIF with checksum",
+			ref:    "https://images.example.com/app.sif#sha256=9327532A05078D7EFD5A0EF9ACE1EE5CD278653D8DF53590E2FB7A4A34CB0BB8",
+			expect: "9327532a05078d7efd5a0ef9ace1ee5cd278653d8df53590e2fb7a4a34cb0bb8",
+		},
+		{
+			name:   "web server SIF without checksum",
+			ref:    "https://images.example.com/app.sif",
+			expect: "",
+		},
+		{
+			name:   "docker image",
+			ref:    "busybox",
+			expect: "",
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			ref, err := ParseRef(tc.ref)
+			require.NoError(t, err)
+			require.Equal(t, tc.expect, ref.Checksum())
+		})
+	}
+}
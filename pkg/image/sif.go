@@ -0,0 +1,115 @@
+// Copyright (c) 2018-2019 Sylabs, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package image
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sylabs/sif/pkg/sif"
+)
+
+// SIFMetadata describes contents of SIF image, e.g. to debug
+// images built for a wrong architecture.
+type SIFMetadata struct {
+	// Arch is an architecture primary partition is built for, e.g. amd64.
+	Arch string `json:"arch"`
+	// CreatedAt is a time image was created at.
+	CreatedAt time.Time `json:"createdAt"`
+	// Partitions are file system partitions found in image.
+	Partitions []SIFPartition `json:"partitions"`
+	// Signatures are fingerprints of keys image is signed with.
+	Signatures []string `json:"signatures"`
+}
+
+// SIFPartition describes SIF file system partition.
+type SIFPartition struct {
+	ID     uint32 `json:"id"`
+	Name   string `json:"name"`
+	Type   string `json:"type"`
+	FsType string `json:"fsType"`
+	Arch   string `json:"arch"`
+	Size   int64  `json:"size"`
+}
+
+var (
+	sifPartTypes = map[sif.Parttype]string{
+		sif.PartSystem:  "system",
+		sif.PartPrimSys: "primary system",
+		sif.PartData:    "data",
+		sif.PartOverlay: "overlay",
+	}
+	sifFsTypes = map[sif.Fstype]string{
+		sif.FsSquash:            "squashfs",
+		sif.FsExt3:              "ext3",
+		sif.FsImmuObj:           "archive",
+		sif.FsRaw:               "raw",
+		sif.FsEncryptedSquashfs: "encrypted squashfs",
+	}
+)
+
+// ReadSIFMetadata reads metadata of SIF image located at sifPath.
+func ReadSIFMetadata(sifPath string) (*SIFMetadata, error) {
+	fimg, err := sif.LoadContainer(sifPath, true)
+	if err != nil {
+		return nil, fmt.Errorf("could not load SIF image: %v", err)
+	}
+	defer fimg.UnloadContainer()
+
+	meta := SIFMetadata{
+		Arch:       sifArch(fimg.Header.Arch),
+		CreatedAt:  time.Unix(fimg.Header.Ctime, 0).UTC(),
+		Partitions: []SIFPartition{},
+		Signatures: []string{},
+	}
+	signatures := make(map[string]bool)
+	for _, descr := range fimg.DescrArr {
+		if !descr.Used {
+			continue
+		}
+		switch descr.Datatype {
+		case sif.DataPartition:
+			part := SIFPartition{
+				ID:   descr.ID,
+				Name: descr.GetName(),
+				Size: descr.Filelen,
+			}
+			if fsType, err := descr.GetFsType(); err == nil {
+				part.FsType = sifFsTypes[fsType]
+			}
+			if partType, err := descr.GetPartType(); err == nil {
+				part.Type = sifPartTypes[partType]
+			}
+			if arch, err := descr.GetArch(); err == nil {
+				part.Arch = sifArch(arch)
+			}
+			meta.Partitions = append(meta.Partitions, part)
+		case sif.DataSignature:
+			fingerprint, err := descr.GetEntityString()
+			if err != nil || signatures[fingerprint] {
+				continue
+			}
+			signatures[fingerprint] = true
+			meta.Signatures = append(meta.Signatures, fingerprint)
+		}
+	}
+	return &meta, nil
+}
+
+// sifArch converts SIF architecture code into GOARCH.
+func sifArch(code [sif.HdrArchLen]byte) string {
+	return sif.GetGoArch(strings.TrimRight(string(code[:]), "\x00"))
+}
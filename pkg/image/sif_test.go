@@ -0,0 +1,78 @@
+// Copyright (c) 2018-2019 Sylabs, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package image
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/sylabs/sif/pkg/sif"
+)
+
+func TestReadSIFMetadata(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	require.NoError(t, err, "could not create temp dir")
+	defer os.RemoveAll(dir)
+	sifPath := filepath.Join(dir, "image.sif")
+
+	const fingerprint = "8883491F4268F173C6E5DC49EDECE4F3F38D871E"
+	rootfs := sif.DescriptorInput{
+		Datatype: sif.DataPartition,
+		Groupid:  sif.DescrDefaultGroup,
+		Link:     sif.DescrUnusedLink,
+		Fname:    "rootfs.squashfs",
+		Data:     []byte("squashfs"),
+		Size:     8,
+	}
+	require.NoError(t, rootfs.SetPartExtra(sif.FsSquash, sif.PartPrimSys, sif.HdrArchARM64))
+	signature := sif.DescriptorInput{
+		Datatype: sif.DataSignature,
+		Groupid:  sif.DescrUnusedGroup,
+		Link:     1,
+		Fname:    "signature",
+		Data:     []byte("signature"),
+		Size:     9,
+	}
+	require.NoError(t, signature.SetSignExtra(sif.HashSHA384, fingerprint))
+	_, err = sif.CreateContainer(sif.CreateInfo{
+		Pathname:   sifPath,
+		Launchstr:  sif.HdrLaunch,
+		Sifversion: sif.HdrVersion,
+		InputDescr: []sif.DescriptorInput{rootfs, signature},
+	})
+	require.NoError(t, err, "could not create SIF image")
+
+	meta, err := ReadSIFMetadata(sifPath)
+	require.NoError(t, err, "could not read SIF metadata")
+	require.Equal(t, "arm64", meta.Arch)
+	require.False(t, meta.CreatedAt.IsZero())
+	require.Equal(t, []SIFPartition{
+		{
+			ID:     1,
+			Name:   "rootfs.squashfs",
+			Type:   "primary system",
+			FsType: "squashfs",
+			Arch:   "arm64",
+			Size:   8,
+		},
+	}, meta.Partitions)
+	require.Equal(t, []string{fingerprint}, meta.Signatures)
+
+	_, err = ReadSIFMetadata(filepath.Join(dir, "missing.sif"))
+	require.Error(t, err)
+}
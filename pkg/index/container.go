@@ -23,7 +23,10 @@ import (
 
 // ContainerIndex provides a convenient and thread-safe way for storing containers.
 type ContainerIndex struct {
-	indx *truncindex.TruncIndex
+	indx   *truncindex.TruncIndex
+	labels labelIndex
+
+	watchers watchers
 }
 
 // NewContainerIndex returns new ContainerIndex ready to use.
@@ -49,6 +52,7 @@ func (i *ContainerIndex) Find(id string) (*kube.Container, error) {
 
 // Remove removes container from index if it present or does nothing otherwise.
 func (i *ContainerIndex) Remove(id string) error {
+	item, _ := i.indx.Get(id)
 	err := i.indx.Delete(id)
 	if err == truncindex.ErrNotFound {
 		return nil
@@ -56,6 +60,10 @@ func (i *ContainerIndex) Remove(id string) error {
 	if err != nil {
 		return fmt.Errorf("could not remove container: %v", err)
 	}
+	if cont, ok := item.(*kube.Container); ok {
+		i.labels.remove(cont.ID(), cont.GetLabels())
+		i.watchers.notify(ContainerEvent{Type: EventRemove, Container: cont})
+	}
 	return nil
 }
 
@@ -65,6 +73,8 @@ func (i *ContainerIndex) Add(cont *kube.Container) error {
 	if err != nil {
 		return fmt.Errorf("could not add container: %v", err)
 	}
+	i.labels.add(cont.ID(), cont.GetLabels(), cont)
+	i.watchers.notify(ContainerEvent{Type: EventAdd, Container: cont})
 	return nil
 }
 
@@ -75,3 +85,15 @@ func (i *ContainerIndex) Iterate(handler func(*kube.Container)) {
 	}
 	i.indx.Iterate(innerIterate)
 }
+
+// IterateByLabels calls handler func on each container registered in index that
+// has all labels from selector. When selector is empty, all containers are iterated.
+func (i *ContainerIndex) IterateByLabels(selector map[string]string, handler func(*kube.Container)) {
+	if len(selector) == 0 {
+		i.Iterate(handler)
+		return
+	}
+	for _, item := range i.labels.match(selector) {
+		handler(item.(*kube.Container))
+	}
+}
@@ -28,6 +28,8 @@ type ImageIndex struct {
 
 	mu      sync.RWMutex
 	refToID map[string]string
+
+	watchers watchers
 }
 
 // NewImageIndex returns new ImageIndex ready to use.
@@ -61,9 +63,44 @@ func (i *ImageIndex) Add(image *image.Info) error {
 		return fmt.Errorf("could not find old image: %v", err)
 	}
 	if err == ErrNotFound {
-		return i.add(image)
+		if err := i.add(image); err != nil {
+			return err
+		}
+		i.watchers.notify(ImageEvent{Type: EventAdd, Image: image})
+		return nil
+	}
+	if err := i.merge(oldImage, image); err != nil {
+		return err
+	}
+	i.watchers.notify(ImageEvent{Type: EventUpdate, Image: oldImage})
+	return nil
+}
+
+// Replace adds the given image info to the index. Unlike Add, existing image
+// with the same ID is replaced entirely instead of merging references, so
+// the index holds exactly the passed info, including its users.
+func (i *ImageIndex) Replace(image *image.Info) error {
+	oldImage, err := i.find(image.ID)
+	if err != nil && err != ErrNotFound {
+		return fmt.Errorf("could not find old image: %v", err)
+	}
+	if oldImage != nil {
+		if err := i.indx.Delete(oldImage.ID); err != nil {
+			return fmt.Errorf("could not remove old image: %v", err)
+		}
+		i.removeRefs(oldImage.Ref.Tags()...)
+		i.removeRefs(oldImage.Ref.Digests()...)
+		oldImage.OnUsageChange(nil)
+	}
+	if err := i.add(image); err != nil {
+		return err
 	}
-	return i.merge(oldImage, image)
+	event := ImageEvent{Type: EventAdd, Image: image}
+	if oldImage != nil {
+		event.Type = EventUpdate
+	}
+	i.watchers.notify(event)
+	return nil
 }
 
 // Remove removes pod from index if it present or returns otherwise.
@@ -79,6 +116,8 @@ func (i *ImageIndex) Remove(id string) error {
 
 	i.removeRefs(imgInfo.Ref.Tags()...)
 	i.removeRefs(imgInfo.Ref.Digests()...)
+	imgInfo.OnUsageChange(nil)
+	i.watchers.notify(ImageEvent{Type: EventRemove, Image: imgInfo})
 	return nil
 }
 
@@ -116,6 +155,9 @@ func (i *ImageIndex) add(image *image.Info) error {
 	for _, digest := range image.Ref.Digests() {
 		i.setRef(digest, image.ID)
 	}
+	image.OnUsageChange(func() {
+		i.watchers.notify(ImageEvent{Type: EventUpdate, Image: image})
+	})
 	return nil
 }
 
@@ -127,16 +169,18 @@ func (i *ImageIndex) merge(oldImage, image *image.Info) error {
 		oldID := i.readRef(tag)
 		i.setRef(tag, image.ID)
 		if oldID != "" && oldID != image.ID {
-			oldInfo, _ := i.Find(image.ID)
-			oldInfo.Ref.RemoveTag(tag)
+			if oldInfo, err := i.find(oldID); err == nil {
+				oldInfo.Ref.RemoveTag(tag)
+			}
 		}
 	}
 	for _, digest := range image.Ref.Digests() {
 		oldID := i.readRef(digest)
 		i.setRef(digest, image.ID)
-		if oldID != "" && oldID == image.ID {
-			oldInfo, _ := i.Find(image.ID)
-			oldInfo.Ref.RemoveDigest(digest)
+		if oldID != "" && oldID != image.ID {
+			if oldInfo, err := i.find(oldID); err == nil {
+				oldInfo.Ref.RemoveDigest(digest)
+			}
 		}
 	}
 	return nil
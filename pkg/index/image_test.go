@@ -24,6 +24,39 @@ import (
 func TestImageIndex(t *testing.T) {
 	t.Run("smoke test", SmokeTestImageIndex)
 	t.Run("advanced test", AdvancedTestImageIndex)
+	t.Run("replace test", ReplaceTestImageIndex)
+}
+
+func ReplaceTestImageIndex(t *testing.T) {
+	indx := NewImageIndex()
+
+	ref, err := image.ParseRef("library://library/default/busybox:1.29")
+	require.NoError(t, err, "could not parse busybox ref")
+	busybox := &image.Info{
+		ID:  "busybox",
+		Ref: ref,
+	}
+	require.NoError(t, indx.Add(busybox))
+
+	ref, err = image.ParseRef("library://library/default/busybox:latest")
+	require.NoError(t, err, "could not parse busybox ref")
+	replaced := &image.Info{
+		ID:  "busybox",
+		Ref: ref,
+	}
+	replaced.Borrow("container1")
+	require.NoError(t, indx.Replace(replaced))
+
+	found, err := indx.Find(busybox.ID)
+	require.NoError(t, err, "index returned unexpected error")
+	require.Equal(t, []string{"container1"}, found.UsedBy())
+	require.ElementsMatch(t, replaced.Ref.Tags(), found.Ref.Tags())
+
+	_, err = indx.Find("library://library/default/busybox:1.29")
+	require.Equal(t, ErrNotFound, err, "old tag is still in index")
+	found, err = indx.Find("library://library/default/busybox:latest")
+	require.NoError(t, err, "index returned unexpected error")
+	require.Equal(t, busybox.ID, found.ID)
 }
 
 func SmokeTestImageIndex(t *testing.T) {
@@ -109,33 +142,27 @@ func SmokeTestImageIndex(t *testing.T) {
 		err := indx.Add(alpine2)
 		require.NoError(t, err)
 
-		alpine.Ref.AddDigests([]string{"library://library/default/alpine:sha256.somefakesha"})
-		err = indx.Add(alpine)
-		require.EqualError(t, err,
-			"could not find old image: could not search index: multiple items found for provided prefix: alpine",
-			"index updated image even when ambiguous")
-
-		found, err := indx.Find(alpine.ID)
-		require.EqualError(t, err, "could not search index: multiple items found for provided prefix: alpine",
-			"index didn't error on ambiguous image id")
+		found, err := indx.Find("alp")
+		require.EqualError(t, err, "could not search index: multiple items found for provided prefix: alp",
+			"index didn't error on ambiguous image id prefix")
 		require.Nil(t, found, "index returned wrong image")
 
-		err = indx.Remove(alpine.ID)
-		require.EqualError(t, err, "could not search index: multiple items found for provided prefix: alpine",
-			"index didn't error on ambiguous image id")
-
-		err = indx.Remove(alpine2.Ref.Tags()[0])
-		require.NoError(t, err, "could not remove ambiguous image from index")
-
 		alpine.Ref.AddDigests([]string{"library://library/default/alpine:sha256.somefakesha"})
 		err = indx.Add(alpine)
-		require.NoError(t, err, "could not update image after ambiguous removed")
+		require.NoError(t, err, "could not update image that prefixes another one")
 
 		found, err = indx.Find(alpine.ID)
 		require.NoError(t, err, "index returned unexpected error")
 		require.Equal(t, found.ID, alpine.ID, "index returned wrong image")
 		require.ElementsMatch(t, found.Ref.Tags(), alpine.Ref.Tags(), "index returned wrong image")
 		require.ElementsMatch(t, found.Ref.Digests(), alpine.Ref.Digests(), "index returned wrong image")
+
+		err = indx.Remove(alpine.ID)
+		require.NoError(t, err, "could not remove image that prefixes another one")
+
+		found, err = indx.Find(alpine2.ID)
+		require.NoError(t, err, "index returned unexpected error")
+		require.Equal(t, found.ID, alpine2.ID, "index returned wrong image")
 	})
 
 }
@@ -199,4 +226,22 @@ func AdvancedTestImageIndex(t *testing.T) {
 		})
 		require.Equal(t, 2, count)
 	})
+
+	t.Run("merge moved tag", func(t *testing.T) {
+		ref, err := image.ParseRef("library://library/default/busybox:latest")
+		require.NoError(t, err, "could not parse busybox ref")
+		err = indx.Add(&image.Info{
+			ID:  busybox.ID,
+			Ref: ref,
+		})
+		require.NoError(t, err)
+
+		found, err := indx.Find("library://library/default/busybox:latest")
+		require.NoError(t, err, "index returned unexpected error")
+		require.Equal(t, busybox.ID, found.ID, "index returned wrong image")
+
+		found, err = indx.Find(busyboxNew.ID)
+		require.NoError(t, err, "index returned unexpected error")
+		require.Empty(t, found.Ref.Tags(), "tag was not removed from old image")
+	})
 }
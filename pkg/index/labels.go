@@ -0,0 +1,105 @@
+// Copyright (c) 2018-2019 Sylabs, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package index
+
+import (
+	"sort"
+	"sync"
+)
+
+// labelIndex is a secondary index that maps label key-value
+// pairs to items that have them, so that items matching label
+// selector are found without scanning all of them.
+type labelIndex struct {
+	mu    sync.RWMutex
+	pairs map[string]map[string]interface{}
+}
+
+func labelPair(key, value string) string {
+	return key + "=" + value
+}
+
+// add adds item with passed ID and labels to the index.
+func (l *labelIndex) add(id string, labels map[string]string, item interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.pairs == nil {
+		l.pairs = make(map[string]map[string]interface{})
+	}
+	for key, value := range labels {
+		pair := labelPair(key, value)
+		items, ok := l.pairs[pair]
+		if !ok {
+			items = make(map[string]interface{})
+			l.pairs[pair] = items
+		}
+		items[id] = item
+	}
+}
+
+// remove removes item with passed ID and labels from the index.
+func (l *labelIndex) remove(id string, labels map[string]string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for key, value := range labels {
+		pair := labelPair(key, value)
+		delete(l.pairs[pair], id)
+		if len(l.pairs[pair]) == 0 {
+			delete(l.pairs, pair)
+		}
+	}
+}
+
+// match returns items that have all labels from selector ordered by ID.
+// Selector must not be empty.
+func (l *labelIndex) match(selector map[string]string) []interface{} {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	// start with the least popular pair to check as few items as possible
+	var smallest map[string]interface{}
+	for key, value := range selector {
+		items := l.pairs[labelPair(key, value)]
+		if len(items) == 0 {
+			return nil
+		}
+		if smallest == nil || len(items) < len(smallest) {
+			smallest = items
+		}
+	}
+
+	var ids []string
+	for id := range smallest {
+		matches := true
+		for key, value := range selector {
+			if _, ok := l.pairs[labelPair(key, value)][id]; !ok {
+				matches = false
+				break
+			}
+		}
+		if matches {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+
+	items := make([]interface{}, len(ids))
+	for i, id := range ids {
+		items[i] = smallest[id]
+	}
+	return items
+}
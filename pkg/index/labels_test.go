@@ -0,0 +1,126 @@
+// Copyright (c) 2018-2019 Sylabs, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package index
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/sylabs/singularity-cri/pkg/image"
+	"github.com/sylabs/singularity-cri/pkg/kube"
+	k8s "k8s.io/kubernetes/pkg/kubelet/apis/cri/runtime/v1alpha2"
+)
+
+func TestLabelIndex(t *testing.T) {
+	var l labelIndex
+	l.add("a", map[string]string{"app": "nginx", "tier": "web"}, "a")
+	l.add("b", map[string]string{"app": "nginx", "tier": "cache"}, "b")
+	l.add("c", map[string]string{"app": "redis", "tier": "cache"}, "c")
+	l.add("d", nil, "d")
+
+	tt := []struct {
+		name     string
+		selector map[string]string
+		expect   []interface{}
+	}{
+		{
+			name:     "single label",
+			selector: map[string]string{"app": "nginx"},
+			expect:   []interface{}{"a", "b"},
+		},
+		{
+			name:     "multiple labels",
+			selector: map[string]string{"app": "nginx", "tier": "cache"},
+			expect:   []interface{}{"b"},
+		},
+		{
+			name:     "unknown value",
+			selector: map[string]string{"app": "mysql"},
+			expect:   nil,
+		},
+		{
+			name:     "no common items",
+			selector: map[string]string{"app": "redis", "tier": "web"},
+			expect:   []interface{}{},
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			actual := l.match(tc.selector)
+			if len(tc.expect) == 0 {
+				require.Empty(t, actual)
+				return
+			}
+			require.Equal(t, tc.expect, actual)
+		})
+	}
+
+	l.remove("b", map[string]string{"app": "nginx", "tier": "cache"})
+	require.Equal(t, []interface{}{"a"}, l.match(map[string]string{"app": "nginx"}))
+	require.Equal(t, []interface{}{"c"}, l.match(map[string]string{"tier": "cache"}))
+	l.remove("a", map[string]string{"app": "nginx", "tier": "web"})
+	_, ok := l.pairs["app=nginx"]
+	require.False(t, ok, "empty label pair is kept")
+}
+
+func TestContainerIndex_IterateByLabels(t *testing.T) {
+	indx := NewContainerIndex()
+	nginx := kube.NewContainer(&k8s.ContainerConfig{
+		Labels: map[string]string{"app": "nginx"},
+	}, nil, &image.Info{}, "")
+	redis := kube.NewContainer(&k8s.ContainerConfig{
+		Labels: map[string]string{"app": "redis"},
+	}, nil, &image.Info{}, "")
+	require.NoError(t, indx.Add(nginx))
+	require.NoError(t, indx.Add(redis))
+
+	collect := func(selector map[string]string) []string {
+		var ids []string
+		indx.IterateByLabels(selector, func(cont *kube.Container) {
+			ids = append(ids, cont.ID())
+		})
+		return ids
+	}
+	require.ElementsMatch(t, []string{nginx.ID(), redis.ID()}, collect(nil))
+	require.Equal(t, []string{nginx.ID()}, collect(map[string]string{"app": "nginx"}))
+
+	require.NoError(t, indx.Remove(nginx.ID()))
+	require.Empty(t, collect(map[string]string{"app": "nginx"}))
+}
+
+func TestPodIndex_IterateByLabels(t *testing.T) {
+	indx := NewPodIndex()
+	nginx := kube.NewPod(&k8s.PodSandboxConfig{
+		Labels: map[string]string{"app": "nginx"},
+	})
+	redis := kube.NewPod(&k8s.PodSandboxConfig{
+		Labels: map[string]string{"app": "redis"},
+	})
+	require.NoError(t, indx.Add(nginx))
+	require.NoError(t, indx.Add(redis))
+
+	collect := func(selector map[string]string) []string {
+		var ids []string
+		indx.IterateByLabels(selector, func(pod *kube.Pod) {
+			ids = append(ids, pod.ID())
+		})
+		return ids
+	}
+	require.ElementsMatch(t, []string{nginx.ID(), redis.ID()}, collect(nil))
+	require.Equal(t, []string{redis.ID()}, collect(map[string]string{"app": "redis"}))
+
+	require.NoError(t, indx.Remove(redis.ID()))
+	require.Empty(t, collect(map[string]string{"app": "redis"}))
+}
@@ -0,0 +1,79 @@
+// Copyright (c) 2018-2019 Sylabs, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package index
+
+import (
+	"strings"
+
+	"github.com/sylabs/singularity-cri/pkg/image"
+	"github.com/sylabs/singularity-cri/pkg/kube"
+	"github.com/sylabs/singularity-cri/pkg/metrics"
+)
+
+// Metrics returns metrics that report number and total size
+// of indexed images partitioned by registry images are pulled from.
+func (i *ImageIndex) Metrics() []metrics.Collector {
+	count := func(add func(float64, ...string)) {
+		i.Iterate(func(info *image.Info) {
+			add(1, info.Ref.URI())
+		})
+	}
+	size := func(add func(float64, ...string)) {
+		i.Iterate(func(info *image.Info) {
+			add(float64(info.Size), info.Ref.URI())
+		})
+	}
+	return []metrics.Collector{
+		metrics.NewGaugeVecFunc("sycri_index_images",
+			"Number of images in the image index.", count, "registry"),
+		metrics.NewGaugeVecFunc("sycri_index_images_size_bytes",
+			"Total size of images in the image index.", size, "registry"),
+	}
+}
+
+// Metrics returns metrics that report number of indexed pods
+// partitioned by their last known state.
+func (i *PodIndex) Metrics() []metrics.Collector {
+	count := func(add func(float64, ...string)) {
+		i.Iterate(func(pod *kube.Pod) {
+			add(1, stateLabel(pod.State().String(), "SANDBOX_"))
+		})
+	}
+	return []metrics.Collector{
+		metrics.NewGaugeVecFunc("sycri_index_pods",
+			"Number of pods in the pod index.", count, "state"),
+	}
+}
+
+// Metrics returns metrics that report number of indexed containers
+// partitioned by their last known state, so that exited containers
+// that are not removed yet are visible.
+func (i *ContainerIndex) Metrics() []metrics.Collector {
+	count := func(add func(float64, ...string)) {
+		i.Iterate(func(cont *kube.Container) {
+			add(1, stateLabel(cont.State().String(), "CONTAINER_"))
+		})
+	}
+	return []metrics.Collector{
+		metrics.NewGaugeVecFunc("sycri_index_containers",
+			"Number of containers in the container index.", count, "state"),
+	}
+}
+
+// stateLabel converts k8s state enum name into a metric label value,
+// e.g. CONTAINER_EXITED becomes exited.
+func stateLabel(state, prefix string) string {
+	return strings.ToLower(strings.TrimPrefix(state, prefix))
+}
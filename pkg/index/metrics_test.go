@@ -0,0 +1,68 @@
+// Copyright (c) 2018-2019 Sylabs, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package index
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/sylabs/singularity-cri/pkg/image"
+	"github.com/sylabs/singularity-cri/pkg/kube"
+	"github.com/sylabs/singularity-cri/pkg/metrics"
+)
+
+func TestIndexMetrics(t *testing.T) {
+	images := NewImageIndex()
+	for _, tc := range []struct {
+		id   string
+		ref  string
+		size uint64
+	}{
+		{id: "busybox", ref: "cloud.sylabs.io/library/default/busybox:1.29", size: 100},
+		{id: "alpine", ref: "cloud.sylabs.io/library/default/alpine:3.8", size: 50},
+		{id: "nginx", ref: "nginx:latest", size: 200},
+	} {
+		ref, err := image.ParseRef(tc.ref)
+		require.NoError(t, err, "could not parse %s ref", tc.id)
+		require.NoError(t, images.Add(&image.Info{ID: tc.id, Ref: ref, Size: tc.size}))
+	}
+
+	containers := NewContainerIndex()
+	require.NoError(t, containers.Add(kube.NewContainer(nil, nil, &image.Info{}, "")))
+	require.NoError(t, containers.Add(kube.NewContainer(nil, nil, &image.Info{}, "")))
+
+	r := metrics.NewRegistry()
+	r.Register(images.Metrics()...)
+	r.Register(NewPodIndex().Metrics()...)
+	r.Register(containers.Metrics()...)
+
+	var buf bytes.Buffer
+	require.NoError(t, r.Write(&buf))
+	require.Equal(t, `# HELP sycri_index_containers Number of containers in the container index.
+# TYPE sycri_index_containers gauge
+sycri_index_containers{state="unknown"} 2
+# HELP sycri_index_images Number of images in the image index.
+# TYPE sycri_index_images gauge
+sycri_index_images{registry="cloud.sylabs.io"} 2
+sycri_index_images{registry="docker.io"} 1
+# HELP sycri_index_images_size_bytes Total size of images in the image index.
+# TYPE sycri_index_images_size_bytes gauge
+sycri_index_images_size_bytes{registry="cloud.sylabs.io"} 150
+sycri_index_images_size_bytes{registry="docker.io"} 200
+# HELP sycri_index_pods Number of pods in the pod index.
+# TYPE sycri_index_pods gauge
+`, buf.String())
+}
@@ -23,7 +23,8 @@ import (
 
 // PodIndex provides a convenient and thread-safe way for storing pods.
 type PodIndex struct {
-	indx *truncindex.TruncIndex
+	indx   *truncindex.TruncIndex
+	labels labelIndex
 }
 
 var (
@@ -54,6 +55,7 @@ func (i *PodIndex) Find(id string) (*kube.Pod, error) {
 
 // Remove removes pod from index if it present or returns otherwise.
 func (i *PodIndex) Remove(id string) error {
+	item, _ := i.indx.Get(id)
 	err := i.indx.Delete(id)
 	if err == truncindex.ErrNotFound {
 		return nil
@@ -61,6 +63,9 @@ func (i *PodIndex) Remove(id string) error {
 	if err != nil {
 		return fmt.Errorf("could not remove pod: %v", err)
 	}
+	if pod, ok := item.(*kube.Pod); ok {
+		i.labels.remove(pod.ID(), pod.GetLabels())
+	}
 	return nil
 }
 
@@ -70,6 +75,7 @@ func (i *PodIndex) Add(pod *kube.Pod) error {
 	if err != nil {
 		return fmt.Errorf("could not add pod: %v", err)
 	}
+	i.labels.add(pod.ID(), pod.GetLabels(), pod)
 	return nil
 }
 
@@ -80,3 +86,15 @@ func (i *PodIndex) Iterate(handler func(*kube.Pod)) {
 	}
 	i.indx.Iterate(innerIterate)
 }
+
+// IterateByLabels calls handler func on each pod registered in index that
+// has all labels from selector. When selector is empty, all pods are iterated.
+func (i *PodIndex) IterateByLabels(selector map[string]string, handler func(*kube.Pod)) {
+	if len(selector) == 0 {
+		i.Iterate(handler)
+		return
+	}
+	for _, item := range i.labels.match(selector) {
+		handler(item.(*kube.Pod))
+	}
+}
@@ -0,0 +1,128 @@
+// Copyright (c) 2018-2019 Sylabs, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package index
+
+import (
+	"sync"
+
+	"github.com/sylabs/singularity-cri/pkg/image"
+	"github.com/sylabs/singularity-cri/pkg/kube"
+)
+
+// EventType describes how index has changed.
+type EventType int
+
+const (
+	// EventAdd means a new item is added to index.
+	EventAdd EventType = iota
+	// EventUpdate means an item that is already indexed is updated,
+	// e.g. image is pulled once again with a new tag or its users change.
+	EventUpdate
+	// EventRemove means an item is removed from index.
+	EventRemove
+)
+
+// String returns a human readable representation of an EventType.
+func (t EventType) String() string {
+	switch t {
+	case EventAdd:
+		return "add"
+	case EventUpdate:
+		return "update"
+	case EventRemove:
+		return "remove"
+	}
+	return "unknown"
+}
+
+// ImageEvent describes a change of ImageIndex.
+type ImageEvent struct {
+	Type  EventType
+	Image *image.Info
+}
+
+// ContainerEvent describes a change of ContainerIndex.
+type ContainerEvent struct {
+	Type      EventType
+	Container *kube.Container
+}
+
+// watchers delivers events to subscribers of an index.
+type watchers struct {
+	mu   sync.Mutex
+	next int
+	subs map[int]func(event interface{})
+}
+
+// add subscribes send func to index events. Returned func unsubscribes it
+// and calls done, after which send is never called again.
+func (w *watchers) add(send func(event interface{}), done func()) func() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.subs == nil {
+		w.subs = make(map[int]func(event interface{}))
+	}
+	id := w.next
+	w.next++
+	w.subs[id] = send
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			w.mu.Lock()
+			defer w.mu.Unlock()
+			delete(w.subs, id)
+			done()
+		})
+	}
+}
+
+// notify sends event to all subscribers. Events are delivered
+// in the same order notify is called.
+func (w *watchers) notify(event interface{}) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for _, send := range w.subs {
+		send(event)
+	}
+}
+
+// Watch subscribes to changes of the index. Events are delivered through
+// returned channel with passed buffer size until returned cancel func is
+// called, which also closes the channel. Subscribers should receive events
+// promptly since index changes block while the channel is full.
+func (i *ImageIndex) Watch(buffer int) (<-chan ImageEvent, func()) {
+	events := make(chan ImageEvent, buffer)
+	cancel := i.watchers.add(func(event interface{}) {
+		events <- event.(ImageEvent)
+	}, func() {
+		close(events)
+	})
+	return events, cancel
+}
+
+// Watch subscribes to changes of the index. Events are delivered through
+// returned channel with passed buffer size until returned cancel func is
+// called, which also closes the channel. Subscribers should receive events
+// promptly since index changes block while the channel is full.
+func (i *ContainerIndex) Watch(buffer int) (<-chan ContainerEvent, func()) {
+	events := make(chan ContainerEvent, buffer)
+	cancel := i.watchers.add(func(event interface{}) {
+		events <- event.(ContainerEvent)
+	}, func() {
+		close(events)
+	})
+	return events, cancel
+}
@@ -0,0 +1,82 @@
+// Copyright (c) 2018-2019 Sylabs, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package index
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/sylabs/singularity-cri/pkg/image"
+	"github.com/sylabs/singularity-cri/pkg/kube"
+)
+
+func TestImageIndex_Watch(t *testing.T) {
+	indx := NewImageIndex()
+	events, cancel := indx.Watch(10)
+
+	ref, err := image.ParseRef("library://library/default/busybox:1.29")
+	require.NoError(t, err, "could not parse busybox ref")
+	busybox := &image.Info{
+		ID:  "busybox",
+		Ref: ref,
+	}
+	ref, err = image.ParseRef("library://library/default/busybox:latest")
+	require.NoError(t, err, "could not parse busybox ref")
+	busyboxLatest := &image.Info{
+		ID:  "busybox",
+		Ref: ref,
+	}
+
+	require.NoError(t, indx.Add(busybox))
+	require.NoError(t, indx.Add(busyboxLatest))
+	busybox.Borrow("container")
+	require.NoError(t, indx.Remove(busybox.ID))
+	busybox.Return("container")
+	cancel()
+	cancel()
+
+	var actual []EventType
+	for event := range events {
+		require.Equal(t, busybox.ID, event.Image.ID)
+		actual = append(actual, event.Type)
+	}
+	require.Equal(t, []EventType{EventAdd, EventUpdate, EventUpdate, EventRemove}, actual)
+
+	require.NoError(t, indx.Add(busybox), "cancelled watch should not block index")
+}
+
+func TestContainerIndex_Watch(t *testing.T) {
+	indx := NewContainerIndex()
+	events, cancel := indx.Watch(10)
+
+	busybox := kube.NewContainer(nil, nil, &image.Info{}, "")
+	nginx := kube.NewContainer(nil, nil, &image.Info{}, "")
+
+	require.NoError(t, indx.Add(busybox))
+	require.NoError(t, indx.Add(nginx))
+	require.NoError(t, indx.Remove(busybox.ID()))
+	cancel()
+
+	tt := []ContainerEvent{
+		{Type: EventAdd, Container: busybox},
+		{Type: EventAdd, Container: nginx},
+		{Type: EventRemove, Container: busybox},
+	}
+	var actual []ContainerEvent
+	for event := range events {
+		actual = append(actual, event)
+	}
+	require.Equal(t, tt, actual)
+}
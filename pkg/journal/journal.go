@@ -0,0 +1,268 @@
+// Copyright (c) 2018-2019 Sylabs, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package journal implements crash-safe persistence of indices. Changes are
+// appended to a write-ahead log that is periodically compacted into a snapshot
+// file replaced with an atomic rename, so that a crash at any moment leaves
+// either the old or the new state on disk, but never a corrupted one.
+package journal
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/golang/glog"
+)
+
+const (
+	// OpPut is an operation that adds or updates an entry.
+	OpPut = "put"
+	// OpDelete is an operation that removes an entry.
+	OpDelete = "delete"
+
+	// DefaultCompactAfter is a default number of journal records
+	// after which journal is compacted into snapshot.
+	DefaultCompactAfter = 100
+
+	// logSuffix is appended to snapshot path to get journal path.
+	logSuffix = ".wal"
+)
+
+// Record is a single change written to the journal.
+type Record struct {
+	Op   string          `json:"op"`
+	Key  string          `json:"key"`
+	Data json.RawMessage `json:"data,omitempty"`
+}
+
+// Journal persists entries of an index. Snapshot file holds a stream of
+// JSON encoded entries, which makes it compatible with plain dumps of indices,
+// and journal file next to it holds changes made after the snapshot was taken.
+// Journal is thread safe to use.
+type Journal struct {
+	path         string
+	compactAfter int
+
+	mu      sync.Mutex
+	log     *os.File
+	records int
+}
+
+// Option is run during Journal initialization and may be
+// used to tune journal's behaviour.
+type Option func(j *Journal)
+
+// WithCompactAfter sets number of journal records after which Append
+// reports that journal should be compacted. When n is not positive,
+// DefaultCompactAfter is used.
+func WithCompactAfter(n int) Option {
+	return func(j *Journal) {
+		if n > 0 {
+			j.compactAfter = n
+		}
+	}
+}
+
+// Open opens journal with snapshot at path creating missing files.
+func Open(path string, opts ...Option) (*Journal, error) {
+	j := &Journal{
+		path:         path,
+		compactAfter: DefaultCompactAfter,
+	}
+	for _, opt := range opts {
+		opt(j)
+	}
+
+	var err error
+	j.log, err = os.OpenFile(path+logSuffix, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("could not open journal: %v", err)
+	}
+	return j, nil
+}
+
+// Replay reads snapshot and journal and calls apply for each entry of
+// the snapshot followed by each record of the journal. Snapshot entries are
+// passed as put records with an empty key. Incomplete record at the end of
+// the journal, e.g. written during a crash, is discarded.
+func (j *Journal) Replay(apply func(Record) error) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	snapshot, err := os.Open(j.path)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("could not open snapshot: %v", err)
+	}
+	if err == nil {
+		defer snapshot.Close()
+		dec := json.NewDecoder(snapshot)
+		for dec.More() {
+			var data json.RawMessage
+			if err := dec.Decode(&data); err != nil {
+				return fmt.Errorf("could not decode snapshot: %v", err)
+			}
+			if err := apply(Record{Op: OpPut, Data: data}); err != nil {
+				return err
+			}
+		}
+	}
+
+	if _, err := j.log.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("could not seek journal: %v", err)
+	}
+	var valid int64
+	j.records = 0
+	reader := bufio.NewReader(j.log)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			if len(line) != 0 {
+				glog.Warningf("Discarding incomplete record at the end of journal %s", j.log.Name())
+			}
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("could not read journal: %v", err)
+		}
+		var rec Record
+		if err := json.Unmarshal(line, &rec); err != nil {
+			return fmt.Errorf("could not decode journal record: %v", err)
+		}
+		if err := apply(rec); err != nil {
+			return err
+		}
+		valid += int64(len(line))
+		j.records++
+	}
+	if err := j.log.Truncate(valid); err != nil {
+		return fmt.Errorf("could not truncate journal: %v", err)
+	}
+	return nil
+}
+
+// Append writes record to the journal and syncs it to disk. It returns
+// true when journal has grown enough to be compacted.
+func (j *Journal) Append(op, key string, v interface{}) (bool, error) {
+	rec := Record{
+		Op:  op,
+		Key: key,
+	}
+	if v != nil {
+		data, err := json.Marshal(v)
+		if err != nil {
+			return false, fmt.Errorf("could not encode %s: %v", key, err)
+		}
+		rec.Data = data
+	}
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return false, fmt.Errorf("could not encode record: %v", err)
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if _, err := j.log.Write(append(line, '\n')); err != nil {
+		return false, fmt.Errorf("could not write journal: %v", err)
+	}
+	if err := j.log.Sync(); err != nil {
+		return false, fmt.Errorf("could not sync journal: %v", err)
+	}
+	j.records++
+	return j.records >= j.compactAfter, nil
+}
+
+// Compact writes entries passed by iterate to a new snapshot that atomically
+// replaces the old one and empties the journal. Entries are written by calling
+// put func passed to iterate. Records are not appended until compaction is over,
+// so changes that are not seen by iterate are never lost.
+func (j *Journal) Compact(iterate func(put func(v interface{}))) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	var buf bytes.Buffer
+	var encodeErr error
+	enc := json.NewEncoder(&buf)
+	iterate(func(v interface{}) {
+		if err := enc.Encode(v); err != nil && encodeErr == nil {
+			encodeErr = err
+		}
+	})
+	if encodeErr != nil {
+		return fmt.Errorf("could not encode snapshot: %v", encodeErr)
+	}
+	if err := writeFileAtomic(j.path, buf.Bytes()); err != nil {
+		return fmt.Errorf("could not write snapshot: %v", err)
+	}
+	// journal records left after a crash at this point are
+	// applied once again on replay, which should be idempotent
+	if err := j.log.Truncate(0); err != nil {
+		return fmt.Errorf("could not truncate journal: %v", err)
+	}
+	if err := j.log.Sync(); err != nil {
+		return fmt.Errorf("could not sync journal: %v", err)
+	}
+	j.records = 0
+	return nil
+}
+
+// Close closes journal file.
+func (j *Journal) Close() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.log.Close()
+}
+
+// writeFileAtomic writes data to a temporary file next to path,
+// syncs it and renames it to path.
+func writeFileAtomic(path string, data []byte) error {
+	dir := filepath.Dir(path)
+	tmp, err := ioutil.TempFile(dir, "."+filepath.Base(path))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(0644); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return err
+	}
+
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
@@ -0,0 +1,109 @@
+// Copyright (c) 2018-2019 Sylabs, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package journal
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type entry struct {
+	ID    string `json:"id"`
+	Value int    `json:"value"`
+}
+
+// replayEntries replays journal into a map of entries.
+func replayEntries(t *testing.T, j *Journal) map[string]entry {
+	entries := make(map[string]entry)
+	err := j.Replay(func(rec Record) error {
+		switch rec.Op {
+		case OpPut:
+			var e entry
+			require.NoError(t, json.Unmarshal(rec.Data, &e))
+			entries[e.ID] = e
+		case OpDelete:
+			delete(entries, rec.Key)
+		}
+		return nil
+	})
+	require.NoError(t, err, "could not replay journal")
+	return entries
+}
+
+func TestJournal(t *testing.T) {
+	dir, err := ioutil.TempDir("", "journal-")
+	require.NoError(t, err, "could not create temp dir")
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "registry.json")
+
+	// snapshot written by plain dumps is still readable
+	require.NoError(t, ioutil.WriteFile(path, []byte(`{"id":"a","value":1}{"id":"b","value":2}`), 0644))
+
+	j, err := Open(path, WithCompactAfter(3))
+	require.NoError(t, err, "could not open journal")
+	require.Equal(t, map[string]entry{
+		"a": {ID: "a", Value: 1},
+		"b": {ID: "b", Value: 2},
+	}, replayEntries(t, j))
+
+	compact, err := j.Append(OpPut, "c", entry{ID: "c", Value: 3})
+	require.NoError(t, err)
+	require.False(t, compact)
+	compact, err = j.Append(OpDelete, "a", nil)
+	require.NoError(t, err)
+	require.False(t, compact)
+	require.NoError(t, j.Close())
+
+	// simulate crash in the middle of a write
+	log, err := os.OpenFile(path+logSuffix, os.O_WRONLY|os.O_APPEND, 0644)
+	require.NoError(t, err)
+	_, err = log.WriteString(`{"op":"put","key":"d","data":{"id":"d"`)
+	require.NoError(t, err)
+	require.NoError(t, log.Close())
+
+	j, err = Open(path, WithCompactAfter(3))
+	require.NoError(t, err, "could not reopen journal")
+	entries := replayEntries(t, j)
+	require.Equal(t, map[string]entry{
+		"b": {ID: "b", Value: 2},
+		"c": {ID: "c", Value: 3},
+	}, entries)
+
+	compact, err = j.Append(OpPut, "e", entry{ID: "e", Value: 5})
+	require.NoError(t, err)
+	require.True(t, compact, "journal should ask for compaction")
+	entries["e"] = entry{ID: "e", Value: 5}
+
+	err = j.Compact(func(put func(v interface{})) {
+		for _, e := range entries {
+			put(e)
+		}
+	})
+	require.NoError(t, err, "could not compact journal")
+	fi, err := os.Stat(path + logSuffix)
+	require.NoError(t, err)
+	require.Zero(t, fi.Size(), "journal should be empty after compaction")
+	require.NoError(t, j.Close())
+
+	j, err = Open(path)
+	require.NoError(t, err, "could not reopen journal")
+	defer j.Close()
+	require.Equal(t, entries, replayEntries(t, j))
+}
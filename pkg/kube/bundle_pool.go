@@ -0,0 +1,48 @@
+// Copyright (c) 2018-2019 Sylabs, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kube
+
+// BundlePool limits number of container bundles that are created
+// concurrently, so that bursts of container creations do not compete
+// for disk and loop devices. Nil BundlePool imposes no limit.
+type BundlePool chan struct{}
+
+// NewBundlePool returns BundlePool that allows workers bundles to be created
+// at the same time. When workers is not positive, nil pool is returned.
+func NewBundlePool(workers int) BundlePool {
+	if workers <= 0 {
+		return nil
+	}
+	return make(BundlePool, workers)
+}
+
+// WithBundlePool sets pool that limits creation of container's bundle.
+func WithBundlePool(pool BundlePool) ContainerOption {
+	return func(c *Container) {
+		c.bundlePool = pool
+	}
+}
+
+func (p BundlePool) acquire() {
+	if p != nil {
+		p <- struct{}{}
+	}
+}
+
+func (p BundlePool) release() {
+	if p != nil {
+		<-p
+	}
+}
@@ -0,0 +1,77 @@
+// Copyright (c) 2018-2019 Sylabs, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kube
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBundlePool(t *testing.T) {
+	tt := []struct {
+		name    string
+		workers int
+	}{
+		{
+			name:    "unlimited",
+			workers: 0,
+		},
+		{
+			name:    "single worker",
+			workers: 1,
+		},
+		{
+			name:    "several workers",
+			workers: 3,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			pool := NewBundlePool(tc.workers)
+			if tc.workers <= 0 {
+				require.Nil(t, pool)
+				for i := 0; i < 10; i++ {
+					pool.acquire()
+				}
+				return
+			}
+
+			for i := 0; i < tc.workers; i++ {
+				pool.acquire()
+			}
+			acquired := make(chan struct{})
+			go func() {
+				pool.acquire()
+				close(acquired)
+			}()
+
+			select {
+			case <-acquired:
+				t.Fatalf("more than %d workers acquired", tc.workers)
+			case <-time.After(50 * time.Millisecond):
+			}
+
+			pool.release()
+			select {
+			case <-acquired:
+			case <-time.After(time.Second):
+				t.Fatalf("worker was not acquired after release")
+			}
+		})
+	}
+}
@@ -16,19 +16,21 @@ package kube
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"io"
 	"os/exec"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/golang/glog"
+	"github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/sylabs/singularity-cri/pkg/fs"
 	"github.com/sylabs/singularity-cri/pkg/image"
 	"github.com/sylabs/singularity-cri/pkg/rand"
 	"github.com/sylabs/singularity-cri/pkg/singularity"
 	"github.com/sylabs/singularity-cri/pkg/singularity/runtime"
 	"github.com/sylabs/singularity/pkg/ociruntime"
-	"github.com/sylabs/singularity/pkg/util/unix"
 	k8s "k8s.io/kubernetes/pkg/kubelet/apis/cri/runtime/v1alpha2"
 )
 
@@ -53,6 +55,9 @@ type Container struct {
 	baseDir  string
 	trashDir string
 
+	// stateMu guards runtimeState, ociState and storageExceeded that
+	// are updated while runtime checks containers in background
+	stateMu      sync.RWMutex
 	runtimeState runtime.State
 	ociState     *ociruntime.State
 	logPath      string
@@ -61,26 +66,137 @@ type Container struct {
 	isStopped bool
 	isRemoved bool
 
+	execEnvDeny  []string
+	execEnvExtra []string
+
+	execMu       sync.Mutex
+	execSessions map[string]*ExecSession
+	processUser  string
+
+	stdinMu       sync.Mutex
 	isStdinClosed bool
 	stdin         io.WriteCloser
 
-	cli        *runtime.CLIClient
+	cli        runtime.OCIClient
+	session    *runtime.ControlSession
 	syncChan   <-chan runtime.State
 	syncCancel context.CancelFunc
+	syncState  *runtime.StateTracker
+
+	logDriver    LogDriver
+	stopLogsFunc func()
+
+	defaultCapabilities   []string
+	defaultSeccompProfile string
+
+	// process label with MCS level allocated for container itself
+	processLabel string
+	shmSize      int64
+
+	sifVolumes        []SIFVolume
+	mountedSIFVolumes int
+
+	tmpfsMounts []specs.Mount
+	hooks       []Hook
+	rlimits     []specs.POSIXRlimit
+
+	realtimeAllowed   bool
+	realtimeRuntime   int64
+	realtimePeriod    uint64
+	numaAwareCpuset   bool
+	timezone          string
+	timezoneFile      string
+	bundlePool        BundlePool
+	stopSignal        string
+	defaultStopSignal string
+	previousID        string
+	projectIDs        *fs.ProjectIDs
+	projectID         uint32
+	storageLimit      int64
+	storageExceeded   string
+}
+
+// logReopener is implemented by OCI clients that
+// write container logs themselves, e.g. runtime.RuncClient.
+type logReopener interface {
+	ReopenLog(id string) error
+}
+
+// ContainerOption is run during Container initialization and may be
+// used to tune container's behaviour.
+type ContainerOption func(c *Container)
+
+// WithLogDriver sets driver that ships container logs in addition to
+// container log file. When driver is nil, only log file is written.
+func WithLogDriver(driver LogDriver) ContainerOption {
+	return func(c *Container) {
+		c.logDriver = driver
+	}
+}
+
+// WithDefaultCapabilities sets capabilities container starts with before
+// capabilities from its security context are added and dropped. When caps
+// is nil, default capabilities of OCI runtime spec generator are used.
+func WithDefaultCapabilities(caps []string) ContainerOption {
+	return func(c *Container) {
+		c.defaultCapabilities = caps
+	}
+}
+
+// WithDefaultSeccompProfile sets path to seccomp profile file that is used
+// instead of the runtime default profile when container requests it, as well
+// as for containers that don't set any profile and would run unconfined
+// otherwise. When path is empty, the runtime default profile is used.
+func WithDefaultSeccompProfile(path string) ContainerOption {
+	return func(c *Container) {
+		c.defaultSeccompProfile = path
+	}
+}
+
+// WithDefaultStopSignal sets signal that is sent to container process on graceful
+// stop when neither container nor image specify one. When sig is empty,
+// DefaultStopSignal is used.
+func WithDefaultStopSignal(sig string) ContainerOption {
+	return func(c *Container) {
+		c.defaultStopSignal = sig
+	}
+}
+
+// WithEngineClient makes container started, signalled and its log reopened
+// over a control session with Singularity OCI engine instead of forking
+// Singularity CLI. When engine is nil or container is run by other OCI
+// runtime, see WithOCIClient, CLI is used for all operations.
+func WithEngineClient(engine *runtime.EngineClient) ContainerOption {
+	return func(c *Container) {
+		c.session = nil
+		if _, ok := c.cli.(*runtime.CLIClient); ok && engine != nil {
+			c.session = engine.Session(c.id)
+		}
+	}
+}
+
+// WithProjectIDs sets allocator of project IDs that are assigned to container
+// base directory, so that its fs usage is read from project quota accounting.
+// When ids is nil or filesystem doesn't support project quotas, usage is
+// calculated by walking container base directory.
+func WithProjectIDs(ids *fs.ProjectIDs) ContainerOption {
+	return func(c *Container) {
+		c.projectIDs = ids
+	}
 }
 
 // NewContainer constructs Container instance. Container is thread safe to use.
-func NewContainer(config *k8s.ContainerConfig, pod *Pod, info *image.Info, trashDir string) *Container {
+func NewContainer(config *k8s.ContainerConfig, pod *Pod, info *image.Info, trashDir string, opts ...ContainerOption) *Container {
 	contID := rand.GenerateID(ContainerIDLen)
 	var execEnvs []string
 	if info.OciConfig != nil {
-		execEnvs = info.OciConfig.Env
+		execEnvs = append(execEnvs, info.OciConfig.Env...)
 	}
 	// environments from config will override oci image values
 	for _, kv := range config.GetEnvs() {
 		execEnvs = append(execEnvs, fmt.Sprintf("%s=%s", kv.Key, kv.Value))
 	}
-	return &Container{
+	cont := &Container{
 		id:              contID,
 		ContainerConfig: config,
 		pod:             pod,
@@ -89,6 +205,13 @@ func NewContainer(config *k8s.ContainerConfig, pod *Pod, info *image.Info, trash
 		trashDir:        trashDir,
 		execEnvs:        execEnvs,
 	}
+	if pod != nil && pod.cli != nil {
+		cont.cli = pod.cli
+	}
+	for _, opt := range opts {
+		opt(cont)
+	}
+	return cont
 }
 
 // ID returns unique container ID.
@@ -103,7 +226,7 @@ func (c *Container) PodID() string {
 
 // State returns current container state understood by k8s.
 func (c *Container) State() k8s.ContainerState {
-	switch c.runtimeState {
+	switch c.getRuntimeState() {
 	case runtime.StateCreated:
 		return k8s.ContainerState_CONTAINER_CREATED
 	case runtime.StateRunning:
@@ -116,6 +239,8 @@ func (c *Container) State() k8s.ContainerState {
 
 // CreatedAt returns pod creation time in Unix nano.
 func (c *Container) CreatedAt() int64 {
+	c.stateMu.RLock()
+	defer c.stateMu.RUnlock()
 	if c.ociState.CreatedAt == nil {
 		return 0
 	}
@@ -124,6 +249,8 @@ func (c *Container) CreatedAt() int64 {
 
 // StartedAt returns container start time in unix nano.
 func (c *Container) StartedAt() int64 {
+	c.stateMu.RLock()
+	defer c.stateMu.RUnlock()
 	if c.ociState.StartedAt == nil {
 		return 0
 	}
@@ -132,23 +259,59 @@ func (c *Container) StartedAt() int64 {
 
 // FinishedAt returns container finish time in unix nano.
 func (c *Container) FinishedAt() int64 {
+	c.stateMu.RLock()
+	defer c.stateMu.RUnlock()
 	if c.ociState.FinishedAt == nil {
 		return 0
 	}
 	return *c.ociState.FinishedAt
 }
 
+// unknownExitCode is reported for exited containers which exit code runtime
+// doesn't know, so that they are not taken for succeeded ones.
+const unknownExitCode = 255
+
 // ExitCode returns container exit code.
 func (c *Container) ExitCode() int32 {
+	c.stateMu.RLock()
+	defer c.stateMu.RUnlock()
+	return c.exitCode()
+}
+
+func (c *Container) exitCode() int32 {
 	if c.ociState.ExitCode == nil {
+		if c.runtimeState == runtime.StateExited {
+			return unknownExitCode
+		}
 		return 0
 	}
 	return int32(*c.ociState.ExitCode)
 }
 
 // ExitDescription returns human readable message of why container has exited.
+// When container process was terminated by a signal, its name is included.
 func (c *Container) ExitDescription() string {
-	return c.ociState.ExitDesc
+	c.stateMu.RLock()
+	defer c.stateMu.RUnlock()
+
+	if c.runtimeState != runtime.StateExited {
+		return c.ociState.ExitDesc
+	}
+	if c.storageExceeded != "" {
+		return c.storageExceeded
+	}
+	desc := c.ociState.ExitDesc
+	if c.ociState.ExitCode == nil && desc == "" {
+		return "exit code is unknown"
+	}
+	sig := runtime.ExitSignal(c.exitCode())
+	if sig == "" || strings.Contains(desc, sig) {
+		return desc
+	}
+	if desc == "" {
+		return fmt.Sprintf("terminated by %s", sig)
+	}
+	return fmt.Sprintf("%s, terminated by %s", desc, sig)
 }
 
 // StateReason returns brief string explaining why container is in its current state.
@@ -158,15 +321,25 @@ func (c *Container) StateReason() string {
 	const (
 		reasonCompleted = "Completed"
 		reasonError     = "Error"
+		reasonUnknown   = "Unknown"
 	)
 
+	c.stateMu.RLock()
+	defer c.stateMu.RUnlock()
+
 	if c.runtimeState == runtime.StateRunning {
 		// no need for any reason here
 		return ""
 	}
 
 	if c.runtimeState == runtime.StateExited {
-		if c.ExitCode() == 0 {
+		if c.storageExceeded != "" {
+			return reasonEphemeralStorage
+		}
+		if c.ociState.ExitCode == nil {
+			return reasonUnknown
+		}
+		if c.exitCode() == 0 {
 			return reasonCompleted
 		}
 		return reasonError
@@ -193,6 +366,18 @@ func (c *Container) LogPath() string {
 	return c.logPath
 }
 
+// Attempt returns number of times kubelet has recreated container
+// with the same name in the pod.
+func (c *Container) Attempt() uint32 {
+	return c.GetMetadata().GetAttempt()
+}
+
+// PreviousID returns ID of the container with the same name that was created
+// in the pod with the previous attempt or empty string if there is none.
+func (c *Container) PreviousID() string {
+	return c.previousID
+}
+
 // ImageID returns id of the container base image.
 func (c *Container) ImageID() string {
 	return c.imgInfo.ID
@@ -202,7 +387,9 @@ func (c *Container) ImageID() string {
 // is created with StdinOnce set to true this call will return
 // nil after first attach to container finishes.
 func (c *Container) Stdin() io.Writer {
-	if c.isStdinClosed {
+	c.stdinMu.Lock()
+	defer c.stdinMu.Unlock()
+	if c.isStdinClosed || c.stdin == nil {
 		return nil
 	}
 	return c.stdin
@@ -211,12 +398,22 @@ func (c *Container) Stdin() io.Writer {
 // StdinClosed returns true when allocated stdin (if any) has
 // been already closed (possibly due to stdinOnce flag).
 func (c *Container) StdinClosed() bool {
+	c.stdinMu.Lock()
+	defer c.stdinMu.Unlock()
 	return c.isStdinClosed
 }
 
-// CloseStdin closes write end of container's stdin.
+// CloseStdin propagates EOF to container process and
+// closes write end of container's stdin.
 func (c *Container) CloseStdin() error {
+	c.stdinMu.Lock()
+	defer c.stdinMu.Unlock()
 	if c.stdin != nil && !c.isStdinClosed {
+		// stdin is a terminal, so EOF is sent as VEOF character;
+		// the second one is needed when input doesn't end with a newline
+		if _, err := c.stdin.Write([]byte{4, 4}); err != nil {
+			glog.V(4).Infof("Could not send EOF to container %s: %v", c.id, err)
+		}
 		if err := c.stdin.Close(); err != nil {
 			return fmt.Errorf("could not close stdin: %v", err)
 		}
@@ -244,6 +441,10 @@ func (c *Container) Create(baseDir string) error {
 			if err := c.cleanupFiles(true); err != nil {
 				glog.Errorf("Could not cleanup bundle: %v", err)
 			}
+			c.pod.releaseCgroup(c)
+			if err := c.pod.updateCgroup(); err != nil {
+				glog.Errorf("Could not shrink pod cgroup: %v", err)
+			}
 		}
 	}()
 
@@ -252,20 +453,30 @@ func (c *Container) Create(baseDir string) error {
 	if err != nil {
 		return fmt.Errorf("invalid container config: %v", err)
 	}
-	err = c.addLogDirectory()
-	if err != nil {
-		return fmt.Errorf("could not create log directory: %v", err)
+	if prev := c.pod.previousAttempt(c); prev != nil {
+		glog.V(3).Infof("Container %s is attempt %d of container %s", c.id, c.Attempt(), prev.id)
+		c.previousID = prev.id
 	}
+	c.addProjectQuota()
 	c.imgInfo.Borrow(c.id)
+	err = c.prepareFiles()
+	if err != nil {
+		return fmt.Errorf("could not prepare container files: %v", err)
+	}
+	err = c.pod.reserveCgroup(c, c.GetLinux().GetResources())
+	if err != nil {
+		return fmt.Errorf("could not update pod cgroup: %v", err)
+	}
 	err = c.spawnOCIContainer()
 	if err != nil {
-		return fmt.Errorf("could not spawn container: %v", err)
+		return runtime.Wrap(err, "could not spawn container")
 	}
 	err = c.UpdateState()
 	if err != nil {
 		return fmt.Errorf("could not update container state: %v", err)
 	}
 	c.pod.addContainer(c)
+	c.pod.releaseCgroup(c)
 	return nil
 }
 
@@ -278,8 +489,14 @@ func (c *Container) Start() error {
 		return ErrContainerNotCreated
 	}
 	glog.V(3).Infof("Starting container %s", c.id)
-	if err := c.cli.Start(c.id); err != nil {
-		return fmt.Errorf("could not start container: %v", err)
+	start := c.cli.Start
+	if c.session != nil {
+		start = func(string) error {
+			return c.session.Start()
+		}
+	}
+	if err := start(c.id); err != nil {
+		return runtime.Wrap(err, "could not start container")
 	}
 	err := c.expectState(runtime.StateRunning)
 	if err != nil {
@@ -288,6 +505,7 @@ func (c *Container) Start() error {
 	if err := c.UpdateState(); err != nil {
 		return fmt.Errorf("could not update container state: %v", err)
 	}
+	c.startLogs()
 	return nil
 }
 
@@ -305,6 +523,7 @@ func (c *Container) Stop(timeout int64) error {
 	if err := c.terminate(timeout); err != nil {
 		return fmt.Errorf("could not terminate container process: %v", err)
 	}
+	c.stopLogs()
 	if err := c.UpdateState(); err != nil {
 		return fmt.Errorf("could not update container state: %v", err)
 	}
@@ -334,6 +553,7 @@ func (c *Container) Remove() error {
 	if err := c.CloseStdin(); err != nil {
 		glog.Errorf("Could not close container stdin: %v", err)
 	}
+	c.stopLogs()
 	if err := c.collectTrash(); err != nil {
 		glog.Errorf("Could not collect container trash: %v", err)
 	}
@@ -342,12 +562,17 @@ func (c *Container) Remove() error {
 	}
 	c.imgInfo.Return(c.id)
 	c.pod.removeContainer(c)
+	if err := c.pod.updateCgroup(); err != nil {
+		glog.Errorf("Could not shrink pod cgroup: %v", err)
+	}
 	c.isRemoved = true
 	return nil
 }
 
 // ExecSync runs passed command inside a container and returns result.
-func (c *Container) ExecSync(timeout time.Duration, cmd []string) (*k8s.ExecSyncResponse, error) {
+// At most maxOutput bytes of stdout and stderr are returned each, the rest is
+// replaced with truncation marker. When maxOutput is 0, runtime default is used.
+func (c *Container) ExecSync(timeout time.Duration, cmd []string, maxOutput int64) (*k8s.ExecSyncResponse, error) {
 	ctx := context.Background()
 	if timeout > 0 {
 		var cancel context.CancelFunc
@@ -358,10 +583,16 @@ func (c *Container) ExecSync(timeout time.Duration, cmd []string) (*k8s.ExecSync
 	if c.imgInfo.Ref.URI() != singularity.DockerDomain || c.imgInfo.OciConfig == nil {
 		cmd = append([]string{singularity.ExecScript}, cmd...)
 	}
-	resp, err := c.cli.ExecSync(ctx, c.id, cmd, c.execEnvs)
+	resp, err := c.cli.ExecSync(ctx, c.id, cmd, c.execEnvs, maxOutput)
 	if err != nil {
 		return nil, fmt.Errorf("exec sync returned error: %v", err)
 	}
+	if resp.Truncated {
+		glog.Warningf("Output of exec sync %v in container %s is truncated", cmd, c.id)
+	}
+	if resp.Signal != "" {
+		glog.V(3).Infof("Exec sync %v in container %s was terminated by %s", cmd, c.id, resp.Signal)
+	}
 
 	return &k8s.ExecSyncResponse{
 		Stdout:   resp.Stdout,
@@ -371,9 +602,8 @@ func (c *Container) ExecSync(timeout time.Duration, cmd []string) (*k8s.ExecSync
 }
 
 // Exec executes a command inside a container with attaching passed io streams to it.
-func (c *Container) Exec(cmd []string, stdin io.Reader, stdout, stderr io.Writer) error {
-	ctx := context.Background()
-
+// Exec process is killed when ctx is done.
+func (c *Container) Exec(ctx context.Context, cmd []string, stdin io.Reader, stdout, stderr io.Writer) error {
 	if c.imgInfo.Ref.URI() != singularity.DockerDomain || c.imgInfo.OciConfig == nil {
 		cmd = append([]string{singularity.ExecScript}, cmd...)
 	}
@@ -386,9 +616,8 @@ func (c *Container) Exec(cmd []string, stdin io.Reader, stdout, stderr io.Writer
 }
 
 // PrepareExec creates an instance of exec.Cmd that may be used
-// later to run a command inside an allocated tty.
-func (c *Container) PrepareExec(cmd []string) *exec.Cmd {
-	ctx := context.Background()
+// later to run a command inside an allocated tty. Command is killed when ctx is done.
+func (c *Container) PrepareExec(ctx context.Context, cmd []string) *exec.Cmd {
 	if c.imgInfo.Ref.URI() != singularity.DockerDomain || c.imgInfo.OciConfig == nil {
 		cmd = append([]string{singularity.ExecScript}, cmd...)
 	}
@@ -398,29 +627,28 @@ func (c *Container) PrepareExec(cmd []string) *exec.Cmd {
 // ReopenLogFile reopens container log file.
 // This method is usually called when logs are rotated.
 func (c *Container) ReopenLogFile() error {
+	if c.session != nil {
+		if err := c.session.ReopenLog(); err != nil {
+			return fmt.Errorf("could not reopen log: %v", err)
+		}
+		return nil
+	}
+	if reopener, ok := c.cli.(logReopener); ok {
+		if err := reopener.ReopenLog(c.id); err != nil {
+			return fmt.Errorf("could not reopen log: %v", err)
+		}
+		return nil
+	}
 	socket := c.ControlSocket()
 	if socket == "" {
 		return fmt.Errorf("container didn't provide control socket")
 
 	}
-	ctrlSock, err := unix.Dial(socket)
-	if err != nil {
-		return fmt.Errorf("could not connect to control socket: %v", err)
-	}
-	defer ctrlSock.Close()
-
 	ctrl := ociruntime.Control{
 		ReopenLog: true,
 	}
-	err = json.NewEncoder(ctrlSock).Encode(&ctrl)
-	if err != nil {
-		return fmt.Errorf("could not send reopen log to control socket: %v", err)
-	}
-
-	buf := make([]byte, 1)
-	_, err = ctrlSock.Read(buf)
-	if err != nil && err != io.EOF {
-		return fmt.Errorf("could not wait reopen log: %v", err)
+	if err := runtime.Control(socket, ctrl); err != nil {
+		return fmt.Errorf("could not reopen log: %v", err)
 	}
 	return nil
 }
@@ -20,8 +20,12 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"sync"
+	"time"
 
 	"github.com/golang/glog"
+	"github.com/opencontainers/selinux/go-selinux/label"
+	"github.com/sylabs/singularity-cri/pkg/fs"
 	ocibundle "github.com/sylabs/singularity/pkg/ocibundle/sif"
 )
 
@@ -30,6 +34,7 @@ const (
 	contBundlePath    = "bundle/"
 	contRootfsPath    = "rootfs/"
 	contOCIConfigPath = "config.json"
+	contVolumesPath   = "volumes/"
 )
 
 // ociConfigPath returns path to container's config.json file.
@@ -62,7 +67,7 @@ func (c *Container) addLogDirectory() error {
 		return nil
 	}
 
-	logPath = filepath.Join(logDir, logPath)
+	logPath = filepath.Join(logDir, attemptLogPath(logPath, c.Attempt()))
 	logDir = filepath.Dir(logPath)
 	glog.V(5).Infof("Creating log directory %s", logDir)
 	err := os.MkdirAll(logDir, 0755)
@@ -73,7 +78,47 @@ func (c *Container) addLogDirectory() error {
 	return nil
 }
 
-func (c *Container) addOCIBundle() error {
+// prepareFiles creates container's log directory, mounts SIF volumes and
+// creates SIF bundle. These steps do not depend on each other, so they
+// are run concurrently to reduce container creation latency.
+func (c *Container) prepareFiles() error {
+	steps := []struct {
+		do   func() error
+		desc string
+	}{
+		{do: c.addLogDirectory, desc: "create log directory"},
+		{do: c.addSIFVolumes, desc: "add SIF volumes"},
+		{do: c.addBundle, desc: "create oci bundle"},
+	}
+
+	var wg sync.WaitGroup
+	errs := make([]error, len(steps))
+	for i, step := range steps {
+		wg.Add(1)
+		go func(i int, do func() error, desc string) {
+			defer wg.Done()
+			if err := do(); err != nil {
+				errs[i] = fmt.Errorf("could not %s: %v", desc, err)
+			}
+		}(i, step.do, step.desc)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addBundle creates SIF bundle with container's rootfs. Number of bundles
+// created at the same time is limited by container's bundle pool.
+func (c *Container) addBundle() error {
+	c.bundlePool.acquire()
+	defer c.bundlePool.release()
+
+	start := time.Now()
 	glog.V(5).Infof("Creating SIF bundle at %s", c.bundlePath())
 	d, err := ocibundle.FromSif(c.imgInfo.Path, c.bundlePath(), true)
 	if err != nil {
@@ -82,12 +127,26 @@ func (c *Container) addOCIBundle() error {
 	if err := d.Create(nil); err != nil {
 		return fmt.Errorf("could not create SIF bundle: %v", err)
 	}
+	glog.V(4).Infof("Created SIF bundle for container %s in %v", c.id, time.Since(start))
+	return nil
+}
 
+// addOCIConfig generates OCI config of container and writes it into the bundle
+// that is previously created by addBundle.
+func (c *Container) addOCIConfig() error {
 	glog.V(5).Infof("Generating OCI config for container %s", c.id)
 	ociSpec, err := translateContainer(c, c.pod)
 	if err != nil {
 		return fmt.Errorf("could not generate oci spec for container: %v", err)
 	}
+	c.processUser = fmt.Sprintf("%d:%d", ociSpec.Process.User.UID, ociSpec.Process.User.GID)
+	if cwd := ociSpec.Process.Cwd; cwd != "" {
+		// create missing working directory the same way docker does
+		uid, gid := int(ociSpec.Process.User.UID), int(ociSpec.Process.User.GID)
+		if err := mkdirInRoot(c.rootfsPath(), cwd, uid, gid); err != nil {
+			return fmt.Errorf("could not create working directory: %v", err)
+		}
+	}
 	config, err := os.OpenFile(c.ociConfigPath(), os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
 	if err != nil {
 		return fmt.Errorf("could not create OCI config file: %v", err)
@@ -100,7 +159,38 @@ func (c *Container) addOCIBundle() error {
 	return nil
 }
 
+// addProjectQuota assigns project ID to container base directory before any
+// files are created in it. Failures are not fatal since usage may still be
+// calculated by walking the directory.
+func (c *Container) addProjectQuota() {
+	if c.projectIDs == nil {
+		return
+	}
+	if err := os.MkdirAll(c.baseDir, 0755); err != nil {
+		glog.Warningf("Could not create container %s base directory: %v", c.id, err)
+		return
+	}
+	if !fs.ProjectQuotaSupported(c.baseDir) {
+		glog.V(4).Infof("Project quotas are not supported for container %s", c.id)
+		return
+	}
+	id := c.projectIDs.Allocate()
+	if err := fs.SetProjectID(c.baseDir, id); err != nil {
+		glog.Warningf("Could not set project quota for container %s: %v", c.id, err)
+		c.projectIDs.Release(id)
+		return
+	}
+	glog.V(4).Infof("Assigned project %d to container %s", id, c.id)
+	c.projectID = id
+}
+
 func (c *Container) cleanupFiles(silent bool) error {
+	if err := c.cleanupSIFVolumes(); err != nil {
+		if !silent {
+			return err
+		}
+		glog.Errorf("Could not cleanup SIF volumes: %v", err)
+	}
 	glog.V(5).Infof("Removing bundle at %s", c.bundlePath())
 	d, err := ocibundle.FromSif("", c.bundlePath(), true)
 	if err != nil {
@@ -123,6 +213,17 @@ func (c *Container) cleanupFiles(silent bool) error {
 		}
 		glog.Errorf("Could not cleanup container: %v", err)
 	}
+	if c.projectID != 0 {
+		c.projectIDs.Release(c.projectID)
+		c.projectID = 0
+	}
+	if c.processLabel != "" {
+		// allow MCS level to be reused by other containers
+		if err := label.ReleaseLabel(c.processLabel); err != nil {
+			glog.Errorf("Could not release SELinux label: %v", err)
+		}
+		c.processLabel = ""
+	}
 	// do not clean any container logs as
 	// they will be removed during pod cleanup
 	// see https://github.com/sylabs/singularity-cri/issues/314
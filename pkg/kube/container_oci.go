@@ -18,13 +18,16 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 
+	"github.com/golang/glog"
 	"github.com/opencontainers/runc/libcontainer/devices"
 	"github.com/opencontainers/runc/libcontainer/user"
 	"github.com/opencontainers/runtime-spec/specs-go"
 	"github.com/opencontainers/runtime-tools/generate"
 	"github.com/opencontainers/runtime-tools/generate/seccomp"
+	"github.com/opencontainers/selinux/go-selinux/label"
 	"github.com/sylabs/singularity-cri/pkg/singularity"
 	k8s "k8s.io/kubernetes/pkg/kubelet/apis/cri/runtime/v1alpha2"
 )
@@ -33,6 +36,8 @@ type containerTranslator struct {
 	cont *Container
 	pod  *Pod
 	g    generate.Generator
+
+	mountLabel string
 }
 
 // translateContainer translates Container and its parent Pod instances
@@ -58,6 +63,9 @@ func (t *containerTranslator) translate() (*specs.Spec, error) {
 	if err := t.configureDevices(); err != nil {
 		return nil, fmt.Errorf("could not configure devices: %v", err)
 	}
+	if err := t.configureSELinux(); err != nil {
+		return nil, fmt.Errorf("could not configure SELinux: %v", err)
+	}
 	if err := t.configureMounts(); err != nil {
 		return nil, fmt.Errorf("could not configure mounts: %v", err)
 	}
@@ -67,6 +75,7 @@ func (t *containerTranslator) translate() (*specs.Spec, error) {
 	t.configureNamespaces()
 	t.configureResources()
 	t.configureAnnotations()
+	t.configureHooks()
 	return t.g.Config, nil
 }
 
@@ -84,13 +93,28 @@ func (t *containerTranslator) configureMounts() error {
 	// default propagation set to rprivate for security reasons
 	t.g.SetLinuxRootPropagation(propagationRprivate)
 
-	if t.pod.GetDnsConfig() != nil {
+	if t.pod.hasResolvConf {
 		t.g.AddMount(specs.Mount{
 			Destination: "/etc/resolv.conf",
 			Source:      t.pod.resolvConfFilePath(),
 			Options:     []string{"bind", "ro"},
 		})
 	}
+	if t.pod.hasHosts && !t.hasMount("/etc/hosts") {
+		// hosts file mounted by kubelet includes host aliases and takes precedence
+		t.g.AddMount(specs.Mount{
+			Destination: "/etc/hosts",
+			Source:      t.pod.hostsFilePath(),
+			Options:     []string{"bind", "ro"},
+		})
+	}
+	if t.cont.timezoneFile != "" && !t.hasMount("/etc/localtime") {
+		t.g.AddMount(specs.Mount{
+			Destination: "/etc/localtime",
+			Source:      t.cont.timezoneFile,
+			Options:     []string{"bind", "ro"},
+		})
+	}
 	t.g.SetHostname(t.pod.GetHostname())
 	t.g.AddMount(specs.Mount{
 		Destination: "/etc/hostname",
@@ -98,12 +122,32 @@ func (t *containerTranslator) configureMounts() error {
 		Options:     []string{"bind", "ro"},
 	})
 
-	if !t.cont.GetLinux().GetSecurityContext().GetPrivileged() {
-		for _, maskedPath := range t.cont.GetLinux().GetSecurityContext().GetMaskedPaths() {
-			t.g.AddLinuxMaskedPaths(maskedPath)
-		}
-		for _, readonlyPath := range t.cont.GetLinux().GetSecurityContext().GetReadonlyPaths() {
-			t.g.AddLinuxReadonlyPaths(readonlyPath)
+	t.configureProcMount()
+
+	for _, mount := range t.cont.tmpfsMounts {
+		t.g.AddMount(mount)
+	}
+	for i, volume := range t.cont.sifVolumes {
+		t.g.AddMount(specs.Mount{
+			Destination: volume.Path,
+			Source:      filepath.Join(t.cont.sifVolumePath(i), contRootfsPath),
+			Options:     []string{"rbind", "ro"},
+		})
+	}
+
+	if t.cont.shmSize > 0 {
+		mounts := t.g.Mounts()
+		for i := range mounts {
+			if mounts[i].Destination != "/dev/shm" {
+				continue
+			}
+			var options []string
+			for _, opt := range mounts[i].Options {
+				if !strings.HasPrefix(opt, "size=") {
+					options = append(options, opt)
+				}
+			}
+			mounts[i].Options = append(options, fmt.Sprintf("size=%d", t.cont.shmSize))
 		}
 	}
 
@@ -118,6 +162,10 @@ func (t *containerTranslator) configureMounts() error {
 	}
 
 	for _, mount := range t.cont.GetMounts() {
+		if t.isTmpfs(mount.GetContainerPath()) {
+			glog.V(3).Infof("Replacing mount %s with tmpfs", mount.GetContainerPath())
+			continue
+		}
 		source, err := filepath.EvalSymlinks(mount.GetHostPath())
 		if err != nil {
 			if os.IsNotExist(err) {
@@ -131,6 +179,12 @@ func (t *containerTranslator) configureMounts() error {
 			}
 		}
 
+		if mount.GetSelinuxRelabel() {
+			if err := label.Relabel(source, t.mountLabel, false); err != nil {
+				return fmt.Errorf("could not relabel %s: %v", source, err)
+			}
+		}
+
 		volume := specs.Mount{
 			Source:      source,
 			Destination: mount.GetContainerPath(),
@@ -158,6 +212,44 @@ func (t *containerTranslator) configureMounts() error {
 	return nil
 }
 
+// configureProcMount sets paths that are masked or made read-only in container.
+// Kubelet sends default /proc paths for Default proc mount and no paths for
+// Unmasked one, so paths are applied exactly as they are sent and no defaults
+// are added here, otherwise Unmasked proc mount would never take effect.
+// Privileged containers get /proc unmasked as well.
+func (t *containerTranslator) configureProcMount() {
+	security := t.cont.GetLinux().GetSecurityContext()
+	if security.GetPrivileged() {
+		return
+	}
+	for _, maskedPath := range security.GetMaskedPaths() {
+		t.g.AddLinuxMaskedPaths(maskedPath)
+	}
+	for _, readonlyPath := range security.GetReadonlyPaths() {
+		t.g.AddLinuxReadonlyPaths(readonlyPath)
+	}
+}
+
+// isTmpfs reports whether tmpfs is requested to be mounted at destination.
+func (t *containerTranslator) isTmpfs(destination string) bool {
+	for _, mount := range t.cont.tmpfsMounts {
+		if mount.Destination == filepath.Clean(destination) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasMount reports whether container config requests a mount to destination.
+func (t *containerTranslator) hasMount(destination string) bool {
+	for _, mount := range t.cont.GetMounts() {
+		if filepath.Clean(mount.GetContainerPath()) == destination {
+			return true
+		}
+	}
+	return false
+}
+
 func (t *containerTranslator) configureDevices() error {
 	if t.cont.GetLinux().GetSecurityContext().GetPrivileged() {
 		hostDevices, err := devices.HostDevices()
@@ -275,6 +367,12 @@ func (t *containerTranslator) configureResources() {
 	if res.GetMemoryLimitInBytes() != 0 {
 		t.g.SetLinuxResourcesMemoryLimit(res.GetMemoryLimitInBytes())
 	}
+	if t.cont.realtimeRuntime != 0 {
+		t.g.SetLinuxResourcesCPURealtimeRuntime(t.cont.realtimeRuntime)
+	}
+	if t.cont.realtimePeriod != 0 {
+		t.g.SetLinuxResourcesCPURealtimePeriod(t.cont.realtimePeriod)
+	}
 }
 
 func (t *containerTranslator) configureProcess() error {
@@ -332,6 +430,10 @@ func (t *containerTranslator) configureProcess() error {
 	security := t.cont.GetLinux().GetSecurityContext()
 	t.g.SetProcessNoNewPrivileges(security.GetNoNewPrivs())
 
+	for _, rlimit := range t.cont.rlimits {
+		t.g.AddProcessRlimits(rlimit.Type, rlimit.Hard, rlimit.Soft)
+	}
+
 	if err := t.configureCapabilities(); err != nil {
 		return err
 	}
@@ -340,9 +442,6 @@ func (t *containerTranslator) configureProcess() error {
 	}
 	t.g.Config.Linux.Seccomp = seccomp.DefaultProfile(t.g.Config) // reload seccomp profile after capabilities setup
 	t.g.SetProcessApparmorProfile(security.GetApparmorProfile())
-	if err := setupSELinux(&t.g, security.GetSelinuxOptions()); err != nil {
-		return err
-	}
 	if err := setupSeccomp(&t.g, security.GetSeccompProfilePath()); err != nil {
 		return err
 	}
@@ -352,7 +451,45 @@ func (t *containerTranslator) configureProcess() error {
 	return nil
 }
 
+// configureSELinux sets SELinux labels of the container. Unless SELinux
+// options set MCS level explicitly, container gets level of its pod, so
+// that pods are separated from each other on enforcing hosts while pod
+// containers can share volumes. When pod has no level, a unique one is
+// allocated and released when container is removed.
+func (t *containerTranslator) configureSELinux() error {
+	security := t.cont.GetLinux().GetSecurityContext()
+	options := security.GetSelinuxOptions()
+	if options == nil && security.GetPrivileged() {
+		return nil
+	}
+
+	ownLevel := options.GetLevel() == "" && t.cont.pod.mountLabel == ""
+	processLabel, mountLabel, err := selinuxLabels(withPodLevel(options, t.cont.pod.mountLabel))
+	if err != nil {
+		return err
+	}
+	glog.V(3).Infof("Setting mount label to %q", mountLabel)
+	t.g.SetLinuxMountLabel(mountLabel)
+	glog.V(3).Infof("Setting process's SELinux label to %q", processLabel)
+	t.g.SetProcessSelinuxLabel(processLabel)
+	if ownLevel {
+		t.cont.processLabel = processLabel
+	}
+	t.mountLabel = mountLabel
+	return nil
+}
+
 func (t *containerTranslator) configureCapabilities() error {
+	if caps := t.cont.defaultCapabilities; caps != nil {
+		t.g.Config.Process.Capabilities = &specs.LinuxCapabilities{
+			Bounding:    append([]string{}, caps...),
+			Effective:   append([]string{}, caps...),
+			Inheritable: append([]string{}, caps...),
+			Permitted:   append([]string{}, caps...),
+			Ambient:     append([]string{}, caps...),
+		}
+	}
+
 	security := t.cont.GetLinux().GetSecurityContext()
 	addCapabilities := security.GetCapabilities().GetAddCapabilities()
 	dropCapabilities := security.GetCapabilities().GetDropCapabilities()
@@ -394,6 +531,20 @@ func (t *containerTranslator) configureCapabilities() error {
 	return nil
 }
 
+func (t *containerTranslator) configureHooks() {
+	for _, hook := range t.cont.hooks {
+		glog.V(3).Infof("Adding %s hook %s to container %s", hook.Stage, hook.Name, t.cont.id)
+		switch hook.Stage {
+		case HookPrestart:
+			t.g.AddPreStartHook(hook.Hook)
+		case HookPoststart:
+			t.g.AddPostStartHook(hook.Hook)
+		case HookPoststop:
+			t.g.AddPostStopHook(hook.Hook)
+		}
+	}
+}
+
 func (t *containerTranslator) configureAnnotations() {
 	for k, v := range t.cont.GetAnnotations() {
 		t.g.AddAnnotation(k, v)
@@ -428,6 +579,12 @@ func (t *containerTranslator) configureUser() error {
 	if err != nil {
 		return err
 	}
+	if containerUser.Uid == 0 && t.runAsNonRoot() {
+		if userSpec == "" {
+			userSpec = "default"
+		}
+		return fmt.Errorf("container must run as non-root user, but %s user resolves to root", userSpec)
+	}
 
 	t.g.SetProcessUID(uint32(containerUser.Uid))
 	t.g.SetProcessGID(uint32(containerUser.Gid))
@@ -440,6 +597,17 @@ func (t *containerTranslator) configureUser() error {
 	return nil
 }
 
+// runAsNonRoot reports whether container or its pod is
+// annotated to be run as non-root user only.
+func (t *containerTranslator) runAsNonRoot() bool {
+	value, ok := t.cont.GetAnnotations()[RunAsNonRootAnnotation]
+	if !ok {
+		value = t.pod.GetAnnotations()[RunAsNonRootAnnotation]
+	}
+	nonRoot, _ := strconv.ParseBool(value)
+	return nonRoot
+}
+
 func getContainerUser(rootfs, userSpec string) (*user.ExecUser, error) {
 	passwdFile, err := os.Open(filepath.Join(rootfs, "/etc/passwd"))
 	if err == nil {
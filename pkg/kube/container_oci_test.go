@@ -0,0 +1,78 @@
+// Copyright (c) 2018-2019 Sylabs, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kube
+
+import (
+	"testing"
+
+	"github.com/opencontainers/runtime-tools/generate"
+	"github.com/stretchr/testify/require"
+	k8s "k8s.io/kubernetes/pkg/kubelet/apis/cri/runtime/v1alpha2"
+)
+
+func TestContainerTranslator_ConfigureProcMount(t *testing.T) {
+	// kubelet's default paths for Default proc mount
+	maskedPaths := []string{"/proc/acpi", "/proc/kcore", "/proc/keys", "/sys/firmware"}
+	readonlyPaths := []string{"/proc/bus", "/proc/sys", "/proc/sysrq-trigger"}
+
+	tt := []struct {
+		name           string
+		security       *k8s.LinuxContainerSecurityContext
+		expectMasked   []string
+		expectReadonly []string
+	}{
+		{
+			name: "default proc mount",
+			security: &k8s.LinuxContainerSecurityContext{
+				MaskedPaths:   maskedPaths,
+				ReadonlyPaths: readonlyPaths,
+			},
+			expectMasked:   maskedPaths,
+			expectReadonly: readonlyPaths,
+		},
+		{
+			name:     "unmasked proc mount",
+			security: &k8s.LinuxContainerSecurityContext{},
+		},
+		{
+			name: "privileged",
+			security: &k8s.LinuxContainerSecurityContext{
+				Privileged:    true,
+				MaskedPaths:   maskedPaths,
+				ReadonlyPaths: readonlyPaths,
+			},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			g, err := generate.New("linux")
+			require.NoError(t, err)
+			translator := containerTranslator{
+				g: g,
+				cont: &Container{
+					ContainerConfig: &k8s.ContainerConfig{
+						Linux: &k8s.LinuxContainerConfig{
+							SecurityContext: tc.security,
+						},
+					},
+				},
+			}
+			translator.configureProcMount()
+			require.Equal(t, tc.expectMasked, translator.g.Config.Linux.MaskedPaths)
+			require.Equal(t, tc.expectReadonly, translator.g.Config.Linux.ReadonlyPaths)
+		})
+	}
+}
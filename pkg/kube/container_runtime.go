@@ -21,28 +21,34 @@ import (
 
 	"github.com/golang/glog"
 	"github.com/sylabs/singularity-cri/pkg/singularity/runtime"
+	"github.com/sylabs/singularity/pkg/ociruntime"
 )
 
+// stateMaxAge is how long queried state of a running container or pod is
+// trusted when no state change was received on sync socket.
+const stateMaxAge = time.Minute
+
 func (c *Container) spawnOCIContainer() error {
-	err := c.addOCIBundle()
+	err := c.addOCIConfig()
 	if err != nil {
-		return fmt.Errorf("could not create oci bundle: %v", err)
+		return fmt.Errorf("could not create oci config: %v", err)
 	}
 
 	syncCtx, cancel := context.WithCancel(context.Background())
 	c.syncCancel = cancel
-	c.syncChan, err = runtime.ObserveState(syncCtx, c.socketPath())
+	events, err := runtime.ObserveState(syncCtx, c.socketPath())
 	if err != nil {
 		return fmt.Errorf("could not listen for state changes: %v", err)
 	}
+	c.syncState, c.syncChan = runtime.TrackState(events, stateMaxAge)
 
 	glog.V(3).Infof("Creating container %s", c.id)
 	// Allocate PTY only if no TTY was explicitly requested by a user.
 	// TTY is a special case handled on runtime side via attach socket.
 	c.stdin, err = c.cli.Create(c.id, c.bundlePath(), c.GetStdin(), c.GetTty(),
-		"--sync-socket", c.socketPath(), "--log-path", c.logPath)
+		"--sync-socket", c.socketPath(), "--log-path", c.logPath, "--log-format", runtime.LogFormatKubernetes)
 	if err != nil {
-		return fmt.Errorf("could not create container: %v", err)
+		return runtime.Wrap(err, "could not create container")
 	}
 
 	if err := c.expectState(runtime.StateCreating); err != nil {
@@ -56,26 +62,111 @@ func (c *Container) spawnOCIContainer() error {
 }
 
 // UpdateState updates container state according to information
-// received from the runtime.
+// received from the runtime. Runtime is queried only when sync socket
+// reported state change since the last query or stopped reporting them.
 func (c *Container) UpdateState() error {
-	var err error
-	c.ociState, err = c.cli.State(c.id)
+	var version uint64
+	if c.syncState != nil {
+		var outdated bool
+		version, outdated = c.syncState.Outdated()
+		if !outdated && c.ociState != nil {
+			return nil
+		}
+	}
+
+	state := c.cli.State
+	if c.session != nil {
+		state = func(string) (*ociruntime.State, error) {
+			return c.session.State()
+		}
+	}
+	ociState, err := state(c.id)
 	if err != nil {
-		return fmt.Errorf("could not get container state: %v", err)
+		return runtime.Wrap(err, "could not get container state")
 	}
-	c.runtimeState = runtime.StatusToState(c.ociState.Status)
+	c.setState(ociState, version)
 	return nil
 }
 
+// UpdateStates updates states of passed containers the same way UpdateState
+// does, but instead of querying outdated states one by one, containers of each
+// runtime are listed at once. Containers missing from the listing, e.g. created
+// meanwhile, or run by runtime that failed to list containers are queried
+// individually. Returned slice holds an error for each container which state
+// could not be updated.
+func UpdateStates(containers []*Container) []error {
+	errs := make([]error, len(containers))
+	versions := make([]uint64, len(containers))
+	outdated := make(map[runtime.OCIClient][]int)
+	for i, c := range containers {
+		if c.syncState != nil {
+			var isOutdated bool
+			versions[i], isOutdated = c.syncState.Outdated()
+			if !isOutdated && c.ociState != nil {
+				continue
+			}
+		}
+		outdated[c.cli] = append(outdated[c.cli], i)
+	}
+
+	for cli, indices := range outdated {
+		states, err := cli.List()
+		if err != nil {
+			glog.Warningf("Could not list containers, querying them one by one: %v", err)
+		}
+		for _, i := range indices {
+			c := containers[i]
+			state, ok := states[c.id]
+			if !ok {
+				errs[i] = c.UpdateState()
+				continue
+			}
+			c.setState(state, versions[i])
+		}
+	}
+	return errs
+}
+
+// setState records container state of passed sync version queried from runtime.
+func (c *Container) setState(state *ociruntime.State, version uint64) {
+	c.stateMu.Lock()
+	c.ociState = state
+	c.runtimeState = runtime.StatusToState(state.Status)
+	c.stateMu.Unlock()
+	if c.session != nil {
+		c.session.Observe(state)
+	}
+	if c.syncState != nil {
+		c.syncState.Queried(version)
+	}
+}
+
 // Pid returns pid of the container process in the host's PID namespace.
 func (c *Container) Pid() int {
+	c.stateMu.RLock()
+	defer c.stateMu.RUnlock()
 	return c.ociState.Pid
 }
 
+// getRuntimeState returns container state as it was last seen.
+func (c *Container) getRuntimeState() runtime.State {
+	c.stateMu.RLock()
+	defer c.stateMu.RUnlock()
+	return c.runtimeState
+}
+
+// setRuntimeState records container state received over sync socket.
+func (c *Container) setRuntimeState(state runtime.State) {
+	c.stateMu.Lock()
+	defer c.stateMu.Unlock()
+	c.runtimeState = state
+}
+
 func (c *Container) expectState(expect runtime.State) error {
-	c.runtimeState = <-c.syncChan
-	if c.runtimeState != expect {
-		return fmt.Errorf("unexpected container state: %v", c.runtimeState)
+	state := <-c.syncChan
+	c.setRuntimeState(state)
+	if state != expect {
+		return fmt.Errorf("unexpected container state: %v", state)
 	}
 	return nil
 }
@@ -87,7 +178,7 @@ func (c *Container) terminate(timeout int64) error {
 	// the end of terminate.
 	defer c.syncCancel()
 
-	if c.runtimeState == runtime.StateExited {
+	if c.getRuntimeState() == runtime.StateExited {
 		return nil
 	}
 
@@ -96,19 +187,16 @@ func (c *Container) terminate(timeout int64) error {
 	}
 
 	// otherwise give container a chance to terminate gracefully
-	var err error
-	if c.imgInfo.OciConfig != nil && c.imgInfo.OciConfig.StopSignal != "" {
-		err = c.cli.Signal(c.id, c.imgInfo.OciConfig.StopSignal)
-	} else {
-		err = c.cli.Kill(c.id, false)
-	}
+	glog.V(3).Infof("Sending %s to container %s", c.stopSignal, c.id)
+	err := c.signal(c.stopSignal)
 	if err != nil {
 		return fmt.Errorf("could not treminate container: %v", err)
 	}
 	select {
-	case c.runtimeState = <-c.syncChan:
-		if c.runtimeState != runtime.StateExited {
-			return fmt.Errorf("unexpected container state: %v", c.runtimeState)
+	case state := <-c.syncChan:
+		c.setRuntimeState(state)
+		if state != runtime.StateExited {
+			return fmt.Errorf("unexpected container state: %v", state)
 		}
 	case <-time.After(time.Second * time.Duration(timeout)):
 		glog.V(3).Infof("Termination timeout for container %s exceeded", c.id)
@@ -127,14 +215,22 @@ func (c *Container) kill() error {
 		defer c.syncCancel()
 	}
 
-	if c.runtimeState == runtime.StateExited {
+	if c.getRuntimeState() == runtime.StateExited {
 		return nil
 	}
 
 	glog.V(3).Infof("Forcibly stopping container %s", c.id)
-	err := c.cli.Kill(c.id, true)
+	err := c.signal("SIGKILL")
 	if err != nil {
 		return fmt.Errorf("could not kill container: %v", err)
 	}
 	return c.expectState(runtime.StateExited)
 }
+
+// signal sends sig to container process over control session when possible.
+func (c *Container) signal(sig string) error {
+	if c.session != nil {
+		return c.session.Signal(sig)
+	}
+	return c.cli.Signal(c.id, sig)
+}
@@ -20,8 +20,10 @@ import (
 	"strconv"
 
 	"github.com/containerd/cgroups"
+	"github.com/golang/glog"
 	"github.com/opencontainers/runtime-spec/specs-go"
 	"github.com/sylabs/singularity-cri/pkg/fs"
+	"github.com/sylabs/singularity-cri/pkg/singularity/runtime"
 	k8s "k8s.io/kubernetes/pkg/kubelet/apis/cri/runtime/v1alpha2"
 )
 
@@ -39,9 +41,9 @@ type ContainerStat struct {
 // implies that cpuacct and memory cgroups controllers are mounted on host
 // at /sys/fs/cgroups/cpuacct and  /sys/fs/cgroups/memory respectively.
 func (c *Container) Stat() (*ContainerStat, error) {
-	fsInfo, err := fs.Usage(c.baseDir)
+	fsInfo, err := c.fsUsage()
 	if err != nil {
-		return nil, fmt.Errorf("could not get fs usage: %v", err)
+		return nil, err
 	}
 	cgroup, err := cgroups.Load(cgroups.V1, cgroups.PidPath(c.Pid()))
 	if err != nil {
@@ -69,6 +71,39 @@ func (c *Container) Stat() (*ContainerStat, error) {
 	}, nil
 }
 
+// fsUsage returns usage of container writable layer. Project quota
+// is used when it is available, otherwise container directory is walked.
+func (c *Container) fsUsage() (*fs.UsageInfo, error) {
+	if c.projectID != 0 {
+		fsInfo, err := fs.ProjectUsage(c.baseDir, c.projectID)
+		if err == nil {
+			return fsInfo, nil
+		}
+		glog.Warningf("Could not get project quota usage of container %s: %v", c.id, err)
+	}
+	fsInfo, err := fs.Usage(c.baseDir)
+	if err != nil {
+		return nil, fmt.Errorf("could not get fs usage: %v", err)
+	}
+	return fsInfo, nil
+}
+
+// ValidateResourcesUpdate checks that upd is valid and remains valid once
+// merged with current container resources, so that update is not rejected
+// halfway through.
+func (c *Container) ValidateResourcesUpdate(upd *k8s.LinuxContainerResources) error {
+	if err := ValidateResources(upd); err != nil {
+		return err
+	}
+	if upd == nil {
+		return nil
+	}
+	if err := ValidateResources(mergeResources(c.GetLinux().GetResources(), upd)); err != nil {
+		return fmt.Errorf("resources after update are invalid: %v", err)
+	}
+	return nil
+}
+
 // UpdateResources updates container resources according to the passed request.
 // This method implies that cpu, cpuset and memory cgroups controllers are mounted on host
 // at /sys/fs/cgroups/cpu, /sys/fs/cgroups/cpuset  and  /sys/fs/cgroups/memory respectively.
@@ -107,22 +142,72 @@ func (c *Container) UpdateResources(upd *k8s.LinuxContainerResources) error {
 			Mems:   upd.CpusetMems,
 		},
 	}
-	err := c.cli.UpdateContainerResources(c.id, req)
-	if err != nil {
-		return fmt.Errorf("could not update resources: %v", err)
-	}
 
+	// oom_score_adj is opened before anything is updated
+	// so that exited container is not left half-updated
+	var oomAdj *os.File
 	if upd.OomScoreAdj != 0 {
-		oomAdj, err := os.OpenFile(fmt.Sprintf("/proc/%d/oom_adj", c.Pid()), os.O_WRONLY, 0644)
+		var err error
+		oomAdj, err = os.OpenFile(fmt.Sprintf("/proc/%d/oom_score_adj", c.Pid()), os.O_WRONLY, 0644)
 		if err != nil {
-			return fmt.Errorf("could not open oom_adj for container: %v", err)
+			return fmt.Errorf("could not open oom_score_adj for container: %v", err)
 		}
 		defer oomAdj.Close()
+	}
 
-		_, err = oomAdj.WriteString(strconv.FormatInt(upd.OomScoreAdj, 32))
+	// pod cgroup is grown to fit both old and new container limits
+	// before the update and is shrunk to the new ones after it
+	updated := mergeResources(c.GetLinux().GetResources(), upd)
+	if err := c.pod.reserveCgroup(c, updated); err != nil {
+		return err
+	}
+	err := c.cli.UpdateContainerResources(c.id, req)
+	if err != nil {
+		c.pod.releaseCgroup(c)
+		return runtime.Wrap(err, "could not update resources")
+	}
+	c.pod.setContainerResources(c, updated)
+	c.pod.releaseCgroup(c)
+	if err := c.pod.updateCgroup(); err != nil {
+		return err
+	}
+
+	if oomAdj != nil {
+		_, err = oomAdj.WriteString(strconv.FormatInt(upd.OomScoreAdj, 10))
 		if err != nil {
-			return fmt.Errorf("could not update oom_adj for container: %v", err)
+			return fmt.Errorf("could not update oom_score_adj for container: %v", err)
 		}
 	}
 	return nil
 }
+
+// mergeResources returns a copy of container resources with non-zero
+// values of the update applied, the same way UpdateResources applies them.
+func mergeResources(res, upd *k8s.LinuxContainerResources) *k8s.LinuxContainerResources {
+	merged := new(k8s.LinuxContainerResources)
+	if res != nil {
+		*merged = *res
+	}
+	if upd.GetCpuPeriod() != 0 {
+		merged.CpuPeriod = upd.GetCpuPeriod()
+	}
+	if upd.GetCpuQuota() != 0 {
+		merged.CpuQuota = upd.GetCpuQuota()
+	}
+	if upd.GetCpuShares() != 0 {
+		merged.CpuShares = upd.GetCpuShares()
+	}
+	if upd.GetMemoryLimitInBytes() != 0 {
+		merged.MemoryLimitInBytes = upd.GetMemoryLimitInBytes()
+	}
+	if upd.GetOomScoreAdj() != 0 {
+		merged.OomScoreAdj = upd.GetOomScoreAdj()
+	}
+	if upd.GetCpusetCpus() != "" {
+		merged.CpusetCpus = upd.GetCpusetCpus()
+	}
+	if upd.GetCpusetMems() != "" {
+		merged.CpusetMems = upd.GetCpusetMems()
+	}
+	return merged
+}
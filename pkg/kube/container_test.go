@@ -0,0 +1,208 @@
+// Copyright (c) 2018-2019 Sylabs, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kube
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/sylabs/singularity-cri/pkg/singularity/runtime"
+	"github.com/sylabs/singularity/pkg/ociruntime"
+)
+
+func TestContainer_ExitDescription(t *testing.T) {
+	exitCode := func(code int) *int {
+		return &code
+	}
+
+	tt := []struct {
+		name   string
+		state  runtime.State
+		oci    ociruntime.State
+		expect string
+	}{
+		{
+			name:   "running",
+			state:  runtime.StateRunning,
+			oci:    ociruntime.State{ExitDesc: ""},
+			expect: "",
+		},
+		{
+			name:   "exited normally",
+			state:  runtime.StateExited,
+			oci:    ociruntime.State{ExitCode: exitCode(1), ExitDesc: "exited with code 1"},
+			expect: "exited with code 1",
+		},
+		{
+			name:   "killed without description",
+			state:  runtime.StateExited,
+			oci:    ociruntime.State{ExitCode: exitCode(137)},
+			expect: "terminated by SIGKILL",
+		},
+		{
+			name:   "killed with description",
+			state:  runtime.StateExited,
+			oci:    ociruntime.State{ExitCode: exitCode(143), ExitDesc: "interrupted by signal"},
+			expect: "interrupted by signal, terminated by SIGTERM",
+		},
+		{
+			name:   "exit code unknown",
+			state:  runtime.StateExited,
+			oci:    ociruntime.State{},
+			expect: "exit code is unknown",
+		},
+		{
+			name:   "description names signal",
+			state:  runtime.StateExited,
+			oci:    ociruntime.State{ExitCode: exitCode(137), ExitDesc: "killed by SIGKILL"},
+			expect: "killed by SIGKILL",
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			oci := tc.oci
+			c := &Container{
+				runtimeState: tc.state,
+				ociState:     &oci,
+			}
+			require.Equal(t, tc.expect, c.ExitDescription())
+		})
+	}
+}
+
+func TestContainer_ExitCode(t *testing.T) {
+	exitCode := func(code int) *int {
+		return &code
+	}
+
+	tt := []struct {
+		name         string
+		state        runtime.State
+		oci          ociruntime.State
+		expectCode   int32
+		expectReason string
+	}{
+		{
+			name:  "running",
+			state: runtime.StateRunning,
+		},
+		{
+			name:         "completed",
+			state:        runtime.StateExited,
+			oci:          ociruntime.State{ExitCode: exitCode(0)},
+			expectReason: "Completed",
+		},
+		{
+			name:         "failed",
+			state:        runtime.StateExited,
+			oci:          ociruntime.State{ExitCode: exitCode(3)},
+			expectCode:   3,
+			expectReason: "Error",
+		},
+		{
+			name:         "exit code unknown",
+			state:        runtime.StateExited,
+			expectCode:   unknownExitCode,
+			expectReason: "Unknown",
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			oci := tc.oci
+			c := &Container{
+				runtimeState: tc.state,
+				ociState:     &oci,
+			}
+			require.Equal(t, tc.expectCode, c.ExitCode())
+			require.Equal(t, tc.expectReason, c.StateReason())
+		})
+	}
+}
+
+// listingClient serves container states from a single listing.
+type listingClient struct {
+	runtime.OCIClient
+	states  map[string]*ociruntime.State
+	lists   int
+	queries int
+}
+
+func (c *listingClient) List() (map[string]*ociruntime.State, error) {
+	c.lists++
+	return c.states, nil
+}
+
+func (c *listingClient) State(id string) (*ociruntime.State, error) {
+	c.queries++
+	return nil, runtime.ErrNotFound
+}
+
+func TestUpdateStates(t *testing.T) {
+	state := func(status string) *ociruntime.State {
+		s := &ociruntime.State{}
+		s.Status = status
+		return s
+	}
+	cli := &listingClient{
+		states: map[string]*ociruntime.State{
+			"running": state("running"),
+			"exited":  state("stopped"),
+		},
+	}
+	containers := []*Container{
+		{id: "running", cli: cli},
+		{id: "exited", cli: cli},
+		{id: "missing", cli: cli},
+	}
+
+	errs := UpdateStates(containers)
+	require.Equal(t, 1, cli.lists, "containers are not listed once")
+	require.Equal(t, 1, cli.queries, "missing container is not queried")
+	require.NoError(t, errs[0])
+	require.NoError(t, errs[1])
+	require.Error(t, errs[2])
+	require.Equal(t, runtime.StateRunning, containers[0].runtimeState)
+	require.Equal(t, runtime.StateExited, containers[1].runtimeState)
+}
+
+func TestContainer_StateConcurrent(t *testing.T) {
+	c := &Container{
+		id:       "test",
+		ociState: &ociruntime.State{},
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			state := &ociruntime.State{}
+			state.Status = "running"
+			if i%2 == 0 {
+				state.Status = "stopped"
+			}
+			c.setState(state, 0)
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		c.State()
+		c.StateReason()
+		c.ExitDescription()
+		c.FinishedAt()
+	}
+	<-done
+	require.Equal(t, runtime.StateRunning, c.getRuntimeState())
+}
@@ -16,10 +16,15 @@ package kube
 
 import (
 	"fmt"
+	"path/filepath"
+	"strconv"
 	"strings"
 
 	"github.com/golang/glog"
+	"github.com/opencontainers/runtime-spec/specs-go"
 	"github.com/sylabs/singularity/pkg/util/capabilities"
+	"golang.org/x/sys/unix"
+	k8s "k8s.io/kubernetes/pkg/kubelet/apis/cri/runtime/v1alpha2"
 )
 
 const (
@@ -30,6 +35,24 @@ const (
 	defaultSeccompProfile       = "runtime/default"
 	defaultDockerSeccompProfile = "docker/default"
 	unconfinedSeccompProfile    = "unconfined"
+
+	// RunAsNonRootAnnotation may be set to true on pod or container to reject
+	// containers which user resolves to root, taking image USER into account.
+	// CRI v1alpha2 does not pass runAsNonRoot flag, kubelet checks it using image
+	// status only, which doesn't take usernames from container rootfs into account.
+	RunAsNonRootAnnotation = "sycri.sylabs.io/run-as-non-root"
+
+	// StopSignalAnnotation may be set on container to override signal
+	// that is sent to container process on graceful stop, e.g. SIGQUIT.
+	// When not set, stop signal from image config is used, if any.
+	StopSignalAnnotation = "sycri.sylabs.io/stop-signal"
+	// DefaultStopSignal is sent to container process on graceful stop
+	// when neither container nor image specify stop signal.
+	DefaultStopSignal = "SIGTERM"
+
+	// DefaultSeccompProfileRoot is a default directory relative localhost
+	// seccomp profiles are loaded from. It is the same as kubelet's default.
+	DefaultSeccompProfileRoot = "/var/lib/kubelet/seccomp"
 )
 
 func (c *Container) validateConfig() error {
@@ -42,21 +65,128 @@ func (c *Container) validateConfig() error {
 	}
 
 	if aaProfile != "" {
-		if aaProfile == defaultAppArmorProfile {
-			aaProfile = "" // do not specify anything in that case
-		}
-		aaProfile = strings.TrimPrefix(aaProfile, appArmorLocalhostPrefix)
+		aaProfile = AppArmorProfileName(aaProfile)
 		glog.V(2).Infof("Setting AppArmor profile to %q for container %s", aaProfile, c.id)
 		security.ApparmorProfile = aaProfile
 	}
-	if security != nil {
-		scProfile, err := prepareSeccompPath(security.GetSeccompProfilePath())
+	if security == nil {
+		// node-wide default profile applies to containers without security context too
+		if c.GetLinux() == nil {
+			c.Linux = new(k8s.LinuxContainerConfig)
+		}
+		security = new(k8s.LinuxContainerSecurityContext)
+		c.Linux.SecurityContext = security
+	}
+	scProfile, err := prepareSeccompPath(security.GetSeccompProfilePath(), c.pod.seccompProfileRoot, c.defaultSeccompProfile)
+	if err != nil {
+		return fmt.Errorf("invalid seccomp profile path: %v", err)
+	}
+	glog.V(2).Infof("Setting seccomp profile to %q for container %s", scProfile, c.id)
+	security.SeccompProfilePath = scProfile
+
+	c.shmSize = c.pod.shmSize
+	if size, ok := c.GetAnnotations()[ShmSizeAnnotation]; ok {
+		var err error
+		c.shmSize, err = ParseShmSize(size)
+		if err != nil {
+			return err
+		}
+		glog.V(2).Infof("Setting shm size to %d for container %s", c.shmSize, c.id)
+	}
+
+	for _, annotations := range []map[string]string{c.pod.GetAnnotations(), c.GetAnnotations()} {
+		if limit, ok := annotations[EphemeralStorageLimitAnnotation]; ok {
+			var err error
+			c.storageLimit, err = ParseEphemeralStorageLimit(limit)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	if c.storageLimit != 0 {
+		glog.V(2).Infof("Setting ephemeral storage limit to %d for container %s", c.storageLimit, c.id)
+	}
+
+	if value, ok := c.GetAnnotations()[TmpfsAnnotation]; ok {
+		var err error
+		c.tmpfsMounts, err = ParseTmpfsMounts(value)
+		if err != nil {
+			return err
+		}
+	}
+
+	c.realtimeRuntime, c.realtimePeriod, err = parseRealtime(c.GetAnnotations(), c.realtimeAllowed)
+	if err != nil {
+		return err
+	}
+
+	res := c.GetLinux().GetResources()
+	if c.numaAwareCpuset && res.GetCpusetCpus() != "" && res.GetCpusetMems() == "" {
+		mems, err := numaNodesOf(res.GetCpusetCpus())
+		if err != nil {
+			glog.Warningf("Could not find NUMA nodes of container %s cpus: %v", c.id, err)
+		} else if mems != "" {
+			glog.V(2).Infof("Setting cpuset mems to %q for container %s", mems, c.id)
+			res.CpusetMems = mems
+		}
+	}
+
+	// container annotation takes precedence over pod one
+	tz := c.timezone
+	for _, annotations := range []map[string]string{c.pod.GetAnnotations(), c.GetAnnotations()} {
+		if value, ok := annotations[TimezoneAnnotation]; ok {
+			tz = value
+		}
+	}
+	c.timezoneFile, err = TimezoneFile(tz)
+	if err != nil {
+		return err
+	}
+
+	// pod annotations override node-wide exec environment settings
+	deny, extra := c.execEnvDeny, c.execEnvExtra
+	if value, ok := c.pod.GetAnnotations()[ExecEnvDenyAnnotation]; ok {
+		deny = splitList(value)
+	}
+	if value, ok := c.pod.GetAnnotations()[ExecEnvAnnotation]; ok {
+		extra = append(append([]string(nil), extra...), splitList(value)...)
+	}
+	if err := ValidateExecEnv(deny, extra); err != nil {
+		return err
+	}
+	c.execEnvs = filterEnv(c.execEnvs, deny, extra)
+
+	// later limits of the same type override previous ones in spec
+	rlimits := append([]specs.POSIXRlimit(nil), c.rlimits...)
+	for _, annotations := range []map[string]string{c.pod.GetAnnotations(), c.GetAnnotations()} {
+		if value, ok := annotations[RlimitsAnnotation]; ok {
+			annotated, err := ParseRlimits(value)
+			if err != nil {
+				return err
+			}
+			rlimits = append(rlimits, annotated...)
+		}
+	}
+	c.rlimits = rlimits
+
+	if value, ok := c.GetAnnotations()[StopSignalAnnotation]; ok {
+		c.stopSignal, err = ParseStopSignal(value)
+		if err != nil {
+			return err
+		}
+	} else if c.imgInfo.OciConfig != nil && c.imgInfo.OciConfig.StopSignal != "" {
+		c.stopSignal, err = ParseStopSignal(c.imgInfo.OciConfig.StopSignal)
 		if err != nil {
-			return fmt.Errorf("invalid seccomp profile path: %v", err)
+			glog.Warningf("Ignoring image stop signal of container %s: %v", c.id, err)
 		}
-		glog.V(2).Infof("Setting seccomp profile to %q for container %s", scProfile, c.id)
-		security.SeccompProfilePath = scProfile
 	}
+	if c.stopSignal == "" {
+		c.stopSignal = c.defaultStopSignal
+	}
+	if c.stopSignal == "" {
+		c.stopSignal = DefaultStopSignal
+	}
+
 	caps := security.GetCapabilities()
 	if caps != nil {
 		caps.AddCapabilities = prepareCapabilities(caps.AddCapabilities, nil)
@@ -65,20 +195,75 @@ func (c *Container) validateConfig() error {
 	return nil
 }
 
-func prepareSeccompPath(scProfile string) (string, error) {
+// AppArmorProfileName returns name of AppArmor profile that should be
+// applied to a container with the profile requested in security context.
+// Empty name is returned for runtime default profile.
+func AppArmorProfileName(profile string) string {
+	if profile == defaultAppArmorProfile {
+		return "" // do not specify anything in that case
+	}
+	return strings.TrimPrefix(profile, appArmorLocalhostPrefix)
+}
+
+// prepareSeccompPath returns path to seccomp profile file that should be loaded
+// for the profile name from security context. Localhost profiles with absolute path
+// are used as is, since kubelet resolves them against its own profile root, while
+// relative ones are looked up in profileRoot and are not allowed to escape it.
+func prepareSeccompPath(scProfile, profileRoot, defaultProfile string) (string, error) {
+	if scProfile == "" && defaultProfile != "" {
+		// node-wide default profile is used instead of unconfined
+		return defaultProfile, nil
+	}
 	if scProfile == "" || scProfile == unconfinedSeccompProfile {
 		// empty profile equals to unconfined according to docs
 		return unconfinedSeccompProfile, nil
 	}
 	if scProfile == defaultSeccompProfile || scProfile == defaultDockerSeccompProfile {
-		// set runtime default profile - nothing in our case
-		return "", nil
+		// runtime default is requested, may be overridden node-wide,
+		// empty path means built-in runtime default profile
+		return defaultProfile, nil
 	}
 	if !strings.HasPrefix(scProfile, seccompLocalhostPrefix) {
 		return "", fmt.Errorf("custom profiles without %q prefix are not allowed", seccompLocalhostPrefix)
 	}
 	scProfile = strings.TrimPrefix(scProfile, seccompLocalhostPrefix)
-	return scProfile, nil
+	if scProfile == "" {
+		return "", fmt.Errorf("localhost profile path cannot be empty")
+	}
+	if filepath.IsAbs(scProfile) {
+		return scProfile, nil
+	}
+
+	if profileRoot == "" {
+		profileRoot = DefaultSeccompProfileRoot
+	}
+	profileRoot = filepath.Clean(profileRoot)
+	path := filepath.Join(profileRoot, scProfile)
+	if !strings.HasPrefix(path, profileRoot+string(filepath.Separator)) {
+		return "", fmt.Errorf("profile %q is outside of %s", scProfile, profileRoot)
+	}
+	return path, nil
+}
+
+// ParseStopSignal returns normalized name of stop signal sig that may be set
+// either by name, with or without SIG prefix, or by number.
+func ParseStopSignal(sig string) (string, error) {
+	if num, err := strconv.Atoi(sig); err == nil {
+		name := unix.SignalName(unix.Signal(num))
+		if name == "" {
+			return "", fmt.Errorf("unknown stop signal %q", sig)
+		}
+		return name, nil
+	}
+
+	name := strings.ToUpper(sig)
+	if !strings.HasPrefix(name, "SIG") {
+		name = "SIG" + name
+	}
+	if unix.SignalNum(name) == 0 {
+		return "", fmt.Errorf("unknown stop signal %q", sig)
+	}
+	return name, nil
 }
 
 func prepareCapabilities(caps []string, excluded []string) []string {
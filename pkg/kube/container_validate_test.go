@@ -0,0 +1,146 @@
+// Copyright (c) 2018-2019 Sylabs, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kube
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPrepareSeccompPath(t *testing.T) {
+	tt := []struct {
+		name        string
+		profile     string
+		root        string
+		defaultPath string
+		expectPath  string
+		expectError error
+	}{
+		{
+			name:       "empty profile",
+			profile:    "",
+			expectPath: unconfinedSeccompProfile,
+		},
+		{
+			name:       "runtime default",
+			profile:    defaultSeccompProfile,
+			expectPath: "",
+		},
+		{
+			name:        "empty profile with node default",
+			profile:     "",
+			defaultPath: "/etc/sycri/seccomp.json",
+			expectPath:  "/etc/sycri/seccomp.json",
+		},
+		{
+			name:        "unconfined with node default",
+			profile:     unconfinedSeccompProfile,
+			defaultPath: "/etc/sycri/seccomp.json",
+			expectPath:  unconfinedSeccompProfile,
+		},
+		{
+			name:        "runtime default with node default",
+			profile:     defaultDockerSeccompProfile,
+			defaultPath: "/etc/sycri/seccomp.json",
+			expectPath:  "/etc/sycri/seccomp.json",
+		},
+		{
+			name:       "absolute localhost profile",
+			profile:    "localhost//var/lib/kubelet/seccomp/audit.json",
+			root:       "/etc/sycri/seccomp",
+			expectPath: "/var/lib/kubelet/seccomp/audit.json",
+		},
+		{
+			name:       "relative localhost profile",
+			profile:    "localhost/profiles/audit.json",
+			root:       "/etc/sycri/seccomp/",
+			expectPath: "/etc/sycri/seccomp/profiles/audit.json",
+		},
+		{
+			name:       "default profile root",
+			profile:    "localhost/audit.json",
+			expectPath: "/var/lib/kubelet/seccomp/audit.json",
+		},
+		{
+			name:        "escaping profile root",
+			profile:     "localhost/../../../etc/passwd",
+			root:        "/etc/sycri/seccomp",
+			expectError: fmt.Errorf(`profile "../../../etc/passwd" is outside of /etc/sycri/seccomp`),
+		},
+		{
+			name:        "empty localhost profile",
+			profile:     "localhost/",
+			expectError: fmt.Errorf("localhost profile path cannot be empty"),
+		},
+		{
+			name:        "no localhost prefix",
+			profile:     "audit.json",
+			expectError: fmt.Errorf(`custom profiles without "localhost/" prefix are not allowed`),
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			path, err := prepareSeccompPath(tc.profile, tc.root, tc.defaultPath)
+			require.Equal(t, tc.expectError, err)
+			require.Equal(t, tc.expectPath, path)
+		})
+	}
+}
+
+func TestPrepareStopSignal(t *testing.T) {
+	tt := []struct {
+		name         string
+		sig          string
+		expectSignal string
+		expectError  error
+	}{
+		{
+			name:         "full name",
+			sig:          "SIGQUIT",
+			expectSignal: "SIGQUIT",
+		},
+		{
+			name:         "short lowercase name",
+			sig:          "term",
+			expectSignal: "SIGTERM",
+		},
+		{
+			name:         "number",
+			sig:          "3",
+			expectSignal: "SIGQUIT",
+		},
+		{
+			name:        "unknown name",
+			sig:         "SIGFOO",
+			expectError: fmt.Errorf(`unknown stop signal "SIGFOO"`),
+		},
+		{
+			name:        "unknown number",
+			sig:         "0",
+			expectError: fmt.Errorf(`unknown stop signal "0"`),
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			sig, err := ParseStopSignal(tc.sig)
+			require.Equal(t, tc.expectError, err)
+			require.Equal(t, tc.expectSignal, sig)
+		})
+	}
+}
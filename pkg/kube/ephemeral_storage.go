@@ -0,0 +1,92 @@
+// Copyright (c) 2018-2019 Sylabs, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kube
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/golang/glog"
+	"github.com/sylabs/singularity-cri/pkg/singularity/runtime"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// EphemeralStorageLimitAnnotation may be set on pod or container to limit ephemeral
+// storage, i.e. writable layer and log file, each container may use, written as
+// Kubernetes quantity, e.g. 1Gi. Container annotation takes precedence.
+const EphemeralStorageLimitAnnotation = "sycri.sylabs.io/ephemeral-storage-limit"
+
+// reasonEphemeralStorage is a reason of containers stopped due to
+// exceeded ephemeral storage limit.
+const reasonEphemeralStorage = "EphemeralStorageLimitExceeded"
+
+// ParseEphemeralStorageLimit parses ephemeral storage limit written
+// as Kubernetes quantity, e.g. 1Gi, into number of bytes.
+func ParseEphemeralStorageLimit(limit string) (int64, error) {
+	q, err := resource.ParseQuantity(limit)
+	if err != nil {
+		return 0, fmt.Errorf("invalid ephemeral storage limit %q: %v", limit, err)
+	}
+	if q.Value() <= 0 {
+		return 0, fmt.Errorf("ephemeral storage limit should be positive, got %q", limit)
+	}
+	return q.Value(), nil
+}
+
+// EnforceStorageLimit checks ephemeral storage usage of running container and
+// stops it when usage exceeds container's limit. It returns true when container
+// is stopped, in which case its state reason reflects exceeded limit.
+func (c *Container) EnforceStorageLimit() (bool, error) {
+	if c.storageLimit == 0 || c.getRuntimeState() != runtime.StateRunning {
+		return false, nil
+	}
+	usage, err := c.storageUsage()
+	if err != nil {
+		return false, fmt.Errorf("could not get ephemeral storage usage: %v", err)
+	}
+	if usage <= c.storageLimit {
+		return false, nil
+	}
+
+	glog.Warningf("Container %s uses %d bytes of ephemeral storage exceeding its limit of %d bytes, stopping it",
+		c.id, usage, c.storageLimit)
+	c.stateMu.Lock()
+	c.storageExceeded = fmt.Sprintf("Container used %d bytes of ephemeral storage exceeding its limit of %d bytes",
+		usage, c.storageLimit)
+	c.stateMu.Unlock()
+	if err := c.Stop(0); err != nil {
+		return false, fmt.Errorf("could not stop container: %v", err)
+	}
+	return true, nil
+}
+
+// storageUsage returns number of bytes used by container writable layer and log file.
+func (c *Container) storageUsage() (int64, error) {
+	fsInfo, err := c.fsUsage()
+	if err != nil {
+		return 0, err
+	}
+	usage := fsInfo.Bytes
+	if c.LogPath() != "" {
+		fi, err := os.Stat(c.LogPath())
+		if err != nil && !os.IsNotExist(err) {
+			return 0, fmt.Errorf("could not stat log file: %v", err)
+		}
+		if err == nil {
+			usage += fi.Size()
+		}
+	}
+	return usage, nil
+}
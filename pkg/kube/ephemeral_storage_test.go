@@ -0,0 +1,60 @@
+// Copyright (c) 2018-2019 Sylabs, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kube
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseEphemeralStorageLimit(t *testing.T) {
+	tt := []struct {
+		name        string
+		limit       string
+		expectLimit int64
+		expectError error
+	}{
+		{
+			name:        "binary suffix",
+			limit:       "2Gi",
+			expectLimit: 2 << 30,
+		},
+		{
+			name:        "decimal suffix",
+			limit:       "500M",
+			expectLimit: 500000000,
+		},
+		{
+			name:        "zero",
+			limit:       "0",
+			expectError: fmt.Errorf(`ephemeral storage limit should be positive, got "0"`),
+		},
+		{
+			name:        "negative",
+			limit:       "-1Gi",
+			expectError: fmt.Errorf(`ephemeral storage limit should be positive, got "-1Gi"`),
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			limit, err := ParseEphemeralStorageLimit(tc.limit)
+			require.Equal(t, tc.expectError, err)
+			require.Equal(t, tc.expectLimit, limit)
+		})
+	}
+}
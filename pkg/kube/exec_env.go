@@ -0,0 +1,94 @@
+// Copyright (c) 2018-2019 Sylabs, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kube
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+const (
+	// ExecEnvDenyAnnotation may be set on pod to override node-wide list of
+	// environment variables that are not passed to exec sessions. It is set
+	// to comma-separated names or shell patterns, e.g. AWS_*,DB_PASSWORD.
+	ExecEnvDenyAnnotation = "sycri.sylabs.io/exec-env-deny"
+	// ExecEnvAnnotation may be set on pod to set additional environment
+	// variables of exec sessions written as comma-separated KEY=VALUE pairs.
+	// They are added to the node-wide ones and override them.
+	ExecEnvAnnotation = "sycri.sylabs.io/exec-env"
+)
+
+// WithExecEnv sets environment variables that are removed from exec sessions
+// environment (deny) and the ones that are added to it (extra). Deny list is
+// written as names or shell patterns and extra as KEY=VALUE pairs.
+func WithExecEnv(deny, extra []string) ContainerOption {
+	return func(c *Container) {
+		c.execEnvDeny = deny
+		c.execEnvExtra = extra
+	}
+}
+
+// ValidateExecEnv checks deny patterns and extra variables
+// that are passed to WithExecEnv are well-formed.
+func ValidateExecEnv(deny, extra []string) error {
+	for _, pattern := range deny {
+		if _, err := path.Match(pattern, ""); err != nil || pattern == "" {
+			return fmt.Errorf("invalid exec env deny pattern %q", pattern)
+		}
+	}
+	for _, kv := range extra {
+		if strings.IndexByte(kv, '=') <= 0 {
+			return fmt.Errorf("invalid exec env %q: should be KEY=VALUE", kv)
+		}
+	}
+	return nil
+}
+
+// filterEnv returns env without variables matching deny patterns and with
+// extra variables appended, so that they override previous values.
+func filterEnv(env, deny, extra []string) []string {
+	filtered := make([]string, 0, len(env)+len(extra))
+	for _, kv := range env {
+		name := kv
+		if i := strings.IndexByte(kv, '='); i >= 0 {
+			name = kv[:i]
+		}
+		if !matchesAny(name, deny) {
+			filtered = append(filtered, kv)
+		}
+	}
+	return append(filtered, extra...)
+}
+
+func matchesAny(name string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// splitList splits comma-separated list skipping empty items.
+func splitList(list string) []string {
+	var items []string
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,107 @@
+// Copyright (c) 2018-2019 Sylabs, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kube
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFilterEnv(t *testing.T) {
+	env := []string{
+		"PATH=/bin",
+		"AWS_ACCESS_KEY_ID=foo",
+		"AWS_SECRET_ACCESS_KEY=bar",
+		"DB_PASSWORD=secret",
+		"HOME=/root",
+	}
+
+	tt := []struct {
+		name      string
+		deny      []string
+		extra     []string
+		expectEnv []string
+	}{
+		{
+			name:      "no filtering",
+			expectEnv: env,
+		},
+		{
+			name: "deny by name and pattern",
+			deny: []string{"AWS_*", "DB_PASSWORD"},
+			expectEnv: []string{
+				"PATH=/bin",
+				"HOME=/root",
+			},
+		},
+		{
+			name:  "extra variables override",
+			deny:  []string{"DB_*"},
+			extra: []string{"PATH=/usr/local/bin:/bin", "DB_HOST=db"},
+			expectEnv: []string{
+				"PATH=/bin",
+				"AWS_ACCESS_KEY_ID=foo",
+				"AWS_SECRET_ACCESS_KEY=bar",
+				"HOME=/root",
+				"PATH=/usr/local/bin:/bin",
+				"DB_HOST=db",
+			},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			require.Equal(t, tc.expectEnv, filterEnv(env, tc.deny, tc.extra))
+		})
+	}
+}
+
+func TestValidateExecEnv(t *testing.T) {
+	tt := []struct {
+		name        string
+		deny        []string
+		extra       []string
+		expectError error
+	}{
+		{
+			name:  "valid",
+			deny:  []string{"AWS_*", "TOKEN"},
+			extra: []string{"PATH=/bin", "EMPTY="},
+		},
+		{
+			name:        "bad pattern",
+			deny:        []string{"AWS_["},
+			expectError: fmt.Errorf(`invalid exec env deny pattern "AWS_["`),
+		},
+		{
+			name:        "extra without value",
+			extra:       []string{"PATH"},
+			expectError: fmt.Errorf(`invalid exec env "PATH": should be KEY=VALUE`),
+		},
+		{
+			name:        "extra without name",
+			extra:       []string{"=foo"},
+			expectError: fmt.Errorf(`invalid exec env "=foo": should be KEY=VALUE`),
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			require.Equal(t, tc.expectError, ValidateExecEnv(tc.deny, tc.extra))
+		})
+	}
+}
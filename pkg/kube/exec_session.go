@@ -0,0 +1,102 @@
+// Copyright (c) 2018-2019 Sylabs, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kube
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/sylabs/singularity-cri/pkg/rand"
+)
+
+// ExecSessionIDLen reflects number of symbols in exec session unique ID.
+const ExecSessionIDLen = 16
+
+// ErrExecSessionNotFound is returned when exec session with requested ID is not running.
+var ErrExecSessionNotFound = fmt.Errorf("exec session is not found")
+
+// ExecSession describes streaming exec process running in a container.
+type ExecSession struct {
+	ID        string    `json:"id"`
+	Command   []string  `json:"command"`
+	User      string    `json:"user"`
+	TTY       bool      `json:"tty"`
+	StartedAt time.Time `json:"startedAt"`
+
+	cancel context.CancelFunc
+}
+
+// StartExecSession registers exec session running cmd in container. Returned context
+// should be used to run the exec process and is cancelled when session is terminated
+// with KillExecSession. Returned function must be called when exec process exits.
+func (c *Container) StartExecSession(cmd []string, tty bool) (context.Context, func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	session := &ExecSession{
+		ID:        rand.GenerateID(ExecSessionIDLen),
+		Command:   cmd,
+		User:      c.processUser,
+		TTY:       tty,
+		StartedAt: time.Now(),
+		cancel:    cancel,
+	}
+
+	c.execMu.Lock()
+	if c.execSessions == nil {
+		c.execSessions = make(map[string]*ExecSession)
+	}
+	c.execSessions[session.ID] = session
+	c.execMu.Unlock()
+	glog.V(3).Infof("Started exec session %s in container %s", session.ID, c.id)
+
+	return ctx, func() {
+		cancel()
+		c.execMu.Lock()
+		delete(c.execSessions, session.ID)
+		c.execMu.Unlock()
+		glog.V(3).Infof("Finished exec session %s in container %s", session.ID, c.id)
+	}
+}
+
+// ExecSessions returns exec sessions running in container sorted by start time.
+func (c *Container) ExecSessions() []ExecSession {
+	c.execMu.Lock()
+	defer c.execMu.Unlock()
+
+	sessions := make([]ExecSession, 0, len(c.execSessions))
+	for _, session := range c.execSessions {
+		sessions = append(sessions, *session)
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].StartedAt.Before(sessions[j].StartedAt)
+	})
+	return sessions
+}
+
+// KillExecSession kills exec process of session with passed id.
+func (c *Container) KillExecSession(id string) error {
+	c.execMu.Lock()
+	defer c.execMu.Unlock()
+
+	session, ok := c.execSessions[id]
+	if !ok {
+		return ErrExecSessionNotFound
+	}
+	glog.V(2).Infof("Killing exec session %s in container %s", id, c.id)
+	session.cancel()
+	return nil
+}
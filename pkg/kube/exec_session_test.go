@@ -0,0 +1,54 @@
+// Copyright (c) 2018-2019 Sylabs, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kube
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestExecSessions(t *testing.T) {
+	c := &Container{
+		id:          "test",
+		processUser: "1000:1000",
+	}
+	require.Empty(t, c.ExecSessions())
+
+	shCtx, shDone := c.StartExecSession([]string{"sh"}, true)
+	_, lsDone := c.StartExecSession([]string{"ls", "-l"}, false)
+
+	sessions := c.ExecSessions()
+	require.Len(t, sessions, 2)
+	require.Equal(t, []string{"sh"}, sessions[0].Command)
+	require.Equal(t, "1000:1000", sessions[0].User)
+	require.True(t, sessions[0].TTY)
+	require.Equal(t, []string{"ls", "-l"}, sessions[1].Command)
+	require.False(t, sessions[1].TTY)
+
+	require.Equal(t, ErrExecSessionNotFound, c.KillExecSession("unknown"))
+	require.NoError(t, c.KillExecSession(sessions[0].ID))
+	select {
+	case <-shCtx.Done():
+	default:
+		t.Fatalf("killed exec session context is not done")
+	}
+	// session is listed until exec process exits
+	require.Len(t, c.ExecSessions(), 2)
+
+	shDone()
+	lsDone()
+	require.Empty(t, c.ExecSessions())
+}
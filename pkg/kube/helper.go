@@ -15,24 +15,94 @@
 package kube
 
 import (
+	"bufio"
+	"bytes"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
 
 	"github.com/golang/glog"
+	"k8s.io/apimachinery/pkg/api/resource"
 	k8s "k8s.io/kubernetes/pkg/kubelet/apis/cri/runtime/v1alpha2"
 )
 
-func writeResolvConf(path string, config *k8s.DNSConfig) error {
+// maxDNSNameservers is a maximum number of nameservers libc resolver uses.
+const maxDNSNameservers = 3
+
+// dnsNumericOptions are resolver options that require a non-negative integer value.
+var dnsNumericOptions = map[string]bool{
+	"ndots":    true,
+	"timeout":  true,
+	"attempts": true,
+}
+
+// dnsFlagOptions are resolver options that have no value.
+var dnsFlagOptions = map[string]bool{
+	"debug":                 true,
+	"rotate":                true,
+	"no-check-names":        true,
+	"inet6":                 true,
+	"ip6-bytestring":        true,
+	"ip6-dotint":            true,
+	"no-ip6-dotint":         true,
+	"edns0":                 true,
+	"single-request":        true,
+	"single-request-reopen": true,
+	"no-tld-query":          true,
+	"use-vc":                true,
+	"no-reload":             true,
+	"trust-ad":              true,
+}
+
+// ShmSizeAnnotation may be set on pod or container to override size
+// of /dev/shm, e.g. 1Gi. Container annotation takes precedence.
+const ShmSizeAnnotation = "sycri.sylabs.io/shm-size"
+
+// ParseShmSize parses /dev/shm size written as Kubernetes
+// quantity, e.g. 512Mi or 2G, into number of bytes.
+func ParseShmSize(size string) (int64, error) {
+	q, err := resource.ParseQuantity(size)
+	if err != nil {
+		return 0, fmt.Errorf("invalid shm size %q: %v", size, err)
+	}
+	if q.Value() <= 0 {
+		return 0, fmt.Errorf("shm size should be positive, got %q", size)
+	}
+	return q.Value(), nil
+}
+
+// writeResolvConf creates resolv.conf file at path according to the passed DNS config.
+// Kubelet sends complete DNS config for ClusterFirst and None DNS policies and entries
+// of its own resolv.conf for Default one, so host's resolv.conf at hostPath is used only
+// when pod's config is empty, e.g. for Default policy when kubelet runs with empty
+// --resolv-conf. When there are no settings to write neither from pod config
+// nor from the host, no file is created and false is returned.
+func writeResolvConf(path string, config *k8s.DNSConfig, hostPath string) (bool, error) {
+	if hostPath != "" && isEmptyDNSConfig(config) {
+		hostConfig, err := parseResolvConf(hostPath)
+		if err != nil && !os.IsNotExist(err) {
+			return false, fmt.Errorf("could not read host resolv.conf: %v", err)
+		}
+		if hostConfig != nil {
+			config = hostConfig
+		}
+	}
 	if config == nil {
-		return nil
+		return false, nil
+	}
+	config, err := normalizeDNSConfig(config)
+	if err != nil {
+		return false, err
 	}
 
 	glog.V(5).Infof("Creating resolv.conf file %s", path)
-	resolv, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	resolv, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
 	if err != nil {
-		return fmt.Errorf("could not create %s: %v", podResolvConfPath, err)
+		return false, fmt.Errorf("could not create %s: %v", podResolvConfPath, err)
 	}
 	for _, s := range config.GetServers() {
 		fmt.Fprintf(resolv, "nameserver %s\n", s)
@@ -44,11 +114,239 @@ func writeResolvConf(path string, config *k8s.DNSConfig) error {
 		fmt.Fprintf(resolv, "options %s\n", o)
 	}
 	if err = resolv.Close(); err != nil {
-		return fmt.Errorf("could not close %s: %v", podResolvConfPath, err)
+		return false, fmt.Errorf("could not close %s: %v", podResolvConfPath, err)
+	}
+	return true, nil
+}
+
+// writeHosts creates hosts file at path with localhost entries and, when ip
+// is not empty, an entry that resolves hostname to ip. The file has the same
+// content as the one kubelet generates for pods without host aliases.
+func writeHosts(path, ip, hostname string) error {
+	glog.V(5).Infof("Creating hosts file %s", path)
+	var buf bytes.Buffer
+	buf.WriteString("# Kubernetes-managed hosts file.\n")
+	buf.WriteString("127.0.0.1\tlocalhost\n")
+	buf.WriteString("::1\tlocalhost ip6-localhost ip6-loopback\n")
+	buf.WriteString("fe00::0\tip6-localnet\n")
+	buf.WriteString("fe00::0\tip6-mcastprefix\n")
+	buf.WriteString("fe00::1\tip6-allnodes\n")
+	buf.WriteString("fe00::2\tip6-allrouters\n")
+	if ip != "" && hostname != "" {
+		fmt.Fprintf(&buf, "%s\t%s\n", ip, hostname)
+	}
+	if err := ioutil.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		return fmt.Errorf("could not write %s: %v", path, err)
+	}
+	return nil
+}
+
+// maxSymlinks is a maximum number of symlinks followed while resolving a path.
+const maxSymlinks = 40
+
+// mkdirInRoot creates directory path with all missing parents inside root
+// directory, e.g. container rootfs, and makes uid and gid owners of the created
+// directories. Symlinks are resolved as if root was a filesystem root, so that
+// resulting path never escapes it.
+func mkdirInRoot(root, path string, uid, gid int) error {
+	current := "/"
+	components := strings.Split(path, "/")
+	links := 0
+	for len(components) > 0 {
+		component := components[0]
+		components = components[1:]
+		if component == "" || component == "." {
+			continue
+		}
+		if component == ".." {
+			current = filepath.Dir(current)
+			continue
+		}
+
+		next := filepath.Join(current, component)
+		hostPath := filepath.Join(root, next)
+		fi, err := os.Lstat(hostPath)
+		if os.IsNotExist(err) {
+			glog.V(5).Infof("Creating %s", hostPath)
+			if err := os.Mkdir(hostPath, 0755); err != nil {
+				return fmt.Errorf("could not create %s: %v", next, err)
+			}
+			if err := os.Lchown(hostPath, uid, gid); err != nil {
+				return fmt.Errorf("could not change owner of %s: %v", next, err)
+			}
+			current = next
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("could not stat %s: %v", next, err)
+		}
+
+		if fi.Mode()&os.ModeSymlink != 0 {
+			links++
+			if links > maxSymlinks {
+				return fmt.Errorf("too many symlinks in %s", path)
+			}
+			target, err := os.Readlink(hostPath)
+			if err != nil {
+				return fmt.Errorf("could not read symlink %s: %v", next, err)
+			}
+			if filepath.IsAbs(target) {
+				current = "/"
+			}
+			components = append(strings.Split(target, "/"), components...)
+			continue
+		}
+		if !fi.IsDir() {
+			return fmt.Errorf("%s is not a directory", next)
+		}
+		current = next
+	}
+	return nil
+}
+
+// parseResolvConf reads resolv.conf file located at path into DNSConfig.
+// Domain directive is treated as a single entry search list.
+func parseResolvConf(path string) (*k8s.DNSConfig, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var config k8s.DNSConfig
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 || strings.HasPrefix(fields[0], "#") || strings.HasPrefix(fields[0], ";") {
+			continue
+		}
+		switch fields[0] {
+		case "nameserver":
+			config.Servers = append(config.Servers, fields[1])
+		case "domain", "search":
+			// the last search or domain directive wins
+			config.Searches = fields[1:]
+		case "options":
+			config.Options = append(config.Options, fields[1:]...)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("could not read %s: %v", path, err)
+	}
+	return &config, nil
+}
+
+// isEmptyDNSConfig reports whether config has no servers, searches and options.
+func isEmptyDNSConfig(config *k8s.DNSConfig) bool {
+	return len(config.GetServers()) == 0 &&
+		len(config.GetSearches()) == 0 &&
+		len(config.GetOptions()) == 0
+}
+
+// mergeDNSEntries merges two lists of resolv.conf entries preserving their order
+// and removing duplicates. Entries are considered equal when key func returns the same
+// value for them, in which case the first entry is kept. Nil key compares entries as is.
+func mergeDNSEntries(entries, fallback []string, key func(string) string) []string {
+	var merged []string
+	seen := make(map[string]bool)
+	for _, list := range [][]string{entries, fallback} {
+		for _, e := range list {
+			k := e
+			if key != nil {
+				k = key(e)
+			}
+			if seen[k] {
+				continue
+			}
+			seen[k] = true
+			merged = append(merged, e)
+		}
+	}
+	return merged
+}
+
+// normalizeDNSConfig removes duplicate servers, searches and options from config,
+// so that the first occurrence of each of them is kept, and caps number of servers
+// at the libc limit. Options with malformed values result in an error, while
+// unknown ones are kept as is since resolver ignores them.
+func normalizeDNSConfig(config *k8s.DNSConfig) (*k8s.DNSConfig, error) {
+	servers := mergeDNSEntries(config.GetServers(), nil, nil)
+	if len(servers) > maxDNSNameservers {
+		glog.Warningf("Only %d nameservers are used by resolver, ignoring %v", maxDNSNameservers, servers[maxDNSNameservers:])
+		servers = servers[:maxDNSNameservers]
+	}
+
+	var options []string
+	for _, o := range config.GetOptions() {
+		o = strings.TrimSpace(o)
+		if o == "" {
+			continue
+		}
+		if err := validateDNSOption(o); err != nil {
+			return nil, err
+		}
+		options = append(options, o)
+	}
+	return &k8s.DNSConfig{
+		Servers:  servers,
+		Searches: mergeDNSEntries(config.GetSearches(), nil, nil),
+		Options:  mergeDNSEntries(options, nil, dnsOptionName),
+	}, nil
+}
+
+// validateDNSOption checks that resolver option has a valid value.
+func validateDNSOption(option string) error {
+	parts := strings.SplitN(option, ":", 2)
+	name := parts[0]
+	switch {
+	case dnsNumericOptions[name]:
+		if len(parts) != 2 {
+			return fmt.Errorf("resolver option %q requires a value", option)
+		}
+		if _, err := strconv.ParseUint(parts[1], 10, 32); err != nil {
+			return fmt.Errorf("invalid resolver option %q: value should be a non-negative integer", option)
+		}
+	case dnsFlagOptions[name]:
+		if len(parts) != 1 {
+			return fmt.Errorf("resolver option %q doesn't take a value", name)
+		}
+	default:
+		glog.Warningf("Unknown resolver option %q", option)
 	}
 	return nil
 }
 
+// dnsOptionName returns name of resolv.conf option, e.g. ndots for ndots:5.
+func dnsOptionName(option string) string {
+	return strings.SplitN(option, ":", 2)[0]
+}
+
+// attemptLogPath returns log path of container's attempt so that logs of recreated
+// containers do not end up in the same file. Kubelet already names log files
+// after attempts, e.g. name/1.log, and such paths are returned as is.
+func attemptLogPath(path string, attempt uint32) string {
+	ext := filepath.Ext(path)
+	base := strings.TrimSuffix(path, ext)
+	if attempt == 0 || filepath.Base(base) == strconv.FormatUint(uint64(attempt), 10) {
+		return path
+	}
+	return fmt.Sprintf("%s.%d%s", base, attempt, ext)
+}
+
+// terminationGracePeriodAnnotation is set by kubelet on containers
+// to the termination grace period of their pod in seconds.
+const terminationGracePeriodAnnotation = "io.kubernetes.pod.terminationGracePeriod"
+
+// terminationGracePeriod returns termination grace period in seconds that
+// kubelet recorded in container annotations, or 0 when there is none.
+func terminationGracePeriod(annotations map[string]string) int64 {
+	period, err := strconv.ParseInt(annotations[terminationGracePeriodAnnotation], 10, 64)
+	if err != nil || period < 0 {
+		return 0
+	}
+	return period
+}
+
 func copyFile(from, to string) error {
 	dest, err := os.OpenFile(to, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
 	if err != nil {
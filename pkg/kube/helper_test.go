@@ -15,6 +15,7 @@
 package kube
 
 import (
+	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
@@ -60,8 +61,9 @@ func TestWriteResolvConf(t *testing.T) {
 
 	for _, tc := range tt {
 		t.Run(tc.name, func(t *testing.T) {
-			err := writeResolvConf(tc.path, tc.conf)
+			written, err := writeResolvConf(tc.path, tc.conf, "")
 			require.NoError(t, err)
+			require.True(t, written)
 			actual, err := ioutil.ReadFile(tc.path)
 			require.NoError(t, err)
 			require.Equal(t, tc.expectContent, string(actual))
@@ -69,3 +71,394 @@ func TestWriteResolvConf(t *testing.T) {
 	}
 
 }
+
+func TestWriteResolvConf_Host(t *testing.T) {
+	hostResolv, err := ioutil.TempFile("", "")
+	require.NoError(t, err, "could not create temp file")
+	defer os.Remove(hostResolv.Name())
+	_, err = hostResolv.WriteString(`# generated by NetworkManager
+domain local
+search example.com lan
+nameserver 8.8.8.8
+nameserver 8.8.4.4
+options ndots:1 rotate
+`)
+	require.NoError(t, err, "could not write host resolv.conf")
+	require.NoError(t, hostResolv.Close(), "could not close host resolv.conf")
+
+	tt := []struct {
+		name          string
+		path          string
+		conf          *k8s.DNSConfig
+		hostPath      string
+		expectWritten bool
+		expectContent string
+	}{
+		{
+			name:          "no config",
+			path:          filepath.Join(os.TempDir(), "resolv.conf.host1"),
+			expectWritten: false,
+		},
+		{
+			name:          "no host file",
+			path:          filepath.Join(os.TempDir(), "resolv.conf.host2"),
+			hostPath:      "/foo/bar/resolv.conf",
+			expectWritten: false,
+		},
+		{
+			name:          "host only",
+			path:          filepath.Join(os.TempDir(), "resolv.conf.host3"),
+			hostPath:      hostResolv.Name(),
+			expectWritten: true,
+			expectContent: "nameserver 8.8.8.8\nnameserver 8.8.4.4\nsearch example.com lan\noptions ndots:1\noptions rotate\n",
+		},
+		{
+			name:          "default policy with empty kubelet resolv.conf",
+			path:          filepath.Join(os.TempDir(), "resolv.conf.host4"),
+			conf:          &k8s.DNSConfig{},
+			hostPath:      hostResolv.Name(),
+			expectWritten: true,
+			expectContent: "nameserver 8.8.8.8\nnameserver 8.8.4.4\nsearch example.com lan\noptions ndots:1\noptions rotate\n",
+		},
+		{
+			name: "default policy",
+			path: filepath.Join(os.TempDir(), "resolv.conf.host5"),
+			conf: &k8s.DNSConfig{
+				Servers:  []string{"192.168.0.1"},
+				Searches: []string{"lan"},
+			},
+			hostPath:      hostResolv.Name(),
+			expectWritten: true,
+			expectContent: "nameserver 192.168.0.1\nsearch lan\n",
+		},
+		{
+			name: "cluster first policy",
+			path: filepath.Join(os.TempDir(), "resolv.conf.host6"),
+			conf: &k8s.DNSConfig{
+				Servers:  []string{"10.0.0.10"},
+				Searches: []string{"default.svc.cluster.local", "svc.cluster.local", "cluster.local"},
+				Options:  []string{"ndots:5"},
+			},
+			hostPath:      hostResolv.Name(),
+			expectWritten: true,
+			expectContent: "nameserver 10.0.0.10\nsearch default.svc.cluster.local svc.cluster.local cluster.local\noptions ndots:5\n",
+		},
+		{
+			name: "none policy",
+			path: filepath.Join(os.TempDir(), "resolv.conf.host7"),
+			conf: &k8s.DNSConfig{
+				Servers: []string{"1.1.1.1"},
+				Options: []string{"edns0"},
+			},
+			hostPath:      hostResolv.Name(),
+			expectWritten: true,
+			expectContent: "nameserver 1.1.1.1\noptions edns0\n",
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			defer os.Remove(tc.path)
+			written, err := writeResolvConf(tc.path, tc.conf, tc.hostPath)
+			require.NoError(t, err)
+			require.Equal(t, tc.expectWritten, written)
+			if !tc.expectWritten {
+				return
+			}
+			actual, err := ioutil.ReadFile(tc.path)
+			require.NoError(t, err)
+			require.Equal(t, tc.expectContent, string(actual))
+		})
+	}
+}
+
+func TestNormalizeDNSConfig(t *testing.T) {
+	tt := []struct {
+		name         string
+		conf         *k8s.DNSConfig
+		expectConfig *k8s.DNSConfig
+		expectError  error
+	}{
+		{
+			name: "duplicates",
+			conf: &k8s.DNSConfig{
+				Servers:  []string{"10.0.0.10", "8.8.8.8", "10.0.0.10"},
+				Searches: []string{"default.svc.cluster.local", "svc.cluster.local", "default.svc.cluster.local"},
+				Options:  []string{"ndots:5", "rotate", " ndots:2", "rotate", ""},
+			},
+			expectConfig: &k8s.DNSConfig{
+				Servers:  []string{"10.0.0.10", "8.8.8.8"},
+				Searches: []string{"default.svc.cluster.local", "svc.cluster.local"},
+				Options:  []string{"ndots:5", "rotate"},
+			},
+		},
+		{
+			name: "too many servers",
+			conf: &k8s.DNSConfig{
+				Servers: []string{"10.0.0.10", "10.0.0.11", "10.0.0.12", "10.0.0.13"},
+			},
+			expectConfig: &k8s.DNSConfig{
+				Servers: []string{"10.0.0.10", "10.0.0.11", "10.0.0.12"},
+			},
+		},
+		{
+			name: "unknown option",
+			conf: &k8s.DNSConfig{
+				Options: []string{"timeout:2", "attempts:3", "new-option"},
+			},
+			expectConfig: &k8s.DNSConfig{
+				Options: []string{"timeout:2", "attempts:3", "new-option"},
+			},
+		},
+		{
+			name: "invalid ndots",
+			conf: &k8s.DNSConfig{
+				Options: []string{"ndots:many"},
+			},
+			expectError: fmt.Errorf(`invalid resolver option "ndots:many": value should be a non-negative integer`),
+		},
+		{
+			name: "missing timeout value",
+			conf: &k8s.DNSConfig{
+				Options: []string{"timeout"},
+			},
+			expectError: fmt.Errorf(`resolver option "timeout" requires a value`),
+		},
+		{
+			name: "flag with value",
+			conf: &k8s.DNSConfig{
+				Options: []string{"rotate:1"},
+			},
+			expectError: fmt.Errorf(`resolver option "rotate" doesn't take a value`),
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			config, err := normalizeDNSConfig(tc.conf)
+			require.Equal(t, tc.expectError, err)
+			require.Equal(t, tc.expectConfig, config)
+		})
+	}
+}
+
+func TestParseShmSize(t *testing.T) {
+	tt := []struct {
+		name        string
+		size        string
+		expectSize  int64
+		expectError bool
+	}{
+		{
+			name:       "binary suffix",
+			size:       "1Gi",
+			expectSize: 1 << 30,
+		},
+		{
+			name:       "decimal suffix",
+			size:       "512M",
+			expectSize: 512 * 1000 * 1000,
+		},
+		{
+			name:       "bytes",
+			size:       "65536",
+			expectSize: 65536,
+		},
+		{
+			name:        "zero",
+			size:        "0",
+			expectError: true,
+		},
+		{
+			name:        "garbage",
+			size:        "large",
+			expectError: true,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			size, err := ParseShmSize(tc.size)
+			require.Equal(t, tc.expectError, err != nil, "unexpected error: %v", err)
+			require.Equal(t, tc.expectSize, size)
+		})
+	}
+}
+
+func TestWriteHosts(t *testing.T) {
+	const localhost = "# Kubernetes-managed hosts file.\n" +
+		"127.0.0.1\tlocalhost\n" +
+		"::1\tlocalhost ip6-localhost ip6-loopback\n" +
+		"fe00::0\tip6-localnet\n" +
+		"fe00::0\tip6-mcastprefix\n" +
+		"fe00::1\tip6-allnodes\n" +
+		"fe00::2\tip6-allrouters\n"
+
+	tt := []struct {
+		name          string
+		ip            string
+		hostname      string
+		expectContent string
+	}{
+		{
+			name:          "pod IP",
+			ip:            "10.22.0.5",
+			hostname:      "busybox",
+			expectContent: localhost + "10.22.0.5\tbusybox\n",
+		},
+		{
+			name:          "no pod IP",
+			hostname:      "busybox",
+			expectContent: localhost,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(os.TempDir(), "hosts.test")
+			defer os.Remove(path)
+
+			require.NoError(t, writeHosts(path, tc.ip, tc.hostname))
+			content, err := ioutil.ReadFile(path)
+			require.NoError(t, err, "could not read hosts file")
+			require.Equal(t, tc.expectContent, string(content))
+		})
+	}
+}
+
+func TestMkdirInRoot(t *testing.T) {
+	root, err := ioutil.TempDir("", "")
+	require.NoError(t, err, "could not create temp dir")
+	defer os.RemoveAll(root)
+
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "usr", "src"), 0755))
+	require.NoError(t, os.Symlink("/usr/src", filepath.Join(root, "src")))
+	require.NoError(t, os.Symlink("../../../../etc", filepath.Join(root, "escape")))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(root, "file"), nil, 0644))
+
+	uid, gid := os.Getuid(), os.Getgid()
+	tt := []struct {
+		name        string
+		path        string
+		expectDir   string
+		expectError bool
+	}{
+		{
+			name:      "existing directory",
+			path:      "/usr/src",
+			expectDir: "usr/src",
+		},
+		{
+			name:      "missing directories",
+			path:      "/opt/app/data/",
+			expectDir: "opt/app/data",
+		},
+		{
+			name:      "absolute symlink",
+			path:      "/src/app",
+			expectDir: "usr/src/app",
+		},
+		{
+			name:      "symlink out of root",
+			path:      "/escape/app",
+			expectDir: "etc/app",
+		},
+		{
+			name:        "file in path",
+			path:        "/file/app",
+			expectError: true,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			err := mkdirInRoot(root, tc.path, uid, gid)
+			require.Equal(t, tc.expectError, err != nil, "unexpected error: %v", err)
+			if !tc.expectError {
+				fi, err := os.Stat(filepath.Join(root, tc.expectDir))
+				require.NoError(t, err)
+				require.True(t, fi.IsDir())
+			}
+		})
+	}
+}
+
+func TestAttemptLogPath(t *testing.T) {
+	tt := []struct {
+		name       string
+		path       string
+		attempt    uint32
+		expectPath string
+	}{
+		{
+			name:       "first attempt",
+			path:       "nginx/0.log",
+			attempt:    0,
+			expectPath: "nginx/0.log",
+		},
+		{
+			name:       "kubelet path",
+			path:       "nginx/2.log",
+			attempt:    2,
+			expectPath: "nginx/2.log",
+		},
+		{
+			name:       "custom path",
+			path:       "nginx.log",
+			attempt:    2,
+			expectPath: "nginx.2.log",
+		},
+		{
+			name:       "custom path without extension",
+			path:       "logs/nginx",
+			attempt:    1,
+			expectPath: "logs/nginx.1",
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			require.Equal(t, tc.expectPath, attemptLogPath(tc.path, tc.attempt))
+		})
+	}
+}
+
+func TestTerminationGracePeriod(t *testing.T) {
+	tt := []struct {
+		name         string
+		annotations  map[string]string
+		expectPeriod int64
+	}{
+		{
+			name:         "no annotation",
+			expectPeriod: 0,
+		},
+		{
+			name: "kubelet annotation",
+			annotations: map[string]string{
+				terminationGracePeriodAnnotation: "30",
+			},
+			expectPeriod: 30,
+		},
+		{
+			name: "invalid annotation",
+			annotations: map[string]string{
+				terminationGracePeriodAnnotation: "soon",
+			},
+			expectPeriod: 0,
+		},
+		{
+			name: "negative annotation",
+			annotations: map[string]string{
+				terminationGracePeriodAnnotation: "-1",
+			},
+			expectPeriod: 0,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			require.Equal(t, tc.expectPeriod, terminationGracePeriod(tc.annotations))
+		})
+	}
+}
@@ -0,0 +1,100 @@
+// Copyright (c) 2018-2019 Sylabs, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kube
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/opencontainers/runtime-spec/specs-go"
+)
+
+const (
+	// HooksAnnotation may be set on pod or container to select OCI hooks
+	// applied to container by their names. It is a comma-separated list of
+	// names of configured hooks that replaces the default ones, HooksNone
+	// value disables all hooks. An empty value is the same as no annotation.
+	// Container annotation takes precedence.
+	HooksAnnotation = "sycri.sylabs.io/hooks"
+	// HooksNone is HooksAnnotation value that disables all hooks.
+	HooksNone = "none"
+
+	// HookPrestart is a stage of hooks run after container is created
+	// but before user process is started.
+	HookPrestart = "prestart"
+	// HookPoststart is a stage of hooks run after user process is started.
+	HookPoststart = "poststart"
+	// HookPoststop is a stage of hooks run after container is deleted.
+	HookPoststop = "poststop"
+)
+
+// Hook is a named OCI lifecycle hook that may be applied to containers.
+type Hook struct {
+	specs.Hook
+	// Name identifies hook in HooksAnnotation.
+	Name string
+	// Stage is one of HookPrestart, HookPoststart or HookPoststop.
+	Stage string
+	// Default hooks are applied to containers that don't select hooks explicitly.
+	Default bool
+}
+
+// WithHooks sets OCI hooks that are added to container spec.
+func WithHooks(hooks []Hook) ContainerOption {
+	return func(c *Container) {
+		c.hooks = hooks
+	}
+}
+
+// SelectHooks returns hooks from the available ones that should be applied
+// to container with passed annotations created in pod with passed annotations.
+func SelectHooks(available []Hook, podAnnotations, contAnnotations map[string]string) ([]Hook, error) {
+	names := strings.TrimSpace(contAnnotations[HooksAnnotation])
+	if names == "" {
+		names = strings.TrimSpace(podAnnotations[HooksAnnotation])
+	}
+	if names == HooksNone {
+		return nil, nil
+	}
+	if names == "" {
+		var hooks []Hook
+		for _, hook := range available {
+			if hook.Default {
+				hooks = append(hooks, hook)
+			}
+		}
+		return hooks, nil
+	}
+
+	var hooks []Hook
+	for _, name := range strings.Split(names, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		found := false
+		for _, hook := range available {
+			if hook.Name == name {
+				hooks = append(hooks, hook)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown hook %q", name)
+		}
+	}
+	return hooks, nil
+}
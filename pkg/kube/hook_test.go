@@ -0,0 +1,85 @@
+// Copyright (c) 2018-2019 Sylabs, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kube
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSelectHooks(t *testing.T) {
+	gpuSetup := Hook{Name: "gpu-setup", Stage: HookPrestart, Default: true}
+	audit := Hook{Name: "audit", Stage: HookPoststop, Default: true}
+	license := Hook{Name: "license", Stage: HookPrestart}
+	available := []Hook{gpuSetup, audit, license}
+
+	tt := []struct {
+		name            string
+		podAnnotations  map[string]string
+		contAnnotations map[string]string
+		expectHooks     []Hook
+		expectError     error
+	}{
+		{
+			name:        "default hooks",
+			expectHooks: []Hook{gpuSetup, audit},
+		},
+		{
+			name:           "pod annotation",
+			podAnnotations: map[string]string{HooksAnnotation: "license, audit"},
+			expectHooks:    []Hook{license, audit},
+		},
+		{
+			name:            "container annotation",
+			podAnnotations:  map[string]string{HooksAnnotation: "license"},
+			contAnnotations: map[string]string{HooksAnnotation: "gpu-setup"},
+			expectHooks:     []Hook{gpuSetup},
+		},
+		{
+			name:            "disabled hooks",
+			contAnnotations: map[string]string{HooksAnnotation: HooksNone},
+		},
+		{
+			name:           "disabled pod hooks",
+			podAnnotations: map[string]string{HooksAnnotation: " none "},
+		},
+		{
+			name:            "empty annotation",
+			contAnnotations: map[string]string{HooksAnnotation: ""},
+			expectHooks:     []Hook{gpuSetup, audit},
+		},
+		{
+			name:            "empty container annotation",
+			podAnnotations:  map[string]string{HooksAnnotation: "license"},
+			contAnnotations: map[string]string{HooksAnnotation: " "},
+			expectHooks:     []Hook{license},
+		},
+		{
+			name:            "unknown hook",
+			contAnnotations: map[string]string{HooksAnnotation: "/bin/sh"},
+			expectError:     fmt.Errorf(`unknown hook "/bin/sh"`),
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			hooks, err := SelectHooks(available, tc.podAnnotations, tc.contAnnotations)
+			require.Equal(t, tc.expectError, err)
+			require.Equal(t, tc.expectHooks, hooks)
+		})
+	}
+}
@@ -0,0 +1,276 @@
+// Copyright (c) 2018-2019 Sylabs, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kube
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+const (
+	// LogDriverAnnotation may be set on pod or container to override
+	// log driver that is used to ship container logs.
+	LogDriverAnnotation = "sycri.sylabs.io/log-driver"
+
+	// LogDriverFile keeps container logs in log file only.
+	LogDriverFile = "file"
+	// LogDriverJournald additionally ships container logs to systemd-journald.
+	LogDriverJournald = "journald"
+
+	// journalSocket is a socket journald receives native protocol messages on.
+	journalSocket = "/run/systemd/journal/socket"
+
+	// logFollowInterval is how often log file is checked for new lines.
+	logFollowInterval = 250 * time.Millisecond
+)
+
+// LogLine is a single line of container output.
+type LogLine struct {
+	Time    time.Time
+	Stream  string
+	Message []byte
+}
+
+// LogDriver ships container logs that are written by runtime into
+// container log file elsewhere. LogDriver should be thread safe.
+type LogDriver interface {
+	// Write ships a single line of container output.
+	Write(c *Container, line LogLine) error
+}
+
+// NewLogDriver returns log driver by its name. Nil driver is
+// returned for LogDriverFile since file logs are written by runtime.
+func NewLogDriver(name string) (LogDriver, error) {
+	switch name {
+	case "", LogDriverFile:
+		return nil, nil
+	case LogDriverJournald:
+		return journaldDriver{socket: journalSocket}, nil
+	default:
+		return nil, fmt.Errorf("unknown log driver %q", name)
+	}
+}
+
+// journaldDriver sends container logs to journald
+// using native protocol, see systemd.journal-fields(7).
+type journaldDriver struct {
+	socket string
+}
+
+func (d journaldDriver) Write(c *Container, line LogLine) error {
+	priority := "6" // info
+	if line.Stream == "stderr" {
+		priority = "3" // err
+	}
+	fields := [][2]string{
+		{"MESSAGE", string(line.Message)},
+		{"PRIORITY", priority},
+		{"SYSLOG_IDENTIFIER", c.GetMetadata().GetName()},
+		{"CONTAINER_ID", c.ID()},
+		{"CONTAINER_NAME", c.GetMetadata().GetName()},
+		{"CONTAINER_ATTEMPT", strconv.FormatUint(uint64(c.Attempt()), 10)},
+		{"CONTAINER_STREAM", line.Stream},
+		{"CONTAINER_TIMESTAMP", line.Time.Format(time.RFC3339Nano)},
+	}
+	if c.pod != nil {
+		fields = append(fields,
+			[2]string{"POD_ID", c.pod.ID()},
+			[2]string{"POD_NAME", c.pod.GetMetadata().GetName()},
+			[2]string{"POD_NAMESPACE", c.pod.GetMetadata().GetNamespace()},
+			[2]string{"POD_UID", c.pod.GetMetadata().GetUid()},
+		)
+	}
+
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: d.socket, Net: "unixgram"})
+	if err != nil {
+		return fmt.Errorf("could not connect to journald: %v", err)
+	}
+	defer conn.Close()
+	if _, err := conn.Write(journalMessage(fields)); err != nil {
+		return fmt.Errorf("could not send message to journald: %v", err)
+	}
+	return nil
+}
+
+// journalMessage encodes fields in journald native protocol.
+func journalMessage(fields [][2]string) []byte {
+	var buf bytes.Buffer
+	for _, field := range fields {
+		key, value := field[0], field[1]
+		if strings.IndexByte(value, '\n') == -1 {
+			fmt.Fprintf(&buf, "%s=%s\n", key, value)
+			continue
+		}
+		// values with newlines are sent as binary data prefixed with size
+		buf.WriteString(key)
+		buf.WriteByte('\n')
+		binary.Write(&buf, binary.LittleEndian, uint64(len(value)))
+		buf.WriteString(value)
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes()
+}
+
+// parseCRILogLine parses line of log file written in CRI format,
+// e.g. 2019-09-20T10:10:10.123456789Z stdout F message.
+func parseCRILogLine(data []byte) (LogLine, bool, error) {
+	parts := bytes.SplitN(data, []byte{' '}, 4)
+	if len(parts) < 3 {
+		return LogLine{}, false, fmt.Errorf("unexpected log line %q", data)
+	}
+	t, err := time.Parse(time.RFC3339Nano, string(parts[0]))
+	if err != nil {
+		return LogLine{}, false, fmt.Errorf("could not parse log time: %v", err)
+	}
+	line := LogLine{
+		Time:   t,
+		Stream: string(parts[1]),
+	}
+	if len(parts) == 4 {
+		line.Message = parts[3]
+	}
+	partial := string(parts[2]) == "P"
+	return line, partial, nil
+}
+
+// startLogs starts shipping container logs with log driver, if any.
+func (c *Container) startLogs() {
+	if c.logDriver == nil || c.logPath == "" {
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	c.stopLogsFunc = func() {
+		cancel()
+		<-done
+	}
+	go c.followLogs(ctx, c.logPath, done)
+}
+
+// stopLogs ships the rest of container logs and stops log shipping.
+func (c *Container) stopLogs() {
+	if c.stopLogsFunc != nil {
+		c.stopLogsFunc()
+		c.stopLogsFunc = nil
+	}
+}
+
+// followLogs ships lines that are appended to container log file with
+// the log driver until ctx is done. Log file rotation is detected by
+// inode change, in which case the old file is read till the end first.
+func (c *Container) followLogs(ctx context.Context, path string, done chan<- struct{}) {
+	defer close(done)
+
+	var (
+		f       *os.File
+		r       *bufio.Reader
+		pending LogLine
+	)
+	defer func() {
+		if f != nil {
+			f.Close()
+		}
+	}()
+
+	ticker := time.NewTicker(logFollowInterval)
+	defer ticker.Stop()
+	stopping := false
+	for {
+		if f == nil {
+			var err error
+			f, err = os.Open(path)
+			if err != nil && !os.IsNotExist(err) {
+				glog.Errorf("Could not open log file of container %s: %v", c.id, err)
+			}
+			if f != nil {
+				r = bufio.NewReader(f)
+			}
+		}
+
+		if f != nil {
+			for {
+				data, err := r.ReadBytes('\n')
+				if err == io.EOF {
+					// unread incomplete line, it will be read when finished
+					if _, err := f.Seek(-int64(len(data)), io.SeekCurrent); err == nil {
+						r.Reset(f)
+					}
+					break
+				}
+				if err != nil {
+					glog.Errorf("Could not read log file of container %s: %v", c.id, err)
+					break
+				}
+
+				line, partial, err := parseCRILogLine(bytes.TrimSuffix(data, []byte{'\n'}))
+				if err != nil {
+					glog.Errorf("Could not parse log of container %s: %v", c.id, err)
+					continue
+				}
+				pending.Time = line.Time
+				pending.Stream = line.Stream
+				pending.Message = append(pending.Message, line.Message...)
+				if partial {
+					continue
+				}
+				if err := c.logDriver.Write(c, pending); err != nil {
+					glog.Errorf("Could not ship log of container %s: %v", c.id, err)
+				}
+				pending = LogLine{}
+			}
+
+			if rotated(f, path) {
+				f.Close()
+				f = nil
+				continue
+			}
+		}
+
+		if stopping {
+			return
+		}
+		select {
+		case <-ctx.Done():
+			// read whatever was written before stop
+			stopping = true
+		case <-ticker.C:
+		}
+	}
+}
+
+// rotated reports whether file at path is not the same as opened f.
+func rotated(f *os.File, path string) bool {
+	opened, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	current, err := os.Stat(path)
+	if err != nil {
+		return os.IsNotExist(err)
+	}
+	return opened.Sys().(*syscall.Stat_t).Ino != current.Sys().(*syscall.Stat_t).Ino
+}
@@ -0,0 +1,146 @@
+// Copyright (c) 2018-2019 Sylabs, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kube
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseCRILogLine(t *testing.T) {
+	tt := []struct {
+		name          string
+		data          string
+		expectLine    LogLine
+		expectPartial bool
+		expectError   error
+	}{
+		{
+			name: "full line",
+			data: "2019-09-20T10:10:10.123456789Z stdout F hello world",
+			expectLine: LogLine{
+				Time:    time.Date(2019, 9, 20, 10, 10, 10, 123456789, time.UTC),
+				Stream:  "stdout",
+				Message: []byte("hello world"),
+			},
+		},
+		{
+			name: "partial line",
+			data: "2019-09-20T10:10:10Z stderr P hello",
+			expectLine: LogLine{
+				Time:    time.Date(2019, 9, 20, 10, 10, 10, 0, time.UTC),
+				Stream:  "stderr",
+				Message: []byte("hello"),
+			},
+			expectPartial: true,
+		},
+		{
+			name: "empty message",
+			data: "2019-09-20T10:10:10Z stdout F",
+			expectLine: LogLine{
+				Time:   time.Date(2019, 9, 20, 10, 10, 10, 0, time.UTC),
+				Stream: "stdout",
+			},
+		},
+		{
+			name:        "not CRI format",
+			data:        "hello",
+			expectError: fmt.Errorf(`unexpected log line "hello"`),
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			line, partial, err := parseCRILogLine([]byte(tc.data))
+			require.Equal(t, tc.expectError, err)
+			require.Equal(t, tc.expectPartial, partial)
+			if err == nil {
+				require.True(t, tc.expectLine.Time.Equal(line.Time))
+				require.Equal(t, tc.expectLine.Stream, line.Stream)
+				require.Equal(t, tc.expectLine.Message, line.Message)
+			}
+		})
+	}
+}
+
+func TestJournalMessage(t *testing.T) {
+	msg := journalMessage([][2]string{
+		{"MESSAGE", "two\nlines"},
+		{"PRIORITY", "6"},
+	})
+	expect := "MESSAGE\n\x09\x00\x00\x00\x00\x00\x00\x00two\nlines\nPRIORITY=6\n"
+	require.Equal(t, expect, string(msg))
+}
+
+type recordingDriver struct {
+	mu    sync.Mutex
+	lines []string
+}
+
+func (d *recordingDriver) Write(_ *Container, line LogLine) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.lines = append(d.lines, line.Stream+" "+string(line.Message))
+	return nil
+}
+
+func TestFollowLogs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	require.NoError(t, err, "could not create temp dir")
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "0.log")
+	err = ioutil.WriteFile(path, []byte(
+		"2019-09-20T10:10:10Z stdout F first\n"+
+			"2019-09-20T10:10:11Z stderr P sec\n"+
+			"2019-09-20T10:10:11Z stderr F ond\n"+
+			"2019-09-20T10:10:12Z stdout F unfin"), 0644)
+	require.NoError(t, err, "could not write log file")
+
+	driver := &recordingDriver{}
+	c := &Container{id: "test", logDriver: driver}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go c.followLogs(ctx, path, done)
+
+	time.Sleep(2 * logFollowInterval)
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+	require.NoError(t, err, "could not open log file")
+	_, err = f.WriteString("ished\n")
+	require.NoError(t, err, "could not append to log file")
+	require.NoError(t, f.Close(), "could not close log file")
+
+	time.Sleep(2 * logFollowInterval)
+	require.NoError(t, os.Rename(path, path+".20190920-101012"), "could not rotate log file")
+	err = ioutil.WriteFile(path, []byte("2019-09-20T10:10:13Z stdout F rotated\n"), 0644)
+	require.NoError(t, err, "could not write new log file")
+
+	cancel()
+	<-done
+	require.Equal(t, []string{
+		"stdout first",
+		"stderr second",
+		"stdout unfinished",
+		"stdout rotated",
+	}, driver.lines)
+}
@@ -0,0 +1,107 @@
+// Copyright (c) 2018-2019 Sylabs, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kube
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// numaNodesDir is a sysfs directory NUMA nodes are listed in, overridden in tests.
+var numaNodesDir = "/sys/devices/system/node"
+
+// WithNUMAAwareCpuset sets whether container's cpuset.mems should be set to
+// NUMA nodes of its exclusive CPUs when kubelet doesn't specify them.
+func WithNUMAAwareCpuset(enabled bool) ContainerOption {
+	return func(c *Container) {
+		c.numaAwareCpuset = enabled
+	}
+}
+
+// numaNodesOf returns list of NUMA nodes CPUs from cpus list belong to
+// written in cpuset format, e.g. 0,1. When no NUMA information
+// is available on the host, empty string is returned.
+func numaNodesOf(cpus string) (string, error) {
+	requested, err := parseCPUList(cpus)
+	if err != nil {
+		return "", fmt.Errorf("invalid cpuset %q: %v", cpus, err)
+	}
+
+	nodeDirs, err := filepath.Glob(filepath.Join(numaNodesDir, "node[0-9]*"))
+	if err != nil {
+		return "", fmt.Errorf("could not list NUMA nodes: %v", err)
+	}
+	var nodes []int
+	for _, dir := range nodeDirs {
+		node, err := strconv.Atoi(strings.TrimPrefix(filepath.Base(dir), "node"))
+		if err != nil {
+			continue
+		}
+		content, err := ioutil.ReadFile(filepath.Join(dir, "cpulist"))
+		if err != nil {
+			return "", fmt.Errorf("could not read NUMA node %d cpus: %v", node, err)
+		}
+		nodeCPUs, err := parseCPUList(strings.TrimSpace(string(content)))
+		if err != nil {
+			return "", fmt.Errorf("invalid NUMA node %d cpus: %v", node, err)
+		}
+		for cpu := range nodeCPUs {
+			if requested[cpu] {
+				nodes = append(nodes, node)
+				break
+			}
+		}
+	}
+
+	sort.Ints(nodes)
+	mems := make([]string, len(nodes))
+	for i, node := range nodes {
+		mems[i] = strconv.Itoa(node)
+	}
+	return strings.Join(mems, ","), nil
+}
+
+// parseCPUList parses list of CPUs written in cpuset format, e.g. 0-3,8.
+func parseCPUList(list string) (map[int]bool, error) {
+	cpus := make(map[int]bool)
+	if list == "" {
+		return cpus, nil
+	}
+	for _, part := range strings.Split(list, ",") {
+		bounds := strings.SplitN(part, "-", 2)
+		first, err := strconv.Atoi(bounds[0])
+		if err != nil {
+			return nil, fmt.Errorf("invalid cpu %q", bounds[0])
+		}
+		last := first
+		if len(bounds) == 2 {
+			last, err = strconv.Atoi(bounds[1])
+			if err != nil {
+				return nil, fmt.Errorf("invalid cpu %q", bounds[1])
+			}
+		}
+		if first < 0 || last < first {
+			return nil, fmt.Errorf("invalid cpu range %q", part)
+		}
+		for cpu := first; cpu <= last; cpu++ {
+			cpus[cpu] = true
+		}
+	}
+	return cpus, nil
+}
@@ -0,0 +1,89 @@
+// Copyright (c) 2018-2019 Sylabs, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kube
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNUMANodesOf(t *testing.T) {
+	root, err := ioutil.TempDir("", "")
+	require.NoError(t, err, "could not create temp dir")
+	defer os.RemoveAll(root)
+
+	nodes := map[string]string{
+		"node0": "0-3,8-11\n",
+		"node1": "4-7,12-15\n",
+	}
+	for node, cpus := range nodes {
+		dir := filepath.Join(root, node)
+		require.NoError(t, os.Mkdir(dir, 0755))
+		require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "cpulist"), []byte(cpus), 0644))
+	}
+	require.NoError(t, os.Mkdir(filepath.Join(root, "power"), 0755))
+
+	defer func(dir string) { numaNodesDir = dir }(numaNodesDir)
+	numaNodesDir = root
+
+	tt := []struct {
+		name        string
+		cpus        string
+		expectMems  string
+		expectError bool
+	}{
+		{
+			name:       "single node",
+			cpus:       "2,3",
+			expectMems: "0",
+		},
+		{
+			name:       "second node",
+			cpus:       "12-13",
+			expectMems: "1",
+		},
+		{
+			name:       "both nodes",
+			cpus:       "3-4",
+			expectMems: "0,1",
+		},
+		{
+			name:       "unknown cpus",
+			cpus:       "32",
+			expectMems: "",
+		},
+		{
+			name:        "invalid cpuset",
+			cpus:        "3-1",
+			expectError: true,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			mems, err := numaNodesOf(tc.cpus)
+			if tc.expectError {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.expectMems, mems)
+		})
+	}
+}
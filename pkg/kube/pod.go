@@ -17,13 +17,16 @@ package kube
 import (
 	"context"
 	"fmt"
+	"os/exec"
 	"sync"
 
+	"github.com/containerd/cgroups"
 	"github.com/golang/glog"
 	"github.com/opencontainers/runtime-spec/specs-go"
 	"github.com/sylabs/singularity-cri/pkg/namespace"
 	"github.com/sylabs/singularity-cri/pkg/network"
 	"github.com/sylabs/singularity-cri/pkg/rand"
+	"github.com/sylabs/singularity-cri/pkg/singularity"
 	"github.com/sylabs/singularity-cri/pkg/singularity/runtime"
 	"github.com/sylabs/singularity/pkg/ociruntime"
 	k8s "k8s.io/kubernetes/pkg/kubelet/apis/cri/runtime/v1alpha2"
@@ -32,6 +35,10 @@ import (
 const (
 	// PodIDLen reflects number of symbols in pod unique ID.
 	PodIDLen = 64
+
+	// maxParallelStops is a maximum number of pod containers
+	// that are stopped concurrently when pod is stopped.
+	maxParallelStops = 8
 )
 
 // Pod represents kubernetes pod. It encapsulates all pod-specific
@@ -51,21 +58,99 @@ type Pod struct {
 	mu         sync.Mutex
 	containers []*Container
 
-	cli        *runtime.CLIClient
+	cli        runtime.OCIClient
+	handler    string
 	syncChan   <-chan runtime.State
+	syncState  *runtime.StateTracker
 	syncCancel context.CancelFunc
 
 	network *network.PodNetwork
+
+	hostResolvConf        string
+	hasResolvConf         bool
+	hasHosts              bool
+	seccompProfileRoot    string
+	defaultSeccompProfile string
+	shmSize               int64
+
+	// SELinux labels with MCS level that is shared by all pod containers
+	processLabel string
+	mountLabel   string
+
+	allowedUnsafeSysctls []string
+
+	cgroup    cgroups.Cgroup
+	ownCgroup bool
+	overhead  PodOverhead
+	// resources reserved in pod cgroup for containers
+	// that are being created or updated, guarded by mu
+	reserved map[string]*k8s.LinuxContainerResources
+
+	pauseSandbox bool
+	pause        *exec.Cmd
+	pauseExited  chan struct{}
+}
+
+// PodOption is run during Pod initialization and may be
+// used to tune pod's behaviour.
+type PodOption func(p *Pod)
+
+// WithHostResolvConf sets path to the host's resolv.conf file
+// that is used when kubelet sends empty pod's DNS config.
+func WithHostResolvConf(path string) PodOption {
+	return func(p *Pod) {
+		p.hostResolvConf = path
+	}
+}
+
+// WithDefaultPodSeccompProfile sets path to seccomp profile file that is used
+// for pod sandbox the same way WithDefaultSeccompProfile does for containers.
+func WithDefaultPodSeccompProfile(path string) PodOption {
+	return func(p *Pod) {
+		p.defaultSeccompProfile = path
+	}
+}
+
+// WithSeccompProfileRoot sets directory relative localhost seccomp profiles
+// of the pod and its containers are loaded from. When dir is empty,
+// DefaultSeccompProfileRoot is used.
+func WithSeccompProfileRoot(dir string) PodOption {
+	return func(p *Pod) {
+		p.seccompProfileRoot = dir
+	}
+}
+
+// WithShmSize sets default size of /dev/shm in bytes for containers
+// of the pod. When size is 0, OCI runtime spec generator default is used.
+func WithShmSize(size int64) PodOption {
+	return func(p *Pod) {
+		p.shmSize = size
+	}
+}
+
+// WithOCIClient makes pod and its containers run by cli instead of
+// Singularity OCI engine. Handler is a name of RuntimeClass handler cli
+// corresponds to. Since cli is not expected to support empty process
+// containers, pod should use pause sandbox.
+func WithOCIClient(handler string, cli runtime.OCIClient) PodOption {
+	return func(p *Pod) {
+		p.handler = handler
+		p.cli = cli
+	}
 }
 
 // NewPod constructs Pod instance. Pod is thread safe to use.
-func NewPod(config *k8s.PodSandboxConfig) *Pod {
+func NewPod(config *k8s.PodSandboxConfig, opts ...PodOption) *Pod {
 	podID := rand.GenerateID(PodIDLen)
-	return &Pod{
+	pod := &Pod{
 		PodSandboxConfig: config,
 		id:               podID,
 		cli:              runtime.NewCLIClient(),
 	}
+	for _, opt := range opts {
+		opt(pod)
+	}
+	return pod
 }
 
 // ID returns unique pod ID.
@@ -73,6 +158,14 @@ func (p *Pod) ID() string {
 	return p.id
 }
 
+// RuntimeHandler returns name of RuntimeClass handler that runs pod.
+func (p *Pod) RuntimeHandler() string {
+	if p.handler == "" {
+		return singularity.RuntimeName
+	}
+	return p.handler
+}
+
 // State returns current pod state.
 func (p *Pod) State() k8s.PodSandboxState {
 	if p.runtimeState == runtime.StateRunning {
@@ -98,12 +191,18 @@ func (p *Pod) Run(baseDir string) error {
 			if err := p.terminate(true); err != nil {
 				glog.Errorf("Could not kill pod after failed run: %v", err)
 			}
-			if err := p.cli.Delete(p.id); err != nil {
-				glog.Errorf("Could not remove pod: %v", err)
+			if !p.pauseSandbox {
+				if err := p.cli.Delete(p.id); err != nil {
+					glog.Errorf("Could not remove pod: %v", err)
+				}
 			}
 			if err := p.cleanupFiles(true); err != nil {
 				glog.Errorf("Could not cleanup pod after failed run: %v", err)
 			}
+			if err := p.removeCgroup(); err != nil {
+				glog.Errorf("Could not remove cgroup after failed run: %v", err)
+			}
+			p.releaseSELinuxLabels()
 		}
 	}()
 
@@ -111,14 +210,25 @@ func (p *Pod) Run(baseDir string) error {
 	if err = p.validateConfig(); err != nil {
 		return fmt.Errorf("invalid pod config: %v", err)
 	}
+	if err = p.allocateSELinuxLabels(); err != nil {
+		return fmt.Errorf("could not allocate SELinux labels: %v", err)
+	}
+	if err = p.createCgroup(); err != nil {
+		return fmt.Errorf("could not create pod cgroup: %v", err)
+	}
 	if err = p.prepareFiles(); err != nil {
 		return fmt.Errorf("could not create pod directories: %v", err)
 	}
 	if err = p.unshareNamespaces(); err != nil {
 		return fmt.Errorf("could not unshare namespaces: %v", err)
 	}
-	if err = p.spawnOCIPod(); err != nil {
-		return fmt.Errorf("could not spawn pod: %v", err)
+	if p.pauseSandbox {
+		err = p.spawnPausePod()
+	} else {
+		err = p.spawnOCIPod()
+	}
+	if err != nil {
+		return runtime.Wrap(err, "could not spawn pod")
 	}
 	if err = p.UpdateState(); err != nil {
 		return fmt.Errorf("could not update pod state: %v", err)
@@ -132,11 +242,8 @@ func (p *Pod) Stop() error {
 		return nil
 	}
 
-	for _, c := range p.containers {
-		err := c.Stop(0)
-		if err != nil {
-			return fmt.Errorf("could not stop container %s: %v", c.id, err)
-		}
+	if err := p.stopContainers(); err != nil {
+		return err
 	}
 
 	err := p.terminate(false)
@@ -168,12 +275,18 @@ func (p *Pod) Remove() error {
 	if err := p.terminate(true); err != nil {
 		return fmt.Errorf("could not kill pod process: %v", err)
 	}
-	if err := p.cli.Delete(p.id); err != nil && err != runtime.ErrNotFound {
-		return fmt.Errorf("could not remove pod: %v", err)
+	if !p.pauseSandbox {
+		if err := p.cli.Delete(p.id); err != nil && err != runtime.ErrNotFound {
+			return fmt.Errorf("could not remove pod: %v", err)
+		}
 	}
 	if err := p.cleanupFiles(false); err != nil {
 		glog.Errorf("Pod cleanup failed: %v", err)
 	}
+	if err := p.removeCgroup(); err != nil {
+		glog.Errorf("Pod cleanup failed: %v", err)
+	}
+	p.releaseSELinuxLabels()
 	p.isRemoved = true
 	return nil
 }
@@ -213,6 +326,38 @@ func (p *Pod) Containers() []string {
 	return containers
 }
 
+// stopContainers stops pod containers concurrently, so that pod stop takes as
+// long as the longest container grace period rather than a sum of them.
+func (p *Pod) stopContainers() error {
+	p.mu.Lock()
+	containers := append([]*Container(nil), p.containers...)
+	p.mu.Unlock()
+
+	var wg sync.WaitGroup
+	workers := make(chan struct{}, maxParallelStops)
+	errs := make([]error, len(containers))
+	for i, c := range containers {
+		wg.Add(1)
+		workers <- struct{}{}
+		go func(i int, c *Container) {
+			defer wg.Done()
+			defer func() { <-workers }()
+			timeout := terminationGracePeriod(c.GetAnnotations())
+			if err := c.Stop(timeout); err != nil {
+				errs[i] = fmt.Errorf("could not stop container %s: %v", c.id, err)
+			}
+		}(i, c)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (p *Pod) addContainer(cont *Container) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
@@ -224,6 +369,23 @@ func (p *Pod) addContainer(cont *Container) {
 	p.containers = append(p.containers, cont)
 }
 
+// previousAttempt returns container of the pod with the same name as cont
+// that was created with the highest attempt number lower than cont's one.
+func (p *Pod) previousAttempt(cont *Container) *Container {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var prev *Container
+	for _, c := range p.containers {
+		if c.GetMetadata().GetName() != cont.GetMetadata().GetName() || c.Attempt() >= cont.Attempt() {
+			continue
+		}
+		if prev == nil || c.Attempt() > prev.Attempt() {
+			prev = c
+		}
+	}
+	return prev
+}
+
 func (p *Pod) removeContainer(cont *Container) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
@@ -253,6 +415,10 @@ func (p *Pod) unshareNamespaces() error {
 			Path: p.bindNamespacePath(specs.IPCNamespace),
 		})
 	}
+	if p.pauseSandbox {
+		// namespaces are created by the pause process
+		return nil
+	}
 	if err := namespace.UnshareAll(p.namespaces); err != nil {
 		return fmt.Errorf("unsahre all failed: %v", err)
 	}
@@ -0,0 +1,249 @@
+// Copyright (c) 2018-2019 Sylabs, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kube
+
+import (
+	"fmt"
+
+	"github.com/containerd/cgroups"
+	"github.com/golang/glog"
+	"github.com/opencontainers/runtime-spec/specs-go"
+	"k8s.io/apimachinery/pkg/api/resource"
+	k8s "k8s.io/kubernetes/pkg/kubelet/apis/cri/runtime/v1alpha2"
+)
+
+const (
+	// podCPUPeriod is a CFS period of pod cgroup, the same kubelet uses.
+	podCPUPeriod = 100000
+	// podMinShares is a minimal cpu.shares value of pod cgroup.
+	podMinShares = 2
+	// sharesPerCPU is a cpu.shares value that corresponds to a single CPU.
+	sharesPerCPU = 1024
+)
+
+// PodOverhead is a resource overhead of pod sandbox and Singularity engine
+// processes that is added to aggregate limits of pod containers, so that it
+// matches overhead of RuntimeClass declared in the cluster.
+type PodOverhead struct {
+	// MilliCPU is a CPU overhead in millicores.
+	MilliCPU int64
+	// Memory is a memory overhead in bytes.
+	Memory int64
+}
+
+// ParsePodOverhead parses pod CPU and memory overhead written as Kubernetes
+// quantities, e.g. 250m and 120Mi. Empty values mean no overhead.
+func ParsePodOverhead(cpu, memory string) (PodOverhead, error) {
+	var overhead PodOverhead
+	if cpu != "" {
+		q, err := resource.ParseQuantity(cpu)
+		if err != nil {
+			return overhead, fmt.Errorf("invalid cpu overhead %q: %v", cpu, err)
+		}
+		if q.Sign() < 0 {
+			return overhead, fmt.Errorf("cpu overhead should not be negative, got %q", cpu)
+		}
+		overhead.MilliCPU = q.MilliValue()
+	}
+	if memory != "" {
+		q, err := resource.ParseQuantity(memory)
+		if err != nil {
+			return overhead, fmt.Errorf("invalid memory overhead %q: %v", memory, err)
+		}
+		if q.Sign() < 0 {
+			return overhead, fmt.Errorf("memory overhead should not be negative, got %q", memory)
+		}
+		overhead.Memory = q.Value()
+	}
+	return overhead, nil
+}
+
+// WithPodOverhead sets resource overhead that is added to
+// aggregate limits of pod containers applied to pod cgroup.
+func WithPodOverhead(overhead PodOverhead) PodOption {
+	return func(p *Pod) {
+		p.overhead = overhead
+	}
+}
+
+// createCgroup creates pod cgroup at pod's cgroup parent so that
+// aggregate limits of pod containers may be applied to it. Cgroup that
+// already exists, e.g. created by kubelet, is managed by its creator, so
+// its limits are left intact and it is not removed together with the pod.
+// This method implies that cgroup v1 controllers are mounted on host
+// at /sys/fs/cgroup.
+func (p *Pod) createCgroup() error {
+	path := cgroups.StaticPath(p.GetLinux().GetCgroupParent())
+	existing, err := cgroups.Load(cgroups.V1, path)
+	if err == nil && len(existing.Subsystems()) != 0 {
+		glog.V(3).Infof("Using existing cgroup %s of pod %s", p.GetLinux().GetCgroupParent(), p.id)
+		p.cgroup = existing
+		return nil
+	}
+
+	glog.V(3).Infof("Creating cgroup %s of pod %s", p.GetLinux().GetCgroupParent(), p.id)
+	p.mu.Lock()
+	resources := p.cgroupResources()
+	p.mu.Unlock()
+	p.cgroup, err = cgroups.New(cgroups.V1, path, resources)
+	if err != nil {
+		return fmt.Errorf("could not create cgroup: %v", err)
+	}
+	p.ownCgroup = true
+	return nil
+}
+
+// updateCgroup applies aggregate limits of pod containers to the pod cgroup.
+// Resources reserved for containers that are being created or updated are
+// accounted as well. Updates are serialized so that concurrent ones do not
+// overwrite each other's limits.
+func (p *Pod) updateCgroup() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.applyCgroup()
+}
+
+// reserveCgroup grows the pod cgroup to fit resources of container c,
+// e.g. the one that is being created, in addition to the ones of pod
+// containers. Reservation is kept until releaseCgroup is called.
+func (p *Pod) reserveCgroup(c *Container, resources *k8s.LinuxContainerResources) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.reserved == nil {
+		p.reserved = make(map[string]*k8s.LinuxContainerResources)
+	}
+	p.reserved[c.id] = resources
+	if err := p.applyCgroup(); err != nil {
+		delete(p.reserved, c.id)
+		return err
+	}
+	return nil
+}
+
+// releaseCgroup drops resources reserved for container c. Pod cgroup
+// is not updated, so callers that need it shrunk should call updateCgroup.
+func (p *Pod) releaseCgroup(c *Container) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.reserved, c.id)
+}
+
+// applyCgroup updates pod cgroup with aggregate resources.
+// It should be called with mu held.
+func (p *Pod) applyCgroup() error {
+	if p.cgroup == nil || !p.ownCgroup {
+		return nil
+	}
+	if err := p.cgroup.Update(p.cgroupResources()); err != nil {
+		return fmt.Errorf("could not update pod cgroup: %v", err)
+	}
+	return nil
+}
+
+// removeCgroup removes pod cgroup if it was created by the pod.
+func (p *Pod) removeCgroup() error {
+	if p.cgroup == nil || !p.ownCgroup {
+		return nil
+	}
+	if err := p.cgroup.Delete(); err != nil {
+		return fmt.Errorf("could not remove pod cgroup: %v", err)
+	}
+	p.cgroup = nil
+	return nil
+}
+
+// cgroupResources returns aggregate resources of pod containers and
+// the reserved ones. It should be called with mu held.
+func (p *Pod) cgroupResources() *specs.LinuxResources {
+	resources := make([]*k8s.LinuxContainerResources, 0, len(p.containers)+len(p.reserved))
+	for _, c := range p.containers {
+		resources = append(resources, c.GetLinux().GetResources())
+	}
+	for _, r := range p.reserved {
+		resources = append(resources, r)
+	}
+	return podCgroupResources(resources, p.overhead)
+}
+
+// setContainerResources saves resources of pod container c
+// so that they are accounted in the pod cgroup.
+func (p *Pod) setContainerResources(c *Container, resources *k8s.LinuxContainerResources) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if c.Linux == nil {
+		c.Linux = new(k8s.LinuxContainerConfig)
+	}
+	c.Linux.Resources = resources
+}
+
+// podCgroupResources sums up resources of pod containers and pod overhead the same
+// way kubelet does for pod cgroups. CPU quota and memory limit are set only when all
+// containers are limited, otherwise pod cgroup is unlimited.
+func podCgroupResources(containers []*k8s.LinuxContainerResources, overhead PodOverhead) *specs.LinuxResources {
+	var (
+		shares         uint64
+		quota          int64
+		memory         int64
+		quotaLimited   = true
+		memoryLimited  = true
+		period         = uint64(podCPUPeriod)
+		unlimitedQuota = int64(-1)
+		unlimitedMem   = int64(-1)
+	)
+	for _, res := range containers {
+		shares += uint64(res.GetCpuShares())
+		if res.GetCpuQuota() > 0 {
+			containerPeriod := res.GetCpuPeriod()
+			if containerPeriod <= 0 {
+				containerPeriod = podCPUPeriod
+			}
+			quota += res.GetCpuQuota() * podCPUPeriod / containerPeriod
+		} else {
+			quotaLimited = false
+		}
+		if res.GetMemoryLimitInBytes() > 0 {
+			memory += res.GetMemoryLimitInBytes()
+		} else {
+			memoryLimited = false
+		}
+	}
+	shares += uint64(overhead.MilliCPU * sharesPerCPU / 1000)
+	quota += overhead.MilliCPU * podCPUPeriod / 1000
+	memory += overhead.Memory
+	if shares < podMinShares {
+		shares = podMinShares
+	}
+
+	resources := &specs.LinuxResources{
+		CPU: &specs.LinuxCPU{
+			Shares: &shares,
+			Period: &period,
+			Quota:  &unlimitedQuota,
+		},
+		Memory: &specs.LinuxMemory{
+			Limit: &unlimitedMem,
+		},
+	}
+	if len(containers) == 0 {
+		return resources
+	}
+	if quotaLimited {
+		resources.CPU.Quota = &quota
+	}
+	if memoryLimited {
+		resources.Memory.Limit = &memory
+	}
+	return resources
+}
@@ -0,0 +1,237 @@
+// Copyright (c) 2018-2019 Sylabs, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kube
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	k8s "k8s.io/kubernetes/pkg/kubelet/apis/cri/runtime/v1alpha2"
+)
+
+func TestPodCgroupResources(t *testing.T) {
+	tt := []struct {
+		name         string
+		containers   []*k8s.LinuxContainerResources
+		overhead     PodOverhead
+		expectShares uint64
+		expectQuota  int64
+		expectMemory int64
+	}{
+		{
+			name:         "no containers",
+			expectShares: 2,
+			expectQuota:  -1,
+			expectMemory: -1,
+		},
+		{
+			name: "all limited",
+			containers: []*k8s.LinuxContainerResources{
+				{
+					CpuShares:          512,
+					CpuPeriod:          100000,
+					CpuQuota:           50000,
+					MemoryLimitInBytes: 1 << 30,
+				},
+				{
+					CpuShares:          1024,
+					CpuPeriod:          50000,
+					CpuQuota:           50000,
+					MemoryLimitInBytes: 512 << 20,
+				},
+			},
+			expectShares: 1536,
+			expectQuota:  150000,
+			expectMemory: 1<<30 + 512<<20,
+		},
+		{
+			name: "default period",
+			containers: []*k8s.LinuxContainerResources{
+				{
+					CpuQuota: 20000,
+				},
+			},
+			expectShares: 2,
+			expectQuota:  20000,
+			expectMemory: -1,
+		},
+		{
+			name: "one unlimited container",
+			containers: []*k8s.LinuxContainerResources{
+				{
+					CpuShares:          256,
+					CpuPeriod:          100000,
+					CpuQuota:           50000,
+					MemoryLimitInBytes: 1 << 30,
+				},
+				nil,
+			},
+			expectShares: 256,
+			expectQuota:  -1,
+			expectMemory: -1,
+		},
+		{
+			name: "overhead",
+			containers: []*k8s.LinuxContainerResources{
+				{
+					CpuShares:          512,
+					CpuPeriod:          100000,
+					CpuQuota:           50000,
+					MemoryLimitInBytes: 1 << 30,
+				},
+			},
+			overhead: PodOverhead{
+				MilliCPU: 250,
+				Memory:   120 << 20,
+			},
+			expectShares: 768,
+			expectQuota:  75000,
+			expectMemory: 1<<30 + 120<<20,
+		},
+		{
+			name: "overhead of unlimited pod",
+			containers: []*k8s.LinuxContainerResources{
+				nil,
+			},
+			overhead: PodOverhead{
+				MilliCPU: 100,
+				Memory:   120 << 20,
+			},
+			expectShares: 102,
+			expectQuota:  -1,
+			expectMemory: -1,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			res := podCgroupResources(tc.containers, tc.overhead)
+			require.Equal(t, tc.expectShares, *res.CPU.Shares)
+			require.Equal(t, uint64(podCPUPeriod), *res.CPU.Period)
+			require.Equal(t, tc.expectQuota, *res.CPU.Quota)
+			require.Equal(t, tc.expectMemory, *res.Memory.Limit)
+		})
+	}
+}
+
+func TestPod_ReserveCgroup(t *testing.T) {
+	p := &Pod{}
+	containers := []*Container{
+		{id: "first"},
+		{id: "second"},
+		{id: "third"},
+	}
+
+	var wg sync.WaitGroup
+	for _, c := range containers {
+		wg.Add(1)
+		go func(c *Container) {
+			defer wg.Done()
+			err := p.reserveCgroup(c, &k8s.LinuxContainerResources{
+				CpuShares:          512,
+				MemoryLimitInBytes: 1 << 30,
+			})
+			require.NoError(t, err)
+		}(c)
+	}
+	wg.Wait()
+
+	p.mu.Lock()
+	res := p.cgroupResources()
+	p.mu.Unlock()
+	require.Equal(t, uint64(1536), *res.CPU.Shares)
+	require.Equal(t, int64(3<<30), *res.Memory.Limit)
+
+	p.releaseCgroup(containers[0])
+	p.mu.Lock()
+	res = p.cgroupResources()
+	p.mu.Unlock()
+	require.Equal(t, uint64(1024), *res.CPU.Shares)
+	require.Equal(t, int64(2<<30), *res.Memory.Limit)
+}
+
+func TestMergeResources(t *testing.T) {
+	res := &k8s.LinuxContainerResources{
+		CpuShares:          512,
+		CpuQuota:           50000,
+		MemoryLimitInBytes: 1 << 30,
+		CpusetCpus:         "0-1",
+	}
+	merged := mergeResources(res, &k8s.LinuxContainerResources{
+		CpuQuota:   100000,
+		CpusetCpus: "2-3",
+	})
+	require.Equal(t, &k8s.LinuxContainerResources{
+		CpuShares:          512,
+		CpuQuota:           100000,
+		MemoryLimitInBytes: 1 << 30,
+		CpusetCpus:         "2-3",
+	}, merged)
+	require.Equal(t, int64(50000), res.CpuQuota, "original resources should not change")
+	require.Equal(t, &k8s.LinuxContainerResources{CpuShares: 2}, mergeResources(nil, &k8s.LinuxContainerResources{CpuShares: 2}))
+}
+
+func TestParsePodOverhead(t *testing.T) {
+	tt := []struct {
+		name           string
+		cpu            string
+		memory         string
+		expectOverhead PodOverhead
+		expectError    string
+	}{
+		{
+			name: "no overhead",
+		},
+		{
+			name:   "cpu and memory",
+			cpu:    "250m",
+			memory: "120Mi",
+			expectOverhead: PodOverhead{
+				MilliCPU: 250,
+				Memory:   120 << 20,
+			},
+		},
+		{
+			name: "whole cpus",
+			cpu:  "2",
+			expectOverhead: PodOverhead{
+				MilliCPU: 2000,
+			},
+		},
+		{
+			name:        "invalid cpu",
+			cpu:         "fast",
+			expectError: `invalid cpu overhead "fast": quantities must match the regular expression '^([+-]?[0-9.]+)([eEinumkKMGTP]*[-+]?[0-9]*)$'`,
+		},
+		{
+			name:        "negative memory",
+			memory:      "-1Mi",
+			expectError: `memory overhead should not be negative, got "-1Mi"`,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			overhead, err := ParsePodOverhead(tc.cpu, tc.memory)
+			if tc.expectError != "" {
+				require.EqualError(t, err, tc.expectError)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.expectOverhead, overhead)
+		})
+	}
+}
@@ -29,6 +29,7 @@ const (
 	podNsStorePath    = "namespaces/"
 	podResolvConfPath = "resolv.conf"
 	podHostnamePath   = "hostname"
+	podHostsPath      = "hosts"
 	podSocketPath     = "sync.sock"
 
 	podBundlePath    = "bundle/"
@@ -53,6 +54,11 @@ func (p *Pod) hostnameFilePath() string {
 	return filepath.Join(p.baseDir, podHostnamePath)
 }
 
+// hostsFilePath returns path to pod's hosts file.
+func (p *Pod) hostsFilePath() string {
+	return filepath.Join(p.baseDir, podHostsPath)
+}
+
 // resolvConfFilePath returns path to pod's resolv.conf file.
 func (p *Pod) resolvConfFilePath() string {
 	return filepath.Join(p.baseDir, podResolvConfPath)
@@ -93,7 +99,8 @@ func (p *Pod) prepareFiles() error {
 	if err := p.addLogDirectory(); err != nil {
 		return fmt.Errorf("could not create log directory: %v", err)
 	}
-	if err := writeResolvConf(p.resolvConfFilePath(), p.GetDnsConfig()); err != nil {
+	p.hasResolvConf, err = writeResolvConf(p.resolvConfFilePath(), p.GetDnsConfig(), p.hostResolvConf)
+	if err != nil {
 		return fmt.Errorf("could not create resolv.conf: %v", err)
 	}
 	if err := p.addHostname(); err != nil {
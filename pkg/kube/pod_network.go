@@ -36,6 +36,16 @@ func (p *Pod) NetworkStatus() *k8s.PodSandboxNetworkStatus {
 	return &k8s.PodSandboxNetworkStatus{Ip: netIP.String()}
 }
 
+// NetworkAttachment returns description of pod's network attachment
+// or nil if pod's network is not set up.
+func (p *Pod) NetworkAttachment() *network.Attachment {
+	if p.network == nil {
+		return nil
+	}
+	a := p.network.Attachment()
+	return &a
+}
+
 // SetUpNetwork brings up network interface and configure it
 // inside pod's network namespace.
 func (p *Pod) SetUpNetwork(manager *network.Manager) error {
@@ -49,12 +59,22 @@ func (p *Pod) SetUpNetwork(manager *network.Manager) error {
 		Name:         p.GetMetadata().Name,
 		NsPath:       nsPath,
 		PortMappings: p.GetPortMappings(),
+		HostDevices:  p.GetAnnotations()[network.HostDevicesAnnotation],
 	}
 	net, err := manager.SetUpPod(networkConfig)
 	if err != nil {
 		return fmt.Errorf("could not set up pod's network: %v", err)
 	}
 	p.network = net
+
+	var ip string
+	if netIP, err := net.GetIP(); err == nil {
+		ip = netIP.String()
+	}
+	if err := writeHosts(p.hostsFilePath(), ip, p.GetHostname()); err != nil {
+		return fmt.Errorf("could not create hosts file: %v", err)
+	}
+	p.hasHosts = true
 	return nil
 }
 
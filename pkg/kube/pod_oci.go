@@ -17,6 +17,7 @@ package kube
 import (
 	"fmt"
 	"io/ioutil"
+	"strings"
 
 	"github.com/golang/glog"
 	"github.com/kubernetes-sigs/cri-o/pkg/seccomp"
@@ -77,8 +78,11 @@ func (t *podTranslator) translate() (*specs.Spec, error) {
 	}
 
 	security := t.pod.GetLinux().GetSecurityContext()
-	if err := setupSELinux(&t.g, security.GetSelinuxOptions()); err != nil {
-		return nil, err
+	if t.pod.processLabel != "" {
+		glog.V(3).Infof("Setting mount label to %q", t.pod.mountLabel)
+		t.g.SetLinuxMountLabel(t.pod.mountLabel)
+		glog.V(3).Infof("Setting process's SELinux label to %q", t.pod.processLabel)
+		t.g.SetProcessSelinuxLabel(t.pod.processLabel)
 	}
 	if err := setupSeccomp(&t.g, security.GetSeccompProfilePath()); err != nil {
 		return nil, err
@@ -97,11 +101,61 @@ func (t *podTranslator) translate() (*specs.Spec, error) {
 	return t.g.Config, nil
 }
 
-func setupSELinux(g *generate.Generator, options *k8s.SELinuxOption) error {
-	if options == nil {
+// allocateSELinuxLabels sets SELinux labels of the pod. When no SELinux
+// options are provided, labels with a unique MCS level are allocated. Pod
+// containers share that level, so that they can access shared volumes,
+// and it is released only when pod is removed.
+func (p *Pod) allocateSELinuxLabels() error {
+	security := p.GetLinux().GetSecurityContext()
+	options := security.GetSelinuxOptions()
+	if options == nil && security.GetPrivileged() {
 		return nil
 	}
 
+	processLabel, mountLabel, err := selinuxLabels(options)
+	if err != nil {
+		return err
+	}
+	p.processLabel = processLabel
+	p.mountLabel = mountLabel
+	return nil
+}
+
+// releaseSELinuxLabels allows MCS level of the pod to be reused by other pods.
+func (p *Pod) releaseSELinuxLabels() {
+	if p.processLabel == "" {
+		return
+	}
+	if err := label.ReleaseLabel(p.processLabel); err != nil {
+		glog.Errorf("Could not release SELinux label: %v", err)
+	}
+	p.processLabel = ""
+	p.mountLabel = ""
+}
+
+// withPodLevel returns SELinux options of a pod container. Unless options
+// set MCS level explicitly, level of passed pod label is used.
+func withPodLevel(options *k8s.SELinuxOption, podLabel string) *k8s.SELinuxOption {
+	if options.GetLevel() != "" {
+		return options
+	}
+	// label has user:role:type:level format, level may contain colons
+	parts := strings.SplitN(podLabel, ":", 4)
+	if len(parts) != 4 {
+		return options
+	}
+	return &k8s.SELinuxOption{
+		User:  options.GetUser(),
+		Role:  options.GetRole(),
+		Type:  options.GetType(),
+		Level: parts[3],
+	}
+}
+
+// selinuxLabels returns process and mount labels built from passed options.
+// Labels get a unique MCS level unless options set it explicitly. Empty
+// labels are returned when SELinux is disabled on the host.
+func selinuxLabels(options *k8s.SELinuxOption) (string, string, error) {
 	var labels []string
 	if options.GetUser() != "" {
 		labels = append(labels, "user:"+options.GetUser())
@@ -117,13 +171,9 @@ func setupSELinux(g *generate.Generator, options *k8s.SELinuxOption) error {
 	}
 	processLabel, mountLabel, err := label.InitLabels(labels)
 	if err != nil {
-		return fmt.Errorf("could not init selinux labels: %v", err)
+		return "", "", fmt.Errorf("could not init selinux labels: %v", err)
 	}
-	glog.V(3).Infof("Setting mount label to %q", mountLabel)
-	g.SetLinuxMountLabel(mountLabel)
-	glog.V(3).Infof("Setting process's SELinux label to %q", processLabel)
-	g.SetProcessSelinuxLabel(processLabel)
-	return nil
+	return processLabel, mountLabel, nil
 }
 
 func setupSeccomp(g *generate.Generator, profile string) error {
@@ -0,0 +1,62 @@
+// Copyright (c) 2018-2019 Sylabs, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kube
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	k8s "k8s.io/kubernetes/pkg/kubelet/apis/cri/runtime/v1alpha2"
+)
+
+func TestWithPodLevel(t *testing.T) {
+	const podLabel = "system_u:object_r:container_file_t:s0:c4,c12"
+
+	tt := []struct {
+		name     string
+		options  *k8s.SELinuxOption
+		podLabel string
+		expect   *k8s.SELinuxOption
+	}{
+		{
+			name:     "no options",
+			podLabel: podLabel,
+			expect:   &k8s.SELinuxOption{Level: "s0:c4,c12"},
+		},
+		{
+			name:     "pod level",
+			options:  &k8s.SELinuxOption{Type: "spc_t"},
+			podLabel: podLabel,
+			expect:   &k8s.SELinuxOption{Type: "spc_t", Level: "s0:c4,c12"},
+		},
+		{
+			name:     "explicit level",
+			options:  &k8s.SELinuxOption{Level: "s0:c1,c2"},
+			podLabel: podLabel,
+			expect:   &k8s.SELinuxOption{Level: "s0:c1,c2"},
+		},
+		{
+			name:    "no pod label",
+			options: &k8s.SELinuxOption{Type: "spc_t"},
+			expect:  &k8s.SELinuxOption{Type: "spc_t"},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			require.Equal(t, tc.expect, withPodLevel(tc.options, tc.podLabel))
+		})
+	}
+}
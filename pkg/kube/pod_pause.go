@@ -0,0 +1,178 @@
+// Copyright (c) 2018-2019 Sylabs, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kube
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"sort"
+	"syscall"
+	"time"
+
+	"github.com/containerd/cgroups"
+	"github.com/golang/glog"
+	"github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/sylabs/singularity-cri/pkg/namespace"
+	"github.com/sylabs/singularity-cri/pkg/singularity/runtime"
+	"github.com/sylabs/singularity/pkg/ociruntime"
+	k8s "k8s.io/kubernetes/pkg/kubelet/apis/cri/runtime/v1alpha2"
+)
+
+// PauseCommand is a hidden sycri subcommand that runs built-in pause
+// process holding pod namespaces when pause sandboxes are enabled.
+// Pod sysctls are passed to it as name=value arguments.
+const PauseCommand = "pause"
+
+// PauseReadyFD is a file descriptor pause process writes an error to when
+// it fails to apply pod sysctls. It is closed once pause process is ready.
+const PauseReadyFD = 3
+
+// pauseBinary is a binary that is run with PauseCommand to start pause process.
+var pauseBinary = "/proc/self/exe"
+
+// WithPauseSandbox makes pod run a minimal built-in pause process holding
+// its namespaces instead of a Singularity OCI engine instance. That reduces
+// memory usage and startup time of pods on dense nodes.
+func WithPauseSandbox(enabled bool) PodOption {
+	return func(p *Pod) {
+		p.pauseSandbox = enabled
+	}
+}
+
+// spawnPausePod starts pause process in new namespaces requested by the pod,
+// waits for it to apply pod sysctls in them and binds them so that pod
+// containers could join them.
+func (p *Pod) spawnPausePod() error {
+	// unlike OCI engine pause process creates all namespaces itself
+	podPID := p.GetLinux().GetSecurityContext().GetNamespaceOptions().GetPid() == k8s.NamespaceMode_POD
+	if podPID {
+		p.namespaces = append(p.namespaces, specs.LinuxNamespace{
+			Type: specs.PIDNamespace,
+			Path: p.bindNamespacePath(specs.PIDNamespace),
+		})
+	}
+
+	sysctls := p.GetLinux().GetSysctls()
+	args := make([]string, 0, len(sysctls)+1)
+	for name, value := range sysctls {
+		args = append(args, name+"="+value)
+	}
+	sort.Strings(args)
+	args = append([]string{PauseCommand}, args...)
+
+	ready, readyW, err := os.Pipe()
+	if err != nil {
+		return fmt.Errorf("could not create pause ready pipe: %v", err)
+	}
+	defer ready.Close()
+
+	glog.V(3).Infof("Starting pause process of pod %s", p.id)
+	cmd := exec.Command(pauseBinary, args...)
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		Cloneflags: namespace.CloneFlags(p.namespaces),
+		// do not receive signals sent to sycri process group
+		Setpgid: true,
+	}
+	// extra files start from descriptor 3, which is PauseReadyFD
+	cmd.ExtraFiles = []*os.File{readyW}
+	err = cmd.Start()
+	readyW.Close()
+	if err != nil {
+		return fmt.Errorf("could not start pause process: %v", err)
+	}
+
+	createdAt := time.Now().UnixNano()
+	p.pauseExited = make(chan struct{})
+	p.ociState = &ociruntime.State{
+		State: specs.State{
+			ID:     p.id,
+			Pid:    cmd.Process.Pid,
+			Status: "running",
+		},
+		CreatedAt: &createdAt,
+		StartedAt: &createdAt,
+	}
+	p.runtimeState = runtime.StateRunning
+	p.pause = cmd
+	go func() {
+		err := cmd.Wait()
+		glog.V(3).Infof("Pause process of pod %s exited: %v", p.id, err)
+		close(p.pauseExited)
+	}()
+
+	msg, err := ioutil.ReadAll(ready)
+	if err != nil {
+		return fmt.Errorf("could not read pause process status: %v", err)
+	}
+	if len(msg) != 0 {
+		return fmt.Errorf("pause process failed: %s", msg)
+	}
+	if p.cgroup != nil {
+		if err := p.cgroup.Add(cgroups.Process{Pid: cmd.Process.Pid}); err != nil {
+			return fmt.Errorf("could not add pause process to pod cgroup: %v", err)
+		}
+	}
+	for _, ns := range p.namespaces {
+		if err := namespace.Bind(cmd.Process.Pid, ns); err != nil {
+			return fmt.Errorf("could not bind namespace: %v", err)
+		}
+	}
+	return nil
+}
+
+// updatePauseState updates pod state according to the state of its pause process.
+func (p *Pod) updatePauseState() {
+	if p.pauseExited == nil {
+		p.runtimeState = runtime.StateExited
+		return
+	}
+	select {
+	case <-p.pauseExited:
+		if p.runtimeState != runtime.StateExited {
+			finishedAt := time.Now().UnixNano()
+			p.ociState.FinishedAt = &finishedAt
+			p.ociState.Status = "stopped"
+		}
+		p.runtimeState = runtime.StateExited
+	default:
+		p.runtimeState = runtime.StateRunning
+	}
+}
+
+// terminatePause sends SIGTERM to the pod pause process, or SIGKILL when
+// force is true, and waits for it to exit.
+func (p *Pod) terminatePause(force bool) error {
+	if p.pause == nil {
+		return nil
+	}
+	select {
+	case <-p.pauseExited:
+		return nil
+	default:
+	}
+
+	sig := syscall.SIGTERM
+	if force {
+		sig = syscall.SIGKILL
+	}
+	if err := p.pause.Process.Signal(sig); err != nil {
+		return fmt.Errorf("could not signal pause process: %v", err)
+	}
+	<-p.pauseExited
+	p.updatePauseState()
+	return nil
+}
@@ -0,0 +1,87 @@
+// Copyright (c) 2018-2019 Sylabs, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kube
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	k8s "k8s.io/kubernetes/pkg/kubelet/apis/cri/runtime/v1alpha2"
+)
+
+func TestPod_SpawnPausePod(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pause-")
+	require.NoError(t, err, "could not create temp dir")
+	defer os.RemoveAll(dir)
+
+	argsFile := filepath.Join(dir, "args")
+	tt := []struct {
+		name        string
+		script      string
+		expectArgs  string
+		expectError bool
+	}{
+		{
+			name:       "sysctls applied",
+			script:     "echo \"$@\" > " + argsFile + "\nexec 3>&-\nexec sleep 60\n",
+			expectArgs: "pause kernel.shmmax=65536 net.ipv4.ip_forward=1\n",
+		},
+		{
+			name:        "sysctls failed",
+			script:      "printf 'could not set sysctl' >&3\nexit 1\n",
+			expectError: true,
+		},
+	}
+
+	defer func(binary string) {
+		pauseBinary = binary
+	}(pauseBinary)
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			pauseBinary = filepath.Join(dir, "pause.sh")
+			err := ioutil.WriteFile(pauseBinary, []byte("#!/bin/sh\n"+tc.script), 0755)
+			require.NoError(t, err, "could not write pause script")
+
+			pod := &Pod{
+				id: "pause-test",
+				PodSandboxConfig: &k8s.PodSandboxConfig{
+					Linux: &k8s.LinuxPodSandboxConfig{
+						Sysctls: map[string]string{
+							"net.ipv4.ip_forward": "1",
+							"kernel.shmmax":       "65536",
+						},
+						SecurityContext: &k8s.LinuxSandboxSecurityContext{
+							NamespaceOptions: &k8s.NamespaceOption{
+								Pid: k8s.NamespaceMode_NODE,
+							},
+						},
+					},
+				},
+			}
+			err = pod.spawnPausePod()
+			defer pod.terminatePause(true)
+			require.Equal(t, tc.expectError, err != nil, "unexpected error: %v", err)
+			if tc.expectError {
+				return
+			}
+			args, err := ioutil.ReadFile(argsFile)
+			require.NoError(t, err)
+			require.Equal(t, tc.expectArgs, string(args))
+		})
+	}
+}
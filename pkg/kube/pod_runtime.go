@@ -41,15 +41,16 @@ func (p *Pod) spawnOCIPod() error {
 
 	syncCtx, cancel := context.WithCancel(context.Background())
 	p.syncCancel = cancel
-	p.syncChan, err = runtime.ObserveState(syncCtx, p.socketPath())
+	events, err := runtime.ObserveState(syncCtx, p.socketPath())
 	if err != nil {
 		return fmt.Errorf("could not listen for state changes: %v", err)
 	}
+	p.syncState, p.syncChan = runtime.TrackState(events, stateMaxAge)
 
 	glog.V(3).Infof("Creating pod %s", p.id)
 	pty, err := p.cli.Create(p.id, p.bundlePath(), false, false, "--empty-process", "--sync-socket", p.socketPath())
 	if err != nil {
-		return fmt.Errorf("could not create pod: %v", err)
+		return runtime.Wrap(err, "could not create pod")
 	}
 	defer pty.Close()
 
@@ -62,7 +63,7 @@ func (p *Pod) spawnOCIPod() error {
 
 	glog.V(3).Infof("Starting pod %s", p.id)
 	if err := p.cli.Start(p.id); err != nil {
-		return fmt.Errorf("could not start pod: %v", err)
+		return runtime.Wrap(err, "could not start pod")
 	}
 
 	if err := p.expectState(runtime.StateRunning); err != nil {
@@ -90,14 +91,31 @@ func (p *Pod) spawnOCIPod() error {
 }
 
 // UpdateState updates container state according to information
-// received from the runtime.
+// received from the runtime. Runtime is queried only when sync socket
+// reported state change since the last query or stopped reporting them.
 func (p *Pod) UpdateState() error {
+	if p.pauseSandbox {
+		p.updatePauseState()
+		return nil
+	}
+	var version uint64
+	if p.syncState != nil {
+		var outdated bool
+		version, outdated = p.syncState.Outdated()
+		if !outdated && p.ociState != nil {
+			return nil
+		}
+	}
+
 	var err error
 	p.ociState, err = p.cli.State(p.id)
 	if err != nil {
-		return fmt.Errorf("could not get pod state: %v", err)
+		return runtime.Wrap(err, "could not get pod state")
 	}
 	p.runtimeState = runtime.StatusToState(p.ociState.Status)
+	if p.syncState != nil {
+		p.syncState.Queried(version)
+	}
 	return nil
 }
 
@@ -126,6 +144,9 @@ func (p *Pod) terminate(force bool) error {
 	if p.runtimeState == runtime.StateExited {
 		return nil
 	}
+	if p.pauseSandbox {
+		return p.terminatePause(force)
+	}
 
 	if force {
 		glog.V(3).Infof("Forcibly stopping pod %s", p.id)
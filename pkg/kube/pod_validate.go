@@ -21,49 +21,63 @@ import (
 	"strings"
 
 	"github.com/golang/glog"
-	"github.com/opencontainers/runtime-spec/specs-go"
+	"k8s.io/apimachinery/pkg/util/validation"
 	k8s "k8s.io/kubernetes/pkg/kubelet/apis/cri/runtime/v1alpha2"
 )
 
-var (
-	sysctlToNs = map[string]specs.LinuxNamespaceType{
-		"kernel.shm": specs.IPCNamespace,
-		"kernel.msg": specs.IPCNamespace,
-		"kernel.sem": specs.IPCNamespace,
-		"fs.mqueue.": specs.IPCNamespace,
-		"net.":       specs.NetworkNamespace,
-	}
-)
-
 const (
 	defaultCgroup = "singularity-cri"
+
+	// maxHostnameLen is a maximum hostname length allowed by the kernel.
+	maxHostnameLen = 64
 )
 
+// ValidateHostname checks that hostname is a valid RFC 1123
+// hostname that may be set in pod's UTS namespace.
+func ValidateHostname(hostname string) error {
+	if len(hostname) > maxHostnameLen {
+		return fmt.Errorf("hostname %q is longer than %d characters", hostname, maxHostnameLen)
+	}
+	if errs := validation.IsDNS1123Subdomain(hostname); len(errs) != 0 {
+		return fmt.Errorf("invalid hostname %q: %s", hostname, strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// defaultHostname returns hostname derived from pod name the same way kubelet
+// does: name is truncated to 63 characters and trailing '-' and '.' are removed.
+func defaultHostname(name string) string {
+	if len(name) > validation.DNS1123LabelMaxLength {
+		name = name[:validation.DNS1123LabelMaxLength]
+	}
+	return strings.TrimRight(name, "-.")
+}
+
 func (p *Pod) validateConfig() error {
-	hasIPC := p.GetLinux().GetSecurityContext().GetNamespaceOptions().GetIpc() == k8s.NamespaceMode_POD
 	hasNET := p.GetLinux().GetSecurityContext().GetNamespaceOptions().GetNetwork() == k8s.NamespaceMode_POD
-
-	for sysctl := range p.GetLinux().GetSysctls() {
-		for prefix, nsType := range sysctlToNs {
-			if strings.HasPrefix(sysctl, prefix) {
-				if (nsType == specs.IPCNamespace && !hasIPC) ||
-					(nsType == specs.NetworkNamespace && !hasNET) {
-					return fmt.Errorf("sysctl %s requires a separate %s namespace", sysctl, nsType)
-				}
-			}
-		}
+	if err := ValidateSysctls(p.GetLinux(), p.allowedUnsafeSysctls); err != nil {
+		return err
 	}
 
 	var err error
 	hostname := p.GetHostname()
 	if hostname == "" {
-		hostname, err = os.Hostname()
-		if err != nil {
-			return fmt.Errorf("could not get default hostname: %v", err)
+		// pods in host network use host's hostname
+		if hasNET {
+			hostname = defaultHostname(p.GetMetadata().GetName())
+		}
+		if ValidateHostname(hostname) != nil {
+			hostname, err = os.Hostname()
+			if err != nil {
+				return fmt.Errorf("could not get default hostname: %v", err)
+			}
 		}
 		glog.V(2).Infof("Setting pod's %s hostname to default value %q", p.id, hostname)
 		p.Hostname = hostname
 	}
+	if err := ValidateHostname(hostname); err != nil {
+		return err
+	}
 
 	cgroupsPath := p.GetLinux().GetCgroupParent()
 	if cgroupsPath == "" {
@@ -75,14 +89,25 @@ func (p *Pod) validateConfig() error {
 		p.Linux.CgroupParent = cgroupsPath
 	}
 
-	security := p.GetLinux().GetSecurityContext()
-	if security != nil {
-		scProfile, err := prepareSeccompPath(security.GetSeccompProfilePath())
+	if size, ok := p.GetAnnotations()[ShmSizeAnnotation]; ok {
+		p.shmSize, err = ParseShmSize(size)
 		if err != nil {
-			return fmt.Errorf("invalid Seccomp profile path: %v", err)
+			return err
 		}
-		security.SeccompProfilePath = scProfile
+		glog.V(2).Infof("Setting pod's %s shm size to %d", p.id, p.shmSize)
+	}
+
+	security := p.GetLinux().GetSecurityContext()
+	if security == nil {
+		// node-wide default profile applies to sandboxes without security context too
+		security = new(k8s.LinuxSandboxSecurityContext)
+		p.Linux.SecurityContext = security
+	}
+	scProfile, err := prepareSeccompPath(security.GetSeccompProfilePath(), p.seccompProfileRoot, p.defaultSeccompProfile)
+	if err != nil {
+		return fmt.Errorf("invalid Seccomp profile path: %v", err)
 	}
+	security.SeccompProfilePath = scProfile
 
 	return nil
 }
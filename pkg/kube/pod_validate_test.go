@@ -0,0 +1,144 @@
+// Copyright (c) 2018-2019 Sylabs, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kube
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	k8s "k8s.io/kubernetes/pkg/kubelet/apis/cri/runtime/v1alpha2"
+)
+
+func TestValidateHostname(t *testing.T) {
+	tt := []struct {
+		name        string
+		hostname    string
+		expectError error
+	}{
+		{
+			name:     "simple hostname",
+			hostname: "nginx-7db9fccd9b-x2v4k",
+		},
+		{
+			name:     "fully qualified hostname",
+			hostname: "web-0.nginx.default.svc",
+		},
+		{
+			name:        "empty hostname",
+			hostname:    "",
+			expectError: fmt.Errorf(`invalid hostname "": a DNS-1123 subdomain must consist of lower case alphanumeric characters, '-' or '.', and must start and end with an alphanumeric character (e.g. 'example.com', regex used for validation is '[a-z0-9]([-a-z0-9]*[a-z0-9])?(\.[a-z0-9]([-a-z0-9]*[a-z0-9])?)*')`),
+		},
+		{
+			name:        "upper case hostname",
+			hostname:    "Nginx",
+			expectError: fmt.Errorf(`invalid hostname "Nginx": a DNS-1123 subdomain must consist of lower case alphanumeric characters, '-' or '.', and must start and end with an alphanumeric character (e.g. 'example.com', regex used for validation is '[a-z0-9]([-a-z0-9]*[a-z0-9])?(\.[a-z0-9]([-a-z0-9]*[a-z0-9])?)*')`),
+		},
+		{
+			name:        "too long hostname",
+			hostname:    strings.Repeat("a", 65),
+			expectError: fmt.Errorf(`hostname %q is longer than 64 characters`, strings.Repeat("a", 65)),
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			require.Equal(t, tc.expectError, ValidateHostname(tc.hostname))
+		})
+	}
+}
+
+func TestDefaultHostname(t *testing.T) {
+	tt := []struct {
+		name           string
+		podName        string
+		expectHostname string
+	}{
+		{
+			name:           "short name",
+			podName:        "nginx",
+			expectHostname: "nginx",
+		},
+		{
+			name:           "long name",
+			podName:        strings.Repeat("a", 62) + "-b",
+			expectHostname: strings.Repeat("a", 62),
+		},
+		{
+			name:           "trailing dot",
+			podName:        "nginx.",
+			expectHostname: "nginx",
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			require.Equal(t, tc.expectHostname, defaultHostname(tc.podName))
+		})
+	}
+}
+
+func TestPod_ValidateConfigSeccomp(t *testing.T) {
+	const nodeDefault = "/etc/sycri/seccomp.json"
+
+	tt := []struct {
+		name          string
+		security      *k8s.LinuxSandboxSecurityContext
+		nodeDefault   string
+		expectProfile string
+	}{
+		{
+			name:          "no security context",
+			nodeDefault:   nodeDefault,
+			expectProfile: nodeDefault,
+		},
+		{
+			name:          "empty profile",
+			security:      &k8s.LinuxSandboxSecurityContext{},
+			nodeDefault:   nodeDefault,
+			expectProfile: nodeDefault,
+		},
+		{
+			name:          "empty profile without node default",
+			security:      &k8s.LinuxSandboxSecurityContext{},
+			expectProfile: unconfinedSeccompProfile,
+		},
+		{
+			name: "unconfined profile",
+			security: &k8s.LinuxSandboxSecurityContext{
+				SeccompProfilePath: unconfinedSeccompProfile,
+			},
+			nodeDefault:   nodeDefault,
+			expectProfile: unconfinedSeccompProfile,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			config := &k8s.PodSandboxConfig{
+				Hostname: "test",
+			}
+			if tc.security != nil {
+				config.Linux = &k8s.LinuxPodSandboxConfig{
+					SecurityContext: tc.security,
+				}
+			}
+			pod := NewPod(config, WithDefaultPodSeccompProfile(tc.nodeDefault))
+			require.NoError(t, pod.validateConfig())
+			require.Equal(t, tc.expectProfile, pod.GetLinux().GetSecurityContext().GetSeccompProfilePath())
+		})
+	}
+}
@@ -0,0 +1,72 @@
+// Copyright (c) 2018-2019 Sylabs, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kube
+
+import (
+	"fmt"
+	"strconv"
+)
+
+const (
+	// CPURealtimeRuntimeAnnotation may be set on container to set
+	// cpu.rt_runtime_us of container cgroup, in microseconds.
+	CPURealtimeRuntimeAnnotation = "sycri.sylabs.io/cpu-rt-runtime"
+	// CPURealtimePeriodAnnotation may be set on container to set
+	// cpu.rt_period_us of container cgroup, in microseconds.
+	CPURealtimePeriodAnnotation = "sycri.sylabs.io/cpu-rt-period"
+)
+
+// WithRealtimeAllowed sets whether container may request realtime
+// scheduling parameters with annotations.
+func WithRealtimeAllowed(allowed bool) ContainerOption {
+	return func(c *Container) {
+		c.realtimeAllowed = allowed
+	}
+}
+
+// parseRealtime parses realtime scheduling parameters requested
+// with container annotations. Zero values mean not requested.
+func parseRealtime(annotations map[string]string, allowed bool) (int64, uint64, error) {
+	runtimeValue, hasRuntime := annotations[CPURealtimeRuntimeAnnotation]
+	periodValue, hasPeriod := annotations[CPURealtimePeriodAnnotation]
+	if !hasRuntime && !hasPeriod {
+		return 0, 0, nil
+	}
+	if !allowed {
+		return 0, 0, fmt.Errorf("realtime scheduling is not allowed on this node")
+	}
+
+	var (
+		runtime int64
+		period  uint64
+		err     error
+	)
+	if hasRuntime {
+		runtime, err = strconv.ParseInt(runtimeValue, 10, 64)
+		if err != nil || runtime <= 0 {
+			return 0, 0, fmt.Errorf("invalid realtime runtime %q", runtimeValue)
+		}
+	}
+	if hasPeriod {
+		period, err = strconv.ParseUint(periodValue, 10, 64)
+		if err != nil || period == 0 {
+			return 0, 0, fmt.Errorf("invalid realtime period %q", periodValue)
+		}
+	}
+	if hasRuntime && hasPeriod && uint64(runtime) > period {
+		return 0, 0, fmt.Errorf("realtime runtime cannot exceed period")
+	}
+	return runtime, period, nil
+}
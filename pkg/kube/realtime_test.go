@@ -0,0 +1,97 @@
+// Copyright (c) 2018-2019 Sylabs, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kube
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRealtime(t *testing.T) {
+	tt := []struct {
+		name          string
+		annotations   map[string]string
+		allowed       bool
+		expectRuntime int64
+		expectPeriod  uint64
+		expectError   error
+	}{
+		{
+			name:        "not requested",
+			annotations: map[string]string{"foo": "bar"},
+		},
+		{
+			name: "not allowed",
+			annotations: map[string]string{
+				CPURealtimeRuntimeAnnotation: "950000",
+			},
+			expectError: fmt.Errorf("realtime scheduling is not allowed on this node"),
+		},
+		{
+			name: "runtime and period",
+			annotations: map[string]string{
+				CPURealtimeRuntimeAnnotation: "950000",
+				CPURealtimePeriodAnnotation:  "1000000",
+			},
+			allowed:       true,
+			expectRuntime: 950000,
+			expectPeriod:  1000000,
+		},
+		{
+			name: "period only",
+			annotations: map[string]string{
+				CPURealtimePeriodAnnotation: "1000000",
+			},
+			allowed:      true,
+			expectPeriod: 1000000,
+		},
+		{
+			name: "invalid runtime",
+			annotations: map[string]string{
+				CPURealtimeRuntimeAnnotation: "-1",
+			},
+			allowed:     true,
+			expectError: fmt.Errorf(`invalid realtime runtime "-1"`),
+		},
+		{
+			name: "invalid period",
+			annotations: map[string]string{
+				CPURealtimePeriodAnnotation: "1s",
+			},
+			allowed:     true,
+			expectError: fmt.Errorf(`invalid realtime period "1s"`),
+		},
+		{
+			name: "runtime exceeds period",
+			annotations: map[string]string{
+				CPURealtimeRuntimeAnnotation: "2000000",
+				CPURealtimePeriodAnnotation:  "1000000",
+			},
+			allowed:     true,
+			expectError: fmt.Errorf("realtime runtime cannot exceed period"),
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			runtime, period, err := parseRealtime(tc.annotations, tc.allowed)
+			require.Equal(t, tc.expectError, err)
+			require.Equal(t, tc.expectRuntime, runtime)
+			require.Equal(t, tc.expectPeriod, period)
+		})
+	}
+}
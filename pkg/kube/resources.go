@@ -0,0 +1,99 @@
+// Copyright (c) 2018-2019 Sylabs, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kube
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	k8s "k8s.io/kubernetes/pkg/kubelet/apis/cri/runtime/v1alpha2"
+)
+
+// Limits of cgroup values the same as the ones enforced by the kernel.
+const (
+	minCPUShares = 2
+	maxCPUShares = 262144
+	minCPUPeriod = 1000
+	maxCPUPeriod = 1000000
+	minCPUQuota  = 1000
+	minOOMScore  = -1000
+	maxOOMScore  = 1000
+)
+
+var (
+	// onlineCPUsPath and onlineNodesPath list CPUs and NUMA nodes
+	// that are online on the node, overridden in tests.
+	onlineCPUsPath  = "/sys/devices/system/cpu/online"
+	onlineNodesPath = "/sys/devices/system/node/online"
+)
+
+// ValidateResources checks that resources requested for a container are valid,
+// so that they may be applied to container cgroup. Limits are not checked against
+// node capacity, since kubernetes allows limits to overcommit the node.
+func ValidateResources(res *k8s.LinuxContainerResources) error {
+	if res == nil {
+		return nil
+	}
+	if shares := res.GetCpuShares(); shares != 0 && (shares < minCPUShares || shares > maxCPUShares) {
+		return fmt.Errorf("cpu shares should be in range [%d, %d], got %d", minCPUShares, maxCPUShares, shares)
+	}
+	if period := res.GetCpuPeriod(); period != 0 && (period < minCPUPeriod || period > maxCPUPeriod) {
+		return fmt.Errorf("cpu period should be in range [%d, %d], got %d", minCPUPeriod, maxCPUPeriod, period)
+	}
+	if quota := res.GetCpuQuota(); quota != 0 && quota != -1 && quota < minCPUQuota {
+		return fmt.Errorf("cpu quota should be either -1 or at least %d, got %d", minCPUQuota, quota)
+	}
+	if score := res.GetOomScoreAdj(); score < minOOMScore || score > maxOOMScore {
+		return fmt.Errorf("oom score adj should be in range [%d, %d], got %d", minOOMScore, maxOOMScore, score)
+	}
+
+	if limit := res.GetMemoryLimitInBytes(); limit < 0 {
+		return fmt.Errorf("memory limit cannot be negative, got %d", limit)
+	}
+	if err := validateCPUList(res.GetCpusetCpus(), onlineCPUsPath); err != nil {
+		return fmt.Errorf("invalid cpuset cpus: %v", err)
+	}
+	if err := validateCPUList(res.GetCpusetMems(), onlineNodesPath); err != nil {
+		return fmt.Errorf("invalid cpuset mems: %v", err)
+	}
+	return nil
+}
+
+// validateCPUList checks that all items of list written in cpuset
+// format are present in the list read from onlinePath.
+func validateCPUList(list, onlinePath string) error {
+	if list == "" {
+		return nil
+	}
+	requested, err := parseCPUList(list)
+	if err != nil {
+		return err
+	}
+	content, err := ioutil.ReadFile(onlinePath)
+	if err != nil {
+		return fmt.Errorf("could not read online list: %v", err)
+	}
+	online, err := parseCPUList(strings.TrimSpace(string(content)))
+	if err != nil {
+		return fmt.Errorf("could not parse online list: %v", err)
+	}
+	for item := range requested {
+		if !online[item] {
+			return fmt.Errorf("%d is not online", item)
+		}
+	}
+	return nil
+}
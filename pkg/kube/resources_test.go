@@ -0,0 +1,188 @@
+// Copyright (c) 2018-2019 Sylabs, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kube
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	k8s "k8s.io/kubernetes/pkg/kubelet/apis/cri/runtime/v1alpha2"
+)
+
+func TestValidateResources(t *testing.T) {
+	root, err := ioutil.TempDir("", "")
+	require.NoError(t, err, "could not create temp dir")
+	defer os.RemoveAll(root)
+
+	cpus := filepath.Join(root, "cpus")
+	nodes := filepath.Join(root, "nodes")
+	require.NoError(t, ioutil.WriteFile(cpus, []byte("0-7\n"), 0644))
+	require.NoError(t, ioutil.WriteFile(nodes, []byte("0-1\n"), 0644))
+
+	defer func(cpus, nodes string) {
+		onlineCPUsPath = cpus
+		onlineNodesPath = nodes
+	}(onlineCPUsPath, onlineNodesPath)
+	onlineCPUsPath = cpus
+	onlineNodesPath = nodes
+
+	tt := []struct {
+		name        string
+		res         *k8s.LinuxContainerResources
+		expectError error
+	}{
+		{
+			name: "nil resources",
+		},
+		{
+			name: "valid resources",
+			res: &k8s.LinuxContainerResources{
+				CpuPeriod:          100000,
+				CpuQuota:           50000,
+				CpuShares:          512,
+				MemoryLimitInBytes: 1 << 30,
+				OomScoreAdj:        -998,
+				CpusetCpus:         "2-3,6",
+				CpusetMems:         "1",
+			},
+		},
+		{
+			name: "unlimited quota",
+			res: &k8s.LinuxContainerResources{
+				CpuQuota: -1,
+			},
+		},
+		{
+			name: "too small shares",
+			res: &k8s.LinuxContainerResources{
+				CpuShares: 1,
+			},
+			expectError: fmt.Errorf("cpu shares should be in range [2, 262144], got 1"),
+		},
+		{
+			name: "too big period",
+			res: &k8s.LinuxContainerResources{
+				CpuPeriod: 2000000,
+			},
+			expectError: fmt.Errorf("cpu period should be in range [1000, 1000000], got 2000000"),
+		},
+		{
+			name: "too small quota",
+			res: &k8s.LinuxContainerResources{
+				CpuQuota: 10,
+			},
+			expectError: fmt.Errorf("cpu quota should be either -1 or at least 1000, got 10"),
+		},
+		{
+			name: "invalid oom score",
+			res: &k8s.LinuxContainerResources{
+				OomScoreAdj: 1001,
+			},
+			expectError: fmt.Errorf("oom score adj should be in range [-1000, 1000], got 1001"),
+		},
+		{
+			name: "memory above node capacity is allowed",
+			res: &k8s.LinuxContainerResources{
+				MemoryLimitInBytes: 1 << 50,
+			},
+		},
+		{
+			name: "negative memory limit",
+			res: &k8s.LinuxContainerResources{
+				MemoryLimitInBytes: -1,
+			},
+			expectError: fmt.Errorf("memory limit cannot be negative, got -1"),
+		},
+		{
+			name: "small memory limit",
+			res: &k8s.LinuxContainerResources{
+				MemoryLimitInBytes: 1 << 20,
+			},
+		},
+		{
+			name: "quota above node capacity is allowed",
+			res: &k8s.LinuxContainerResources{
+				CpuPeriod: 50000,
+				CpuQuota:  400001,
+			},
+		},
+		{
+			name: "offline cpu",
+			res: &k8s.LinuxContainerResources{
+				CpusetCpus: "6-8",
+			},
+			expectError: fmt.Errorf("invalid cpuset cpus: 8 is not online"),
+		},
+		{
+			name: "offline node",
+			res: &k8s.LinuxContainerResources{
+				CpusetMems: "2",
+			},
+			expectError: fmt.Errorf("invalid cpuset mems: 2 is not online"),
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			require.Equal(t, tc.expectError, ValidateResources(tc.res))
+		})
+	}
+}
+
+func TestContainer_ValidateResourcesUpdate(t *testing.T) {
+	c := &Container{
+		ContainerConfig: &k8s.ContainerConfig{
+			Linux: &k8s.LinuxContainerConfig{
+				Resources: &k8s.LinuxContainerResources{
+					CpuPeriod: 10000,
+					CpuQuota:  10000,
+				},
+			},
+		},
+	}
+
+	tt := []struct {
+		name        string
+		upd         *k8s.LinuxContainerResources
+		expectError error
+	}{
+		{
+			name: "nil update",
+		},
+		{
+			name: "quota with current period",
+			upd: &k8s.LinuxContainerResources{
+				CpuQuota: 30000,
+			},
+		},
+		{
+			name: "invalid update",
+			upd: &k8s.LinuxContainerResources{
+				CpuShares: 1,
+			},
+			expectError: fmt.Errorf("cpu shares should be in range [2, 262144], got 1"),
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			require.Equal(t, tc.expectError, c.ValidateResourcesUpdate(tc.upd))
+		})
+	}
+}
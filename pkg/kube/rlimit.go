@@ -0,0 +1,115 @@
+// Copyright (c) 2018-2019 Sylabs, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kube
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/opencontainers/runtime-spec/specs-go"
+)
+
+// RlimitsAnnotation may be set on pod or container to set resource limits
+// of container process. It is a comma-separated list of name=soft[:hard]
+// pairs, e.g. memlock=unlimited,nofile=1024:65536. Container annotation
+// takes precedence over pod annotation for the same limit.
+const RlimitsAnnotation = "sycri.sylabs.io/rlimits"
+
+// rlimitTypes are resource limits that may be set for container process.
+var rlimitTypes = map[string]bool{
+	"RLIMIT_AS":         true,
+	"RLIMIT_CORE":       true,
+	"RLIMIT_CPU":        true,
+	"RLIMIT_DATA":       true,
+	"RLIMIT_FSIZE":      true,
+	"RLIMIT_LOCKS":      true,
+	"RLIMIT_MEMLOCK":    true,
+	"RLIMIT_MSGQUEUE":   true,
+	"RLIMIT_NICE":       true,
+	"RLIMIT_NOFILE":     true,
+	"RLIMIT_NPROC":      true,
+	"RLIMIT_RSS":        true,
+	"RLIMIT_RTPRIO":     true,
+	"RLIMIT_RTTIME":     true,
+	"RLIMIT_SIGPENDING": true,
+	"RLIMIT_STACK":      true,
+}
+
+// WithRlimits sets default resource limits of container process,
+// they may be overridden with RlimitsAnnotation.
+func WithRlimits(rlimits []specs.POSIXRlimit) ContainerOption {
+	return func(c *Container) {
+		c.rlimits = rlimits
+	}
+}
+
+// ParseRlimits parses comma-separated list of name=soft[:hard] pairs into
+// POSIX rlimits. Name may omit RLIMIT_ prefix and is case insensitive, limit
+// may be set to unlimited. When hard limit is omitted it equals to soft one.
+func ParseRlimits(value string) ([]specs.POSIXRlimit, error) {
+	var rlimits []specs.POSIXRlimit
+	for _, pair := range strings.Split(value, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("rlimit %q should be in name=soft[:hard] format", pair)
+		}
+		typ := strings.ToUpper(parts[0])
+		if !strings.HasPrefix(typ, "RLIMIT_") {
+			typ = "RLIMIT_" + typ
+		}
+		if !rlimitTypes[typ] {
+			return nil, fmt.Errorf("unknown rlimit %q", parts[0])
+		}
+
+		limits := strings.SplitN(parts[1], ":", 2)
+		soft, err := parseRlimitValue(limits[0])
+		if err != nil {
+			return nil, err
+		}
+		hard := soft
+		if len(limits) == 2 {
+			hard, err = parseRlimitValue(limits[1])
+			if err != nil {
+				return nil, err
+			}
+		}
+		if soft > hard {
+			return nil, fmt.Errorf("soft limit of %s cannot exceed hard limit", typ)
+		}
+		rlimits = append(rlimits, specs.POSIXRlimit{
+			Type: typ,
+			Soft: soft,
+			Hard: hard,
+		})
+	}
+	return rlimits, nil
+}
+
+func parseRlimitValue(value string) (uint64, error) {
+	if value == "unlimited" || value == "-1" {
+		return math.MaxUint64, nil // RLIM_INFINITY
+	}
+	v, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid rlimit value %q", value)
+	}
+	return v, nil
+}
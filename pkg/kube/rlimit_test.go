@@ -0,0 +1,74 @@
+// Copyright (c) 2018-2019 Sylabs, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kube
+
+import (
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRlimits(t *testing.T) {
+	tt := []struct {
+		name          string
+		value         string
+		expectRlimits []specs.POSIXRlimit
+		expectError   error
+	}{
+		{
+			name: "empty",
+		},
+		{
+			name:  "soft and hard",
+			value: "memlock=unlimited, RLIMIT_NOFILE=1024:65536,stack=8388608:-1",
+			expectRlimits: []specs.POSIXRlimit{
+				{Type: "RLIMIT_MEMLOCK", Soft: math.MaxUint64, Hard: math.MaxUint64},
+				{Type: "RLIMIT_NOFILE", Soft: 1024, Hard: 65536},
+				{Type: "RLIMIT_STACK", Soft: 8388608, Hard: math.MaxUint64},
+			},
+		},
+		{
+			name:        "unknown limit",
+			value:       "files=1024",
+			expectError: fmt.Errorf(`unknown rlimit "files"`),
+		},
+		{
+			name:        "no value",
+			value:       "nofile",
+			expectError: fmt.Errorf(`rlimit "nofile" should be in name=soft[:hard] format`),
+		},
+		{
+			name:        "invalid value",
+			value:       "nofile=many",
+			expectError: fmt.Errorf(`invalid rlimit value "many"`),
+		},
+		{
+			name:        "soft above hard",
+			value:       "nofile=unlimited:1024",
+			expectError: fmt.Errorf("soft limit of RLIMIT_NOFILE cannot exceed hard limit"),
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			rlimits, err := ParseRlimits(tc.value)
+			require.Equal(t, tc.expectError, err)
+			require.Equal(t, tc.expectRlimits, rlimits)
+		})
+	}
+}
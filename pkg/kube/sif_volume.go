@@ -0,0 +1,109 @@
+// Copyright (c) 2018-2019 Sylabs, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kube
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/golang/glog"
+	"github.com/sylabs/singularity-cri/pkg/image"
+	ocibundle "github.com/sylabs/singularity/pkg/ocibundle/sif"
+)
+
+// SIFVolumesAnnotation may be set on pod or container to mount SIF images
+// from image store as read-only volumes. It is a comma-separated list of
+// image=path pairs, e.g. library://sylabs/examples/refdata:latest=/data.
+const SIFVolumesAnnotation = "sycri.sylabs.io/sif-volumes"
+
+// SIFVolume is a SIF image that is mounted into container as a read-only volume.
+type SIFVolume struct {
+	// Image is a SIF image from image store to mount.
+	Image *image.Info
+	// Path is a container path to mount image at.
+	Path string
+}
+
+// WithSIFVolumes sets SIF images that are mounted into container
+// as read-only volumes in addition to mounts from container config.
+func WithSIFVolumes(volumes []SIFVolume) ContainerOption {
+	return func(c *Container) {
+		c.sifVolumes = volumes
+	}
+}
+
+// ParseSIFVolumes parses comma-separated list of image=path pairs
+// and returns image references and container paths respectively.
+func ParseSIFVolumes(value string) ([]string, []string, error) {
+	var refs, paths []string
+	for _, pair := range strings.Split(value, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		i := strings.LastIndex(pair, "=")
+		if i <= 0 {
+			return nil, nil, fmt.Errorf("SIF volume %q should be in image=path format", pair)
+		}
+		ref, path := pair[:i], pair[i+1:]
+		if !filepath.IsAbs(path) {
+			return nil, nil, fmt.Errorf("SIF volume path %q should be absolute", path)
+		}
+		refs = append(refs, ref)
+		paths = append(paths, filepath.Clean(path))
+	}
+	return refs, paths, nil
+}
+
+// sifVolumePath returns path to the bundle SIF volume with index i is mounted in.
+func (c *Container) sifVolumePath(i int) string {
+	return filepath.Join(c.baseDir, contVolumesPath, strconv.Itoa(i))
+}
+
+// addSIFVolumes mounts root filesystems of SIF volumes on the host,
+// so that they can be bind mounted into container.
+func (c *Container) addSIFVolumes() error {
+	for i, volume := range c.sifVolumes {
+		glog.V(5).Infof("Mounting SIF volume %s for container %s", volume.Image.ID, c.id)
+		d, err := ocibundle.FromSif(volume.Image.Path, c.sifVolumePath(i), false)
+		if err != nil {
+			return fmt.Errorf("could not create SIF bundle driver: %v", err)
+		}
+		if err := d.Create(nil); err != nil {
+			return fmt.Errorf("could not mount SIF volume %s: %v", volume.Image.ID, err)
+		}
+		volume.Image.Borrow(c.id)
+		c.mountedSIFVolumes++
+	}
+	return nil
+}
+
+// cleanupSIFVolumes unmounts SIF volumes previously mounted by addSIFVolumes.
+func (c *Container) cleanupSIFVolumes() error {
+	for ; c.mountedSIFVolumes > 0; c.mountedSIFVolumes-- {
+		i := c.mountedSIFVolumes - 1
+		d, err := ocibundle.FromSif("", c.sifVolumePath(i), false)
+		if err != nil {
+			return fmt.Errorf("could not create SIF bundle driver: %v", err)
+		}
+		if err := d.Delete(); err != nil {
+			return fmt.Errorf("could not unmount SIF volume: %v", err)
+		}
+		c.sifVolumes[i].Image.Return(c.id)
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+// Copyright (c) 2018-2019 Sylabs, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kube
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSIFVolumes(t *testing.T) {
+	tt := []struct {
+		name        string
+		value       string
+		expectRefs  []string
+		expectPaths []string
+		expectError error
+	}{
+		{
+			name: "empty",
+		},
+		{
+			name:        "multiple volumes",
+			value:       "library://sylabs/examples/refdata:latest=/data, tools.sif=/opt/tools/,",
+			expectRefs:  []string{"library://sylabs/examples/refdata:latest", "tools.sif"},
+			expectPaths: []string{"/data", "/opt/tools"},
+		},
+		{
+			name:        "no path",
+			value:       "library://sylabs/examples/refdata:latest",
+			expectError: fmt.Errorf(`SIF volume "library://sylabs/examples/refdata:latest" should be in image=path format`),
+		},
+		{
+			name:        "relative path",
+			value:       "tools.sif=opt/tools",
+			expectError: fmt.Errorf(`SIF volume path "opt/tools" should be absolute`),
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			refs, paths, err := ParseSIFVolumes(tc.value)
+			require.Equal(t, tc.expectError, err)
+			require.Equal(t, tc.expectRefs, refs)
+			require.Equal(t, tc.expectPaths, paths)
+		})
+	}
+}
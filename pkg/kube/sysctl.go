@@ -0,0 +1,111 @@
+// Copyright (c) 2018-2019 Sylabs, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kube
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/opencontainers/runtime-spec/specs-go"
+	k8s "k8s.io/kubernetes/pkg/kubelet/apis/cri/runtime/v1alpha2"
+)
+
+var (
+	// sysctlToNs maps prefixes of namespaced sysctls to namespaces
+	// they belong to, the same list kubelet uses.
+	sysctlToNs = map[string]specs.LinuxNamespaceType{
+		"kernel.shm": specs.IPCNamespace,
+		"kernel.msg": specs.IPCNamespace,
+		"kernel.sem": specs.IPCNamespace,
+		"fs.mqueue.": specs.IPCNamespace,
+		"net.":       specs.NetworkNamespace,
+	}
+)
+
+// WithAllowedUnsafeSysctls sets node-level sysctls that pods are allowed
+// to set. Each entry is either a sysctl name or a prefix ending with *.
+func WithAllowedUnsafeSysctls(sysctls []string) PodOption {
+	return func(p *Pod) {
+		p.allowedUnsafeSysctls = sysctls
+	}
+}
+
+// ValidateSysctlPatterns checks that each pattern is either a sysctl
+// name or a prefix followed by *, e.g. kernel.msg*.
+func ValidateSysctlPatterns(patterns []string) error {
+	for _, pattern := range patterns {
+		name := strings.TrimSuffix(pattern, "*")
+		if name == "" || strings.Contains(name, "*") {
+			return fmt.Errorf("invalid sysctl pattern %q", pattern)
+		}
+	}
+	return nil
+}
+
+// ValidateSysctls checks sysctls requested by pod config. Namespaced sysctls
+// require pod to have its own namespace they belong to, while node-level ones
+// change host settings and are rejected unless they match allowedUnsafe patterns.
+func ValidateSysctls(config *k8s.LinuxPodSandboxConfig, allowedUnsafe []string) error {
+	hasIPC := config.GetSecurityContext().GetNamespaceOptions().GetIpc() == k8s.NamespaceMode_POD
+	hasNET := config.GetSecurityContext().GetNamespaceOptions().GetNetwork() == k8s.NamespaceMode_POD
+
+	for sysctl := range config.GetSysctls() {
+		// sysctl names may be written with slashes as well
+		name := strings.Replace(sysctl, "/", ".", -1)
+		switch sysctlNamespace(name) {
+		case specs.IPCNamespace:
+			if !hasIPC {
+				return fmt.Errorf("sysctl %s requires a separate %s namespace", sysctl, specs.IPCNamespace)
+			}
+		case specs.NetworkNamespace:
+			if !hasNET {
+				return fmt.Errorf("sysctl %s requires a separate %s namespace", sysctl, specs.NetworkNamespace)
+			}
+		default:
+			if !matchSysctl(name, allowedUnsafe) {
+				return fmt.Errorf("sysctl %s is not namespaced and is not allowed on this node", sysctl)
+			}
+		}
+	}
+	return nil
+}
+
+// sysctlNamespace returns namespace the sysctl belongs to,
+// or an empty string for node-level sysctls.
+func sysctlNamespace(sysctl string) specs.LinuxNamespaceType {
+	for prefix, nsType := range sysctlToNs {
+		if strings.HasPrefix(sysctl, prefix) {
+			return nsType
+		}
+	}
+	return ""
+}
+
+// matchSysctl returns true if sysctl matches any of the patterns.
+func matchSysctl(sysctl string, patterns []string) bool {
+	for _, pattern := range patterns {
+		pattern = strings.Replace(pattern, "/", ".", -1)
+		if prefix := strings.TrimSuffix(pattern, "*"); prefix != pattern {
+			if strings.HasPrefix(sysctl, prefix) {
+				return true
+			}
+			continue
+		}
+		if sysctl == pattern {
+			return true
+		}
+	}
+	return false
+}
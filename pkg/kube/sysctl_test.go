@@ -0,0 +1,146 @@
+// Copyright (c) 2018-2019 Sylabs, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kube
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	k8s "k8s.io/kubernetes/pkg/kubelet/apis/cri/runtime/v1alpha2"
+)
+
+func TestValidateSysctls(t *testing.T) {
+	podNamespaces := &k8s.LinuxSandboxSecurityContext{
+		NamespaceOptions: &k8s.NamespaceOption{
+			Network: k8s.NamespaceMode_POD,
+			Ipc:     k8s.NamespaceMode_POD,
+		},
+	}
+	hostNamespaces := &k8s.LinuxSandboxSecurityContext{
+		NamespaceOptions: &k8s.NamespaceOption{
+			Network: k8s.NamespaceMode_NODE,
+			Ipc:     k8s.NamespaceMode_NODE,
+		},
+	}
+
+	tt := []struct {
+		name          string
+		config        *k8s.LinuxPodSandboxConfig
+		allowedUnsafe []string
+		expectError   error
+	}{
+		{
+			name: "no sysctls",
+		},
+		{
+			name: "namespaced sysctls",
+			config: &k8s.LinuxPodSandboxConfig{
+				SecurityContext: podNamespaces,
+				Sysctls: map[string]string{
+					"net.ipv4.ip_local_port_range": "1024 65535",
+					"net/core/somaxconn":           "1024",
+					"kernel.shm_rmid_forced":       "1",
+					"kernel.sem":                   "250 32000 32 128",
+				},
+			},
+		},
+		{
+			name: "network sysctl in host network",
+			config: &k8s.LinuxPodSandboxConfig{
+				SecurityContext: hostNamespaces,
+				Sysctls: map[string]string{
+					"net.core.somaxconn": "1024",
+				},
+			},
+			expectError: fmt.Errorf("sysctl net.core.somaxconn requires a separate network namespace"),
+		},
+		{
+			name: "ipc sysctl in host ipc",
+			config: &k8s.LinuxPodSandboxConfig{
+				SecurityContext: hostNamespaces,
+				Sysctls: map[string]string{
+					"kernel.msgmax": "65536",
+				},
+			},
+			expectError: fmt.Errorf("sysctl kernel.msgmax requires a separate ipc namespace"),
+		},
+		{
+			name: "node-level sysctl",
+			config: &k8s.LinuxPodSandboxConfig{
+				SecurityContext: podNamespaces,
+				Sysctls: map[string]string{
+					"vm.max_map_count": "262144",
+				},
+			},
+			expectError: fmt.Errorf("sysctl vm.max_map_count is not namespaced and is not allowed on this node"),
+		},
+		{
+			name: "allowed node-level sysctl",
+			config: &k8s.LinuxPodSandboxConfig{
+				SecurityContext: podNamespaces,
+				Sysctls: map[string]string{
+					"vm.max_map_count": "262144",
+				},
+			},
+			allowedUnsafe: []string{"vm.max_map_count"},
+		},
+		{
+			name: "allowed node-level sysctl prefix",
+			config: &k8s.LinuxPodSandboxConfig{
+				SecurityContext: podNamespaces,
+				Sysctls: map[string]string{
+					"kernel/pid_max": "65536",
+				},
+			},
+			allowedUnsafe: []string{"vm.*", "kernel.*"},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			require.Equal(t, tc.expectError, ValidateSysctls(tc.config, tc.allowedUnsafe))
+		})
+	}
+}
+
+func TestValidateSysctlPatterns(t *testing.T) {
+	tt := []struct {
+		name        string
+		patterns    []string
+		expectError error
+	}{
+		{
+			name:     "valid patterns",
+			patterns: []string{"vm.max_map_count", "kernel.*"},
+		},
+		{
+			name:        "only wildcard",
+			patterns:    []string{"*"},
+			expectError: fmt.Errorf(`invalid sysctl pattern "*"`),
+		},
+		{
+			name:        "wildcard in the middle",
+			patterns:    []string{"vm.*.max"},
+			expectError: fmt.Errorf(`invalid sysctl pattern "vm.*.max"`),
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			require.Equal(t, tc.expectError, ValidateSysctlPatterns(tc.patterns))
+		})
+	}
+}
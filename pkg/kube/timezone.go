@@ -0,0 +1,71 @@
+// Copyright (c) 2018-2019 Sylabs, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kube
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// TimezoneAnnotation may be set on pod or container to override
+	// node-wide timezone of containers. It is set either to TimezoneHost,
+	// to zoneinfo name, e.g. Europe/London, or to an empty value that
+	// disables timezone injection.
+	TimezoneAnnotation = "sycri.sylabs.io/timezone"
+	// TimezoneHost is a timezone that makes container use host's /etc/localtime.
+	TimezoneHost = "host"
+)
+
+var (
+	// hostLocaltime is host's localtime file, overridden in tests.
+	hostLocaltime = "/etc/localtime"
+	// zoneinfoDir is a directory zoneinfo files are looked up in, overridden in tests.
+	zoneinfoDir = "/usr/share/zoneinfo"
+)
+
+// WithTimezone sets default timezone of container, see TimezoneAnnotation
+// for possible values. Empty timezone means container's own localtime is used.
+func WithTimezone(tz string) ContainerOption {
+	return func(c *Container) {
+		c.timezone = tz
+	}
+}
+
+// TimezoneFile returns path to a host file that should be mounted
+// into container as /etc/localtime to make it use timezone tz.
+func TimezoneFile(tz string) (string, error) {
+	if tz == "" {
+		return "", nil
+	}
+
+	path := hostLocaltime
+	if tz != TimezoneHost {
+		path = filepath.Join(zoneinfoDir, tz)
+		if filepath.IsAbs(tz) || !strings.HasPrefix(path, zoneinfoDir+string(filepath.Separator)) {
+			return "", fmt.Errorf("invalid timezone %q", tz)
+		}
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		return "", fmt.Errorf("could not find timezone %q: %v", tz, err)
+	}
+	if fi.IsDir() {
+		return "", fmt.Errorf("invalid timezone %q", tz)
+	}
+	return path, nil
+}
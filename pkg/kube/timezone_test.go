@@ -0,0 +1,96 @@
+// Copyright (c) 2018-2019 Sylabs, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kube
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTimezoneFile(t *testing.T) {
+	root, err := ioutil.TempDir("", "")
+	require.NoError(t, err, "could not create temp dir")
+	defer os.RemoveAll(root)
+
+	localtime := filepath.Join(root, "localtime")
+	zoneinfo := filepath.Join(root, "zoneinfo")
+	require.NoError(t, ioutil.WriteFile(localtime, nil, 0644))
+	require.NoError(t, os.MkdirAll(filepath.Join(zoneinfo, "Europe"), 0755))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(zoneinfo, "Europe", "London"), nil, 0644))
+
+	defer func(localtime, zoneinfo string) {
+		hostLocaltime = localtime
+		zoneinfoDir = zoneinfo
+	}(hostLocaltime, zoneinfoDir)
+	hostLocaltime = localtime
+	zoneinfoDir = zoneinfo
+
+	tt := []struct {
+		name        string
+		tz          string
+		expectPath  string
+		expectError bool
+	}{
+		{
+			name: "disabled",
+		},
+		{
+			name:       "host",
+			tz:         TimezoneHost,
+			expectPath: localtime,
+		},
+		{
+			name:       "zoneinfo",
+			tz:         "Europe/London",
+			expectPath: filepath.Join(zoneinfo, "Europe", "London"),
+		},
+		{
+			name:        "unknown zone",
+			tz:          "Europe/Atlantis",
+			expectError: true,
+		},
+		{
+			name:        "directory",
+			tz:          "Europe",
+			expectError: true,
+		},
+		{
+			name:        "outside of zoneinfo",
+			tz:          "../localtime",
+			expectError: true,
+		},
+		{
+			name:        "absolute path",
+			tz:          "/etc/passwd",
+			expectError: true,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			path, err := TimezoneFile(tc.tz)
+			if tc.expectError {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.expectPath, path)
+		})
+	}
+}
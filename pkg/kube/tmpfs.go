@@ -0,0 +1,82 @@
+// Copyright (c) 2018-2019 Sylabs, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kube
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/opencontainers/runtime-spec/specs-go"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// TmpfsAnnotation may be set on container to mount memory-backed tmpfs at
+// container paths. It is a semicolon-separated list of path[:options], where
+// options are comma-separated and may include size, mode, ro and noexec, e.g.
+// /scratch:size=1Gi,mode=0700;/cache. Container mounts to the same paths, e.g.
+// emptyDir volumes with Memory medium, are replaced with tmpfs.
+const TmpfsAnnotation = "sycri.sylabs.io/tmpfs"
+
+// ParseTmpfsMounts parses value of TmpfsAnnotation into OCI mounts.
+func ParseTmpfsMounts(value string) ([]specs.Mount, error) {
+	var mounts []specs.Mount
+	for _, item := range strings.Split(value, ";") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		parts := strings.SplitN(item, ":", 2)
+		path := parts[0]
+		if !filepath.IsAbs(path) {
+			return nil, fmt.Errorf("tmpfs path %q should be absolute", path)
+		}
+
+		mode := "mode=1777"
+		options := []string{"nosuid", "nodev"}
+		if len(parts) == 2 {
+			for _, opt := range strings.Split(parts[1], ",") {
+				kv := strings.SplitN(strings.TrimSpace(opt), "=", 2)
+				switch {
+				case kv[0] == "ro" || kv[0] == "noexec":
+					options = append(options, kv[0])
+				case kv[0] == "size" && len(kv) == 2:
+					q, err := resource.ParseQuantity(kv[1])
+					if err != nil || q.Value() <= 0 {
+						return nil, fmt.Errorf("invalid tmpfs size %q", kv[1])
+					}
+					options = append(options, fmt.Sprintf("size=%d", q.Value()))
+				case kv[0] == "mode" && len(kv) == 2:
+					m, err := strconv.ParseUint(kv[1], 8, 32)
+					if err != nil || m > 07777 {
+						return nil, fmt.Errorf("invalid tmpfs mode %q", kv[1])
+					}
+					mode = fmt.Sprintf("mode=%o", m)
+				default:
+					return nil, fmt.Errorf("unsupported tmpfs option %q", opt)
+				}
+			}
+		}
+
+		mounts = append(mounts, specs.Mount{
+			Destination: filepath.Clean(path),
+			Type:        "tmpfs",
+			Source:      "tmpfs",
+			Options:     append(options, mode),
+		})
+	}
+	return mounts, nil
+}
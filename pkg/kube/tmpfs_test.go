@@ -0,0 +1,82 @@
+// Copyright (c) 2018-2019 Sylabs, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kube
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseTmpfsMounts(t *testing.T) {
+	tt := []struct {
+		name         string
+		value        string
+		expectMounts []specs.Mount
+		expectError  error
+	}{
+		{
+			name: "empty",
+		},
+		{
+			name:  "with options",
+			value: "/scratch:size=1Gi,mode=0700,noexec; /cache/;",
+			expectMounts: []specs.Mount{
+				{
+					Destination: "/scratch",
+					Type:        "tmpfs",
+					Source:      "tmpfs",
+					Options:     []string{"nosuid", "nodev", "size=1073741824", "noexec", "mode=700"},
+				},
+				{
+					Destination: "/cache",
+					Type:        "tmpfs",
+					Source:      "tmpfs",
+					Options:     []string{"nosuid", "nodev", "mode=1777"},
+				},
+			},
+		},
+		{
+			name:        "relative path",
+			value:       "scratch",
+			expectError: fmt.Errorf(`tmpfs path "scratch" should be absolute`),
+		},
+		{
+			name:        "invalid size",
+			value:       "/scratch:size=huge",
+			expectError: fmt.Errorf(`invalid tmpfs size "huge"`),
+		},
+		{
+			name:        "invalid mode",
+			value:       "/scratch:mode=0800",
+			expectError: fmt.Errorf(`invalid tmpfs mode "0800"`),
+		},
+		{
+			name:        "unsupported option",
+			value:       "/scratch:exec",
+			expectError: fmt.Errorf(`unsupported tmpfs option "exec"`),
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			mounts, err := ParseTmpfsMounts(tc.value)
+			require.Equal(t, tc.expectError, err)
+			require.Equal(t, tc.expectMounts, mounts)
+		})
+	}
+}
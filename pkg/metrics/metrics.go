@@ -0,0 +1,376 @@
+// Copyright (c) 2018-2019 Sylabs, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package metrics implements a minimal set of metric types that are
+// exposed in Prometheus text format, see
+// https://prometheus.io/docs/instrumenting/exposition_formats.
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/golang/glog"
+)
+
+// DefaultRegistry is a registry that all package level metrics are registered in.
+var DefaultRegistry = NewRegistry()
+
+// Collector is a metric that may be registered in Registry.
+type Collector interface {
+	describe() (name, help, typ string)
+	write(w io.Writer)
+}
+
+// Registry holds metrics and serves them over HTTP in Prometheus text format.
+// Registry is thread safe to use.
+type Registry struct {
+	mu         sync.Mutex
+	collectors map[string]Collector
+}
+
+// NewRegistry returns new empty Registry.
+func NewRegistry() *Registry {
+	return &Registry{
+		collectors: make(map[string]Collector),
+	}
+}
+
+// Register adds passed metrics to the registry. It panics if metric
+// with the same name is already registered, since it's a programming error.
+func (r *Registry) Register(cs ...Collector) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, c := range cs {
+		name, _, _ := c.describe()
+		if _, ok := r.collectors[name]; ok {
+			panic(fmt.Sprintf("metric %s is already registered", name))
+		}
+		r.collectors[name] = c
+	}
+}
+
+// Write writes all registered metrics to w in Prometheus text format.
+func (r *Registry) Write(w io.Writer) error {
+	r.mu.Lock()
+	names := make([]string, 0, len(r.collectors))
+	for name := range r.collectors {
+		names = append(names, name)
+	}
+	collectors := make([]Collector, 0, len(names))
+	sort.Strings(names)
+	for _, name := range names {
+		collectors = append(collectors, r.collectors[name])
+	}
+	r.mu.Unlock()
+
+	var buf bytes.Buffer
+	for _, c := range collectors {
+		name, help, typ := c.describe()
+		fmt.Fprintf(&buf, "# HELP %s %s\n", name, escape(help, false))
+		fmt.Fprintf(&buf, "# TYPE %s %s\n", name, typ)
+		c.write(&buf)
+	}
+	_, err := buf.WriteTo(w)
+	return err
+}
+
+// ServeHTTP implements http.Handler interface.
+func (r *Registry) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	if err := r.Write(w); err != nil {
+		glog.Errorf("Could not write metrics: %v", err)
+	}
+}
+
+// Register adds passed metrics to DefaultRegistry.
+func Register(cs ...Collector) {
+	DefaultRegistry.Register(cs...)
+}
+
+type series struct {
+	labelValues []string
+	value       float64
+	// sum and counts are used by histograms only, value holds number
+	// of observations then, counts hold number of observations that
+	// fall into the corresponding bucket.
+	sum    float64
+	counts []uint64
+}
+
+// vec is a set of series of a metric that are distinguished by label values.
+type vec struct {
+	name    string
+	help    string
+	typ     string
+	labels  []string
+	buckets []float64
+
+	mu     sync.Mutex
+	series map[string]*series
+}
+
+func newVec(name, help, typ string, labels []string) *vec {
+	return &vec{
+		name:   name,
+		help:   help,
+		typ:    typ,
+		labels: labels,
+		series: make(map[string]*series),
+	}
+}
+
+func (v *vec) describe() (string, string, string) {
+	return v.name, v.help, v.typ
+}
+
+func (v *vec) update(values []string, f func(s *series)) {
+	if len(values) != len(v.labels) {
+		panic(fmt.Sprintf("metric %s expects %d label values, got %d", v.name, len(v.labels), len(values)))
+	}
+
+	key := strings.Join(values, "\xff")
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	s, ok := v.series[key]
+	if !ok {
+		s = &series{
+			labelValues: append([]string(nil), values...),
+			counts:      make([]uint64, len(v.buckets)),
+		}
+		v.series[key] = s
+	}
+	f(s)
+}
+
+func (v *vec) write(w io.Writer) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	keys := make([]string, 0, len(v.series))
+	for key := range v.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		s := v.series[key]
+		if v.typ != "histogram" {
+			fmt.Fprintf(w, "%s%s %s\n", v.name, labelPairs(v.labels, s.labelValues), formatValue(s.value))
+			continue
+		}
+
+		labels := make([]string, len(v.labels)+1)
+		copy(labels, v.labels)
+		labels[len(v.labels)] = "le"
+		values := make([]string, len(labels))
+		copy(values, s.labelValues)
+
+		var count uint64
+		for i, bucket := range v.buckets {
+			count += s.counts[i]
+			values[len(values)-1] = formatValue(bucket)
+			fmt.Fprintf(w, "%s_bucket%s %d\n", v.name, labelPairs(labels, values), count)
+		}
+		values[len(values)-1] = "+Inf"
+		pairs := labelPairs(labels, values)
+		fmt.Fprintf(w, "%s_bucket%s %d\n", v.name, pairs, uint64(s.value))
+		fmt.Fprintf(w, "%s_sum%s %s\n", v.name, labelPairs(v.labels, s.labelValues), formatValue(s.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", v.name, labelPairs(v.labels, s.labelValues), uint64(s.value))
+	}
+}
+
+// CounterVec is a counter partitioned by labels.
+type CounterVec struct {
+	*vec
+}
+
+// NewCounterVec returns new CounterVec with passed name, help and labels.
+func NewCounterVec(name, help string, labels ...string) *CounterVec {
+	return &CounterVec{newVec(name, help, "counter", labels)}
+}
+
+// Inc increments counter with passed label values by 1.
+func (c *CounterVec) Inc(values ...string) {
+	c.Add(1, values...)
+}
+
+// Add increases counter with passed label values by delta,
+// which must not be negative.
+func (c *CounterVec) Add(delta float64, values ...string) {
+	if delta < 0 {
+		panic(fmt.Sprintf("counter %s cannot decrease", c.name))
+	}
+	c.update(values, func(s *series) {
+		s.value += delta
+	})
+}
+
+// GaugeVec is a gauge partitioned by labels.
+type GaugeVec struct {
+	*vec
+}
+
+// NewGaugeVec returns new GaugeVec with passed name, help and labels.
+func NewGaugeVec(name, help string, labels ...string) *GaugeVec {
+	return &GaugeVec{newVec(name, help, "gauge", labels)}
+}
+
+// Set sets gauge with passed label values to value.
+func (g *GaugeVec) Set(value float64, values ...string) {
+	g.update(values, func(s *series) {
+		s.value = value
+	})
+}
+
+// Add adds delta to gauge with passed label values, delta may be negative.
+func (g *GaugeVec) Add(delta float64, values ...string) {
+	g.update(values, func(s *series) {
+		s.value += delta
+	})
+}
+
+// DefaultBuckets are default histogram buckets that are suitable for
+// measuring duration of network requests in seconds.
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// ExponentialBuckets returns count buckets where the lowest
+// bucket is start and each next one is factor times bigger.
+func ExponentialBuckets(start, factor float64, count int) []float64 {
+	buckets := make([]float64, count)
+	for i := range buckets {
+		buckets[i] = start
+		start *= factor
+	}
+	return buckets
+}
+
+// HistogramVec is a histogram partitioned by labels.
+type HistogramVec struct {
+	*vec
+}
+
+// NewHistogramVec returns new HistogramVec with passed name, help, labels and
+// upper bounds of buckets, which must be sorted in increasing order.
+func NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	v := newVec(name, help, "histogram", labels)
+	v.buckets = buckets
+	return &HistogramVec{v}
+}
+
+// Observe adds a single observation to histogram with passed label values.
+func (h *HistogramVec) Observe(value float64, values ...string) {
+	h.update(values, func(s *series) {
+		s.value++
+		s.sum += value
+		for i, bucket := range h.buckets {
+			if value <= bucket {
+				s.counts[i]++
+				break
+			}
+		}
+	})
+}
+
+// GaugeFunc is a gauge which value is obtained by calling
+// a function each time metrics are collected.
+type GaugeFunc struct {
+	name string
+	help string
+	f    func() float64
+}
+
+// NewGaugeFunc returns new GaugeFunc with passed name and help. Passed f
+// must be safe to be called concurrently.
+func NewGaugeFunc(name, help string, f func() float64) *GaugeFunc {
+	return &GaugeFunc{
+		name: name,
+		help: help,
+		f:    f,
+	}
+}
+
+func (g *GaugeFunc) describe() (string, string, string) {
+	return g.name, g.help, "gauge"
+}
+
+func (g *GaugeFunc) write(w io.Writer) {
+	fmt.Fprintf(w, "%s %s\n", g.name, formatValue(g.f()))
+}
+
+// GaugeVecFunc is a gauge partitioned by labels which series are
+// obtained by calling a function each time metrics are collected.
+type GaugeVecFunc struct {
+	name   string
+	help   string
+	labels []string
+	f      func(add func(delta float64, values ...string))
+}
+
+// NewGaugeVecFunc returns new GaugeVecFunc with passed name, help and
+// label names. Passed f reports series by calling add, values of series
+// with the same label values are summed up. Passed f must be safe to be
+// called concurrently.
+func NewGaugeVecFunc(name, help string, f func(add func(delta float64, values ...string)), labels ...string) *GaugeVecFunc {
+	return &GaugeVecFunc{
+		name:   name,
+		help:   help,
+		labels: labels,
+		f:      f,
+	}
+}
+
+func (g *GaugeVecFunc) describe() (string, string, string) {
+	return g.name, g.help, "gauge"
+}
+
+func (g *GaugeVecFunc) write(w io.Writer) {
+	v := newVec(g.name, g.help, "gauge", g.labels)
+	g.f(func(delta float64, values ...string) {
+		v.update(values, func(s *series) {
+			s.value += delta
+		})
+	})
+	v.write(w)
+}
+
+func labelPairs(labels, values []string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	pairs := make([]string, len(labels))
+	for i := range labels {
+		pairs[i] = labels[i] + `="` + escape(values[i], true) + `"`
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func escape(s string, quote bool) string {
+	s = strings.Replace(s, `\`, `\\`, -1)
+	s = strings.Replace(s, "\n", `\n`, -1)
+	if quote {
+		s = strings.Replace(s, `"`, `\"`, -1)
+	}
+	return s
+}
+
+func formatValue(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
@@ -0,0 +1,120 @@
+// Copyright (c) 2018-2019 Sylabs, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metrics
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegistry(t *testing.T) {
+	requests := NewCounterVec("test_requests_total", "Total number of requests.", "method", "code")
+	inFlight := NewGaugeVec("test_in_flight", "Number of requests\nin flight.")
+	uptime := NewGaugeFunc("test_uptime_seconds", "Uptime in seconds.", func() float64 {
+		return 42.5
+	})
+
+	r := NewRegistry()
+	r.Register(requests, inFlight, uptime)
+	require.Panics(t, func() {
+		r.Register(requests)
+	})
+
+	requests.Inc("Create", "OK")
+	requests.Add(2, "Create", "OK")
+	requests.Inc("Remove", `Not "Found"`)
+	inFlight.Add(3)
+	inFlight.Add(-1)
+	require.Panics(t, func() {
+		requests.Inc("Create")
+	})
+	require.Panics(t, func() {
+		requests.Add(-1, "Create", "OK")
+	})
+
+	expect := `# HELP test_in_flight Number of requests\nin flight.
+# TYPE test_in_flight gauge
+test_in_flight 2
+# HELP test_requests_total Total number of requests.
+# TYPE test_requests_total counter
+test_requests_total{method="Create",code="OK"} 3
+test_requests_total{method="Remove",code="Not \"Found\""} 1
+# HELP test_uptime_seconds Uptime in seconds.
+# TYPE test_uptime_seconds gauge
+test_uptime_seconds 42.5
+`
+	var buf bytes.Buffer
+	require.NoError(t, r.Write(&buf))
+	require.Equal(t, expect, buf.String())
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	require.Equal(t, "text/plain; version=0.0.4", rec.Header().Get("Content-Type"))
+	require.Equal(t, expect, rec.Body.String())
+}
+
+func TestHistogramVec(t *testing.T) {
+	duration := NewHistogramVec("test_duration_seconds", "Request duration.", []float64{0.1, 1}, "method")
+	r := NewRegistry()
+	r.Register(duration)
+
+	duration.Observe(0.05, "Pull")
+	duration.Observe(0.5, "Pull")
+	duration.Observe(0.5, "Pull")
+	duration.Observe(5, "Pull")
+
+	var buf bytes.Buffer
+	require.NoError(t, r.Write(&buf))
+	require.Equal(t, `# HELP test_duration_seconds Request duration.
+# TYPE test_duration_seconds histogram
+test_duration_seconds_bucket{method="Pull",le="0.1"} 1
+test_duration_seconds_bucket{method="Pull",le="1"} 3
+test_duration_seconds_bucket{method="Pull",le="+Inf"} 4
+test_duration_seconds_sum{method="Pull"} 6.05
+test_duration_seconds_count{method="Pull"} 4
+`, buf.String())
+
+	require.Equal(t, []float64{1, 4, 16}, ExponentialBuckets(1, 4, 3))
+}
+
+func TestGaugeVecFunc(t *testing.T) {
+	items := []string{"running", "exited", "exited"}
+	states := NewGaugeVecFunc("test_items", "Number of items.", func(add func(float64, ...string)) {
+		for _, state := range items {
+			add(1, state)
+		}
+	}, "state")
+	r := NewRegistry()
+	r.Register(states)
+
+	var buf bytes.Buffer
+	require.NoError(t, r.Write(&buf))
+	require.Equal(t, `# HELP test_items Number of items.
+# TYPE test_items gauge
+test_items{state="exited"} 2
+test_items{state="running"} 1
+`, buf.String())
+
+	items = items[:1]
+	buf.Reset()
+	require.NoError(t, r.Write(&buf))
+	require.Equal(t, `# HELP test_items Number of items.
+# TYPE test_items gauge
+test_items{state="running"} 1
+`, buf.String())
+}
@@ -67,13 +67,9 @@ func UnshareAll(namespaces []specs.LinuxNamespace) error {
 		return nil
 	}
 
-	var cloneFlags int
-	for _, ns := range namespaces {
-		cloneFlags |= nsToInfo[ns.Type].cloneFlag
-	}
 	cmd := exec.Command("/bin/sh")
 	cmd.SysProcAttr = &unix.SysProcAttr{
-		Cloneflags: uintptr(cloneFlags),
+		Cloneflags: CloneFlags(namespaces),
 	}
 	stdin, err := cmd.StdinPipe()
 	if err != nil {
@@ -95,6 +91,16 @@ func UnshareAll(namespaces []specs.LinuxNamespace) error {
 	return nil
 }
 
+// CloneFlags returns clone flags that should be passed to
+// create a process in new namespaces of passed types.
+func CloneFlags(namespaces []specs.LinuxNamespace) uintptr {
+	var cloneFlags int
+	for _, ns := range namespaces {
+		cloneFlags |= nsToInfo[ns.Type].cloneFlag
+	}
+	return uintptr(cloneFlags)
+}
+
 // Remove unmounts and removes namespace file at ns.Path. Remove doesn't
 // return an error if namespace is not mounted or file doesn't exist.
 func Remove(ns specs.LinuxNamespace) error {
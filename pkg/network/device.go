@@ -0,0 +1,189 @@
+// Copyright (c) 2018-2019 Sylabs, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package network
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/golang/glog"
+	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netns"
+)
+
+// HostDevicesAnnotation is a pod annotation that requests host network
+// devices (e.g. SR-IOV virtual functions) to be moved into pod's network
+// namespace. Its value is either a number of devices to take from the
+// node-local pool or a comma-separated list of device names from that pool.
+const HostDevicesAnnotation = "sycri.sylabs.io/host-net-devices"
+
+// DevicePool holds host network devices that may be passed into pods.
+// Each device may be attached to a single pod at a time. DevicePool
+// is thread safe to use.
+type DevicePool struct {
+	mu      sync.Mutex
+	devices []string
+	owners  map[string]string
+}
+
+// NewDevicePool returns new DevicePool that consists of passed host devices.
+func NewDevicePool(devices []string) *DevicePool {
+	pool := &DevicePool{
+		owners: make(map[string]string, len(devices)),
+	}
+	for _, dev := range devices {
+		if _, ok := pool.owners[dev]; ok || dev == "" {
+			continue
+		}
+		pool.devices = append(pool.devices, dev)
+		pool.owners[dev] = ""
+	}
+	return pool
+}
+
+// Allocate reserves devices for pod according to the passed request,
+// which has the same format as HostDevicesAnnotation value.
+func (p *DevicePool) Allocate(podID, request string) ([]string, error) {
+	request = strings.TrimSpace(request)
+	if request == "" {
+		return nil, nil
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var allocated []string
+	if n, err := strconv.Atoi(request); err == nil {
+		if n < 0 {
+			return nil, fmt.Errorf("invalid number of devices requested: %d", n)
+		}
+		for _, dev := range p.devices {
+			if len(allocated) == n {
+				break
+			}
+			if p.owners[dev] == "" {
+				allocated = append(allocated, dev)
+			}
+		}
+		if len(allocated) != n {
+			return nil, fmt.Errorf("requested %d devices, only %d available", n, len(allocated))
+		}
+	} else {
+		for _, dev := range strings.Split(request, ",") {
+			dev = strings.TrimSpace(dev)
+			owner, ok := p.owners[dev]
+			if !ok {
+				return nil, fmt.Errorf("device %q is not in the pool", dev)
+			}
+			if owner != "" {
+				return nil, fmt.Errorf("device %q is already used by pod %s", dev, owner)
+			}
+			allocated = append(allocated, dev)
+		}
+	}
+
+	for _, dev := range allocated {
+		p.owners[dev] = podID
+	}
+	return allocated, nil
+}
+
+// Release returns all devices that were allocated for pod back to the pool.
+func (p *DevicePool) Release(podID string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for dev, owner := range p.owners {
+		if owner == podID {
+			p.owners[dev] = ""
+		}
+	}
+}
+
+// attachDevices moves passed host devices into network namespace
+// located at nsPath and brings them up.
+func attachDevices(nsPath string, devices []string) error {
+	podNs, err := netns.GetFromPath(nsPath)
+	if err != nil {
+		return fmt.Errorf("could not open pod network namespace: %v", err)
+	}
+	defer podNs.Close()
+
+	podHandle, err := netlink.NewHandleAt(podNs)
+	if err != nil {
+		return fmt.Errorf("could not get pod netlink handle: %v", err)
+	}
+	defer podHandle.Delete()
+
+	for _, dev := range devices {
+		link, err := netlink.LinkByName(dev)
+		if err != nil {
+			return fmt.Errorf("could not find host device %s: %v", dev, err)
+		}
+		glog.V(3).Infof("Moving host device %s to %s", dev, nsPath)
+		if err := netlink.LinkSetNsFd(link, int(podNs)); err != nil {
+			return fmt.Errorf("could not move %s to pod network namespace: %v", dev, err)
+		}
+		link, err = podHandle.LinkByName(dev)
+		if err != nil {
+			return fmt.Errorf("could not find %s in pod network namespace: %v", dev, err)
+		}
+		if err := podHandle.LinkSetUp(link); err != nil {
+			return fmt.Errorf("could not bring %s up: %v", dev, err)
+		}
+	}
+	return nil
+}
+
+// detachDevices moves passed devices from network namespace located
+// at nsPath back to the host network namespace. Devices that are not
+// found in pod's network namespace are skipped.
+func detachDevices(nsPath string, devices []string) error {
+	hostNs, err := netns.Get()
+	if err != nil {
+		return fmt.Errorf("could not open host network namespace: %v", err)
+	}
+	defer hostNs.Close()
+
+	podNs, err := netns.GetFromPath(nsPath)
+	if err != nil {
+		return fmt.Errorf("could not open pod network namespace: %v", err)
+	}
+	defer podNs.Close()
+
+	podHandle, err := netlink.NewHandleAt(podNs)
+	if err != nil {
+		return fmt.Errorf("could not get pod netlink handle: %v", err)
+	}
+	defer podHandle.Delete()
+
+	for _, dev := range devices {
+		link, err := podHandle.LinkByName(dev)
+		if err != nil {
+			glog.Warningf("Skipping device %s: %v", dev, err)
+			continue
+		}
+		if err := podHandle.LinkSetDown(link); err != nil {
+			glog.Warningf("Could not bring %s down: %v", dev, err)
+		}
+		glog.V(3).Infof("Moving device %s back to host", dev)
+		if err := podHandle.LinkSetNsFd(link, int(hostNs)); err != nil {
+			return fmt.Errorf("could not move %s to host network namespace: %v", dev, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+// Copyright (c) 2018-2019 Sylabs, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package network
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDevicePool(t *testing.T) {
+	pool := NewDevicePool([]string{"ib0", "ib1", "ib2", "ib1", ""})
+
+	tt := []struct {
+		name         string
+		podID        string
+		request      string
+		expectDevice []string
+		expectError  error
+	}{
+		{
+			name:         "empty request",
+			podID:        "pod1",
+			request:      "",
+			expectDevice: nil,
+			expectError:  nil,
+		},
+		{
+			name:         "by name",
+			podID:        "pod1",
+			request:      "ib1",
+			expectDevice: []string{"ib1"},
+			expectError:  nil,
+		},
+		{
+			name:         "name is taken",
+			podID:        "pod2",
+			request:      "ib0, ib1",
+			expectDevice: nil,
+			expectError:  fmt.Errorf(`device "ib1" is already used by pod pod1`),
+		},
+		{
+			name:         "unknown name",
+			podID:        "pod2",
+			request:      "eth0",
+			expectDevice: nil,
+			expectError:  fmt.Errorf(`device "eth0" is not in the pool`),
+		},
+		{
+			name:         "by number",
+			podID:        "pod2",
+			request:      "2",
+			expectDevice: []string{"ib0", "ib2"},
+			expectError:  nil,
+		},
+		{
+			name:         "not enough devices",
+			podID:        "pod3",
+			request:      "1",
+			expectDevice: nil,
+			expectError:  fmt.Errorf("requested 1 devices, only 0 available"),
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			devices, err := pool.Allocate(tc.podID, tc.request)
+			require.Equal(t, tc.expectError, err)
+			require.Equal(t, tc.expectDevice, devices)
+		})
+	}
+
+	pool.Release("pod2")
+	devices, err := pool.Allocate("pod3", "2")
+	require.NoError(t, err)
+	require.Equal(t, []string{"ib0", "ib2"}, devices)
+}
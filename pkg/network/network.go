@@ -41,6 +41,7 @@ type Manager struct {
 	defaultNetwork *libcni.NetworkConfigList
 	cniPath        *snetwork.CNIPath
 	podCIDR        string
+	devicePool     *DevicePool
 }
 
 // PodConfig contains/defines pod network configuration.
@@ -50,6 +51,9 @@ type PodConfig struct {
 	Name         string
 	NsPath       string
 	PortMappings []*k8s.PortMapping
+	// HostDevices holds pod's request for host network devices,
+	// see HostDevicesAnnotation for the format details.
+	HostDevices string
 }
 
 // PodNetwork represents set up pod's network. It is a caller's responsibility
@@ -58,6 +62,10 @@ type PodConfig struct {
 type PodNetwork struct {
 	setup          *snetwork.Setup
 	defaultNetwork string
+
+	podID       string
+	nsPath      string
+	hostDevices []string
 }
 
 // Init initializes CNI network manager.
@@ -210,13 +218,63 @@ func (m *Manager) SetUpPod(podConfig *PodConfig) (*PodNetwork, error) {
 	if err := setup.AddNetworks(); err != nil {
 		return nil, err
 	}
-	return &PodNetwork{
+	podNetwork := &PodNetwork{
 		setup:          setup,
 		defaultNetwork: m.defaultNetwork.Name,
-	}, nil
+		podID:          podConfig.ID,
+		nsPath:         podConfig.NsPath,
+	}
+	if err := m.attachHostDevices(podNetwork, podConfig.HostDevices); err != nil {
+		if err := setup.DelNetworks(); err != nil {
+			glog.Errorf("Could not tear down pod network: %v", err)
+		}
+		return nil, fmt.Errorf("could not attach host devices: %v", err)
+	}
+	return podNetwork, nil
 }
 
-// TearDownPod tears down pod's network interface.
+// SetDevicePool sets pool of host network devices that
+// may be requested by pods with HostDevicesAnnotation.
+func (m *Manager) SetDevicePool(pool *DevicePool) {
+	m.Lock()
+	defer m.Unlock()
+	m.devicePool = pool
+}
+
+func (m *Manager) hostDevicePool() *DevicePool {
+	m.RLock()
+	defer m.RUnlock()
+	return m.devicePool
+}
+
+func (m *Manager) attachHostDevices(podNetwork *PodNetwork, request string) error {
+	if request == "" {
+		return nil
+	}
+	pool := m.hostDevicePool()
+	if pool == nil {
+		return fmt.Errorf("no host network devices are configured on this node")
+	}
+	devices, err := pool.Allocate(podNetwork.podID, request)
+	if err != nil {
+		return err
+	}
+	err = attachDevices(podNetwork.nsPath, devices)
+	if err != nil {
+		if err := detachDevices(podNetwork.nsPath, devices); err != nil {
+			glog.Errorf("Could not return host devices: %v", err)
+		}
+		pool.Release(podNetwork.podID)
+		return err
+	}
+	podNetwork.hostDevices = devices
+	return nil
+}
+
+// TearDownPod tears down pod's network interface. Networks are deleted even
+// when host devices fail to detach, so that pod's IP addresses are released.
+// Devices that failed to detach stay allocated to the pod until teardown is
+// retried.
 func (m *Manager) TearDownPod(podNetwork *PodNetwork) error {
 	if err := m.checkInit(); err != nil {
 		return err
@@ -224,7 +282,24 @@ func (m *Manager) TearDownPod(podNetwork *PodNetwork) error {
 	if podNetwork.setup == nil {
 		return fmt.Errorf("nil network setup")
 	}
-	return podNetwork.setup.DelNetworks()
+	var detachErr error
+	if len(podNetwork.hostDevices) != 0 {
+		detachErr = detachDevices(podNetwork.nsPath, podNetwork.hostDevices)
+		if detachErr == nil {
+			if pool := m.hostDevicePool(); pool != nil {
+				pool.Release(podNetwork.podID)
+			}
+			podNetwork.hostDevices = nil
+		}
+	}
+	err := podNetwork.setup.DelNetworks()
+	switch {
+	case detachErr != nil && err != nil:
+		return fmt.Errorf("could not detach host devices: %v; could not delete networks: %v", detachErr, err)
+	case detachErr != nil:
+		return fmt.Errorf("could not detach host devices: %v", detachErr)
+	}
+	return err
 }
 
 // Status returns an error if the network manager is not initialized.
@@ -256,3 +331,24 @@ func (n *PodNetwork) GetIP() (net.IP, error) {
 	}
 	return nil, fmt.Errorf("could not get pod's IP: %v", err)
 }
+
+// Attachment describes how pod is attached to network.
+type Attachment struct {
+	Network     string   `json:"network"`
+	NsPath      string   `json:"nsPath"`
+	IP          string   `json:"ip,omitempty"`
+	HostDevices []string `json:"hostDevices,omitempty"`
+}
+
+// Attachment returns description of pod's network attachment.
+func (n *PodNetwork) Attachment() Attachment {
+	a := Attachment{
+		Network:     n.defaultNetwork,
+		NsPath:      n.nsPath,
+		HostDevices: n.hostDevices,
+	}
+	if ip, err := n.GetIP(); err == nil {
+		a.IP = ip.String()
+	}
+	return a
+}
@@ -0,0 +1,120 @@
+// Copyright (c) 2018-2019 Sylabs, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package device
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	k8sDP "k8s.io/kubernetes/pkg/kubelet/apis/deviceplugin/v1beta1"
+)
+
+// kubeletCheckpoint is a file where kubelet device manager
+// persists devices allocated to running containers.
+const kubeletCheckpoint = k8sDP.DevicePluginPath + "kubelet_internal_checkpoint"
+
+// kubeletCheckpointData mirrors parts of kubelet device manager checkpoint
+// that are needed to find allocated devices. DeviceIDs is a plain list in older
+// kubelets and is grouped by NUMA node since Kubernetes 1.20.
+type kubeletCheckpointData struct {
+	Data struct {
+		PodDeviceEntries []struct {
+			PodUID        string
+			ContainerName string
+			ResourceName  string
+			DeviceIDs     json.RawMessage
+		}
+	}
+}
+
+// deviceOwner is a container device is allocated to.
+type deviceOwner struct {
+	podUID    string
+	container string
+}
+
+func (o deviceOwner) String() string {
+	return o.podUID + "/" + o.container
+}
+
+// allocatedDevices reads kubelet checkpoint located at path and returns
+// devices of resourceName mapped onto containers they are allocated to.
+// Kubelet never removes entries of terminated pods from its checkpoint,
+// so returned owners may be long gone. Missing checkpoint means
+// that there are no allocated devices.
+func allocatedDevices(path, resourceName string) (map[string][]deviceOwner, error) {
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not read kubelet checkpoint: %v", err)
+	}
+
+	var checkpoint kubeletCheckpointData
+	if err := json.Unmarshal(data, &checkpoint); err != nil {
+		return nil, fmt.Errorf("could not decode kubelet checkpoint: %v", err)
+	}
+
+	allocated := make(map[string][]deviceOwner)
+	for _, entry := range checkpoint.Data.PodDeviceEntries {
+		if entry.ResourceName != resourceName {
+			continue
+		}
+
+		var ids []string
+		if err := json.Unmarshal(entry.DeviceIDs, &ids); err != nil {
+			var numaIDs map[string][]string
+			if err := json.Unmarshal(entry.DeviceIDs, &numaIDs); err != nil {
+				return nil, fmt.Errorf("could not decode devices of %s/%s: %v", entry.PodUID, entry.ContainerName, err)
+			}
+			for _, numaIDs := range numaIDs {
+				ids = append(ids, numaIDs...)
+			}
+		}
+		owner := deviceOwner{
+			podUID:    entry.PodUID,
+			container: entry.ContainerName,
+		}
+		for _, id := range ids {
+			allocated[id] = append(allocated[id], owner)
+		}
+	}
+	return allocated, nil
+}
+
+// conflictingAllocations returns devices that are allocated to containers of
+// more than one active pod. Containers of the same pod may share a device
+// since kubelet reuses devices released by init containers.
+func conflictingAllocations(allocated map[string][]deviceOwner, activePods map[string]bool) map[string][]deviceOwner {
+	conflicts := make(map[string][]deviceOwner)
+	for id, owners := range allocated {
+		var active []deviceOwner
+		pods := make(map[string]bool, len(owners))
+		for _, owner := range owners {
+			if !activePods[owner.podUID] {
+				continue
+			}
+			active = append(active, owner)
+			pods[owner.podUID] = true
+		}
+		if len(pods) > 1 {
+			conflicts[id] = active
+		}
+	}
+	return conflicts
+}
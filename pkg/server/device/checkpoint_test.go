@@ -0,0 +1,198 @@
+// Copyright (c) 2018-2019 Sylabs, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package device
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	k8sDP "k8s.io/kubernetes/pkg/kubelet/apis/deviceplugin/v1beta1"
+)
+
+func TestAllocatedDevices(t *testing.T) {
+	tt := []struct {
+		name            string
+		checkpoint      string
+		expectAllocated map[string][]deviceOwner
+		expectError     bool
+	}{
+		{
+			name: "device list",
+			checkpoint: `{"Data":{"PodDeviceEntries":[
+				{"PodUID":"pod1","ContainerName":"c1","ResourceName":"example.com/gpu","DeviceIDs":["gpu0","gpu1"],"AllocResp":""},
+				{"PodUID":"pod2","ContainerName":"c2","ResourceName":"example.com/nic","DeviceIDs":["nic0"],"AllocResp":""}
+			],"RegisteredDevices":{"example.com/gpu":["gpu0","gpu1","gpu2"]}},"Checksum":42}`,
+			expectAllocated: map[string][]deviceOwner{
+				"gpu0": {{podUID: "pod1", container: "c1"}},
+				"gpu1": {{podUID: "pod1", container: "c1"}},
+			},
+		},
+		{
+			name: "devices by NUMA node",
+			checkpoint: `{"Data":{"PodDeviceEntries":[
+				{"PodUID":"pod1","ContainerName":"c1","ResourceName":"example.com/gpu","DeviceIDs":{"0":["gpu0"],"1":["gpu2"]},"AllocResp":""}
+			]},"Checksum":42}`,
+			expectAllocated: map[string][]deviceOwner{
+				"gpu0": {{podUID: "pod1", container: "c1"}},
+				"gpu2": {{podUID: "pod1", container: "c1"}},
+			},
+		},
+		{
+			name:        "invalid checkpoint",
+			checkpoint:  `{"Data":{"PodDeviceEntries":[{"ResourceName":"example.com/gpu","DeviceIDs":42}]}}`,
+			expectError: true,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			f, err := ioutil.TempFile("", "checkpoint-")
+			require.NoError(t, err, "could not create temp file")
+			defer os.Remove(f.Name())
+			_, err = f.WriteString(tc.checkpoint)
+			require.NoError(t, err, "could not write checkpoint")
+			require.NoError(t, f.Close())
+
+			allocated, err := allocatedDevices(f.Name(), "example.com/gpu")
+			require.Equal(t, tc.expectError, err != nil, "unexpected error: %v", err)
+			require.Equal(t, tc.expectAllocated, allocated)
+		})
+	}
+
+	allocated, err := allocatedDevices("/not/exist", "example.com/gpu")
+	require.NoError(t, err)
+	require.Empty(t, allocated)
+}
+
+func TestConflictingAllocations(t *testing.T) {
+	allocated := map[string][]deviceOwner{
+		// init container released device to app container
+		"gpu0": {
+			{podUID: "pod1", container: "init"},
+			{podUID: "pod1", container: "app"},
+		},
+		// device was freed by terminated pod
+		"gpu1": {
+			{podUID: "pod2", container: "app"},
+			{podUID: "pod3", container: "app"},
+		},
+		"gpu2": {
+			{podUID: "pod3", container: "app"},
+			{podUID: "pod4", container: "app"},
+		},
+	}
+	activePods := map[string]bool{
+		"pod1": true,
+		"pod3": true,
+		"pod4": true,
+	}
+	require.Equal(t, map[string][]deviceOwner{
+		"gpu2": {
+			{podUID: "pod3", container: "app"},
+			{podUID: "pod4", container: "app"},
+		},
+	}, conflictingAllocations(allocated, activePods))
+}
+
+func TestDevicePlugin_AllocateCheckpointed(t *testing.T) {
+	f, err := ioutil.TempFile("", "checkpoint-")
+	require.NoError(t, err, "could not create temp file")
+	defer os.Remove(f.Name())
+	_, err = f.WriteString(`{"Data":{"PodDeviceEntries":[
+		{"PodUID":"pod1","ContainerName":"c1","ResourceName":"example.com/gpu","DeviceIDs":["gpu0"]}
+	]}}`)
+	require.NoError(t, err, "could not write checkpoint")
+	require.NoError(t, f.Close())
+
+	b := &fakeBackend{
+		gpus: []*gpu{
+			{id: "gpu0", paths: []string{"/dev/gpu0"}},
+			{id: "gpu1", paths: []string{"/dev/gpu1"}},
+		},
+		ill: make(chan string),
+	}
+	dp, err := newDevicePlugin(b, func(dp *SingularityDevicePlugin) {
+		dp.checkpoint = f.Name()
+	})
+	require.NoError(t, err)
+
+	// kubelet keeps devices of terminated pods in checkpoint,
+	// so they must be allocated again
+	_, err = dp.Allocate(context.Background(), &k8sDP.AllocateRequest{
+		ContainerRequests: []*k8sDP.ContainerAllocateRequest{
+			{DevicesIDs: []string{"gpu1", "gpu0"}},
+		},
+	})
+	require.NoError(t, err)
+}
+
+func TestDevicePlugin_ReserveCheckpointed(t *testing.T) {
+	f, err := ioutil.TempFile("", "checkpoint-")
+	require.NoError(t, err, "could not create temp file")
+	defer os.Remove(f.Name())
+	_, err = f.WriteString(`{"Data":{"PodDeviceEntries":[
+		{"PodUID":"pod1","ContainerName":"c1","ResourceName":"example.com/gpu","DeviceIDs":["gpu0"]},
+		{"PodUID":"pod2","ContainerName":"c1","ResourceName":"example.com/gpu","DeviceIDs":["gpu1"]}
+	]}}`)
+	require.NoError(t, err, "could not write checkpoint")
+	require.NoError(t, f.Close())
+
+	b := &fakeBackend{
+		gpus: []*gpu{
+			{id: "gpu0", paths: []string{"/dev/gpu0"}},
+			{id: "gpu1", paths: []string{"/dev/gpu1"}},
+		},
+		ill: make(chan string),
+	}
+	activePods := map[string]bool{"pod1": true}
+	dp, err := newDevicePlugin(b, WithActivePods(func() map[string]bool {
+		return activePods
+	}), func(dp *SingularityDevicePlugin) {
+		dp.checkpoint = f.Name()
+	})
+	require.NoError(t, err)
+
+	listIDs := func() []string {
+		var ids []string
+		for _, dev := range dp.listK8sDevices() {
+			ids = append(ids, dev.ID)
+		}
+		sort.Strings(ids)
+		return ids
+	}
+	allocate := func(ids ...string) error {
+		_, err := dp.Allocate(context.Background(), &k8sDP.AllocateRequest{
+			ContainerRequests: []*k8sDP.ContainerAllocateRequest{
+				{DevicesIDs: ids},
+			},
+		})
+		return err
+	}
+
+	// gpu0 is held by active pod, while gpu1 was freed by terminated one
+	require.Equal(t, []string{"gpu1"}, listIDs())
+	require.Error(t, allocate("gpu0"))
+	require.NoError(t, allocate("gpu1"))
+	require.False(t, dp.releaseReservations())
+
+	delete(activePods, "pod1")
+	require.True(t, dp.releaseReservations())
+	require.Equal(t, []string{"gpu0", "gpu1"}, listIDs())
+	require.NoError(t, allocate("gpu0"))
+}
@@ -47,12 +47,12 @@ import (
 	"context"
 	"fmt"
 	"os/exec"
+	"strings"
+	"sync"
+	"time"
 
-	"github.com/NVIDIA/gpu-monitoring-tools/bindings/go/nvml"
 	"github.com/golang/glog"
 	"github.com/sylabs/singularity-cri/pkg/singularity"
-	"github.com/sylabs/singularity-cri/pkg/singularity/runtime"
-	"github.com/sylabs/singularity/pkg/util/nvidia"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 	k8sDP "k8s.io/kubernetes/pkg/kubelet/apis/deviceplugin/v1beta1"
@@ -66,43 +66,170 @@ var (
 	// ErrUnableToLoad is returned when device plugin is unable to
 	// detect loaded graphic driver on the host or unable to load
 	// NVML shared library.
-	ErrUnableToLoad = fmt.Errorf("unable to load: check libnvidia-ml.so.1 library and graphic drivers")
+	ErrUnableToLoad = fmt.Errorf("unable to load: check libnvidia-ml.so.1 library, amdgpu module and graphic drivers")
 )
 
+// gpu is a single GPU device that is advertised to kubelet.
+type gpu struct {
+	// id is a unique device ID.
+	id string
+	// parent is an ID of a physical device when gpu
+	// is a partition of it, e.g. NVIDIA MIG device.
+	parent string
+	// paths holds device nodes that should be
+	// available in container to access GPU.
+	paths []string
+}
+
+// backend encapsulates vendor specific GPU operations.
+type backend interface {
+	// resourceName returns name of the resource to register in kubelet.
+	resourceName() string
+	// devices returns all GPUs found on the host.
+	devices() ([]*gpu, error)
+	// monitor starts health checking of the passed devices. IDs of unhealthy
+	// devices are sent to the returned channel until done is closed.
+	monitor(done <-chan struct{}, devices []*gpu) (<-chan string, error)
+	// probe checks whether device that was reported unhealthy
+	// was reset since then and is usable again.
+	probe(device *gpu) error
+	// allocate returns instructions to make passed devices available in container.
+	allocate(devices []*gpu) (*k8sDP.ContainerAllocateResponse, error)
+	// shutdown frees any resources taken by backend.
+	shutdown() error
+}
+
+// SharedGPUAnnotation is set on containers that are allocated shared GPUs.
+// Its value is a comma-separated list of physical GPU IDs, so containers
+// with intersecting values share the same devices.
+const SharedGPUAnnotation = "sycri.sylabs.io/shared-gpus"
+
 // SingularityDevicePlugin is Singularity implementation of a DevicePluginServer
-// interface that allows containers to request nvidia GPUs.
+// interface that allows containers to request GPUs. Both NVIDIA and AMD (ROCm)
+// GPUs are supported, whichever is found on the host first.
 type SingularityDevicePlugin struct {
-	devices  map[string]*nvml.Device
+	backend          backend
+	replicas         int
+	recoveryInterval time.Duration
+	// checkpoint is a kubelet device manager checkpoint that
+	// is used to find devices allocated before plugin restart.
+	checkpoint string
+	// activePods returns UIDs of pods that are still active on the node.
+	activePods func() map[string]bool
+	// singularityConfDir is used by NVIDIA backend only.
+	singularityConfDir string
+	// devices maps advertised device IDs onto GPUs, which differ
+	// only when GPUs are shared between multiple containers.
+	devices  map[string]*gpu
 	hospital map[string]string
-	confDir  string
+	// advertised maps GPU IDs onto advertised device IDs.
+	advertised map[string][]string
+
+	mu sync.Mutex
+	// reserved maps advertised device IDs onto active pods they were
+	// allocated to before plugin restart. Reserved devices are neither
+	// advertised nor allocated until their pods terminate.
+	reserved map[string][]deviceOwner
 
 	done         chan struct{}
 	unhealthyDev <-chan string
 }
 
+// defaultRecoveryInterval is a default interval between
+// attempts to recover unhealthy devices.
+const defaultRecoveryInterval = time.Minute
+
+// Option is a functional option used to configure SingularityDevicePlugin.
+type Option func(dp *SingularityDevicePlugin)
+
+// WithReplicas sets number of times each GPU is advertised to kubelet, which
+// allows containers to share GPUs in time-sliced manner. Numbers less than 2
+// disable GPU sharing.
+func WithReplicas(n int) Option {
+	return func(dp *SingularityDevicePlugin) {
+		dp.replicas = n
+	}
+}
+
+// WithRecoveryInterval sets interval between attempts to recover unhealthy devices.
+// Devices that are found reset are advertised to kubelet as healthy again.
+// When not positive, defaultRecoveryInterval is used.
+func WithRecoveryInterval(d time.Duration) Option {
+	return func(dp *SingularityDevicePlugin) {
+		if d > 0 {
+			dp.recoveryInterval = d
+		}
+	}
+}
+
+// WithSingularityConfDir sets Singularity config directory that is used to
+// look for NVIDIA libraries list. When not set, it is detected automatically.
+func WithSingularityConfDir(dir string) Option {
+	return func(dp *SingularityDevicePlugin) {
+		dp.singularityConfDir = dir
+	}
+}
+
+// WithActivePods sets function that returns UIDs of pods that are still active
+// on the node. It is used to reserve devices that kubelet checkpoint assigns
+// to active pods, so they are not allocated twice after plugin restart.
+func WithActivePods(f func() map[string]bool) Option {
+	return func(dp *SingularityDevicePlugin) {
+		dp.activePods = f
+	}
+}
+
 // NewSingularityDevicePlugin initializes and returns Singularity device plugin
-// that allows us to access nvidia GPUs on host. It fails if there is no
-// graphic driver installed on host or if Nvidia Management Library (NVML)
-// fails to load.
-func NewSingularityDevicePlugin() (*SingularityDevicePlugin, error) {
-	_, err := exec.LookPath(singularity.RuntimeName)
+// that allows us to access GPUs on host. It fails if there is no graphic driver
+// installed on host or if neither Nvidia Management Library (NVML) nor
+// ROCm kernel driver can be loaded.
+func NewSingularityDevicePlugin(opts ...Option) (*SingularityDevicePlugin, error) {
+	_, err := exec.LookPath(singularity.BinaryPath())
 	if err != nil {
-		return nil, fmt.Errorf("could not find %s on this machine: %v", singularity.RuntimeName, err)
+		return nil, fmt.Errorf("could not find %s on this machine: %v", singularity.BinaryPath(), err)
 	}
-	config, err := runtime.NewCLIClient().BuildConfig()
-	if err != nil {
-		return nil, fmt.Errorf("could not get build config: %v", err)
+
+	settings := &SingularityDevicePlugin{}
+	for _, opt := range opts {
+		opt(settings)
 	}
+	loaders := []func() (backend, error){
+		func() (backend, error) {
+			return loadNVIDIA(settings.singularityConfDir)
+		},
+		loadROCm,
+	}
+
+	loadErr := ErrUnableToLoad
+	for _, load := range loaders {
+		b, err := load()
+		if err == ErrUnableToLoad {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
 
-	glog.V(1).Infof("Loading NVML")
-	if err = nvml.Init(); err != nil {
-		glog.Errorf("Could not initialize NVML library: %v", err)
-		return nil, ErrUnableToLoad
+		dp, err := newDevicePlugin(b, opts...)
+		if err == ErrNoGPUs {
+			loadErr = ErrNoGPUs
+			continue
+		}
+		return dp, err
 	}
+	return nil, loadErr
+}
 
+func newDevicePlugin(b backend, opts ...Option) (*SingularityDevicePlugin, error) {
+	var err error
 	dp := &SingularityDevicePlugin{
-		done:    make(chan struct{}),
-		confDir: config.SingularityConfdir,
+		backend:          b,
+		recoveryInterval: defaultRecoveryInterval,
+		checkpoint:       kubeletCheckpoint,
+		done:             make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(dp)
 	}
 	defer func() {
 		if err != nil {
@@ -111,43 +238,87 @@ func NewSingularityDevicePlugin() (*SingularityDevicePlugin, error) {
 		}
 	}()
 
-	v, err := nvml.GetDriverVersion()
-	if err != nil {
-		glog.Errorf("Could not get driver version: %v", err)
-		return nil, ErrUnableToLoad
-	}
-	glog.V(1).Infof("Found graphic driver of version %v", v)
-
-	devices, err := getDevices()
+	devices, err := b.devices()
 	if err != nil {
 		return nil, fmt.Errorf("could not get available devices: %v", err)
 	}
 	if len(devices) == 0 {
-		return nil, ErrNoGPUs
+		err = ErrNoGPUs
+		return nil, err
 	}
 
-	dp.devices = make(map[string]*nvml.Device, len(devices))
+	dp.devices = make(map[string]*gpu, len(devices))
 	dp.hospital = make(map[string]string, len(devices))
-	devIDs := make([]string, len(devices))
-	for i, dev := range devices {
-		dp.devices[dev.UUID] = dev
-		dp.hospital[dev.UUID] = k8sDP.Healthy
-		devIDs[i] = dev.UUID
+	dp.advertised = make(map[string][]string, len(devices))
+	for _, dev := range devices {
+		ids := []string{dev.id}
+		if dp.replicas > 1 {
+			ids = make([]string, dp.replicas)
+			for i := range ids {
+				ids[i] = fmt.Sprintf("%s::%d", dev.id, i)
+			}
+		}
+		for _, id := range ids {
+			dp.devices[id] = dev
+			dp.hospital[id] = k8sDP.Healthy
+		}
+		dp.advertised[dev.id] = ids
 	}
+	dp.updateDevicesMetric()
 
-	dp.unhealthyDev, err = monitorGPUs(dp.done, devIDs)
+	dp.unhealthyDev, err = b.monitor(dp.done, devices)
 	if err != nil {
 		return nil, fmt.Errorf("could not start GPU monitoring: %v", err)
 	}
-
+	glog.V(1).Infof("Found %d devices of %s resource", len(devices), b.resourceName())
+	dp.reconcileAllocations()
 	return dp, nil
 }
 
+// reconcileAllocations checks devices allocated before plugin restart against
+// pods that are still active and reserves devices held by them. Entries of
+// terminated pods are ignored since kubelet checkpoint outlives pods.
+func (dp *SingularityDevicePlugin) reconcileAllocations() {
+	if dp.activePods == nil {
+		return
+	}
+	allocated, err := allocatedDevices(dp.checkpoint, dp.ResourceName())
+	if err != nil {
+		// not fatal, kubelet may be of incompatible version
+		glog.Warningf("Could not find allocated devices: %v", err)
+		return
+	}
+	activePods := dp.activePods()
+	reserved := make(map[string][]deviceOwner)
+	for devID, owners := range allocated {
+		if _, ok := dp.devices[devID]; !ok {
+			continue
+		}
+		for _, owner := range owners {
+			if activePods[owner.podUID] {
+				glog.V(3).Infof("Device %s is allocated to %s", devID, owner)
+				reserved[devID] = append(reserved[devID], owner)
+			}
+		}
+	}
+	dp.mu.Lock()
+	dp.reserved = reserved
+	dp.mu.Unlock()
+	for devID, owners := range conflictingAllocations(allocated, activePods) {
+		glog.Warningf("Device %s is allocated to multiple pods: %v", devID, owners)
+	}
+}
+
+// ResourceName returns name of the resource device plugin provides.
+func (dp *SingularityDevicePlugin) ResourceName() string {
+	return dp.backend.resourceName()
+}
+
 // Shutdown shuts down device plugin and any GPU monitoring activity.
 func (dp *SingularityDevicePlugin) Shutdown() error {
 	glog.V(3).Infof("Cancelling GPU monitoring")
 	close(dp.done)
-	return nvml.Shutdown()
+	return dp.backend.shutdown()
 }
 
 // GetDevicePluginOptions returns options to be communicated with Device Manager.
@@ -164,76 +335,133 @@ func (dp *SingularityDevicePlugin) ListAndWatch(_ *k8sDP.Empty, srv k8sDP.Device
 	if err != nil {
 		return status.Errorf(codes.Unknown, "could not send initial devices state: %v", err)
 	}
+	ticker := time.NewTicker(dp.recoveryInterval)
+	defer ticker.Stop()
+
 	for {
 		select {
 		case <-dp.done:
 			return nil
 		case devID := <-dp.unhealthyDev:
-			dp.hospital[devID] = k8sDP.Unhealthy
+			for _, id := range dp.advertised[devID] {
+				dp.hospital[id] = k8sDP.Unhealthy
+			}
 			glog.Warningf("Device %s is in hospital", devID)
+		case <-ticker.C:
+			released := dp.releaseReservations()
+			if !dp.recover() && !released {
+				continue
+			}
+		}
 
-			err := srv.Send(&k8sDP.ListAndWatchResponse{Devices: dp.listK8sDevices()})
-			if err != nil {
-				return status.Errorf(codes.Unknown, "could not send updated devices state: %v", err)
+		dp.updateDevicesMetric()
+		err := srv.Send(&k8sDP.ListAndWatchResponse{Devices: dp.listK8sDevices()})
+		if err != nil {
+			return status.Errorf(codes.Unknown, "could not send updated devices state: %v", err)
+		}
+	}
+}
+
+// recover probes all unhealthy devices and marks healthy those that
+// are recovered. It reports whether any device state has changed.
+func (dp *SingularityDevicePlugin) recover() bool {
+	var recovered bool
+	for devID, ids := range dp.advertised {
+		if dp.hospital[ids[0]] == k8sDP.Healthy {
+			continue
+		}
+		if err := dp.backend.probe(dp.devices[ids[0]]); err != nil {
+			glog.V(4).Infof("Device %s is still unhealthy: %v", devID, err)
+			continue
+		}
+		for _, id := range ids {
+			dp.hospital[id] = k8sDP.Healthy
+		}
+		glog.Infof("Device %s is recovered", devID)
+		recovered = true
+	}
+	return recovered
+}
+
+// releaseReservations frees reserved devices whose pods are no
+// longer active. It reports whether any device was released.
+func (dp *SingularityDevicePlugin) releaseReservations() bool {
+	dp.mu.Lock()
+	defer dp.mu.Unlock()
+
+	if len(dp.reserved) == 0 {
+		return false
+	}
+	activePods := dp.activePods()
+	var released bool
+	for devID, owners := range dp.reserved {
+		var active []deviceOwner
+		for _, owner := range owners {
+			if activePods[owner.podUID] {
+				active = append(active, owner)
 			}
 		}
+		if len(active) != 0 {
+			dp.reserved[devID] = active
+			continue
+		}
+		delete(dp.reserved, devID)
+		glog.Infof("Device %s is released by terminated pods %v", devID, owners)
+		released = true
 	}
+	return released
 }
 
 // Allocate is called during container creation so that the Device Plugin can run
 // device specific operations and instruct Kubelet of the steps to make the Device
 // available in the container.
-func (dp *SingularityDevicePlugin) Allocate(ctx context.Context, req *k8sDP.AllocateRequest) (*k8sDP.AllocateResponse, error) {
-	nvLibs, nvBins, err := nvidia.Paths(dp.confDir, "")
+func (dp *SingularityDevicePlugin) Allocate(_ context.Context, req *k8sDP.AllocateRequest) (*k8sDP.AllocateResponse, error) {
+	allocationsMetric.Inc(dp.ResourceName())
+	resp, err := dp.allocate(req)
 	if err != nil {
-		return nil, status.Errorf(codes.Internal, "could not search NVIDIA files: %v", err)
+		failedAllocationsMetric.Inc(dp.ResourceName())
 	}
-	glog.V(4).Infof("NVIDIA paths are %v and %v", nvLibs, nvBins)
+	return resp, err
+}
 
-	nvDevs, err := nvidia.Devices(false)
-	if err != nil {
-		return nil, status.Errorf(codes.Internal, "could not search NVIDIA complementary devices: %v", err)
-	}
-	glog.V(4).Infof("NVIDIA complementary devices are %v", nvDevs)
-
-	nvidiaMounts := make([]*k8sDP.Mount, 0, len(nvLibs)+len(nvBins))
-	for _, libPath := range nvLibs {
-		nvidiaMounts = append(nvidiaMounts, &k8sDP.Mount{
-			ContainerPath: libPath,
-			HostPath:      libPath,
-			ReadOnly:      true,
-		})
-	}
-	for _, binPath := range nvBins {
-		nvidiaMounts = append(nvidiaMounts, &k8sDP.Mount{
-			ContainerPath: binPath,
-			HostPath:      binPath,
-			ReadOnly:      true,
-		})
-	}
+func (dp *SingularityDevicePlugin) allocate(req *k8sDP.AllocateRequest) (*k8sDP.AllocateResponse, error) {
+	dp.mu.Lock()
+	defer dp.mu.Unlock()
 
 	allocateResponses := make([]*k8sDP.ContainerAllocateResponse, 0, len(req.ContainerRequests))
 	for _, allocateRequest := range req.ContainerRequests {
-		nvidiaDevices := make([]*k8sDP.DeviceSpec, 0, len(nvDevs)+len(allocateRequest.DevicesIDs))
-		for _, nvDev := range nvDevs {
-			nvidiaDevices = append(nvidiaDevices, &k8sDP.DeviceSpec{
-				ContainerPath: nvDev,
-				HostPath:      nvDev,
-				Permissions:   "rw",
-			})
-		}
+		devices := make([]*gpu, 0, len(allocateRequest.DevicesIDs))
+		seen := make(map[string]bool, len(allocateRequest.DevicesIDs))
 		for _, devID := range allocateRequest.DevicesIDs {
-			device := dp.devices[devID]
-			nvidiaDevices = append(nvidiaDevices, &k8sDP.DeviceSpec{
-				ContainerPath: device.Path,
-				HostPath:      device.Path,
-				Permissions:   "rw",
-			})
+			device, ok := dp.devices[devID]
+			if !ok {
+				return nil, status.Errorf(codes.InvalidArgument, "unknown device %s", devID)
+			}
+			if owners, ok := dp.reserved[devID]; ok {
+				return nil, status.Errorf(codes.FailedPrecondition, "device %s is allocated to active pod %s", devID, owners[0])
+			}
+			// replicas of the same GPU may be allocated to a single container
+			if seen[device.id] {
+				continue
+			}
+			seen[device.id] = true
+			devices = append(devices, device)
 		}
-		allocateResponses = append(allocateResponses, &k8sDP.ContainerAllocateResponse{
-			Mounts:  nvidiaMounts,
-			Devices: nvidiaDevices,
-		})
+		resp, err := dp.backend.allocate(devices)
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "could not allocate devices: %v", err)
+		}
+		if dp.replicas > 1 {
+			ids := make([]string, len(devices))
+			for i, device := range devices {
+				ids[i] = device.id
+			}
+			if resp.Annotations == nil {
+				resp.Annotations = make(map[string]string, 1)
+			}
+			resp.Annotations[SharedGPUAnnotation] = strings.Join(ids, ",")
+		}
+		allocateResponses = append(allocateResponses, resp)
 	}
 	return &k8sDP.AllocateResponse{
 		ContainerResponses: allocateResponses,
@@ -248,8 +476,14 @@ func (*SingularityDevicePlugin) PreStartContainer(context.Context, *k8sDP.PreSta
 }
 
 func (dp *SingularityDevicePlugin) listK8sDevices() []*k8sDP.Device {
+	dp.mu.Lock()
+	defer dp.mu.Unlock()
+
 	devices := make([]*k8sDP.Device, 0, len(dp.hospital))
 	for devID, health := range dp.hospital {
+		if _, ok := dp.reserved[devID]; ok {
+			continue
+		}
 		devices = append(devices, &k8sDP.Device{
 			ID:     devID,
 			Health: health,
@@ -257,3 +491,16 @@ func (dp *SingularityDevicePlugin) listK8sDevices() []*k8sDP.Device {
 	}
 	return devices
 }
+
+// deviceSpecs returns device specs to bind passed device nodes into container as is.
+func deviceSpecs(paths ...string) []*k8sDP.DeviceSpec {
+	specs := make([]*k8sDP.DeviceSpec, 0, len(paths))
+	for _, path := range paths {
+		specs = append(specs, &k8sDP.DeviceSpec{
+			ContainerPath: path,
+			HostPath:      path,
+			Permissions:   "rw",
+		})
+	}
+	return specs
+}
@@ -0,0 +1,168 @@
+// Copyright (c) 2018-2019 Sylabs, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package device
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/sylabs/singularity-cri/pkg/metrics"
+	k8sDP "k8s.io/kubernetes/pkg/kubelet/apis/deviceplugin/v1beta1"
+)
+
+type fakeBackend struct {
+	gpus   []*gpu
+	ill    chan string
+	broken map[string]bool
+}
+
+func (*fakeBackend) resourceName() string {
+	return "example.com/gpu"
+}
+
+func (b *fakeBackend) devices() ([]*gpu, error) {
+	return b.gpus, nil
+}
+
+func (b *fakeBackend) monitor(<-chan struct{}, []*gpu) (<-chan string, error) {
+	return b.ill, nil
+}
+
+func (b *fakeBackend) probe(device *gpu) error {
+	if b.broken[device.id] {
+		return fmt.Errorf("device is broken")
+	}
+	return nil
+}
+
+func (*fakeBackend) allocate(devices []*gpu) (*k8sDP.ContainerAllocateResponse, error) {
+	var paths []string
+	for _, dev := range devices {
+		paths = append(paths, dev.paths...)
+	}
+	return &k8sDP.ContainerAllocateResponse{
+		Devices: deviceSpecs(paths...),
+	}, nil
+}
+
+func (*fakeBackend) shutdown() error {
+	return nil
+}
+
+func TestDevicePlugin_Allocate(t *testing.T) {
+	b := &fakeBackend{
+		gpus: []*gpu{
+			{id: "gpu0", paths: []string{"/dev/gpu0"}},
+			{id: "gpu1", paths: []string{"/dev/gpu1"}},
+		},
+		ill: make(chan string),
+	}
+
+	tt := []struct {
+		name              string
+		replicas          int
+		request           []string
+		expectIDs         []string
+		expectPaths       []string
+		expectAnnotations map[string]string
+		expectError       bool
+	}{
+		{
+			name:        "exclusive",
+			replicas:    0,
+			request:     []string{"gpu1"},
+			expectIDs:   []string{"gpu0", "gpu1"},
+			expectPaths: []string{"/dev/gpu1"},
+		},
+		{
+			name:        "exclusive unknown device",
+			replicas:    1,
+			request:     []string{"gpu0::0"},
+			expectIDs:   []string{"gpu0", "gpu1"},
+			expectError: true,
+		},
+		{
+			name:        "shared",
+			replicas:    2,
+			request:     []string{"gpu0::1", "gpu1::0", "gpu0::0"},
+			expectIDs:   []string{"gpu0::0", "gpu0::1", "gpu1::0", "gpu1::1"},
+			expectPaths: []string{"/dev/gpu0", "/dev/gpu1"},
+			expectAnnotations: map[string]string{
+				SharedGPUAnnotation: "gpu0,gpu1",
+			},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			dp, err := newDevicePlugin(b, WithReplicas(tc.replicas))
+			require.NoError(t, err)
+
+			var ids []string
+			for _, dev := range dp.listK8sDevices() {
+				ids = append(ids, dev.ID)
+			}
+			sort.Strings(ids)
+			require.Equal(t, tc.expectIDs, ids)
+
+			resp, err := dp.Allocate(context.Background(), &k8sDP.AllocateRequest{
+				ContainerRequests: []*k8sDP.ContainerAllocateRequest{
+					{DevicesIDs: tc.request},
+				},
+			})
+			require.Equal(t, tc.expectError, err != nil, "unexpected error: %v", err)
+			if tc.expectError {
+				return
+			}
+			require.Len(t, resp.ContainerResponses, 1)
+			require.Equal(t, deviceSpecs(tc.expectPaths...), resp.ContainerResponses[0].Devices)
+			require.Equal(t, tc.expectAnnotations, resp.ContainerResponses[0].Annotations)
+		})
+	}
+}
+
+func TestDevicePlugin_Recover(t *testing.T) {
+	b := &fakeBackend{
+		gpus: []*gpu{
+			{id: "gpu0", paths: []string{"/dev/gpu0"}},
+			{id: "gpu1", paths: []string{"/dev/gpu1"}},
+		},
+		ill:    make(chan string),
+		broken: map[string]bool{"gpu0": true},
+	}
+	dp, err := newDevicePlugin(b, WithReplicas(2))
+	require.NoError(t, err)
+
+	dp.hospital["gpu0::0"] = k8sDP.Unhealthy
+	dp.hospital["gpu0::1"] = k8sDP.Unhealthy
+	require.False(t, dp.recover())
+	require.Equal(t, k8sDP.Unhealthy, dp.hospital["gpu0::1"])
+
+	b.broken["gpu0"] = false
+	require.True(t, dp.recover())
+	require.Equal(t, k8sDP.Healthy, dp.hospital["gpu0::0"])
+	require.Equal(t, k8sDP.Healthy, dp.hospital["gpu0::1"])
+	require.False(t, dp.recover())
+
+	dp.updateDevicesMetric()
+	var buf bytes.Buffer
+	require.NoError(t, metrics.DefaultRegistry.Write(&buf))
+	require.Contains(t, buf.String(), `sycri_device_plugin_devices{resource="example.com/gpu",health="Healthy"} 4`)
+	require.Contains(t, buf.String(), `sycri_device_plugin_devices{resource="example.com/gpu",health="Unhealthy"} 0`)
+}
@@ -0,0 +1,75 @@
+// Copyright (c) 2018-2019 Sylabs, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package device
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/sylabs/singularity-cri/pkg/metrics"
+	k8sDP "k8s.io/kubernetes/pkg/kubelet/apis/deviceplugin/v1beta1"
+)
+
+var (
+	devicesMetric = metrics.NewGaugeVec("sycri_device_plugin_devices",
+		"Number of devices advertised to kubelet.", "resource", "health")
+	allocationsMetric = metrics.NewCounterVec("sycri_device_plugin_allocations_total",
+		"Number of allocation requests.", "resource")
+	failedAllocationsMetric = metrics.NewCounterVec("sycri_device_plugin_failed_allocations_total",
+		"Number of failed allocation requests.", "resource")
+	nvmlErrorsMetric = metrics.NewCounterVec("sycri_device_plugin_nvml_errors_total",
+		"Number of errors returned by NVML.")
+	healthCheckAgeMetric = metrics.NewGaugeFunc("sycri_device_plugin_health_check_age_seconds",
+		"Time since the last devices health check.", healthCheckAge)
+)
+
+// lastHealthCheck holds time of the last health check in unix nanoseconds.
+var lastHealthCheck int64
+
+func init() {
+	metrics.Register(
+		devicesMetric,
+		allocationsMetric,
+		failedAllocationsMetric,
+		nvmlErrorsMetric,
+		healthCheckAgeMetric,
+	)
+}
+
+// healthChecked should be called by backends each time device health is checked.
+func healthChecked() {
+	atomic.StoreInt64(&lastHealthCheck, time.Now().UnixNano())
+}
+
+func healthCheckAge() float64 {
+	last := atomic.LoadInt64(&lastHealthCheck)
+	if last == 0 {
+		return 0
+	}
+	return time.Since(time.Unix(0, last)).Seconds()
+}
+
+// updateDevicesMetric sets number of healthy and unhealthy devices.
+func (dp *SingularityDevicePlugin) updateDevicesMetric() {
+	var healthy int
+	for _, health := range dp.hospital {
+		if health == k8sDP.Healthy {
+			healthy++
+		}
+	}
+	resource := dp.ResourceName()
+	devicesMetric.Set(float64(healthy), resource, k8sDP.Healthy)
+	devicesMetric.Set(float64(len(dp.hospital)-healthy), resource, k8sDP.Unhealthy)
+}
@@ -0,0 +1,135 @@
+// Copyright (c) 2018-2019 Sylabs, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package device
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	nvidiaCapsProc = "/proc/driver/nvidia/capabilities"
+	nvidiaCapsDev  = "/dev/nvidia-caps"
+)
+
+// migDevices returns MIG devices that are created on the physical GPU
+// with the passed UUID and device node. Each compute instance is returned
+// as a separate device with ID in form of MIG-<GPU UUID>/<GI>/<CI>. When MIG
+// is disabled or no instances are created, migDevices returns nil.
+//
+// Vendored NVML bindings have no MIG API, so instances are discovered via
+// NVIDIA capabilities exposed in procfs, the same way nvidia-container-cli does.
+// Device nodes that grant access to GPU and compute instances are located
+// in nvidia-caps directory under devRoot.
+func migDevices(procRoot, devRoot, uuid, path string) ([]*gpu, error) {
+	minor, err := strconv.Atoi(strings.TrimPrefix(filepath.Base(path), "nvidia"))
+	if err != nil {
+		return nil, fmt.Errorf("could not get minor number of %s: %v", path, err)
+	}
+
+	migDir := filepath.Join(procRoot, fmt.Sprintf("gpu%d", minor), "mig")
+	gis, err := instanceIDs(migDir, "gi")
+	if err != nil {
+		return nil, err
+	}
+
+	var devices []*gpu
+	for _, gi := range gis {
+		giDir := filepath.Join(migDir, fmt.Sprintf("gi%d", gi))
+		giMinor, err := capMinor(filepath.Join(giDir, "access"))
+		if err != nil {
+			return nil, fmt.Errorf("could not read GPU instance %d access: %v", gi, err)
+		}
+		cis, err := instanceIDs(giDir, "ci")
+		if err != nil {
+			return nil, err
+		}
+		for _, ci := range cis {
+			ciMinor, err := capMinor(filepath.Join(giDir, fmt.Sprintf("ci%d", ci), "access"))
+			if err != nil {
+				return nil, fmt.Errorf("could not read compute instance %d/%d access: %v", gi, ci, err)
+			}
+			devices = append(devices, &gpu{
+				id:     fmt.Sprintf("MIG-%s/%d/%d", uuid, gi, ci),
+				parent: uuid,
+				paths: []string{
+					path,
+					filepath.Join(devRoot, fmt.Sprintf("nvidia-cap%d", giMinor)),
+					filepath.Join(devRoot, fmt.Sprintf("nvidia-cap%d", ciMinor)),
+				},
+			})
+		}
+	}
+	return devices, nil
+}
+
+// instanceIDs returns sorted IDs of instances found in dir, which are
+// represented by subdirectories named <prefix><ID>. Missing dir is not an error.
+func instanceIDs(dir, prefix string) ([]int, error) {
+	entries, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not read %s: %v", dir, err)
+	}
+
+	var ids []int
+	for _, entry := range entries {
+		if !entry.IsDir() || !strings.HasPrefix(entry.Name(), prefix) {
+			continue
+		}
+		id, err := strconv.Atoi(strings.TrimPrefix(entry.Name(), prefix))
+		if err != nil {
+			continue
+		}
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	return ids, nil
+}
+
+// capMinor reads minor number of nvidia-caps device node from the
+// capability access file which has the following format:
+//
+//	DeviceFileMinor: 12
+//	DeviceFileMode: 292
+//	DeviceFileModify: 1
+func capMinor(path string) (int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		parts := strings.SplitN(scanner.Text(), ":", 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) != "DeviceFileMinor" {
+			continue
+		}
+		return strconv.Atoi(strings.TrimSpace(parts[1]))
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, err
+	}
+	return 0, fmt.Errorf("no device minor found")
+}
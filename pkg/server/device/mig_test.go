@@ -0,0 +1,95 @@
+// Copyright (c) 2018-2019 Sylabs, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package device
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMigDevices(t *testing.T) {
+	root, err := ioutil.TempDir("", "mig-")
+	require.NoError(t, err, "could not create temp dir")
+	defer os.RemoveAll(root)
+
+	files := map[string]string{
+		"gpu0/mig/gi1/access":     "DeviceFileMinor: 12\nDeviceFileMode: 292\n",
+		"gpu0/mig/gi1/ci0/access": "DeviceFileMinor: 13\nDeviceFileMode: 292\n",
+		"gpu0/mig/gi2/access":     "DeviceFileMinor: 21\nDeviceFileMode: 292\n",
+		"gpu0/mig/gi2/ci0/access": "DeviceFileMinor: 22\nDeviceFileMode: 292\n",
+		"gpu0/mig/gi2/ci1/access": "DeviceFileMinor: 23\nDeviceFileMode: 292\n",
+		"gpu1/mig/gi3/access":     "DeviceFileMode: 292\n",
+	}
+	for path, content := range files {
+		path = filepath.Join(root, path)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, ioutil.WriteFile(path, []byte(content), 0644))
+	}
+
+	tt := []struct {
+		name          string
+		path          string
+		expectDevices []*gpu
+		expectError   bool
+	}{
+		{
+			name: "mig enabled",
+			path: "/dev/nvidia0",
+			expectDevices: []*gpu{
+				{
+					id:     "MIG-GPU-0/1/0",
+					parent: "GPU-0",
+					paths:  []string{"/dev/nvidia0", "/dev/nvidia-caps/nvidia-cap12", "/dev/nvidia-caps/nvidia-cap13"},
+				},
+				{
+					id:     "MIG-GPU-0/2/0",
+					parent: "GPU-0",
+					paths:  []string{"/dev/nvidia0", "/dev/nvidia-caps/nvidia-cap21", "/dev/nvidia-caps/nvidia-cap22"},
+				},
+				{
+					id:     "MIG-GPU-0/2/1",
+					parent: "GPU-0",
+					paths:  []string{"/dev/nvidia0", "/dev/nvidia-caps/nvidia-cap21", "/dev/nvidia-caps/nvidia-cap23"},
+				},
+			},
+		},
+		{
+			name:        "broken access file",
+			path:        "/dev/nvidia1",
+			expectError: true,
+		},
+		{
+			name: "mig disabled",
+			path: "/dev/nvidia2",
+		},
+		{
+			name:        "invalid device path",
+			path:        "/dev/nvidiactl",
+			expectError: true,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			devices, err := migDevices(root, "/dev/nvidia-caps", "GPU-0", tc.path)
+			require.Equal(t, tc.expectError, err != nil, "unexpected error: %v", err)
+			require.Equal(t, tc.expectDevices, devices)
+		})
+	}
+}
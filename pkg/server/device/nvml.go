@@ -45,47 +45,335 @@ package device
 
 import (
 	"fmt"
+	"os"
+	"path/filepath"
 	"strings"
+	"sync"
 
 	"github.com/NVIDIA/gpu-monitoring-tools/bindings/go/nvml"
 	"github.com/golang/glog"
+	"github.com/sylabs/singularity-cri/pkg/singularity/runtime"
+	"github.com/sylabs/singularity/pkg/util/nvidia"
+	k8sDP "k8s.io/kubernetes/pkg/kubelet/apis/deviceplugin/v1beta1"
 )
 
-func getDevices() ([]*nvml.Device, error) {
+const nvidiaResourceName = "nvidia.com/gpu"
+
+// nvLibListConf is a Singularity config file that lists NVIDIA libraries and
+// binaries, it is used when nvidia-container-cli is not available.
+const nvLibListConf = "nvliblist.conf"
+
+// singularityConfDirs are common locations of Singularity config directory
+// that are checked in order when it cannot be found out from the build config.
+var singularityConfDirs = []string{
+	"/usr/local/etc/singularity",
+	"/etc/singularity",
+}
+
+// nvidiaBackend manages NVIDIA GPUs via NVML.
+type nvidiaBackend struct {
+	nvLibList string
+
+	mu sync.Mutex
+	// failures holds ECC errors of physical GPUs recorded
+	// when they reported critical XID errors.
+	failures map[string]eccErrors
+}
+
+// eccErrors is a total number of uncorrected volatile ECC errors of a GPU.
+// Volatile counters are cleared when GPU is reset, so comparing them tells
+// whether GPU was reset since critical error.
+type eccErrors struct {
+	supported bool
+	count     uint64
+}
+
+// resetObserved reports whether GPU that had before ECC errors at the moment of
+// critical error was reset since then. When ECC errors are not counted, reset
+// cannot be observed and clean health query is the only evidence of recovery.
+func resetObserved(before, after eccErrors) bool {
+	if !before.supported || !after.supported || before.count == 0 {
+		return true
+	}
+	return after.count < before.count
+}
+
+// loadNVIDIA loads NVML library. Singularity config directory confDir is used
+// to look for NVIDIA files, when empty it is detected automatically.
+func loadNVIDIA(confDir string) (backend, error) {
+	if confDir == "" {
+		confDir = detectConfDir()
+	}
+	nvLibList := filepath.Join(confDir, nvLibListConf)
+	glog.V(3).Infof("Using %s to search NVIDIA files", nvLibList)
+
+	glog.V(1).Infof("Loading NVML")
+	if err := nvml.Init(); err != nil {
+		glog.Errorf("Could not initialize NVML library: %v", err)
+		return nil, ErrUnableToLoad
+	}
+
+	v, err := nvml.GetDriverVersion()
+	if err != nil {
+		glog.Errorf("Could not get driver version: %v", err)
+		nvml.Shutdown()
+		return nil, ErrUnableToLoad
+	}
+	glog.V(1).Infof("Found graphic driver of version %v", v)
+
+	return &nvidiaBackend{
+		nvLibList: nvLibList,
+		failures:  make(map[string]eccErrors),
+	}, nil
+}
+
+// detectConfDir returns Singularity config directory that contains NVIDIA
+// libraries list. Directory from Singularity build config is preferred.
+func detectConfDir() string {
+	candidates := singularityConfDirs
+	config, err := runtime.NewCLIClient().BuildConfig()
+	if err != nil {
+		glog.Warningf("Could not get Singularity build config: %v", err)
+	} else {
+		candidates = append([]string{config.SingularityConfdir}, candidates...)
+	}
+	return findConfDir(candidates)
+}
+
+// findConfDir returns the first of candidates that contains NVIDIA libraries
+// list. If none of them does, the first candidate is returned.
+func findConfDir(candidates []string) string {
+	for _, dir := range candidates {
+		if _, err := os.Stat(filepath.Join(dir, nvLibListConf)); err == nil {
+			return dir
+		}
+	}
+	glog.Warningf("Could not find %s in any of %v", nvLibListConf, candidates)
+	return candidates[0]
+}
+
+func (*nvidiaBackend) resourceName() string {
+	return nvidiaResourceName
+}
+
+func (*nvidiaBackend) devices() ([]*gpu, error) {
 	n, err := nvml.GetDeviceCount()
 	if err != nil {
+		nvmlErrorsMetric.Inc()
 		return nil, fmt.Errorf("could not get GPU count: %v", err)
 	}
 
-	devices := make([]*nvml.Device, n)
+	devices := make([]*gpu, 0, n)
 	for i := uint(0); i < n; i++ {
 		d, err := nvml.NewDeviceLite(i)
 		if err != nil {
+			nvmlErrorsMetric.Inc()
 			return nil, fmt.Errorf("could not get device #%d: %v", i, err)
 		}
-		devices[i] = d
+
+		migs, err := migDevices(nvidiaCapsProc, nvidiaCapsDev, d.UUID, d.Path)
+		if err != nil {
+			return nil, fmt.Errorf("could not get MIG devices of %s: %v", d.UUID, err)
+		}
+		if len(migs) != 0 {
+			glog.V(1).Infof("Found %d MIG devices on %s", len(migs), d.UUID)
+			devices = append(devices, migs...)
+			continue
+		}
+		devices = append(devices, &gpu{
+			id:    d.UUID,
+			paths: []string{d.Path},
+		})
 	}
 
 	return devices, nil
 }
 
+// probe checks that GPU went through reset after XID critical error. GPU must be
+// visible to NVML, its device nodes must be present, it must be possible to
+// subscribe for its critical errors, which fails for lost GPUs, and its status
+// must be queried cleanly. When GPU counts ECC errors, its volatile counters
+// must be cleared by reset as well.
+func (b *nvidiaBackend) probe(device *gpu) error {
+	uuid := device.id
+	if device.parent != "" {
+		uuid = device.parent
+	}
+	for _, path := range device.paths {
+		if _, err := os.Stat(path); err != nil {
+			return err
+		}
+	}
+
+	d, err := deviceByUUID(uuid)
+	if err != nil {
+		return err
+	}
+	eventSet := nvml.NewEventSet()
+	defer nvml.DeleteEventSet(eventSet)
+	err = nvml.RegisterEventForDevice(eventSet, nvml.XidCriticalError, uuid)
+	if err != nil {
+		nvmlErrorsMetric.Inc()
+		return fmt.Errorf("could not subscribe for events: %v", err)
+	}
+	ecc, err := queryECCErrors(d)
+	if err != nil {
+		nvmlErrorsMetric.Inc()
+		return fmt.Errorf("could not query device status: %v", err)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !resetObserved(b.failures[uuid], ecc) {
+		return fmt.Errorf("device has not been reset since critical error")
+	}
+	delete(b.failures, uuid)
+	return nil
+}
+
+// recordFailure saves ECC errors of GPU with the passed UUID that reported
+// critical error, unless they are already recorded for an earlier error.
+func (b *nvidiaBackend) recordFailure(uuid string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, ok := b.failures[uuid]; ok {
+		return
+	}
+	var ecc eccErrors
+	d, err := deviceByUUID(uuid)
+	if err == nil {
+		ecc, err = queryECCErrors(d)
+	}
+	if err != nil {
+		glog.Warningf("Could not query ECC errors of %s: %v", uuid, err)
+	}
+	b.failures[uuid] = ecc
+}
+
+// deviceByUUID returns GPU with the passed UUID.
+func deviceByUUID(uuid string) (*nvml.Device, error) {
+	n, err := nvml.GetDeviceCount()
+	if err != nil {
+		nvmlErrorsMetric.Inc()
+		return nil, fmt.Errorf("could not get GPU count: %v", err)
+	}
+	for i := uint(0); i < n; i++ {
+		d, err := nvml.NewDeviceLite(i)
+		if err == nil && d.UUID == uuid {
+			return d, nil
+		}
+	}
+	return nil, fmt.Errorf("device is not found")
+}
+
+// queryECCErrors queries full status of the passed GPU, which fails
+// for GPUs that are not usable, and returns its ECC errors.
+func queryECCErrors(d *nvml.Device) (eccErrors, error) {
+	status, err := d.Status()
+	if err != nil {
+		return eccErrors{}, err
+	}
+	var ecc eccErrors
+	for _, count := range []*uint64{
+		status.Memory.ECCErrors.L1Cache,
+		status.Memory.ECCErrors.L2Cache,
+		status.Memory.ECCErrors.Device,
+	} {
+		if count != nil {
+			ecc.supported = true
+			ecc.count += *count
+		}
+	}
+	return ecc, nil
+}
+
+func (b *nvidiaBackend) allocate(devices []*gpu) (*k8sDP.ContainerAllocateResponse, error) {
+	nvLibs, nvBins, err := nvidia.Paths(b.nvLibList, "")
+	if err != nil {
+		return nil, fmt.Errorf("could not search NVIDIA files: %v", err)
+	}
+	glog.V(4).Infof("NVIDIA paths are %v and %v", nvLibs, nvBins)
+
+	nvDevs, err := nvidia.Devices(false)
+	if err != nil {
+		return nil, fmt.Errorf("could not search NVIDIA complementary devices: %v", err)
+	}
+	glog.V(4).Infof("NVIDIA complementary devices are %v", nvDevs)
+
+	nvidiaMounts := make([]*k8sDP.Mount, 0, len(nvLibs)+len(nvBins))
+	for _, libPath := range nvLibs {
+		nvidiaMounts = append(nvidiaMounts, &k8sDP.Mount{
+			ContainerPath: libPath,
+			HostPath:      libPath,
+			ReadOnly:      true,
+		})
+	}
+	for _, binPath := range nvBins {
+		nvidiaMounts = append(nvidiaMounts, &k8sDP.Mount{
+			ContainerPath: binPath,
+			HostPath:      binPath,
+			ReadOnly:      true,
+		})
+	}
+
+	// MIG devices of the same GPU share its device node
+	paths := nvDevs
+	seen := make(map[string]bool)
+	for _, device := range devices {
+		for _, path := range device.paths {
+			if !seen[path] {
+				seen[path] = true
+				paths = append(paths, path)
+			}
+		}
+	}
+	nvidiaDevices := deviceSpecs(paths...)
+	return &k8sDP.ContainerAllocateResponse{
+		Mounts:  nvidiaMounts,
+		Devices: nvidiaDevices,
+	}, nil
+}
+
+func (*nvidiaBackend) shutdown() error {
+	return nvml.Shutdown()
+}
+
 const (
 	errGPUMemoryPageFault   = 31
 	errGPUStoppedProcessing = 43
 	errPreemptiveCleanup    = 45
 )
 
-func monitorGPUs(done <-chan struct{}, devIDs []string) (<-chan string, error) {
-	ill := make(chan string, len(devIDs))
+func (b *nvidiaBackend) monitor(done <-chan struct{}, devices []*gpu) (<-chan string, error) {
+	// events are reported for physical GPUs only, so collect
+	// all devices that are affected by a physical GPU failure
+	var devIDs []string
+	affected := make(map[string][]string)
+	for _, dev := range devices {
+		physID := dev.id
+		if dev.parent != "" {
+			physID = dev.parent
+		}
+		if _, ok := affected[physID]; !ok {
+			devIDs = append(devIDs, physID)
+		}
+		affected[physID] = append(affected[physID], dev.id)
+	}
+
+	ill := make(chan string, len(devices))
 	eventSet := nvml.NewEventSet()
 	for _, devID := range devIDs {
 		err := nvml.RegisterEventForDevice(eventSet, nvml.XidCriticalError, devID)
 		if err != nil && strings.HasSuffix(err.Error(), "Not Supported") {
 			glog.Warningf("Healthcheck is not supported for %s, marking it unhealthy", devID)
-			ill <- devID
+			for _, id := range affected[devID] {
+				ill <- id
+			}
 			continue
 		}
 		if err != nil {
+			nvmlErrorsMetric.Inc()
 			nvml.DeleteEventSet(eventSet)
 			return nil, fmt.Errorf("could not subscribe for %s events: %v", devID, err)
 		}
@@ -100,10 +388,12 @@ func monitorGPUs(done <-chan struct{}, devIDs []string) (<-chan string, error) {
 				return
 			default:
 				event, err := nvml.WaitForEvent(eventSet, 5000)
+				healthChecked()
 				if err != nil && strings.Contains(err.Error(), "Timeout") {
 					continue
 				}
 				if err != nil {
+					nvmlErrorsMetric.Inc()
 					glog.Errorf("Could not wait for event: %v", err)
 					continue
 				}
@@ -119,11 +409,17 @@ func monitorGPUs(done <-chan struct{}, devIDs []string) (<-chan string, error) {
 				if event.UUID == nil || len(*event.UUID) == 0 {
 					// All devices are unhealthy
 					for _, devID := range devIDs {
-						ill <- devID
+						b.recordFailure(devID)
+					}
+					for _, dev := range devices {
+						ill <- dev.id
 					}
 					continue
 				}
-				ill <- *event.UUID
+				b.recordFailure(*event.UUID)
+				for _, id := range affected[*event.UUID] {
+					ill <- id
+				}
 			}
 		}
 	}()
@@ -0,0 +1,110 @@
+// Copyright (c) 2018-2019 Sylabs, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package device
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFindConfDir(t *testing.T) {
+	root, err := ioutil.TempDir("", "sing-conf-")
+	require.NoError(t, err, "could not create temp dir")
+	defer os.RemoveAll(root)
+
+	local := filepath.Join(root, "usr/local/etc/singularity")
+	etc := filepath.Join(root, "etc/singularity")
+	require.NoError(t, os.MkdirAll(local, 0755))
+	require.NoError(t, os.MkdirAll(etc, 0755))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(etc, nvLibListConf), nil, 0644))
+
+	tt := []struct {
+		name       string
+		candidates []string
+		expectDir  string
+	}{
+		{
+			name:       "first has no list",
+			candidates: []string{local, etc},
+			expectDir:  etc,
+		},
+		{
+			name:       "first has list",
+			candidates: []string{etc, local},
+			expectDir:  etc,
+		},
+		{
+			name:       "none has list",
+			candidates: []string{local, filepath.Join(root, "opt")},
+			expectDir:  local,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			require.Equal(t, tc.expectDir, findConfDir(tc.candidates))
+		})
+	}
+}
+
+func TestResetObserved(t *testing.T) {
+	tt := []struct {
+		name   string
+		before eccErrors
+		after  eccErrors
+		expect bool
+	}{
+		{
+			name:   "counters cleared",
+			before: eccErrors{supported: true, count: 3},
+			after:  eccErrors{supported: true, count: 0},
+			expect: true,
+		},
+		{
+			name:   "counters kept",
+			before: eccErrors{supported: true, count: 3},
+			after:  eccErrors{supported: true, count: 3},
+			expect: false,
+		},
+		{
+			name:   "counters grown",
+			before: eccErrors{supported: true, count: 3},
+			after:  eccErrors{supported: true, count: 5},
+			expect: false,
+		},
+		{
+			name:   "no errors before failure",
+			before: eccErrors{supported: true},
+			after:  eccErrors{supported: true},
+			expect: true,
+		},
+		{
+			name:   "not supported",
+			before: eccErrors{},
+			after:  eccErrors{},
+			expect: true,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			require.Equal(t, tc.expect, resetObserved(tc.before, tc.after))
+		})
+	}
+}
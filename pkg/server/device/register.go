@@ -53,13 +53,11 @@ import (
 	k8sDP "k8s.io/kubernetes/pkg/kubelet/apis/deviceplugin/v1beta1"
 )
 
-const resourceName = "nvidia.com/gpu"
-
 // RegisterInKubelet registers Singularity device plugin that is
-// listening on socket in kubelet.
-func RegisterInKubelet(socket string) error {
+// listening on socket in kubelet as a provider of resourceName.
+func RegisterInKubelet(socket, resourceName string) error {
 	for attempt := 1; attempt < 5; attempt++ {
-		err := register(socket)
+		err := register(socket, resourceName)
 		if err != nil {
 			glog.Errorf("Device plugin registration failed: %v", err)
 			timeout := time.Second * time.Duration(attempt*2)
@@ -72,7 +70,7 @@ func RegisterInKubelet(socket string) error {
 	return fmt.Errorf("failed to register in kubelet")
 }
 
-func register(socket string) error {
+func register(socket, resourceName string) error {
 	conn, err := grpc.Dial("unix://"+k8sDP.KubeletSocket, grpc.WithInsecure())
 	if err != nil {
 		return fmt.Errorf("could not dial kubelet: %v", err)
@@ -0,0 +1,204 @@
+// Copyright (c) 2018-2019 Sylabs, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package device
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+	k8sDP "k8s.io/kubernetes/pkg/kubelet/apis/deviceplugin/v1beta1"
+)
+
+const (
+	rocmResourceName = "amd.com/gpu"
+	rocmKFDDevice    = "/dev/kfd"
+
+	rocmHealthCheckInterval = time.Second * 5
+)
+
+// rocmBackend manages AMD GPUs via ROCm kernel fusion driver (KFD).
+type rocmBackend struct {
+	// sysfs is a root of sysfs, overridden in tests.
+	sysfs string
+	// dev is a root of device nodes, overridden in tests.
+	dev string
+}
+
+func loadROCm() (backend, error) {
+	b := &rocmBackend{
+		sysfs: "/sys",
+		dev:   "/dev",
+	}
+	if _, err := os.Stat(b.kfd()); err != nil {
+		glog.Errorf("Could not find ROCm kernel driver: %v", err)
+		return nil, ErrUnableToLoad
+	}
+	glog.V(1).Infof("Found ROCm kernel driver")
+	return b, nil
+}
+
+func (b *rocmBackend) kfd() string {
+	return filepath.Join(b.dev, filepath.Base(rocmKFDDevice))
+}
+
+func (*rocmBackend) resourceName() string {
+	return rocmResourceName
+}
+
+// devices walks KFD topology to find GPU nodes. CPU nodes are
+// also present in topology, but they have no SIMD units.
+func (b *rocmBackend) devices() ([]*gpu, error) {
+	nodesDir := filepath.Join(b.sysfs, "class/kfd/kfd/topology/nodes")
+	nodes, err := ioutil.ReadDir(nodesDir)
+	if err != nil {
+		return nil, fmt.Errorf("could not read KFD topology: %v", err)
+	}
+
+	var devices []*gpu
+	for _, node := range nodes {
+		props, err := readKFDProperties(filepath.Join(nodesDir, node.Name(), "properties"))
+		if err != nil {
+			return nil, fmt.Errorf("could not read node %s properties: %v", node.Name(), err)
+		}
+		if props["simd_count"] == 0 {
+			continue
+		}
+
+		id := props["unique_id"]
+		if id == 0 {
+			id = props["gpu_id"]
+		}
+		minor := props["drm_render_minor"]
+		paths := []string{filepath.Join(b.dev, "dri", fmt.Sprintf("renderD%d", minor))}
+		card, err := b.drmCard(minor)
+		if err != nil {
+			glog.Warningf("Could not find DRM card for render node %d: %v", minor, err)
+		} else {
+			paths = append(paths, card)
+		}
+		devices = append(devices, &gpu{
+			id:    strconv.FormatUint(id, 10),
+			paths: paths,
+		})
+	}
+	return devices, nil
+}
+
+// drmCard returns path to the card device node that belongs
+// to the same GPU as render node with the passed minor number.
+func (b *rocmBackend) drmCard(renderMinor uint64) (string, error) {
+	drmDir := filepath.Join(b.sysfs, "class/drm", fmt.Sprintf("renderD%d", renderMinor), "device/drm")
+	entries, err := ioutil.ReadDir(drmDir)
+	if err != nil {
+		return "", err
+	}
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), "card") {
+			return filepath.Join(b.dev, "dri", entry.Name()), nil
+		}
+	}
+	return "", fmt.Errorf("no card in %s", drmDir)
+}
+
+// monitor periodically checks that device nodes of passed
+// GPUs are present on the host. ROCm kernel driver doesn't provide
+// any event API similar to NVML so polling is the best we can do.
+func (b *rocmBackend) monitor(done <-chan struct{}, devices []*gpu) (<-chan string, error) {
+	ill := make(chan string, len(devices))
+	go func() {
+		ticker := time.NewTicker(rocmHealthCheckInterval)
+		defer ticker.Stop()
+
+		reported := make(map[string]bool, len(devices))
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				healthChecked()
+				for _, dev := range devices {
+					err := b.probe(dev)
+					if err == nil {
+						// device may be reported again once it's recovered
+						reported[dev.id] = false
+						continue
+					}
+					if !reported[dev.id] {
+						glog.Errorf("Device %s is unavailable: %v", dev.id, err)
+						reported[dev.id] = true
+						ill <- dev.id
+					}
+				}
+			}
+		}
+	}()
+	return ill, nil
+}
+
+// probe checks that all device nodes of the passed GPU are present.
+func (*rocmBackend) probe(device *gpu) error {
+	for _, path := range device.paths {
+		if _, err := os.Stat(path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (b *rocmBackend) allocate(devices []*gpu) (*k8sDP.ContainerAllocateResponse, error) {
+	specs := deviceSpecs(b.kfd())
+	for _, device := range devices {
+		specs = append(specs, deviceSpecs(device.paths...)...)
+	}
+	return &k8sDP.ContainerAllocateResponse{
+		Devices: specs,
+	}, nil
+}
+
+func (*rocmBackend) shutdown() error {
+	return nil
+}
+
+// readKFDProperties parses KFD topology node properties file
+// which consists of lines in form of "<name> <value>".
+func readKFDProperties(path string) (map[string]uint64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	props := make(map[string]uint64)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 {
+			continue
+		}
+		v, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		props[fields[0]] = v
+	}
+	return props, scanner.Err()
+}
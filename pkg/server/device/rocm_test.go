@@ -0,0 +1,81 @@
+// Copyright (c) 2018-2019 Sylabs, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package device
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	k8sDP "k8s.io/kubernetes/pkg/kubelet/apis/deviceplugin/v1beta1"
+)
+
+func TestROCmBackend(t *testing.T) {
+	root, err := ioutil.TempDir("", "rocm-")
+	require.NoError(t, err, "could not create temp dir")
+	defer os.RemoveAll(root)
+
+	files := map[string]string{
+		"sys/class/kfd/kfd/topology/nodes/0/properties":  "cpu_cores_count 8\nsimd_count 0\ngpu_id 0\n",
+		"sys/class/kfd/kfd/topology/nodes/1/properties":  "simd_count 256\ngpu_id 4242\nunique_id 1234567\ndrm_render_minor 128\n",
+		"sys/class/kfd/kfd/topology/nodes/2/properties":  "simd_count 256\ngpu_id 4343\ndrm_render_minor 129\n",
+		"sys/class/drm/renderD128/device/drm/card0":      "",
+		"sys/class/drm/renderD128/device/drm/renderD128": "",
+	}
+	for path, content := range files {
+		path = filepath.Join(root, path)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, ioutil.WriteFile(path, []byte(content), 0644))
+	}
+
+	b := &rocmBackend{
+		sysfs: filepath.Join(root, "sys"),
+		dev:   filepath.Join(root, "dev"),
+	}
+	devices, err := b.devices()
+	require.NoError(t, err)
+	require.Equal(t, []*gpu{
+		{
+			id: "1234567",
+			paths: []string{
+				filepath.Join(root, "dev/dri/renderD128"),
+				filepath.Join(root, "dev/dri/card0"),
+			},
+		},
+		{
+			id:    "4343",
+			paths: []string{filepath.Join(root, "dev/dri/renderD129")},
+		},
+	}, devices)
+
+	resp, err := b.allocate(devices[1:])
+	require.NoError(t, err)
+	require.Equal(t, &k8sDP.ContainerAllocateResponse{
+		Devices: []*k8sDP.DeviceSpec{
+			{
+				ContainerPath: filepath.Join(root, "dev/kfd"),
+				HostPath:      filepath.Join(root, "dev/kfd"),
+				Permissions:   "rw",
+			},
+			{
+				ContainerPath: filepath.Join(root, "dev/dri/renderD129"),
+				HostPath:      filepath.Join(root, "dev/dri/renderD129"),
+				Permissions:   "rw",
+			},
+		},
+	}, resp)
+}
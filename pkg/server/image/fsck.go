@@ -0,0 +1,103 @@
+// Copyright (c) 2018-2019 Sylabs, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package image
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/golang/glog"
+	"github.com/sylabs/singularity-cri/pkg/image"
+	"github.com/sylabs/singularity-cri/pkg/singularity"
+)
+
+// FsckReport describes inconsistencies between registered
+// images and files found in storage directory.
+type FsckReport struct {
+	// Missing are IDs of images that were removed from
+	// registry since their files are missing.
+	Missing []string `json:"missing"`
+	// Reindexed are IDs of SIF images that were found in storage
+	// directory and added to registry without any references.
+	Reindexed []string `json:"reindexed"`
+	// Orphans are paths of files in storage directory that are
+	// not registered and cannot be added to registry, e.g. leftovers
+	// of interrupted pulls. They are not removed automatically.
+	Orphans []string `json:"orphans"`
+}
+
+// Fsck reconciles registry with files in storage directory. Images which files
+// are missing are removed from registry. Unregistered SIF images which names
+// match their checksums, i.e. ones pulled earlier, are added back to registry,
+// so that they are visible to kubelet and may be garbage collected. Other
+// unregistered files are reported only.
+func (s *SingularityRegistry) Fsck() (*FsckReport, error) {
+	var report FsckReport
+	known := make(map[string]bool)
+	var images []*image.Info
+	s.images.Iterate(func(info *image.Info) {
+		images = append(images, info)
+	})
+	for _, info := range images {
+		if info.Ref.URI() == singularity.LocalFileDomain {
+			continue
+		}
+		_, err := os.Stat(info.Path)
+		if err == nil {
+			known[info.Path] = true
+			continue
+		}
+		if !os.IsNotExist(err) {
+			return nil, fmt.Errorf("could not check image %s: %v", info.ID, err)
+		}
+		glog.Warningf("Image %s file %s is missing, removing it from registry", info.ID, info.Path)
+		if err := s.images.Remove(info.ID); err != nil {
+			return nil, fmt.Errorf("could not remove image %s: %v", info.ID, err)
+		}
+		report.Missing = append(report.Missing, info.ID)
+	}
+
+	fii, err := ioutil.ReadDir(s.storage)
+	if err != nil {
+		return nil, fmt.Errorf("could not read storage directory: %v", err)
+	}
+	for _, fi := range fii {
+		path := filepath.Join(s.storage, fi.Name())
+		if known[path] || !fi.Mode().IsRegular() || isRegistryFile(fi.Name()) {
+			continue
+		}
+		info, err := image.ReadInfo(path)
+		if err != nil || info.ID != fi.Name() {
+			glog.Warningf("Found unregistered file %s in storage directory", path)
+			report.Orphans = append(report.Orphans, path)
+			continue
+		}
+		if err := s.images.Add(info); err != nil {
+			return nil, fmt.Errorf("could not register image %s: %v", path, err)
+		}
+		glog.Infof("Registered image %s found in storage directory", info.ID)
+		report.Reindexed = append(report.Reindexed, info.ID)
+	}
+	return &report, nil
+}
+
+// isRegistryFile checks whether file with passed name belongs to
+// registry backup, including journal and temporary files.
+func isRegistryFile(name string) bool {
+	return strings.HasPrefix(strings.TrimPrefix(name, "."), registryInfoFile)
+}
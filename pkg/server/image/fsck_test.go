@@ -0,0 +1,70 @@
+// Copyright (c) 2018-2019 Sylabs, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package image
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/sylabs/singularity-cri/pkg/image"
+	"github.com/sylabs/singularity-cri/pkg/index"
+)
+
+func TestSingularityRegistry_Fsck(t *testing.T) {
+	storage, err := ioutil.TempDir("", "fsck")
+	require.NoError(t, err, "could not create temp storage directory")
+	defer os.RemoveAll(storage)
+
+	write := func(name string) string {
+		path := filepath.Join(storage, name)
+		require.NoError(t, ioutil.WriteFile(path, []byte(name), 0644))
+		return path
+	}
+	write(registryInfoFile)
+	write(registryInfoFile + ".wal")
+	partial := write(".3f8e4a17b6c1d0e3f8e4a17b6c1d0e3f")
+	present := write("present")
+
+	images := index.NewImageIndex()
+	add := func(id, ref, path string) {
+		r, err := image.ParseRef(ref)
+		require.NoError(t, err)
+		require.NoError(t, images.Add(&image.Info{ID: id, Ref: r, Path: path}))
+	}
+	add("present", "busybox:1.28", present)
+	add("missing", "nginx:latest", filepath.Join(storage, "missing"))
+	add("local", "local.file/tmp/missing.sif", "/tmp/missing.sif")
+
+	registry := &SingularityRegistry{
+		storage: storage,
+		images:  images,
+	}
+	report, err := registry.Fsck()
+	require.NoError(t, err)
+	require.Equal(t, &FsckReport{
+		Missing: []string{"missing"},
+		Orphans: []string{partial},
+	}, report)
+
+	_, err = images.Find("missing")
+	require.Equal(t, index.ErrNotFound, err)
+	_, err = images.Find("present")
+	require.NoError(t, err)
+	_, err = images.Find("local")
+	require.NoError(t, err)
+}
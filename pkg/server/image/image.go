@@ -18,42 +18,96 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strconv"
 	"strings"
-	"sync"
 	"time"
 
 	"github.com/golang/glog"
 	"github.com/sylabs/singularity-cri/pkg/fs"
 	"github.com/sylabs/singularity-cri/pkg/image"
 	"github.com/sylabs/singularity-cri/pkg/index"
+	"github.com/sylabs/singularity-cri/pkg/journal"
 	"github.com/sylabs/singularity-cri/pkg/singularity"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 	k8s "k8s.io/kubernetes/pkg/kubelet/apis/cri/runtime/v1alpha2"
 )
 
-const registryInfoFile = "registry.json"
+const (
+	registryInfoFile = "registry.json"
+
+	// scratchDirName is a name of directory inside image storage that
+	// temporary files of pulls are created in by default.
+	scratchDirName = "tmp"
+
+	// indexEventsBuffer is a number of image index events
+	// that may be queued before they are recorded.
+	indexEventsBuffer = 16
+)
 
 // SingularityRegistry implements k8s ImageService interface.
 type SingularityRegistry struct {
-	storage string // path to image storage without trailing slash
-	images  *index.ImageIndex
+	storage    string // path to image storage without trailing slash
+	scratchDir string
+	images     *index.ImageIndex
+	journal    *journal.Journal
+
+	layerCache     *image.LayerCache
+	libraryCache   *image.LibraryCache
+	definitionDirs []string
+
+	stopWatch func()
+	watchDone chan struct{}
+}
 
-	m        sync.Mutex
-	infoFile *os.File
+// Option is run during SingularityRegistry initialization.
+type Option func(s *SingularityRegistry)
+
+// WithLayerCache makes images pulled from docker registries reuse OCI
+// blobs cached in c, which is pruned after each pull. When c is nil,
+// images are built from scratch.
+func WithLayerCache(c *image.LayerCache) Option {
+	return func(s *SingularityRegistry) {
+		s.layerCache = c
+	}
+}
+
+// WithScratchDir makes temporary files of pulls be created in dir, e.g. on a
+// volume other than image storage. When dir is empty, tmp directory inside
+// image storage is used. Leftovers of interrupted pulls are removed from
+// dir on startup.
+func WithScratchDir(dir string) Option {
+	return func(s *SingularityRegistry) {
+		s.scratchDir = dir
+	}
+}
+
+// WithLibraryCache makes library image metadata be looked up in c
+// before the library is queried. When c is nil, library is always queried.
+func WithLibraryCache(c *image.LibraryCache) Option {
+	return func(s *SingularityRegistry) {
+		s.libraryCache = c
+	}
+}
+
+// WithDefinitionDirs allows images to be built on the node from Singularity
+// definition files located in passed dirs, see singularity.LocalDefinitionDomain.
+// When dirs are empty, such images cannot be pulled.
+func WithDefinitionDirs(dirs []string) Option {
+	return func(s *SingularityRegistry) {
+		s.definitionDirs = dirs
+	}
 }
 
 // NewSingularityRegistry initializes and returns SingularityRuntime.
 // Singularity must be installed on the host otherwise it will return an error.
-func NewSingularityRegistry(storePath string, index *index.ImageIndex) (*SingularityRegistry, error) {
-	_, err := exec.LookPath(singularity.RuntimeName)
+func NewSingularityRegistry(storePath string, index *index.ImageIndex, opts ...Option) (*SingularityRegistry, error) {
+	_, err := exec.LookPath(singularity.BinaryPath())
 	if err != nil {
-		return nil, fmt.Errorf("could not find %s on this machine: %v", singularity.RuntimeName, err)
+		return nil, fmt.Errorf("could not find %s on this machine: %v", singularity.BinaryPath(), err)
 	}
 
 	storePath, err = filepath.Abs(storePath)
@@ -65,11 +119,23 @@ func NewSingularityRegistry(storePath string, index *index.ImageIndex) (*Singula
 		storage: storePath,
 		images:  index,
 	}
+	for _, opt := range opts {
+		opt(&registry)
+	}
 
 	if err := os.MkdirAll(storePath, 0755); err != nil {
 		return nil, fmt.Errorf("could not create storage directory: %v", err)
 	}
-	registry.infoFile, err = os.OpenFile(filepath.Join(storePath, registryInfoFile), os.O_CREATE|os.O_RDWR, 0644)
+	if registry.scratchDir == "" {
+		registry.scratchDir = filepath.Join(storePath, scratchDirName)
+	}
+	if err := os.MkdirAll(registry.scratchDir, 0700); err != nil {
+		return nil, fmt.Errorf("could not create scratch directory: %v", err)
+	}
+	if err := image.CleanScratchDir(registry.scratchDir); err != nil {
+		glog.Errorf("Could not clean scratch directory: %v", err)
+	}
+	registry.journal, err = journal.Open(filepath.Join(storePath, registryInfoFile))
 	if err != nil {
 		return nil, fmt.Errorf("could not open registry backup file: %v", err)
 	}
@@ -77,16 +143,26 @@ func NewSingularityRegistry(storePath string, index *index.ImageIndex) (*Singula
 	if err != nil {
 		return nil, err
 	}
+	if _, err := registry.Fsck(); err != nil {
+		glog.Errorf("Could not check storage directory consistency: %v", err)
+	}
+	if err = registry.dumpInfo(); err != nil {
+		return nil, fmt.Errorf("could not compact registry backup file: %v", err)
+	}
+
+	events, stopWatch := registry.images.Watch(indexEventsBuffer)
+	registry.stopWatch = stopWatch
+	registry.watchDone = make(chan struct{})
+	go registry.recordEvents(events)
 	return &registry, nil
 }
 
 // Shutdown should be called whenever SingularityRegistry is no longer
 // used to make sure allocated resources are freed.
 func (s *SingularityRegistry) Shutdown() error {
-	s.m.Lock()
-	defer s.m.Unlock()
-
-	if err := s.infoFile.Close(); err != nil {
+	s.stopWatch()
+	<-s.watchDone
+	if err := s.journal.Close(); err != nil {
 		return fmt.Errorf("could not close infoFile: %v", err)
 	}
 	return nil
@@ -99,7 +175,7 @@ func (s *SingularityRegistry) PullImage(ctx context.Context, req *k8s.PullImageR
 		return nil, status.Errorf(codes.InvalidArgument, "could not parse image reference: %v", err)
 	}
 
-	info, err := image.LibraryInfo(ctx, ref, req.GetAuth())
+	info, err := s.libraryInfo(ctx, ref, req.GetAuth())
 	if err == image.ErrNotFound {
 		return nil, status.Errorf(codes.NotFound, "image %s is not found", ref)
 	}
@@ -107,19 +183,54 @@ func (s *SingularityRegistry) PullImage(ctx context.Context, req *k8s.PullImageR
 		return nil, status.Errorf(codes.Internal, "could not get %s image metadata: %v", ref, err)
 	}
 	if info != nil {
-		_, err := s.images.Find(info.Sha256)
+		found, err := s.images.Find(info.Sha256)
 		if err == nil {
 			glog.V(2).Infof("Image %s is already present with the same checksum, skipping pull", ref)
-			return &k8s.PullImageResponse{
-				ImageRef: info.ID,
-			}, nil
+			return s.tagImage(found, ref)
+		}
+	}
+
+	if checksum := ref.Checksum(); checksum != "" {
+		found, err := s.images.Find(checksum)
+		if err == nil {
+			glog.V(2).Infof("Image %s is already present with the same checksum, skipping pull", ref)
+			return s.tagImage(found, ref)
+		}
+	}
+
+	digest, err := image.DockerDigest(ctx, ref, req.GetAuth())
+	if err != nil && err != image.ErrNotDocker {
+		glog.Warningf("Could not get %s image digest: %v", ref, err)
+	}
+	if digest != "" {
+		found, err := s.images.Find(digest)
+		if err == nil {
+			glog.V(2).Infof("Image %s is already present with the same digest, skipping pull", ref)
+			return s.tagImage(found, ref)
+		}
+	}
+
+	var definition string
+	if path := ref.DefinitionPath(); path != "" {
+		definition, err = s.checkDefinition(path)
+		if err != nil {
+			return nil, status.Errorf(codes.PermissionDenied, "could not build image: %v", err)
 		}
 	}
 
-	info, err = image.Pull(ctx, s.storage, ref, req.GetAuth())
+	pullStart := time.Now()
+	info, err = image.Pull(ctx, s.storage, ref, req.GetAuth(), image.WithLayerCache(s.layerCache),
+		image.WithDigest(digest), image.WithScratchDir(s.scratchDir), image.WithDefinitionPath(definition))
+	if s.layerCache != nil {
+		if err := s.layerCache.Prune(); err != nil {
+			glog.Errorf("Could not prune layer cache: %v", err)
+		}
+	}
 	if err != nil {
 		return nil, status.Errorf(codes.Internal, "could not pull image: %v", err)
 	}
+	pullDurationMetric.Observe(time.Since(pullStart).Seconds())
+	pullSizeMetric.Observe(float64(info.Size))
 	if err := info.Verify(); err != nil {
 		info.Remove()
 		return nil, status.Errorf(codes.InvalidArgument, "could not verify image: %v", err)
@@ -128,14 +239,30 @@ func (s *SingularityRegistry) PullImage(ctx context.Context, req *k8s.PullImageR
 		info.Remove()
 		return nil, status.Errorf(codes.Internal, "could not index image: %v", err)
 	}
-	if err = s.dumpInfo(); err != nil {
-		glog.Errorf("Could not dump registry info: %v", err)
-	}
 	return &k8s.PullImageResponse{
 		ImageRef: info.ID,
 	}, nil
 }
 
+// libraryInfo returns info about library image using library cache when it is set.
+func (s *SingularityRegistry) libraryInfo(ctx context.Context, ref *image.Reference, auth *k8s.AuthConfig) (*image.Info, error) {
+	if s.libraryCache != nil {
+		return s.libraryCache.Info(ctx, ref, auth)
+	}
+	return image.LibraryInfo(ctx, ref, auth)
+}
+
+// tagImage makes ref point to already pulled image found, e.g. when
+// a new tag of the same image is pulled, so that no rebuild is needed.
+func (s *SingularityRegistry) tagImage(found *image.Info, ref *image.Reference) (*k8s.PullImageResponse, error) {
+	if err := s.images.Add(&image.Info{ID: found.ID, Ref: ref}); err != nil {
+		return nil, status.Errorf(codes.Internal, "could not index image: %v", err)
+	}
+	return &k8s.PullImageResponse{
+		ImageRef: found.ID,
+	}, nil
+}
+
 // RemoveImage removes the image.
 // This call is idempotent, and does not return an error if the image has already been removed.
 func (s *SingularityRegistry) RemoveImage(ctx context.Context, req *k8s.RemoveImageRequest) (*k8s.RemoveImageResponse, error) {
@@ -156,9 +283,6 @@ func (s *SingularityRegistry) RemoveImage(ctx context.Context, req *k8s.RemoveIm
 	if err := s.images.Remove(info.ID); err != nil {
 		return nil, status.Errorf(codes.Internal, "could not remove image from index: %v", err)
 	}
-	if err = s.dumpInfo(); err != nil {
-		glog.Errorf("Could not dump registry info: %v", err)
-	}
 	return &k8s.RemoveImageResponse{}, nil
 }
 
@@ -178,53 +302,71 @@ func (s *SingularityRegistry) ImageStatus(ctx context.Context, req *k8s.ImageSta
 		verboseInfo = map[string]string{
 			"usedBy": fmt.Sprintf("%v", info.UsedBy()),
 		}
-	}
-
-	var uid *k8s.Int64Value
-	var username string
-	if info.OciConfig != nil && info.OciConfig.User != "" {
-		// If conf.User is not empty, possible options are:
-		//     * "user"
-		//     * "uid"
-		//     * "user:group"
-		//     * "uid:gid
-		//     * "user:gid"
-		//     * "uid:group"
-		user := strings.Split(info.OciConfig.User, ":")[0]
-		userID, err := strconv.ParseInt(user, 10, 32)
+		meta, err := image.ReadSIFMetadata(info.Path)
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "could not read image metadata: %v", err)
+		}
+		data, err := json.Marshal(meta)
 		if err != nil {
-			username = user
-		} else {
-			uid = &k8s.Int64Value{
-				Value: userID,
+			return nil, status.Errorf(codes.Internal, "could not encode image metadata: %v", err)
+		}
+		verboseInfo["sif"] = string(data)
+		if info.OciConfig != nil {
+			data, err := json.Marshal(info.OciConfig)
+			if err != nil {
+				return nil, status.Errorf(codes.Internal, "could not encode OCI config: %v", err)
 			}
+			verboseInfo["ociConfig"] = string(data)
 		}
-
 	}
+
 	return &k8s.ImageStatusResponse{
-		Image: &k8s.Image{
-			Id:          info.ID,
-			RepoTags:    info.Ref.Tags(),
-			RepoDigests: info.Ref.Digests(),
-			Size_:       info.Size,
-			Uid:         uid,
-			Username:    username,
-		},
-		Info: verboseInfo,
+		Image: k8sImage(info),
+		Info:  verboseInfo,
 	}, nil
 }
 
+// k8sImage converts image info into image returned to kubelet.
+func k8sImage(info *image.Info) *k8s.Image {
+	img := &k8s.Image{
+		Id:          info.ID,
+		RepoTags:    info.Ref.Tags(),
+		RepoDigests: info.Ref.Digests(),
+		Size_:       info.Size,
+	}
+	if info.OciConfig != nil {
+		img.Uid, img.Username = imageUser(info.OciConfig.User)
+	}
+	return img
+}
+
+// imageUser returns either uid or name of the user image
+// processes run as according to the OCI config user.
+func imageUser(user string) (*k8s.Int64Value, string) {
+	if user == "" {
+		return nil, ""
+	}
+	// If user is not empty, possible options are:
+	//     * "user"
+	//     * "uid"
+	//     * "user:group"
+	//     * "uid:gid
+	//     * "user:gid"
+	//     * "uid:group"
+	user = strings.Split(user, ":")[0]
+	uid, err := strconv.ParseInt(user, 10, 32)
+	if err != nil {
+		return nil, user
+	}
+	return &k8s.Int64Value{Value: uid}, ""
+}
+
 // ListImages lists existing images.
 func (s *SingularityRegistry) ListImages(ctx context.Context, req *k8s.ListImagesRequest) (*k8s.ListImagesResponse, error) {
 	var imgs []*k8s.Image
 	appendToResult := func(info *image.Info) {
 		if info.Matches(req.Filter) {
-			imgs = append(imgs, &k8s.Image{
-				Id:          info.ID,
-				RepoTags:    info.Ref.Tags(),
-				RepoDigests: info.Ref.Digests(),
-				Size_:       info.Size,
-			})
+			imgs = append(imgs, k8sImage(info))
 		}
 	}
 	s.images.Iterate(appendToResult)
@@ -261,52 +403,94 @@ func (s *SingularityRegistry) ImageFsInfo(context.Context, *k8s.ImageFsInfoReque
 
 // loadInfo reads backup file and restores registry according to it.
 func (s *SingularityRegistry) loadInfo() error {
-	s.m.Lock()
-	defer s.m.Unlock()
-
-	_, err := s.infoFile.Seek(0, io.SeekStart)
-	if err != nil {
-		return fmt.Errorf("could not seek registry info file: %v", err)
-	}
-	dec := json.NewDecoder(s.infoFile)
+	return s.journal.Replay(func(rec journal.Record) error {
+		switch rec.Op {
+		case journal.OpPut:
+			var info *image.Info
+			if err := json.Unmarshal(rec.Data, &info); err != nil {
+				return fmt.Errorf("could not decode image: %v", err)
+			}
+			// record holds complete image info, including its users
+			if err := s.images.Replace(info); err != nil {
+				return fmt.Errorf("could not add decoded image to index: %v", err)
+			}
+		case journal.OpDelete:
+			err := s.images.Remove(rec.Key)
+			if err != nil && err != index.ErrNotFound {
+				return fmt.Errorf("could not remove image from index: %v", err)
+			}
+		default:
+			return fmt.Errorf("unknown registry record operation %q", rec.Op)
+		}
+		return nil
+	})
+}
 
-	// while the array contains values
-	for dec.More() {
-		var info *image.Info
-		// decode an array value (Message)
-		err := dec.Decode(&info)
-		if err != nil {
-			return fmt.Errorf("could not decode image: %v", err)
+// recordEvents records changes of image index into backup
+// file until events channel is closed.
+func (s *SingularityRegistry) recordEvents(events <-chan index.ImageEvent) {
+	defer close(s.watchDone)
+	for event := range events {
+		op := journal.OpPut
+		if event.Type == index.EventRemove {
+			op = journal.OpDelete
 		}
-		err = s.images.Add(info)
-		if err != nil {
-			return fmt.Errorf("could not add decoded image to index: %v", err)
+		if err := s.recordInfo(op, event.Image); err != nil {
+			glog.Errorf("Could not record registry info: %v", err)
 		}
 	}
+}
 
+// recordInfo appends image change to backup file,
+// compacting it once enough changes are recorded.
+func (s *SingularityRegistry) recordInfo(op string, info *image.Info) error {
+	if info.Ref.URI() == singularity.LocalFileDomain {
+		return nil
+	}
+	var data interface{}
+	if op == journal.OpPut {
+		data = info
+	}
+	compact, err := s.journal.Append(op, info.ID, data)
+	if err != nil {
+		return err
+	}
+	if compact {
+		return s.dumpInfo()
+	}
 	return nil
 }
 
 // dumpInfo dumps registry into backup file.
 func (s *SingularityRegistry) dumpInfo() error {
-	s.m.Lock()
-	defer s.m.Unlock()
+	return s.journal.Compact(func(put func(v interface{})) {
+		s.images.Iterate(func(info *image.Info) {
+			if info.Ref.URI() == singularity.LocalFileDomain {
+				return
+			}
+			put(info)
+		})
+	})
+}
 
-	_, err := s.infoFile.Seek(0, io.SeekStart)
+// checkDefinition checks that definition file at passed path is located in one
+// of directories images may be built from. It returns resolved path of the file
+// that image should be built from, so that symlinks swapped after the check
+// don't take effect.
+func (s *SingularityRegistry) checkDefinition(path string) (string, error) {
+	path, err := filepath.EvalSymlinks(path)
 	if err != nil {
-		return fmt.Errorf("could not seek registry info file: %v", err)
+		return "", fmt.Errorf("could not resolve definition file path: %v", err)
 	}
-	err = s.infoFile.Truncate(0)
-	if err != nil {
-		return fmt.Errorf("could not reset file: %v", err)
-	}
-	enc := json.NewEncoder(s.infoFile)
-	encodeToFile := func(info *image.Info) {
-		if info.Ref.URI() == singularity.LocalFileDomain {
-			return
+	for _, dir := range s.definitionDirs {
+		dir, err := filepath.EvalSymlinks(dir)
+		if err != nil {
+			glog.Warningf("Could not resolve definition files directory: %v", err)
+			continue
+		}
+		if strings.HasPrefix(path, dir+string(filepath.Separator)) {
+			return path, nil
 		}
-		_ = enc.Encode(info)
 	}
-	s.images.Iterate(encodeToFile)
-	return nil
+	return "", fmt.Errorf("definition file %s is not located in allowed directories", path)
 }
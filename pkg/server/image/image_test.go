@@ -0,0 +1,262 @@
+// Copyright (c) 2018-2019 Sylabs, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package image
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	uuid "github.com/satori/go.uuid"
+	"github.com/stretchr/testify/require"
+	"github.com/sylabs/sif/pkg/sif"
+	"github.com/sylabs/singularity-cri/pkg/image"
+	"github.com/sylabs/singularity-cri/pkg/index"
+	"github.com/sylabs/singularity-cri/pkg/journal"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	k8s "k8s.io/kubernetes/pkg/kubelet/apis/cri/runtime/v1alpha2"
+)
+
+func TestSingularityRegistry_CheckDefinition(t *testing.T) {
+	dir, err := ioutil.TempDir("", "definitions")
+	require.NoError(t, err, "could not create temp directory")
+	defer os.RemoveAll(dir)
+	dir, err = filepath.EvalSymlinks(dir)
+	require.NoError(t, err, "could not resolve temp directory")
+
+	allowed := filepath.Join(dir, "allowed")
+	other := filepath.Join(dir, "allowed-other")
+	for _, d := range []string{allowed, other} {
+		require.NoError(t, os.Mkdir(d, 0755))
+		require.NoError(t, ioutil.WriteFile(filepath.Join(d, "app.def"), []byte("Bootstrap: docker"), 0644))
+	}
+	require.NoError(t, os.Symlink(filepath.Join(other, "app.def"), filepath.Join(allowed, "link.def")))
+	require.NoError(t, os.Symlink("app.def", filepath.Join(allowed, "inner.def")))
+
+	tt := []struct {
+		name        string
+		path        string
+		expectPath  string
+		expectError bool
+	}{
+		{
+			name:       "allowed directory",
+			path:       filepath.Join(allowed, "app.def"),
+			expectPath: filepath.Join(allowed, "app.def"),
+		},
+		{
+			name:       "symlink within allowed directory",
+			path:       filepath.Join(allowed, "inner.def"),
+			expectPath: filepath.Join(allowed, "app.def"),
+		},
+		{
+			name:        "directory with the same prefix",
+			path:        filepath.Join(other, "app.def"),
+			expectError: true,
+		},
+		{
+			name:        "symlink out of allowed directory",
+			path:        filepath.Join(allowed, "link.def"),
+			expectError: true,
+		},
+		{
+			name:        "relative path out of allowed directory",
+			path:        filepath.Join(allowed, "..", "allowed-other", "app.def"),
+			expectError: true,
+		},
+		{
+			name:        "missing file",
+			path:        filepath.Join(allowed, "missing.def"),
+			expectError: true,
+		},
+	}
+
+	registry := &SingularityRegistry{
+		definitionDirs: []string{allowed},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			path, err := registry.checkDefinition(tc.path)
+			if tc.expectError {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+			}
+			require.Equal(t, tc.expectPath, path)
+		})
+	}
+}
+
+func TestSingularityRegistry_LoadInfo(t *testing.T) {
+	dir, err := ioutil.TempDir("", "registry")
+	require.NoError(t, err, "could not create temp directory")
+	defer os.RemoveAll(dir)
+
+	infoPath := filepath.Join(dir, registryInfoFile)
+	restart := func(s *SingularityRegistry) *SingularityRegistry {
+		if s != nil {
+			require.NoError(t, s.journal.Close())
+		}
+		j, err := journal.Open(infoPath)
+		require.NoError(t, err, "could not open registry journal")
+		restarted := &SingularityRegistry{
+			images:  index.NewImageIndex(),
+			journal: j,
+		}
+		require.NoError(t, restarted.loadInfo(), "could not load registry info")
+		return restarted
+	}
+
+	ref, err := image.ParseRef("library://library/default/busybox:1.29")
+	require.NoError(t, err, "could not parse busybox ref")
+	busybox := &image.Info{
+		ID:  "busybox",
+		Ref: ref,
+	}
+	registry := restart(nil)
+	require.NoError(t, registry.images.Add(busybox))
+	require.NoError(t, registry.dumpInfo())
+
+	// users added after snapshot are only in the journal
+	busybox.Borrow("container1")
+	require.NoError(t, registry.recordInfo(journal.OpPut, busybox))
+
+	registry = restart(registry)
+	found, err := registry.images.Find(busybox.ID)
+	require.NoError(t, err, "could not find image after restart")
+	require.Equal(t, []string{"container1"}, found.UsedBy())
+
+	// journal is compacted on startup
+	require.NoError(t, registry.dumpInfo())
+	registry = restart(registry)
+	defer registry.journal.Close()
+	found, err = registry.images.Find(busybox.ID)
+	require.NoError(t, err, "could not find image after second restart")
+	require.Equal(t, []string{"container1"}, found.UsedBy())
+}
+
+func TestImageUser(t *testing.T) {
+	tt := []struct {
+		name           string
+		user           string
+		expectUID      *k8s.Int64Value
+		expectUsername string
+	}{
+		{
+			name: "no user",
+			user: "",
+		},
+		{
+			name:      "uid",
+			user:      "1000",
+			expectUID: &k8s.Int64Value{Value: 1000},
+		},
+		{
+			name:      "root uid with gid",
+			user:      "0:0",
+			expectUID: &k8s.Int64Value{Value: 0},
+		},
+		{
+			name:           "username",
+			user:           "nobody",
+			expectUsername: "nobody",
+		},
+		{
+			name:           "username with group",
+			user:           "app:staff",
+			expectUsername: "app",
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			uid, username := imageUser(tc.user)
+			require.Equal(t, tc.expectUID, uid)
+			require.Equal(t, tc.expectUsername, username)
+		})
+	}
+}
+
+func TestSingularityRegistry_PullImageInUse(t *testing.T) {
+	dir, err := ioutil.TempDir("", "registry")
+	require.NoError(t, err, "could not create temp directory")
+	defer os.RemoveAll(dir)
+
+	rootfs := []byte("squashfs")
+	part := sif.DescriptorInput{
+		Datatype: sif.DataPartition,
+		Groupid:  sif.DescrDefaultGroup,
+		Size:     int64(len(rootfs)),
+		Fname:    "rootfs",
+		Fp:       bytes.NewReader(rootfs),
+	}
+	require.NoError(t, part.SetPartExtra(sif.FsSquash, sif.PartPrimSys, sif.GetSIFArch(runtime.GOARCH)))
+	sifPath := filepath.Join(dir, "app.sif")
+	_, err = sif.CreateContainer(sif.CreateInfo{
+		Pathname:   sifPath,
+		Launchstr:  sif.HdrLaunch,
+		Sifversion: sif.HdrVersion,
+		ID:         uuid.NewV4(),
+		InputDescr: []sif.DescriptorInput{part},
+	})
+	require.NoError(t, err, "could not create SIF")
+
+	registry := &SingularityRegistry{
+		storage: dir,
+		images:  index.NewImageIndex(),
+	}
+	pull := func(ref string) string {
+		resp, err := registry.PullImage(context.Background(), &k8s.PullImageRequest{
+			Image: &k8s.ImageSpec{Image: ref},
+		})
+		require.NoError(t, err, "could not pull %s", ref)
+		return resp.ImageRef
+	}
+
+	// image pulled from library earlier is in use by a container
+	data, err := ioutil.ReadFile(sifPath)
+	require.NoError(t, err)
+	id := fmt.Sprintf("%x", sha256.Sum256(data))
+	ref, err := image.ParseRef("library://library/default/app:1.0")
+	require.NoError(t, err)
+	pulled := &image.Info{
+		ID:     id,
+		Sha256: id,
+		Path:   filepath.Join(dir, id),
+		Ref:    ref,
+	}
+	require.NoError(t, ioutil.WriteFile(pulled.Path, data, 0644))
+	require.NoError(t, registry.images.Add(pulled))
+	pulled.Borrow("container1")
+
+	// re-pull of the same image must keep its users and references
+	require.Equal(t, id, pull("local.file"+sifPath))
+	info, err := registry.images.Find(id)
+	require.NoError(t, err)
+	require.Equal(t, []string{"container1"}, info.UsedBy())
+	require.Contains(t, info.Ref.Tags(), "library://library/default/app:1.0")
+
+	_, err = registry.RemoveImage(context.Background(), &k8s.RemoveImageRequest{
+		Image: &k8s.ImageSpec{Image: id},
+	})
+	require.Equal(t, codes.FailedPrecondition, status.Code(err))
+}
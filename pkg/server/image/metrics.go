@@ -0,0 +1,33 @@
+// Copyright (c) 2018-2019 Sylabs, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package image
+
+import (
+	"github.com/sylabs/singularity-cri/pkg/metrics"
+)
+
+var (
+	pullDurationMetric = metrics.NewHistogramVec("sycri_image_pull_duration_seconds",
+		"Duration of successful image pulls.", metrics.ExponentialBuckets(1, 2, 10))
+	pullSizeMetric = metrics.NewHistogramVec("sycri_image_pull_size_bytes",
+		"Size of successfully pulled images.", metrics.ExponentialBuckets(1<<20, 4, 8))
+)
+
+func init() {
+	metrics.Register(
+		pullDurationMetric,
+		pullSizeMetric,
+	)
+}
@@ -16,10 +16,13 @@ package runtime
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"path/filepath"
+	"strings"
 
 	"github.com/golang/glog"
+	"github.com/sylabs/singularity-cri/pkg/apparmor"
 	"github.com/sylabs/singularity-cri/pkg/index"
 	"github.com/sylabs/singularity-cri/pkg/kube"
 	"google.golang.org/grpc/codes"
@@ -42,6 +45,11 @@ func (s *SingularityRuntime) CreateContainer(_ context.Context, req *k8s.CreateC
 		return nil, status.Error(codes.InvalidArgument, "RunAsGroup should only be specified when RunAsUser or RunAsUsername is specified")
 	}
 
+	aaProfile := kube.AppArmorProfileName(req.GetConfig().GetLinux().GetSecurityContext().GetApparmorProfile())
+	if err := apparmor.Ensure(aaProfile, s.appArmorProfileDir); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid AppArmor profile: %v", err)
+	}
+
 	info, err := s.imageIndex.Find(req.Config.GetImage().GetImage())
 	if err == index.ErrNotFound {
 		return nil, status.Error(codes.NotFound, "image is not found")
@@ -52,7 +60,37 @@ func (s *SingularityRuntime) CreateContainer(_ context.Context, req *k8s.CreateC
 		return nil, err
 	}
 
-	cont := kube.NewContainer(req.Config, pod, info, s.trashDir)
+	logDriver, err := s.containerLogDriver(req.Config, pod)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "could not select log driver: %v", err)
+	}
+
+	sifVolumes, err := s.containerSIFVolumes(req.Config, pod)
+	if err != nil {
+		return nil, err
+	}
+
+	hooks, err := kube.SelectHooks(s.hooks, pod.GetAnnotations(), req.GetConfig().GetAnnotations())
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "could not select hooks: %v", err)
+	}
+
+	cont := kube.NewContainer(req.Config, pod, info, s.trashDir,
+		kube.WithHooks(hooks),
+		kube.WithRlimits(s.rlimits),
+		kube.WithRealtimeAllowed(s.allowRealtime),
+		kube.WithNUMAAwareCpuset(s.numaAwareCpuset),
+		kube.WithTimezone(s.timezone),
+		kube.WithBundlePool(s.bundlePool),
+		kube.WithDefaultStopSignal(s.stopSignal),
+		kube.WithExecEnv(s.execEnvDeny, s.execEnv),
+		kube.WithProjectIDs(s.projectIDs),
+		kube.WithSIFVolumes(sifVolumes),
+		kube.WithLogDriver(logDriver),
+		kube.WithDefaultCapabilities(s.defaultCapabilities),
+		kube.WithDefaultSeccompProfile(s.defaultSeccompProfile),
+		kube.WithEngineClient(s.engine),
+	)
 	cleanupOnFailure := func() {
 		if err := s.containers.Remove(cont.ID()); err != nil {
 			glog.Errorf("Could not remove container from index: %v", err)
@@ -61,7 +99,7 @@ func (s *SingularityRuntime) CreateContainer(_ context.Context, req *k8s.CreateC
 	contBaseDir := filepath.Join(s.baseRunDir, "containers", cont.ID())
 	if err := cont.Create(contBaseDir); err != nil {
 		cleanupOnFailure()
-		return nil, status.Errorf(codes.Internal, "could not create container: %v", err)
+		return nil, engineError(err, "could not create container")
 	}
 
 	err = s.containers.Add(cont)
@@ -69,11 +107,47 @@ func (s *SingularityRuntime) CreateContainer(_ context.Context, req *k8s.CreateC
 		cleanupOnFailure()
 		return nil, err
 	}
+	containersMetric.Add(1)
 	return &k8s.CreateContainerResponse{
 		ContainerId: cont.ID(),
 	}, nil
 }
 
+// containerSIFVolumes returns SIF volumes requested for a container with passed
+// config that is created in pod. Node-wide volumes are followed by the ones
+// requested with pod annotation and then with container annotation.
+func (s *SingularityRuntime) containerSIFVolumes(config *k8s.ContainerConfig, pod *kube.Pod) ([]kube.SIFVolume, error) {
+	pairs := append([]string{}, s.sifVolumes...)
+	pairs = append(pairs, pod.GetAnnotations()[kube.SIFVolumesAnnotation])
+	pairs = append(pairs, config.GetAnnotations()[kube.SIFVolumesAnnotation])
+	refs, paths, err := kube.ParseSIFVolumes(strings.Join(pairs, ","))
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid SIF volumes: %v", err)
+	}
+
+	volumes := make([]kube.SIFVolume, 0, len(refs))
+	seen := make(map[string]bool, len(paths))
+	for i, ref := range refs {
+		if seen[paths[i]] {
+			return nil, status.Errorf(codes.InvalidArgument, "multiple SIF volumes are mounted at %s", paths[i])
+		}
+		seen[paths[i]] = true
+
+		info, err := s.imageIndex.Find(ref)
+		if err == index.ErrNotFound {
+			return nil, status.Errorf(codes.NotFound, "SIF volume image %s is not found", ref)
+		}
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "could not find SIF volume image %s: %v", ref, err)
+		}
+		volumes = append(volumes, kube.SIFVolume{
+			Image: info,
+			Path:  paths[i],
+		})
+	}
+	return volumes, nil
+}
+
 // StartContainer starts the container.
 func (s *SingularityRuntime) StartContainer(_ context.Context, req *k8s.StartContainerRequest) (*k8s.StartContainerResponse, error) {
 	cont, err := s.findContainer(req.ContainerId)
@@ -86,7 +160,7 @@ func (s *SingularityRuntime) StartContainer(_ context.Context, req *k8s.StartCon
 		return nil, status.Errorf(codes.InvalidArgument, "attempt to start container in %s state", cont.State())
 	}
 	if err != nil {
-		return nil, status.Errorf(codes.Internal, "could not start container: %v", err)
+		return nil, engineError(err, "could not start container")
 	}
 	return &k8s.StartContainerResponse{}, nil
 }
@@ -125,6 +199,7 @@ func (s *SingularityRuntime) RemoveContainer(_ context.Context, req *k8s.RemoveC
 	if err := s.containers.Remove(cont.ID()); err != nil {
 		return nil, status.Errorf(codes.Internal, "could not remove container from index: %v", err)
 	}
+	containersMetric.Add(-1)
 	return &k8s.RemoveContainerResponse{}, nil
 }
 
@@ -137,13 +212,24 @@ func (s *SingularityRuntime) ContainerStatus(_ context.Context, req *k8s.Contain
 	}
 
 	if err := cont.UpdateState(); err != nil {
-		return nil, status.Errorf(codes.Internal, "could not update container state: %v", err)
+		return nil, engineError(err, "could not update container state")
 	}
 
 	var verboseInfo map[string]string
 	if req.Verbose {
 		verboseInfo = map[string]string{
-			"pid": fmt.Sprintf("%d", cont.Pid()),
+			"pid":     fmt.Sprintf("%d", cont.Pid()),
+			"attempt": fmt.Sprintf("%d", cont.Attempt()),
+		}
+		if prev := cont.PreviousID(); prev != "" {
+			verboseInfo["previousContainerId"] = prev
+		}
+		if sessions := cont.ExecSessions(); len(sessions) != 0 {
+			data, err := json.Marshal(sessions)
+			if err != nil {
+				return nil, status.Errorf(codes.Internal, "could not encode exec sessions: %v", err)
+			}
+			verboseInfo["execSessions"] = string(data)
 		}
 	}
 	return &k8s.ContainerStatusResponse{
@@ -172,11 +258,11 @@ func (s *SingularityRuntime) ContainerStatus(_ context.Context, req *k8s.Contain
 func (s *SingularityRuntime) ListContainers(_ context.Context, req *k8s.ListContainersRequest) (*k8s.ListContainersResponse, error) {
 	var containers []*k8s.Container
 
-	appendContToResult := func(cont *kube.Container) {
-		if err := cont.UpdateState(); err != nil {
-			glog.Errorf("Could not fetch container %s: %v", cont.ID(), err)
-			return
-		}
+	var matched []*kube.Container
+	s.containers.IterateByLabels(req.GetFilter().GetLabelSelector(), func(cont *kube.Container) {
+		matched = append(matched, cont)
+	})
+	for _, cont := range updateContainerStates(matched) {
 		if cont.MatchesFilter(req.Filter) {
 			containers = append(containers, &k8s.Container{
 				Id:           cont.ID(),
@@ -191,12 +277,27 @@ func (s *SingularityRuntime) ListContainers(_ context.Context, req *k8s.ListCont
 			})
 		}
 	}
-	s.containers.Iterate(appendContToResult)
 	return &k8s.ListContainersResponse{
 		Containers: containers,
 	}, nil
 }
 
+// updateContainerStates updates state of passed containers, outdated
+// states are listed at once. Containers which state could not be updated
+// are logged and omitted from the returned slice.
+func updateContainerStates(containers []*kube.Container) []*kube.Container {
+	errs := kube.UpdateStates(containers)
+	updated := make([]*kube.Container, 0, len(containers))
+	for i, cont := range containers {
+		if errs[i] != nil {
+			glog.Errorf("Could not fetch container %s: %v", cont.ID(), errs[i])
+			continue
+		}
+		updated = append(updated, cont)
+	}
+	return updated
+}
+
 func (s *SingularityRuntime) findContainer(id string) (*kube.Container, error) {
 	cont, err := s.containers.Find(id)
 	if err == index.ErrNotFound {
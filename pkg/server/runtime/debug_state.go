@@ -0,0 +1,102 @@
+// Copyright (c) 2018-2019 Sylabs, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runtime
+
+import (
+	"github.com/sylabs/singularity-cri/pkg/image"
+	"github.com/sylabs/singularity-cri/pkg/kube"
+	"github.com/sylabs/singularity-cri/pkg/network"
+)
+
+// DebugState is a snapshot of runtime internal state that
+// helps to investigate stuck pods and containers.
+type DebugState struct {
+	Images     []*image.Info         `json:"images"`
+	Pods       []PodDebugState       `json:"pods"`
+	Containers []ContainerDebugState `json:"containers"`
+}
+
+// PodDebugState describes pod known to the runtime.
+type PodDebugState struct {
+	ID         string              `json:"id"`
+	Name       string              `json:"name"`
+	Namespace  string              `json:"namespace"`
+	State      string              `json:"state"`
+	Pid        int                 `json:"pid"`
+	CreatedAt  int64               `json:"createdAt"`
+	Containers []string            `json:"containers"`
+	Network    *network.Attachment `json:"network,omitempty"`
+}
+
+// ContainerDebugState describes container known to the runtime.
+type ContainerDebugState struct {
+	ID           string             `json:"id"`
+	PodID        string             `json:"podId"`
+	Name         string             `json:"name"`
+	Attempt      uint32             `json:"attempt"`
+	Image        string             `json:"image"`
+	ImageID      string             `json:"imageId"`
+	State        string             `json:"state"`
+	Reason       string             `json:"reason,omitempty"`
+	Pid          int                `json:"pid"`
+	CreatedAt    int64              `json:"createdAt"`
+	StartedAt    int64              `json:"startedAt"`
+	FinishedAt   int64              `json:"finishedAt"`
+	ExitCode     int32              `json:"exitCode"`
+	LogPath      string             `json:"logPath,omitempty"`
+	ExecSessions []kube.ExecSession `json:"execSessions,omitempty"`
+}
+
+// DebugState returns snapshot of images, pods and containers known to
+// the runtime. Last known states are reported without querying Singularity,
+// so that snapshot can be taken even when Singularity hangs.
+func (s *SingularityRuntime) DebugState() DebugState {
+	var state DebugState
+	s.imageIndex.Iterate(func(info *image.Info) {
+		state.Images = append(state.Images, info)
+	})
+	s.pods.Iterate(func(pod *kube.Pod) {
+		state.Pods = append(state.Pods, PodDebugState{
+			ID:         pod.ID(),
+			Name:       pod.GetMetadata().GetName(),
+			Namespace:  pod.GetMetadata().GetNamespace(),
+			State:      pod.State().String(),
+			Pid:        pod.Pid(),
+			CreatedAt:  pod.CreatedAt(),
+			Containers: pod.Containers(),
+			Network:    pod.NetworkAttachment(),
+		})
+	})
+	s.containers.Iterate(func(cont *kube.Container) {
+		state.Containers = append(state.Containers, ContainerDebugState{
+			ID:           cont.ID(),
+			PodID:        cont.PodID(),
+			Name:         cont.GetMetadata().GetName(),
+			Attempt:      cont.Attempt(),
+			Image:        cont.GetImage().GetImage(),
+			ImageID:      cont.ImageID(),
+			State:        cont.State().String(),
+			Reason:       cont.StateReason(),
+			Pid:          cont.Pid(),
+			CreatedAt:    cont.CreatedAt(),
+			StartedAt:    cont.StartedAt(),
+			FinishedAt:   cont.FinishedAt(),
+			ExitCode:     cont.ExitCode(),
+			LogPath:      cont.LogPath(),
+			ExecSessions: cont.ExecSessions(),
+		})
+	})
+	return state
+}
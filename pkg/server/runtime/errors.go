@@ -0,0 +1,41 @@
+// Copyright (c) 2018-2019 Sylabs, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runtime
+
+import (
+	sRuntime "github.com/sylabs/singularity-cri/pkg/singularity/runtime"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// engineErrorCodes maps failures reported by Singularity OCI engine to gRPC codes.
+var engineErrorCodes = map[sRuntime.ErrorKind]codes.Code{
+	sRuntime.KindNotFound:    codes.NotFound,
+	sRuntime.KindPermission:  codes.PermissionDenied,
+	sRuntime.KindOOM:         codes.ResourceExhausted,
+	sRuntime.KindInvalidSpec: codes.InvalidArgument,
+	sRuntime.KindUnavailable: codes.Unavailable,
+}
+
+// engineError returns gRPC status error for err annotated with msg. When err
+// was reported by Singularity OCI engine it is mapped to the matching code,
+// otherwise codes.Internal is used. Engine's message is kept in either case.
+func engineError(err error, msg string) error {
+	code, ok := engineErrorCodes[sRuntime.KindOf(err)]
+	if !ok {
+		code = codes.Internal
+	}
+	return status.Errorf(code, "%s: %v", msg, err)
+}
@@ -0,0 +1,43 @@
+// Copyright (c) 2018-2019 Sylabs, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runtime
+
+import (
+	"fmt"
+
+	"github.com/sylabs/singularity-cri/pkg/kube"
+)
+
+// ExecSessions returns exec sessions running in containers grouped by container ID.
+// Containers without running exec sessions are omitted.
+func (s *SingularityRuntime) ExecSessions() map[string][]kube.ExecSession {
+	sessions := make(map[string][]kube.ExecSession)
+	s.containers.Iterate(func(cont *kube.Container) {
+		if contSessions := cont.ExecSessions(); len(contSessions) != 0 {
+			sessions[cont.ID()] = contSessions
+		}
+	})
+	return sessions
+}
+
+// KillExecSession kills exec process of session with sessionID running in container
+// with containerID. It returns kube.ErrExecSessionNotFound if there is no such session.
+func (s *SingularityRuntime) KillExecSession(containerID, sessionID string) error {
+	cont, err := s.containers.Find(containerID)
+	if err != nil {
+		return fmt.Errorf("could not fetch container: %v", err)
+	}
+	return cont.KillExecSession(sessionID)
+}
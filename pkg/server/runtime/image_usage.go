@@ -0,0 +1,55 @@
+// Copyright (c) 2018-2019 Sylabs, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runtime
+
+import (
+	"github.com/golang/glog"
+	"github.com/sylabs/singularity-cri/pkg/image"
+	"github.com/sylabs/singularity/pkg/ociruntime"
+)
+
+// stateLister is implemented by sRuntime.OCIClient.
+type stateLister interface {
+	List() (map[string]*ociruntime.State, error)
+}
+
+// releaseStaleImageUsers returns images that are recorded as used by containers
+// that no longer exist, e.g. when containers were removed while sycri was down.
+// Containers are listed once with each of passed clients and only those missing
+// from all successful listings are considered gone. When any listing fails, no
+// image is released, since containers it would report stay unknown.
+func releaseStaleImageUsers(images []*image.Info, clients []stateLister) {
+	known := make(map[string]bool)
+	for _, cli := range clients {
+		states, err := cli.List()
+		if err != nil {
+			glog.Warningf("Could not list containers to release stale image users: %v", err)
+			return
+		}
+		for id := range states {
+			known[id] = true
+		}
+	}
+
+	for _, info := range images {
+		for _, id := range info.UsedBy() {
+			if known[id] {
+				continue
+			}
+			glog.V(2).Infof("Container %s is gone, releasing image %s", id, info.ID)
+			info.Return(id)
+		}
+	}
+}
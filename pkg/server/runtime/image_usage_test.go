@@ -0,0 +1,68 @@
+// Copyright (c) 2018-2019 Sylabs, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runtime
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/sylabs/singularity-cri/pkg/image"
+	"github.com/sylabs/singularity/pkg/ociruntime"
+)
+
+type fakeStateLister struct {
+	ids []string
+	err error
+}
+
+func (f fakeStateLister) List() (map[string]*ociruntime.State, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	states := make(map[string]*ociruntime.State, len(f.ids))
+	for _, id := range f.ids {
+		states[id] = &ociruntime.State{}
+	}
+	return states, nil
+}
+
+func TestReleaseStaleImageUsers(t *testing.T) {
+	newImages := func() (*image.Info, *image.Info) {
+		busybox := &image.Info{ID: "busybox"}
+		busybox.Borrow("running")
+		busybox.Borrow("removed")
+		nginx := &image.Info{ID: "nginx"}
+		nginx.Borrow("runc")
+		nginx.Borrow("removed-too")
+		return busybox, nginx
+	}
+
+	busybox, nginx := newImages()
+	releaseStaleImageUsers([]*image.Info{busybox, nginx}, []stateLister{
+		fakeStateLister{ids: []string{"running"}},
+		fakeStateLister{ids: []string{"runc"}},
+	})
+	require.Equal(t, []string{"running"}, busybox.UsedBy())
+	require.Equal(t, []string{"runc"}, nginx.UsedBy())
+
+	busybox, nginx = newImages()
+	releaseStaleImageUsers([]*image.Info{busybox, nginx}, []stateLister{
+		fakeStateLister{ids: []string{"running"}},
+		fakeStateLister{err: fmt.Errorf("runc is broken")},
+	})
+	require.ElementsMatch(t, []string{"running", "removed"}, busybox.UsedBy())
+	require.ElementsMatch(t, []string{"runc", "removed-too"}, nginx.UsedBy())
+}
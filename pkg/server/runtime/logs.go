@@ -0,0 +1,156 @@
+// Copyright (c) 2018-2019 Sylabs, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runtime
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/sylabs/singularity-cri/pkg/kube"
+	k8s "k8s.io/kubernetes/pkg/kubelet/apis/cri/runtime/v1alpha2"
+)
+
+const (
+	// DefaultContainerLogMaxFiles is a default number of log files,
+	// including the active one, that are kept for each container.
+	DefaultContainerLogMaxFiles = 5
+
+	// logRotationInterval is how often container log sizes are checked.
+	logRotationInterval = 10 * time.Second
+
+	// rotatedLogSuffixFormat is a format of rotated log files suffix,
+	// it is the same as used by kubelet so that rotated files are
+	// discoverable by kubelet, e.g. 0.log.20190920-101010.
+	rotatedLogSuffixFormat = "20060102-150405"
+)
+
+// WithContainerLogRotation enables rotation of container logs once
+// they grow bigger than maxSize bytes. At most maxFiles log files,
+// including the active one, are kept for each container. When maxFiles
+// is less than 2, DefaultContainerLogMaxFiles is used.
+func WithContainerLogRotation(maxSize int64, maxFiles int) Option {
+	return func(r *SingularityRuntime) {
+		if maxSize <= 0 {
+			return
+		}
+		if maxFiles < 2 {
+			maxFiles = DefaultContainerLogMaxFiles
+		}
+		r.logMaxSize = maxSize
+		r.logMaxFiles = maxFiles
+	}
+}
+
+// WithContainerLogDriver sets default driver that ships container logs,
+// see kube.NewLogDriver. It may be overridden for a pod or a container
+// with kube.LogDriverAnnotation.
+func WithContainerLogDriver(name string) Option {
+	return func(r *SingularityRuntime) {
+		r.logDriver = name
+	}
+}
+
+// containerLogDriver returns log driver for a container
+// with passed config that is created in pod.
+func (s *SingularityRuntime) containerLogDriver(config *k8s.ContainerConfig, pod *kube.Pod) (kube.LogDriver, error) {
+	name := s.logDriver
+	if driver, ok := pod.GetAnnotations()[kube.LogDriverAnnotation]; ok {
+		name = driver
+	}
+	if driver, ok := config.GetAnnotations()[kube.LogDriverAnnotation]; ok {
+		name = driver
+	}
+	return kube.NewLogDriver(name)
+}
+
+// rotateLogs periodically rotates logs of running containers until done is closed.
+func (s *SingularityRuntime) rotateLogs(done <-chan struct{}) {
+	ticker := time.NewTicker(logRotationInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+
+		s.containers.Iterate(func(cont *kube.Container) {
+			if cont.State() != k8s.ContainerState_CONTAINER_RUNNING || cont.LogPath() == "" {
+				return
+			}
+			if err := rotateContainerLog(cont, s.logMaxSize, s.logMaxFiles, time.Now()); err != nil {
+				glog.Errorf("Could not rotate logs of container %s: %v", cont.ID(), err)
+			}
+		})
+	}
+}
+
+// logReopener is implemented by kube.Container.
+type logReopener interface {
+	LogPath() string
+	ReopenLogFile() error
+}
+
+// rotateContainerLog renames container log file when it is bigger than maxSize
+// and asks runtime to reopen it, so that new file is created. Oldest rotated
+// files are removed so that at most maxFiles log files are kept.
+func rotateContainerLog(cont logReopener, maxSize int64, maxFiles int, now time.Time) error {
+	logPath := cont.LogPath()
+	fi, err := os.Stat(logPath)
+	if err != nil {
+		return fmt.Errorf("could not stat log file: %v", err)
+	}
+	if fi.Size() <= maxSize {
+		return nil
+	}
+
+	rotated := logPath + "." + now.Format(rotatedLogSuffixFormat)
+	if err := os.Rename(logPath, rotated); err != nil {
+		return fmt.Errorf("could not rename log file: %v", err)
+	}
+	if err := cont.ReopenLogFile(); err != nil {
+		// restore log file, otherwise runtime would keep writing to rotated file
+		if err := os.Rename(rotated, logPath); err != nil {
+			glog.Errorf("Could not restore log file %s: %v", logPath, err)
+		}
+		return fmt.Errorf("could not reopen log file: %v", err)
+	}
+	return removeRotatedLogs(logPath, maxFiles-1)
+}
+
+// removeRotatedLogs removes the oldest rotated files of log
+// at logPath so that at most keep rotated files are left.
+func removeRotatedLogs(logPath string, keep int) error {
+	rotated, err := filepath.Glob(logPath + ".*")
+	if err != nil {
+		return fmt.Errorf("could not list rotated log files: %v", err)
+	}
+	if len(rotated) <= keep {
+		return nil
+	}
+
+	// suffix format makes lexical order match chronological order
+	sort.Strings(rotated)
+	for _, path := range rotated[:len(rotated)-keep] {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("could not remove rotated log file: %v", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+// Copyright (c) 2018-2019 Sylabs, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runtime
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type fakeContainer struct {
+	logPath   string
+	reopenErr error
+}
+
+func (c *fakeContainer) LogPath() string {
+	return c.logPath
+}
+
+func (c *fakeContainer) ReopenLogFile() error {
+	if c.reopenErr != nil {
+		return c.reopenErr
+	}
+	return ioutil.WriteFile(c.logPath, nil, 0644)
+}
+
+func TestRotateContainerLog(t *testing.T) {
+	now := time.Date(2019, 9, 20, 10, 10, 10, 0, time.UTC)
+
+	tt := []struct {
+		name        string
+		size        int
+		reopenErr   error
+		existing    []string
+		expectFiles []string
+		expectError error
+	}{
+		{
+			name:        "small log",
+			size:        10,
+			existing:    []string{"0.log.20190920-090000"},
+			expectFiles: []string{"0.log", "0.log.20190920-090000"},
+		},
+		{
+			name: "rotated",
+			size: 100,
+			existing: []string{
+				"0.log.20190920-070000",
+				"0.log.20190920-080000",
+				"0.log.20190920-090000",
+			},
+			expectFiles: []string{
+				"0.log",
+				"0.log.20190920-090000",
+				"0.log.20190920-101010",
+			},
+		},
+		{
+			name:        "reopen failed",
+			size:        100,
+			reopenErr:   fmt.Errorf("container didn't provide control socket"),
+			expectFiles: []string{"0.log"},
+			expectError: fmt.Errorf("could not reopen log file: container didn't provide control socket"),
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "logs-")
+			require.NoError(t, err)
+			defer os.RemoveAll(dir)
+
+			cont := &fakeContainer{
+				logPath:   filepath.Join(dir, "0.log"),
+				reopenErr: tc.reopenErr,
+			}
+			require.NoError(t, ioutil.WriteFile(cont.logPath, make([]byte, tc.size), 0644))
+			for _, name := range tc.existing {
+				require.NoError(t, ioutil.WriteFile(filepath.Join(dir, name), nil, 0644))
+			}
+
+			err = rotateContainerLog(cont, 50, 3, now)
+			require.Equal(t, tc.expectError, err)
+
+			files, err := ioutil.ReadDir(dir)
+			require.NoError(t, err)
+			var names []string
+			for _, fi := range files {
+				names = append(names, fi.Name())
+			}
+			sort.Strings(names)
+			require.Equal(t, tc.expectFiles, names)
+		})
+	}
+}
@@ -0,0 +1,52 @@
+// Copyright (c) 2018-2019 Sylabs, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runtime
+
+import (
+	"github.com/sylabs/singularity-cri/pkg/metrics"
+)
+
+var (
+	podsMetric = metrics.NewGaugeVec("sycri_pods",
+		"Number of pods managed by the runtime.")
+	containersMetric = metrics.NewGaugeVec("sycri_containers",
+		"Number of containers managed by the runtime.")
+	streamingSessionsMetric = metrics.NewGaugeVec("sycri_streaming_sessions",
+		"Number of active streaming sessions.", "type")
+)
+
+func init() {
+	metrics.Register(
+		podsMetric,
+		containersMetric,
+		streamingSessionsMetric,
+	)
+}
+
+// IndexMetrics returns metrics that report content of pod and container
+// indices. They are not registered by default since there may be
+// multiple runtime instances in a single process.
+func (s *SingularityRuntime) IndexMetrics() []metrics.Collector {
+	return append(s.pods.Metrics(), s.containers.Metrics()...)
+}
+
+// trackStreamingSession increments number of active streaming
+// sessions of passed type and returns func to decrement it back.
+func trackStreamingSession(typ string) func() {
+	streamingSessionsMetric.Add(1, typ)
+	return func() {
+		streamingSessionsMetric.Add(-1, typ)
+	}
+}
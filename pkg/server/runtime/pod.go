@@ -31,11 +31,32 @@ import (
 // RunPodSandbox creates and starts a pod-level sandbox. Runtimes must ensure
 // the sandbox is in the ready state on success.
 func (s *SingularityRuntime) RunPodSandbox(_ context.Context, req *k8s.RunPodSandboxRequest) (*k8s.RunPodSandboxResponse, error) {
-	if req.GetRuntimeHandler() != "" && req.GetRuntimeHandler() != singularity.RuntimeName {
-		return nil, status.Errorf(codes.FailedPrecondition, "only %s runtime is supported", singularity.RuntimeName)
+	podOpts := []kube.PodOption{
+		kube.WithHostResolvConf(s.hostResolvConf),
+		kube.WithSeccompProfileRoot(s.seccompProfileRoot),
+		kube.WithDefaultPodSeccompProfile(s.defaultSeccompProfile),
+		kube.WithShmSize(s.shmSize),
+		kube.WithPauseSandbox(s.pauseSandbox),
+		kube.WithPodOverhead(s.podOverhead),
+		kube.WithAllowedUnsafeSysctls(s.allowedUnsafeSysctls),
+	}
+	if handler := req.GetRuntimeHandler(); handler != "" && handler != singularity.RuntimeName {
+		cli, ok := s.runtimeHandlers[handler]
+		if !ok {
+			return nil, status.Errorf(codes.FailedPrecondition, "unknown runtime handler %q", handler)
+		}
+		podOpts = append(podOpts, kube.WithOCIClient(handler, cli), kube.WithPauseSandbox(true))
+	}
+	if hostname := req.GetConfig().GetHostname(); hostname != "" {
+		if err := kube.ValidateHostname(hostname); err != nil {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+	}
+	if err := kube.ValidateSysctls(req.GetConfig().GetLinux(), s.allowedUnsafeSysctls); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
 	}
 
-	pod := kube.NewPod(req.Config)
+	pod := kube.NewPod(req.Config, podOpts...)
 	cleanupOnFailure := func() {
 		if err := s.pods.Remove(pod.ID()); err != nil {
 			glog.Errorf("Could not remove pod from index: %v", err)
@@ -44,7 +65,7 @@ func (s *SingularityRuntime) RunPodSandbox(_ context.Context, req *k8s.RunPodSan
 	podBaseDir := filepath.Join(s.baseRunDir, "pods", pod.ID())
 	if err := pod.Run(podBaseDir); err != nil {
 		cleanupOnFailure()
-		return nil, status.Errorf(codes.Internal, "could not run pod: %v", err)
+		return nil, engineError(err, "could not run pod")
 	}
 
 	// bring up network interface if requested
@@ -59,6 +80,7 @@ func (s *SingularityRuntime) RunPodSandbox(_ context.Context, req *k8s.RunPodSan
 		cleanupOnFailure()
 		return nil, err
 	}
+	podsMetric.Add(1)
 	return &k8s.RunPodSandboxResponse{
 		PodSandboxId: pod.ID(),
 	}, nil
@@ -111,10 +133,12 @@ func (s *SingularityRuntime) RemovePodSandbox(_ context.Context, req *k8s.Remove
 	if err := s.pods.Remove(pod.ID()); err != nil {
 		return nil, status.Errorf(codes.Internal, "could not remove pod from index: %v", err)
 	}
+	podsMetric.Add(-1)
 	for _, containerID := range containers {
 		if err := s.containers.Remove(containerID); err != nil {
 			return nil, status.Errorf(codes.Internal, "could not remove container from index: %v", err)
 		}
+		containersMetric.Add(-1)
 	}
 	return &k8s.RemovePodSandboxResponse{}, nil
 }
@@ -127,7 +151,7 @@ func (s *SingularityRuntime) PodSandboxStatus(_ context.Context, req *k8s.PodSan
 		return nil, err
 	}
 	if err := pod.UpdateState(); err != nil {
-		return nil, status.Errorf(codes.Internal, "could not update pod state: %v", err)
+		return nil, engineError(err, "could not update pod state")
 	}
 
 	var verboseInfo map[string]string
@@ -175,12 +199,27 @@ func (s *SingularityRuntime) ListPodSandbox(_ context.Context, req *k8s.ListPodS
 			})
 		}
 	}
-	s.pods.Iterate(appendPodToResult)
+	s.pods.IterateByLabels(req.GetFilter().GetLabelSelector(), appendPodToResult)
 	return &k8s.ListPodSandboxResponse{
 		Items: pods,
 	}, nil
 }
 
+// ActivePods returns UIDs of kubernetes pods whose sandboxes are ready.
+func (s *SingularityRuntime) ActivePods() map[string]bool {
+	active := make(map[string]bool)
+	s.pods.Iterate(func(pod *kube.Pod) {
+		if err := pod.UpdateState(); err != nil {
+			glog.Errorf("Could not update pod state: %v", err)
+			return
+		}
+		if pod.State() == k8s.PodSandboxState_SANDBOX_READY {
+			active[pod.GetMetadata().GetUid()] = true
+		}
+	})
+	return active
+}
+
 func (s *SingularityRuntime) findPod(id string) (*kube.Pod, error) {
 	pod, err := s.pods.Find(id)
 	if err == index.ErrNotFound {
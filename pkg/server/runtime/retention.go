@@ -0,0 +1,248 @@
+// Copyright (c) 2018-2019 Sylabs, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runtime
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/sylabs/singularity-cri/pkg/index"
+	"github.com/sylabs/singularity-cri/pkg/kube"
+	k8s "k8s.io/kubernetes/pkg/kubelet/apis/cri/runtime/v1alpha2"
+)
+
+// retentionCheckInterval is how often exited containers and trash
+// directories are checked against retention policy.
+const retentionCheckInterval = time.Minute
+
+// RetentionPolicy limits exited containers and container trash
+// directories that are kept on the node. Zero values mean no limit.
+type RetentionPolicy struct {
+	// MaxExitedContainers is a number of exited containers that
+	// are kept, containers that exited earlier are removed first.
+	MaxExitedContainers int
+	// ExitedContainerMaxAge is how long containers are kept after they exit.
+	ExitedContainerMaxAge time.Duration
+	// MaxTrashDirs is a number of container trash directories that
+	// are kept, directories that are collected earlier are removed first.
+	MaxTrashDirs int
+	// TrashMaxAge is how long container trash directories are kept.
+	TrashMaxAge time.Duration
+}
+
+func (p RetentionPolicy) enabled() bool {
+	return p.MaxExitedContainers > 0 || p.ExitedContainerMaxAge > 0 ||
+		p.MaxTrashDirs > 0 || p.TrashMaxAge > 0
+}
+
+// WithRetention enables background removal of exited containers
+// and trash directories that exceed passed retention policy.
+func WithRetention(policy RetentionPolicy) Option {
+	return func(r *SingularityRuntime) {
+		r.retention = policy
+	}
+}
+
+// retained is an item that is subject to retention policy.
+type retained struct {
+	id string
+	at time.Time
+}
+
+// selectExpired returns IDs of items that are older than maxAge along with
+// the oldest items that exceed maxCount. Zero maxCount or maxAge means no limit.
+func selectExpired(items []retained, maxCount int, maxAge time.Duration, now time.Time) []string {
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].at.Before(items[j].at)
+	})
+	var expired []string
+	for i, item := range items {
+		tooMany := maxCount > 0 && len(items)-i > maxCount
+		tooOld := maxAge > 0 && now.Sub(item.at) > maxAge
+		if tooMany || tooOld {
+			expired = append(expired, item.id)
+		}
+	}
+	return expired
+}
+
+// exitedContainer is an exited container that is subject to retention policy.
+type exitedContainer struct {
+	retained
+	podID string
+	name  string
+}
+
+// selectRemovable returns IDs of exited containers that exceed retention policy.
+// The most recent exited container of each pod container is always kept while
+// its pod sandbox exists, since kubelet relies on it to apply restart policy,
+// count restarts and serve logs of the previous instance.
+func (p RetentionPolicy) selectRemovable(conts []exitedContainer, podExists func(id string) bool, now time.Time) []string {
+	type podContainer struct {
+		podID string
+		name  string
+	}
+	latest := make(map[podContainer]exitedContainer)
+	for _, cont := range conts {
+		key := podContainer{podID: cont.podID, name: cont.name}
+		last, ok := latest[key]
+		if !ok || cont.at.After(last.at) {
+			latest[key] = cont
+		}
+	}
+
+	keep := make(map[string]bool)
+	for key, cont := range latest {
+		if podExists(key.podID) {
+			keep[cont.id] = true
+		}
+	}
+
+	var items []retained
+	for _, cont := range conts {
+		if !keep[cont.id] {
+			items = append(items, cont.retained)
+		}
+	}
+	return selectExpired(items, p.MaxExitedContainers, p.ExitedContainerMaxAge, now)
+}
+
+// collectGarbage periodically removes exited containers and trash
+// directories that exceed retention policy until done is closed.
+func (s *SingularityRuntime) collectGarbage(done <-chan struct{}) {
+	ticker := time.NewTicker(retentionCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+
+		s.removeExitedContainers(time.Now())
+		if s.trashDir == "" {
+			continue
+		}
+		if err := pruneTrash(s.trashDir, s.retention.MaxTrashDirs, s.retention.TrashMaxAge, time.Now()); err != nil {
+			glog.Errorf("Could not prune trash directory: %v", err)
+		}
+	}
+}
+
+// removeExitedContainers removes exited containers that exceed retention policy.
+// Containers are checked against their last known state, the most recent
+// exited container of each pod container is kept while its pod exists.
+func (s *SingularityRuntime) removeExitedContainers(now time.Time) {
+	if s.retention.MaxExitedContainers == 0 && s.retention.ExitedContainerMaxAge == 0 {
+		return
+	}
+
+	exited := make(map[string]*kube.Container)
+	var conts []exitedContainer
+	s.containers.Iterate(func(cont *kube.Container) {
+		// containers with unknown finish time are left to kubelet
+		if cont.State() != k8s.ContainerState_CONTAINER_EXITED || cont.FinishedAt() == 0 {
+			return
+		}
+		exited[cont.ID()] = cont
+		conts = append(conts, exitedContainer{
+			retained: retained{
+				id: cont.ID(),
+				at: time.Unix(0, cont.FinishedAt()),
+			},
+			podID: cont.PodID(),
+			name:  cont.GetMetadata().GetName(),
+		})
+	})
+
+	podExists := func(id string) bool {
+		_, err := s.pods.Find(id)
+		return err != index.ErrNotFound
+	}
+	for _, id := range s.retention.selectRemovable(conts, podExists, now) {
+		cont := exited[id]
+		if err := cont.Remove(); err != nil {
+			glog.Errorf("Could not remove exited container %s: %v", id, err)
+			continue
+		}
+		if err := s.containers.Remove(id); err != nil {
+			glog.Errorf("Could not remove container %s from index: %v", id, err)
+			continue
+		}
+		containersMetric.Add(-1)
+		glog.V(2).Infof("Removed exited container %s due to retention policy", id)
+	}
+}
+
+// pruneTrash removes container trash directories, which are located at
+// <trashDir>/<podID>/<containerID>, that are older than maxAge along with
+// the oldest ones that exceed maxDirs. Pod directories that become empty
+// are removed as well.
+func pruneTrash(trashDir string, maxDirs int, maxAge time.Duration, now time.Time) error {
+	if maxDirs == 0 && maxAge == 0 {
+		return nil
+	}
+
+	pods, err := ioutil.ReadDir(trashDir)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("could not read trash directory: %v", err)
+	}
+
+	var items []retained
+	for _, pod := range pods {
+		if !pod.IsDir() {
+			continue
+		}
+		conts, err := ioutil.ReadDir(filepath.Join(trashDir, pod.Name()))
+		if err != nil {
+			return fmt.Errorf("could not read pod trash directory: %v", err)
+		}
+		for _, cont := range conts {
+			if !cont.IsDir() {
+				continue
+			}
+			items = append(items, retained{
+				id: filepath.Join(pod.Name(), cont.Name()),
+				at: cont.ModTime(),
+			})
+		}
+	}
+
+	podDirs := make(map[string]bool)
+	for _, id := range selectExpired(items, maxDirs, maxAge, now) {
+		if err := os.RemoveAll(filepath.Join(trashDir, id)); err != nil {
+			return fmt.Errorf("could not remove trash directory: %v", err)
+		}
+		podDirs[filepath.Join(trashDir, filepath.Dir(id))] = true
+	}
+	for podDir := range podDirs {
+		fii, err := ioutil.ReadDir(podDir)
+		if err != nil || len(fii) != 0 {
+			continue
+		}
+		if err := os.Remove(podDir); err != nil {
+			glog.Warningf("Could not remove pod trash directory %s: %v", podDir, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,169 @@
+// Copyright (c) 2018-2019 Sylabs, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runtime
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSelectExpired(t *testing.T) {
+	now := time.Now()
+	items := func() []retained {
+		return []retained{
+			{id: "b", at: now.Add(-2 * time.Hour)},
+			{id: "d", at: now},
+			{id: "a", at: now.Add(-3 * time.Hour)},
+			{id: "c", at: now.Add(-time.Hour)},
+		}
+	}
+
+	tt := []struct {
+		name     string
+		maxCount int
+		maxAge   time.Duration
+		expect   []string
+	}{
+		{
+			name:   "no limits",
+			expect: nil,
+		},
+		{
+			name:     "count limit",
+			maxCount: 1,
+			expect:   []string{"a", "b", "c"},
+		},
+		{
+			name:     "count limit not exceeded",
+			maxCount: 4,
+			expect:   nil,
+		},
+		{
+			name:   "age limit",
+			maxAge: 90 * time.Minute,
+			expect: []string{"a", "b"},
+		},
+		{
+			name:     "both limits",
+			maxCount: 2,
+			maxAge:   150 * time.Minute,
+			expect:   []string{"a", "b"},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			require.Equal(t, tc.expect, selectExpired(items(), tc.maxCount, tc.maxAge, now))
+		})
+	}
+}
+
+func TestRetentionPolicy_SelectRemovable(t *testing.T) {
+	now := time.Now()
+	exited := func(id, podID, name string, age time.Duration) exitedContainer {
+		return exitedContainer{
+			retained: retained{id: id, at: now.Add(-age)},
+			podID:    podID,
+			name:     name,
+		}
+	}
+	conts := func() []exitedContainer {
+		return []exitedContainer{
+			exited("job-1", "job-pod", "job", 5*time.Hour),
+			exited("web-1", "web-pod", "web", 4*time.Hour),
+			exited("web-2", "web-pod", "web", 3*time.Hour),
+			exited("init-1", "web-pod", "init", 3*time.Hour),
+			exited("old-1", "gone-pod", "old", 2*time.Hour),
+			exited("old-2", "gone-pod", "old", time.Hour),
+		}
+	}
+	podExists := func(id string) bool {
+		return id != "gone-pod"
+	}
+
+	tt := []struct {
+		name   string
+		policy RetentionPolicy
+		expect []string
+	}{
+		{
+			name:   "no limits",
+			expect: nil,
+		},
+		{
+			name:   "count limit",
+			policy: RetentionPolicy{MaxExitedContainers: 1},
+			expect: []string{"web-1", "old-1"},
+		},
+		{
+			name:   "age limit",
+			policy: RetentionPolicy{ExitedContainerMaxAge: 90 * time.Minute},
+			expect: []string{"web-1", "old-1"},
+		},
+		{
+			name:   "zero age limit",
+			policy: RetentionPolicy{ExitedContainerMaxAge: time.Nanosecond},
+			expect: []string{"web-1", "old-1", "old-2"},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			require.Equal(t, tc.expect, tc.policy.selectRemovable(conts(), podExists, now))
+		})
+	}
+}
+
+func TestPruneTrash(t *testing.T) {
+	trashDir, err := ioutil.TempDir("", "trash")
+	require.NoError(t, err, "could not create temp trash directory")
+	defer os.RemoveAll(trashDir)
+
+	now := time.Now()
+	dirs := map[string]time.Time{
+		"pod1/cont1": now.Add(-3 * time.Hour),
+		"pod1/cont2": now.Add(-time.Minute),
+		"pod2/cont3": now.Add(-2 * time.Hour),
+		"pod3/cont4": now,
+	}
+	for dir, mtime := range dirs {
+		path := filepath.Join(trashDir, dir)
+		require.NoError(t, os.MkdirAll(path, 0755))
+		require.NoError(t, os.Chtimes(path, mtime, mtime))
+	}
+
+	require.NoError(t, pruneTrash(trashDir, 0, 0, now))
+	require.NoError(t, pruneTrash(filepath.Join(trashDir, "missing"), 1, time.Hour, now))
+	require.NoError(t, pruneTrash(trashDir, 0, time.Hour, now))
+	for _, dir := range []string{"pod1/cont1", "pod2/cont3", "pod2"} {
+		_, err := os.Stat(filepath.Join(trashDir, dir))
+		require.True(t, os.IsNotExist(err), "%s is not removed", dir)
+	}
+	for _, dir := range []string{"pod1/cont2", "pod3/cont4"} {
+		_, err := os.Stat(filepath.Join(trashDir, dir))
+		require.NoError(t, err, "%s is removed", dir)
+	}
+
+	require.NoError(t, pruneTrash(trashDir, 1, 0, now))
+	fii, err := ioutil.ReadDir(trashDir)
+	require.NoError(t, err)
+	require.Len(t, fii, 1)
+	require.Equal(t, "pod3", fii[0].Name())
+}
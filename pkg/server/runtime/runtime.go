@@ -16,6 +16,7 @@ package runtime
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"net/http"
 	"os/exec"
@@ -23,10 +24,15 @@ import (
 	"time"
 
 	"github.com/golang/glog"
+	"github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/sylabs/singularity-cri/pkg/fs"
+	"github.com/sylabs/singularity-cri/pkg/image"
 	"github.com/sylabs/singularity-cri/pkg/index"
 	"github.com/sylabs/singularity-cri/pkg/kube"
 	"github.com/sylabs/singularity-cri/pkg/network"
 	"github.com/sylabs/singularity-cri/pkg/singularity"
+	sRuntime "github.com/sylabs/singularity-cri/pkg/singularity/runtime"
+	"github.com/sylabs/singularity-cri/pkg/version"
 	snetwork "github.com/sylabs/singularity/pkg/network"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
@@ -51,9 +57,44 @@ type SingularityRuntime struct {
 	baseRunDir  string
 	trashDir    string
 
+	hostResolvConf        string
+	seccompProfileRoot    string
+	defaultSeccompProfile string
+	defaultCapabilities   []string
+	appArmorProfileDir    string
+	shmSize               int64
+	pauseSandbox          bool
+	podOverhead           kube.PodOverhead
+	allowedUnsafeSysctls  []string
+	sifVolumes            []string
+	hooks                 []kube.Hook
+	rlimits               []specs.POSIXRlimit
+	allowRealtime         bool
+	numaAwareCpuset       bool
+	timezone              string
+	bundlePool            kube.BundlePool
+	stopSignal            string
+	execSyncMaxOutput     int64
+	execEnvDeny           []string
+	execEnv               []string
+	projectIDs            *fs.ProjectIDs
+	engine                *sRuntime.EngineClient
+	runtimeHandlers       map[string]sRuntime.OCIClient
+
+	logDriver       string
+	logMaxSize      int64
+	logMaxFiles     int
+	logRotationDone chan struct{}
+
+	storageCheckDone chan struct{}
+
+	retention   RetentionPolicy
+	janitorDone chan struct{}
+
 	streaming streaming.Server
 
 	networkManager *network.Manager
+	netDevicePool  *network.DevicePool
 }
 
 // Option is run during SingularityRuntime initialization.
@@ -64,9 +105,9 @@ type Option func(r *SingularityRuntime)
 // Singularity must be installed on the host otherwise it will return an error.
 // SingularityRuntime depends on SingularityRegistry so it must not be nil.
 func NewSingularityRuntime(imgIndex *index.ImageIndex, opts ...Option) (*SingularityRuntime, error) {
-	sing, err := exec.LookPath(singularity.RuntimeName)
+	sing, err := exec.LookPath(singularity.BinaryPath())
 	if err != nil {
-		return nil, fmt.Errorf("could not find %s on this machine: %v", singularity.RuntimeName, err)
+		return nil, fmt.Errorf("could not find %s on this machine: %v", singularity.BinaryPath(), err)
 	}
 
 	runtime := &SingularityRuntime{
@@ -80,6 +121,31 @@ func NewSingularityRuntime(imgIndex *index.ImageIndex, opts ...Option) (*Singula
 	for _, opt := range opts {
 		opt(runtime)
 	}
+
+	// images restored from registry backup may still be recorded
+	// as used by containers that were removed while sycri was down
+	var images []*image.Info
+	imgIndex.Iterate(func(info *image.Info) {
+		images = append(images, info)
+	})
+	clients := []stateLister{sRuntime.NewCLIClient()}
+	for _, cli := range runtime.runtimeHandlers {
+		clients = append(clients, cli)
+	}
+	releaseStaleImageUsers(images, clients)
+	if runtime.networkManager != nil && runtime.netDevicePool != nil {
+		runtime.networkManager.SetDevicePool(runtime.netDevicePool)
+	}
+	if runtime.logMaxSize > 0 {
+		runtime.logRotationDone = make(chan struct{})
+		go runtime.rotateLogs(runtime.logRotationDone)
+	}
+	runtime.storageCheckDone = make(chan struct{})
+	go runtime.enforceStorageLimits(runtime.storageCheckDone)
+	if runtime.retention.enabled() {
+		runtime.janitorDone = make(chan struct{})
+		go runtime.collectGarbage(runtime.janitorDone)
+	}
 	return runtime, nil
 }
 
@@ -134,6 +200,18 @@ func WithNetwork(cniBin, cniConf string) Option {
 	}
 }
 
+// WithHostNetDevices sets host network devices, e.g. SR-IOV virtual functions,
+// that may be moved into pod's network namespace on request.
+// It has effect only when networking support is enabled with WithNetwork.
+func WithHostNetDevices(devices []string) Option {
+	return func(r *SingularityRuntime) {
+		if len(devices) == 0 {
+			return
+		}
+		r.netDevicePool = network.NewDevicePool(devices)
+	}
+}
+
 // WithBaseRunDir sets base directory where all running pods
 // and containers are stored. Overrides DefaultBaseRunDir.
 func WithBaseRunDir(dir string) Option {
@@ -150,9 +228,206 @@ func WithTrashDir(dir string) Option {
 	}
 }
 
+// WithHostResolvConf sets path to the host's resolv.conf file that
+// will be merged with DNS config of each pod. When path is empty
+// only DNS config received from kubelet is used.
+func WithHostResolvConf(path string) Option {
+	return func(r *SingularityRuntime) {
+		r.hostResolvConf = path
+	}
+}
+
+// WithSeccompProfileRoot sets directory relative localhost seccomp
+// profiles are loaded from, see kube.WithSeccompProfileRoot.
+func WithSeccompProfileRoot(dir string) Option {
+	return func(r *SingularityRuntime) {
+		r.seccompProfileRoot = dir
+	}
+}
+
+// WithDefaultSeccompProfile sets path to seccomp profile file that is used for pods
+// and containers requesting runtime default profile or not setting any profile,
+// see kube.WithDefaultSeccompProfile.
+func WithDefaultSeccompProfile(path string) Option {
+	return func(r *SingularityRuntime) {
+		r.defaultSeccompProfile = path
+	}
+}
+
+// WithDefaultCapabilities sets capabilities each container starts with before
+// capabilities from its security context are applied. When caps is nil,
+// default capabilities of OCI runtime spec generator are used.
+func WithDefaultCapabilities(caps []string) Option {
+	return func(r *SingularityRuntime) {
+		r.defaultCapabilities = caps
+	}
+}
+
+// WithAppArmorProfileDir sets directory requested AppArmor profiles
+// that are not loaded yet are loaded from, see apparmor.Ensure.
+func WithAppArmorProfileDir(dir string) Option {
+	return func(r *SingularityRuntime) {
+		r.appArmorProfileDir = dir
+	}
+}
+
+// WithShmSize sets default size of /dev/shm in bytes for all containers,
+// see kube.WithShmSize. It may be overridden with kube.ShmSizeAnnotation.
+func WithShmSize(size int64) Option {
+	return func(r *SingularityRuntime) {
+		r.shmSize = size
+	}
+}
+
+// WithSIFVolumes sets SIF images that are mounted into all containers as
+// read-only volumes, each one is written as image=path pair, see kube.ParseSIFVolumes.
+func WithSIFVolumes(volumes []string) Option {
+	return func(r *SingularityRuntime) {
+		r.sifVolumes = volumes
+	}
+}
+
+// WithHooks sets OCI hooks that may be applied to containers, see kube.SelectHooks.
+func WithHooks(hooks []kube.Hook) Option {
+	return func(r *SingularityRuntime) {
+		r.hooks = hooks
+	}
+}
+
+// WithRlimits sets default resource limits of container processes,
+// they may be overridden with kube.RlimitsAnnotation.
+func WithRlimits(rlimits []specs.POSIXRlimit) Option {
+	return func(r *SingularityRuntime) {
+		r.rlimits = rlimits
+	}
+}
+
+// WithRealtimeAllowed sets whether containers may request realtime
+// scheduling parameters, see kube.WithRealtimeAllowed.
+func WithRealtimeAllowed(allowed bool) Option {
+	return func(r *SingularityRuntime) {
+		r.allowRealtime = allowed
+	}
+}
+
+// WithNUMAAwareCpuset sets whether containers with exclusive CPUs are pinned
+// to the matching NUMA nodes, see kube.WithNUMAAwareCpuset.
+func WithNUMAAwareCpuset(enabled bool) Option {
+	return func(r *SingularityRuntime) {
+		r.numaAwareCpuset = enabled
+	}
+}
+
+// WithTimezone sets default timezone of containers, see kube.WithTimezone.
+func WithTimezone(tz string) Option {
+	return func(r *SingularityRuntime) {
+		r.timezone = tz
+	}
+}
+
+// WithBundleWorkers sets maximum number of container bundles
+// that are created concurrently, 0 means no limit.
+func WithBundleWorkers(workers int) Option {
+	return func(r *SingularityRuntime) {
+		r.bundlePool = kube.NewBundlePool(workers)
+	}
+}
+
+// WithStopSignal sets default signal that is sent to containers
+// on graceful stop, see kube.WithDefaultStopSignal.
+func WithStopSignal(sig string) Option {
+	return func(r *SingularityRuntime) {
+		r.stopSignal = sig
+	}
+}
+
+// WithDirectEngine sets whether containers are started and signalled by talking
+// to Singularity OCI engine directly, see kube.WithEngineClient. When disabled,
+// Singularity CLI is forked for every operation.
+func WithDirectEngine(enabled bool) Option {
+	return func(r *SingularityRuntime) {
+		r.engine = nil
+		if enabled {
+			r.engine = sRuntime.NewEngineClient(sRuntime.NewCLIClient())
+		}
+	}
+}
+
+// WithRuntimeHandlers makes pods with RuntimeClass handler that is a key
+// of handlers run by runc compatible OCI runtime at the corresponding path.
+func WithRuntimeHandlers(handlers map[string]string) Option {
+	return func(r *SingularityRuntime) {
+		r.runtimeHandlers = make(map[string]sRuntime.OCIClient, len(handlers))
+		for name, path := range handlers {
+			r.runtimeHandlers[name] = sRuntime.NewRuncClient(path)
+		}
+	}
+}
+
+// WithExecSyncMaxOutput sets maximum number of bytes of each output stream
+// returned by ExecSync. When size is 0, runtime.DefaultMaxExecSyncOutput is used.
+func WithExecSyncMaxOutput(size int64) Option {
+	return func(r *SingularityRuntime) {
+		r.execSyncMaxOutput = size
+	}
+}
+
+// WithExecEnv sets environment variables that are removed from
+// and added to exec sessions, see kube.WithExecEnv.
+func WithExecEnv(deny, extra []string) Option {
+	return func(r *SingularityRuntime) {
+		r.execEnvDeny = deny
+		r.execEnv = extra
+	}
+}
+
+// WithProjectQuota enables accounting of containers fs usage with project
+// quotas, where each container is assigned project ID starting from baseID.
+// When baseID is 0, project quotas are not used.
+func WithProjectQuota(baseID uint32) Option {
+	return func(r *SingularityRuntime) {
+		if baseID != 0 {
+			r.projectIDs = fs.NewProjectIDs(baseID)
+		}
+	}
+}
+
+// WithPauseSandbox makes pods run a minimal built-in pause
+// process instead of a Singularity OCI engine instance.
+func WithPauseSandbox(enabled bool) Option {
+	return func(r *SingularityRuntime) {
+		r.pauseSandbox = enabled
+	}
+}
+
+// WithPodOverhead sets resource overhead of pod sandboxes
+// that is added to aggregate limits of pod cgroups.
+func WithPodOverhead(overhead kube.PodOverhead) Option {
+	return func(r *SingularityRuntime) {
+		r.podOverhead = overhead
+	}
+}
+
+// WithAllowedUnsafeSysctls sets node-level sysctls that pods are allowed
+// to set, each one is either a sysctl name or a prefix ending with *.
+func WithAllowedUnsafeSysctls(sysctls []string) Option {
+	return func(r *SingularityRuntime) {
+		r.allowedUnsafeSysctls = sysctls
+	}
+}
+
 // Shutdown shuts down any running background tasks created by SingularityRuntime.
 // This methods should be called when SingularityRuntime will no longer be used.
 func (s *SingularityRuntime) Shutdown() error {
+	if s.logRotationDone != nil {
+		close(s.logRotationDone)
+	}
+	if s.storageCheckDone != nil {
+		close(s.storageCheckDone)
+	}
+	if s.janitorDone != nil {
+		close(s.janitorDone)
+	}
 	if err := s.streaming.Stop(); err != nil {
 		return fmt.Errorf("could not stop streaming server: %v", err)
 	}
@@ -199,9 +474,12 @@ func (s *SingularityRuntime) UpdateContainerResources(ctx context.Context, req *
 	if err != nil {
 		return nil, err
 	}
+	if err := cont.ValidateResourcesUpdate(req.GetLinux()); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid container resources: %v", err)
+	}
 	err = cont.UpdateResources(req.GetLinux())
 	if err != nil {
-		return nil, status.Errorf(codes.Internal, "could not update container resources: %v", err)
+		return nil, engineError(err, "could not update container resources")
 	}
 	return &k8s.UpdateContainerResourcesResponse{}, nil
 }
@@ -217,7 +495,7 @@ func (s *SingularityRuntime) ReopenContainerLog(ctx context.Context, req *k8s.Re
 		return nil, err
 	}
 	if err := cont.UpdateState(); err != nil {
-		return nil, status.Errorf(codes.Internal, "could not update container state: %v", err)
+		return nil, engineError(err, "could not update container state")
 	}
 	if cont.State() != k8s.ContainerState_CONTAINER_RUNNING {
 		return nil, status.Error(codes.InvalidArgument, "container is not running")
@@ -238,7 +516,7 @@ func (s *SingularityRuntime) ExecSync(ctx context.Context, req *k8s.ExecSyncRequ
 	}
 
 	timeout := time.Second * time.Duration(req.Timeout)
-	resp, err := cont.ExecSync(timeout, req.Cmd)
+	resp, err := cont.ExecSync(timeout, req.Cmd, s.execSyncMaxOutput)
 	if err != nil {
 		return nil, status.Errorf(codes.Internal, "could not execute in container: %v", err)
 	}
@@ -328,7 +606,7 @@ func (s *SingularityRuntime) ListContainerStats(ctx context.Context, req *k8s.Li
 			containers = append(containers, containerStats(cont, stat))
 		}
 	}
-	s.containers.Iterate(appendContToResult)
+	s.containers.IterateByLabels(filter.GetLabelSelector(), appendContToResult)
 	return &k8s.ListContainerStatsResponse{
 		Stats: containers,
 	}, nil
@@ -362,11 +640,21 @@ func (s *SingularityRuntime) Status(ctx context.Context, req *k8s.StatusRequest)
 		networkReady.Reason = "NetworkNotReady"
 		networkReady.Message = fmt.Sprintf("sycri: network is not ready: %v", err)
 	}
-	return &k8s.StatusResponse{
+	resp := &k8s.StatusResponse{
 		Status: &k8s.RuntimeStatus{
 			Conditions: conditions,
 		},
-	}, nil
+	}
+	if req.GetVerbose() {
+		info, err := json.Marshal(version.Get())
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "could not encode build info: %v", err)
+		}
+		resp.Info = map[string]string{
+			"buildInfo": string(info),
+		}
+	}
+	return resp, nil
 }
 
 func containerStats(c *kube.Container, stat *kube.ContainerStat) *k8s.ContainerStats {
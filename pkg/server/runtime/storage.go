@@ -0,0 +1,60 @@
+// Copyright (c) 2018-2019 Sylabs, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runtime
+
+import (
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/sylabs/singularity-cri/pkg/kube"
+	k8s "k8s.io/kubernetes/pkg/kubelet/apis/cri/runtime/v1alpha2"
+)
+
+// storageCheckInterval is how often ephemeral storage usage of containers is checked.
+const storageCheckInterval = 10 * time.Second
+
+// enforceStorageLimits periodically stops running containers that exceed
+// their ephemeral storage limit, see kube.EphemeralStorageLimitAnnotation,
+// until done is closed.
+func (s *SingularityRuntime) enforceStorageLimits(done <-chan struct{}) {
+	ticker := time.NewTicker(storageCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+
+		// usage is checked outside of index lock since walking
+		// container directories and stopping containers takes time
+		var running []*kube.Container
+		s.containers.Iterate(func(cont *kube.Container) {
+			if cont.State() == k8s.ContainerState_CONTAINER_RUNNING {
+				running = append(running, cont)
+			}
+		})
+		for _, cont := range running {
+			stopped, err := cont.EnforceStorageLimit()
+			if err != nil {
+				glog.Errorf("Could not enforce ephemeral storage limit of container %s: %v", cont.ID(), err)
+				continue
+			}
+			if stopped {
+				glog.Infof("Container %s is stopped due to exceeded ephemeral storage limit", cont.ID())
+			}
+		}
+	}
+}
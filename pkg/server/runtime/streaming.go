@@ -42,6 +42,7 @@ func (s *streamingRuntime) Exec(containerID string, cmd []string,
 	tty bool, resize <-chan remotecommand.TerminalSize) error {
 
 	glog.V(4).Infof("Exec %v in %s...", cmd, containerID)
+	defer trackStreamingSession("exec")()
 	c, err := s.runtime.containers.Find(containerID)
 	if err != nil {
 		return fmt.Errorf("could not fetch container: %v", err)
@@ -54,10 +55,13 @@ func (s *streamingRuntime) Exec(containerID string, cmd []string,
 		return fmt.Errorf("container is not running")
 	}
 
+	ctx, done := c.StartExecSession(cmd, tty)
+	defer done()
+
 	var execErr error
 	if tty {
 		// stderr is nil here
-		execCmd := c.PrepareExec(cmd)
+		execCmd := c.PrepareExec(ctx, cmd)
 
 		master, err := pty.Start(execCmd)
 		if err != nil {
@@ -96,7 +100,7 @@ func (s *streamingRuntime) Exec(containerID string, cmd []string,
 		}
 		execErr = execCmd.Wait()
 	} else {
-		execErr = c.Exec(cmd, stdin, stdout, stderr)
+		execErr = c.Exec(ctx, cmd, stdin, stdout, stderr)
 	}
 
 	glog.V(4).Infof("Exec for %s returned %v...", containerID, execErr)
@@ -109,6 +113,7 @@ func (s *streamingRuntime) Attach(containerID string,
 	tty bool, resize <-chan remotecommand.TerminalSize) error {
 
 	glog.V(4).Infof("Attaching to %s...", containerID)
+	defer trackStreamingSession("attach")()
 	c, err := s.runtime.containers.Find(containerID)
 	if err != nil {
 		return fmt.Errorf("could not fetch container: %v", err)
@@ -171,8 +176,9 @@ func (s *streamingRuntime) Attach(containerID string,
 		}()
 	}
 
-	errors := make(chan error, 2)
+	var outErr, inErr chan error
 	if stdout != nil || stderr != nil {
+		outErr = make(chan error, 1)
 		go func() {
 			// there is no way to distinguish stdout and stderr
 			// as both of them are written to attach socket by the runtime
@@ -183,10 +189,10 @@ func (s *streamingRuntime) Attach(containerID string,
 
 			_, err := io.Copy(out, attachSock)
 			// do not report attach socket close as error
-			if err != nil && err != io.EOF {
-				errors <- err
+			if err == io.EOF {
+				err = nil
 			}
-			errors <- nil
+			outErr <- err
 		}()
 	}
 
@@ -197,19 +203,45 @@ func (s *streamingRuntime) Attach(containerID string,
 		}
 
 		if contStdin != nil {
+			inErr = make(chan error, 1)
 			go func() {
 				// copy until ctrl-d hits
 				_, err := utils.CopyDetachable(contStdin, stdin, []byte{4})
-				// do not treat detach as an error
-				if _, ok := err.(utils.DetachError); ok {
-					errors <- nil
-				}
-				errors <- err
+				inErr <- err
 			}()
 		}
 	}
 
-	err = <-errors
+	select {
+	case err = <-outErr:
+	case err = <-inErr:
+		if _, ok := err.(utils.DetachError); ok {
+			// do not treat detach as an error
+			err = nil
+			break
+		}
+		if err != nil {
+			break
+		}
+		// client closed its stdin, keep streaming output until container
+		// closes it, but propagate EOF only when stdin is not reused by
+		// further attaches, otherwise container would never get more input
+		if c.GetStdinOnce() {
+			glog.V(2).Infof("Propagating EOF to container %s", c.ID())
+			if tty {
+				_, err = attachSock.Write([]byte{4})
+			} else {
+				err = c.CloseStdin()
+			}
+			if err != nil {
+				glog.Errorf("Could not propagate EOF to container: %v", err)
+			}
+		}
+		err = nil
+		if outErr != nil {
+			err = <-outErr
+		}
+	}
 	glog.V(4).Infof("Attach for %s returned %v...", containerID, err)
 	if c.GetStdinOnce() && !c.StdinClosed() {
 		glog.V(2).Infof("Closing stdin for container %s", c.ID())
@@ -224,6 +256,7 @@ func (s *streamingRuntime) Attach(containerID string,
 // PortForward enters pod's NET namespace to forward passed
 // stream to the given port and back.
 func (s *streamingRuntime) PortForward(podSandboxID string, port int32, stream io.ReadWriteCloser) error {
+	defer trackStreamingSession("portforward")()
 	p, err := s.runtime.pods.Find(podSandboxID)
 	if err != nil {
 		return fmt.Errorf("could not fetch container: %v", err)
@@ -0,0 +1,65 @@
+// Copyright (c) 2018-2019 Sylabs, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package singularity
+
+// Binary describes Singularity installation that is used to run containers
+// and pull images, so that multiple installations may coexist on a node.
+type Binary struct {
+	// Path is a path to Singularity binary. Relative path is looked up in PATH.
+	Path string
+	// Flags are global flags that are passed to every command, e.g. -c.
+	Flags []string
+	// OCISubcommand is a subcommand that manages OCI containers.
+	OCISubcommand string
+}
+
+var binary = Binary{
+	Path:          RuntimeName,
+	OCISubcommand: "oci",
+}
+
+// SetBinary sets Singularity installation used by Singularity-CRI. Empty
+// fields of b are left unchanged. SetBinary is not thread safe and should be
+// called on startup before any Singularity command is run.
+func SetBinary(b Binary) {
+	if b.Path != "" {
+		binary.Path = b.Path
+	}
+	if b.Flags != nil {
+		binary.Flags = append([]string{}, b.Flags...)
+	}
+	if b.OCISubcommand != "" {
+		binary.OCISubcommand = b.OCISubcommand
+	}
+}
+
+// BinaryPath returns path to Singularity binary.
+func BinaryPath() string {
+	return binary.Path
+}
+
+// OCISubcommand returns subcommand that manages OCI containers.
+func OCISubcommand() string {
+	return binary.OCISubcommand
+}
+
+// Command returns Singularity command line that runs passed args
+// with global flags, e.g. Command("version").
+func Command(args ...string) []string {
+	cmd := make([]string, 0, 1+len(binary.Flags)+len(args))
+	cmd = append(cmd, binary.Path)
+	cmd = append(cmd, binary.Flags...)
+	return append(cmd, args...)
+}
@@ -0,0 +1,68 @@
+// Copyright (c) 2018-2019 Sylabs, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package singularity
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetBinary(t *testing.T) {
+	defer func(b Binary) { binary = b }(binary)
+
+	tt := []struct {
+		name       string
+		binary     Binary
+		expectCmd  []string
+		expectPath string
+		expectOCI  string
+	}{
+		{
+			name:       "default",
+			binary:     Binary{},
+			expectCmd:  []string{"singularity", "version"},
+			expectPath: "singularity",
+			expectOCI:  "oci",
+		},
+		{
+			name: "custom binary",
+			binary: Binary{
+				Path:  "/opt/singularity/bin/singularity",
+				Flags: []string{"-c", "/opt/singularity/etc/singularity.conf"},
+			},
+			expectCmd:  []string{"/opt/singularity/bin/singularity", "-c", "/opt/singularity/etc/singularity.conf", "version"},
+			expectPath: "/opt/singularity/bin/singularity",
+			expectOCI:  "oci",
+		},
+		{
+			name: "custom subcommand keeps binary",
+			binary: Binary{
+				OCISubcommand: "oci-next",
+			},
+			expectCmd:  []string{"/opt/singularity/bin/singularity", "-c", "/opt/singularity/etc/singularity.conf", "version"},
+			expectPath: "/opt/singularity/bin/singularity",
+			expectOCI:  "oci-next",
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			SetBinary(tc.binary)
+			require.Equal(t, tc.expectCmd, Command("version"))
+			require.Equal(t, tc.expectPath, BinaryPath())
+			require.Equal(t, tc.expectOCI, OCISubcommand())
+		})
+	}
+}
@@ -0,0 +1,94 @@
+// Copyright (c) 2018-2019 Sylabs, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runtime
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+const (
+	// DefaultCallTimeout is a default maximum duration of a single
+	// Singularity CLI command, e.g. oci state.
+	DefaultCallTimeout = 2 * time.Minute
+	// DefaultCallRetries is a default number of times idempotent
+	// Singularity CLI command is retried after it timed out.
+	DefaultCallRetries = 1
+)
+
+// CallPolicy limits how long Singularity CLI commands may run so that hung
+// engine doesn't block CRI requests forever. Idempotent commands, i.e. state
+// queries and signals, that time out are retried.
+type CallPolicy struct {
+	// Timeout is a maximum duration of a single command.
+	Timeout time.Duration
+	// Retries is a number of times idempotent command is retried.
+	// Negative value disables retries.
+	Retries int
+}
+
+var callPolicy = CallPolicy{
+	Timeout: DefaultCallTimeout,
+	Retries: DefaultCallRetries,
+}
+
+// SetCallPolicy sets policy of Singularity CLI commands. Zero fields of p are
+// left unchanged. SetCallPolicy is not thread safe and should be called on
+// startup before any Singularity command is run.
+func SetCallPolicy(p CallPolicy) {
+	if p.Timeout != 0 {
+		callPolicy.Timeout = p.Timeout
+	}
+	switch {
+	case p.Retries < 0:
+		callPolicy.Retries = 0
+	case p.Retries > 0:
+		callPolicy.Retries = p.Retries
+	}
+}
+
+// callContext returns context that is done once call timeout expires.
+func callContext() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), callPolicy.Timeout)
+}
+
+// callError returns EngineError for command that failed with err
+// and stderr output. When command was killed because ctx expired,
+// error of KindUnavailable is returned.
+func callError(ctx context.Context, err error, stderr []byte) *EngineError {
+	if ctx.Err() == context.DeadlineExceeded {
+		return &EngineError{
+			Kind:    KindUnavailable,
+			Message: fmt.Sprintf("engine did not respond within %v", callPolicy.Timeout),
+			Err:     err,
+		}
+	}
+	return newEngineError(err, stderr)
+}
+
+// retry calls f until it succeeds, fails with error other than
+// KindUnavailable or call retries are exhausted.
+func retry(f func() error) error {
+	for attempt := 0; ; attempt++ {
+		err := f()
+		if KindOf(err) != KindUnavailable || attempt >= callPolicy.Retries {
+			return err
+		}
+		glog.Warningf("Retrying Singularity command: %v", err)
+	}
+}
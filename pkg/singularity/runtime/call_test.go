@@ -0,0 +1,107 @@
+// Copyright (c) 2018-2019 Sylabs, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runtime
+
+import (
+	"fmt"
+	"os/exec"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCallError(t *testing.T) {
+	defer func(p CallPolicy) { callPolicy = p }(callPolicy)
+	SetCallPolicy(CallPolicy{Timeout: 50 * time.Millisecond})
+
+	ctx, cancel := callContext()
+	defer cancel()
+	err := exec.CommandContext(ctx, "sleep", "10").Run()
+	require.Error(t, err)
+	eErr := callError(ctx, err, []byte("partial output"))
+	require.Equal(t, KindUnavailable, eErr.Kind)
+	require.Equal(t, "engine did not respond within 50ms", eErr.Message)
+
+	ctx, cancel = callContext()
+	defer cancel()
+	err = exec.CommandContext(ctx, "false").Run()
+	require.Error(t, err)
+	eErr = callError(ctx, err, []byte("FATAL: permission denied"))
+	require.Equal(t, KindPermission, eErr.Kind)
+}
+
+func TestRetry(t *testing.T) {
+	defer func(p CallPolicy) { callPolicy = p }(callPolicy)
+	SetCallPolicy(CallPolicy{Retries: 2})
+
+	unavailable := &EngineError{Kind: KindUnavailable, Err: fmt.Errorf("signal: killed")}
+	tt := []struct {
+		name        string
+		errs        []error
+		expectCalls int
+		expectError error
+	}{
+		{
+			name:        "success",
+			errs:        []error{nil},
+			expectCalls: 1,
+		},
+		{
+			name:        "not retried",
+			errs:        []error{ErrNotFound},
+			expectCalls: 1,
+			expectError: ErrNotFound,
+		},
+		{
+			name:        "success after timeout",
+			errs:        []error{unavailable, nil},
+			expectCalls: 2,
+		},
+		{
+			name:        "retries exhausted",
+			errs:        []error{unavailable, unavailable, unavailable, nil},
+			expectCalls: 3,
+			expectError: unavailable,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			var calls int
+			err := retry(func() error {
+				err := tc.errs[calls]
+				calls++
+				return err
+			})
+			require.Equal(t, tc.expectError, err)
+			require.Equal(t, tc.expectCalls, calls)
+		})
+	}
+}
+
+func TestRetry_Disabled(t *testing.T) {
+	defer func(p CallPolicy) { callPolicy = p }(callPolicy)
+	SetCallPolicy(CallPolicy{Retries: -1})
+
+	unavailable := &EngineError{Kind: KindUnavailable, Err: fmt.Errorf("signal: killed")}
+	var calls int
+	err := retry(func() error {
+		calls++
+		return unavailable
+	})
+	require.Equal(t, unavailable, err)
+	require.Equal(t, 1, calls)
+}
@@ -17,14 +17,18 @@ package runtime
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"strings"
 	"sync"
 
 	"github.com/golang/glog"
+	"github.com/opencontainers/runtime-spec/specs-go"
 	"github.com/sylabs/singularity-cri/pkg/singularity"
+	"github.com/sylabs/singularity/pkg/ociruntime"
 )
 
 const (
@@ -33,6 +37,11 @@ const (
 
 	// LogLevelDebug singularity client will be launched with -d flag.
 	LogLevelDebug = "debug"
+
+	// LogFormatKubernetes is a container log format expected by kubelet, where
+	// each line is prefixed with RFC3339Nano timestamp, stream name and tag
+	// that tells whether line is full (F) or partial (P).
+	LogFormatKubernetes = "kubernetes"
 )
 
 type (
@@ -42,6 +51,23 @@ type (
 		ociBaseCmd []string
 	}
 
+	// OCIClient drives OCI runtime that runs pod and container bundles.
+	// CLIClient implements it for Singularity OCI engine, RuncClient
+	// for runc compatible runtimes.
+	OCIClient interface {
+		State(id string) (*ociruntime.State, error)
+		List() (map[string]*ociruntime.State, error)
+		Create(id, bundle string, stdin, tty bool, flags ...string) (io.WriteCloser, error)
+		Start(id string) error
+		Signal(id, sig string) error
+		Kill(id string, force bool) error
+		Delete(id string) error
+		ExecSync(ctx context.Context, id string, args, envs []string, maxOutput int64) (*ExecResponse, error)
+		Exec(ctx context.Context, id string, stdin io.Reader, stdout, stderr io.Writer, args, envs []string) error
+		PrepareExec(ctx context.Context, id string, args, envs []string) *exec.Cmd
+		UpdateContainerResources(id string, req *specs.LinuxResources) error
+	}
+
 	// BuildConfig is Singularity's build configuration.
 	BuildConfig struct {
 		SingularityConfdir string
@@ -53,14 +79,15 @@ var (
 	client *CLIClient
 )
 
-// NewCLIClient returns new CLIClient ready to use.
+// NewCLIClient returns new CLIClient ready to use. Client runs Singularity
+// installation that is set with singularity.SetBinary before the first call.
 func NewCLIClient() *CLIClient {
 	once.Do(func() {
 		logFlag := "-q"
 		if os.Getenv(LogLevelEnv) == LogLevelDebug {
 			logFlag = "-d"
 		}
-		client = &CLIClient{ociBaseCmd: []string{singularity.RuntimeName, logFlag, "oci"}}
+		client = &CLIClient{ociBaseCmd: singularity.Command(logFlag, singularity.OCISubcommand())}
 	})
 	return client
 }
@@ -68,7 +95,11 @@ func NewCLIClient() *CLIClient {
 // BuildConfig returns configuration which was used to build
 // current Singularity installation.
 func (c *CLIClient) BuildConfig() (*BuildConfig, error) {
-	cmd := exec.Command(singularity.RuntimeName, "buildcfg")
+	ctx, cancel := callContext()
+	defer cancel()
+
+	buildcfg := singularity.Command("buildcfg")
+	cmd := exec.CommandContext(ctx, buildcfg[0], buildcfg[1:]...)
 	confBytes, err := cmd.Output()
 	if err != nil {
 		return nil, fmt.Errorf("could not run buildcfg command: %v", err)
@@ -81,13 +112,17 @@ func (c *CLIClient) BuildConfig() (*BuildConfig, error) {
 }
 
 func run(cmd []string) error {
-	runCmd := exec.Command(cmd[0], cmd[1:]...)
-	runCmd.Stderr = os.Stderr
+	ctx, cancel := callContext()
+	defer cancel()
+
+	stderr := tailBuffer{limit: maxEngineMessage}
+	runCmd := exec.CommandContext(ctx, cmd[0], cmd[1:]...)
+	runCmd.Stderr = io.MultiWriter(os.Stderr, &stderr)
 
 	glog.V(5).Infof("Executing %v", cmd)
 	err := runCmd.Run()
 	if err != nil {
-		return fmt.Errorf("could not execute: %v", err)
+		return Wrap(callError(ctx, err, stderr.Bytes()), "could not execute")
 	}
 	return nil
 }
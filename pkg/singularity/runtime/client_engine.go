@@ -0,0 +1,123 @@
+// Copyright (c) 2018-2019 Sylabs, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runtime
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+
+	"github.com/golang/glog"
+	"github.com/sylabs/singularity/pkg/ociruntime"
+	"github.com/sylabs/singularity/pkg/util/unix"
+	sysunix "golang.org/x/sys/unix"
+)
+
+// EngineClient interacts with Singularity OCI engine of a container directly
+// instead of forking Singularity CLI for each operation: containers are started
+// through engine's control socket and signals are sent to container process.
+// Operations fall back to CLIClient when container state lacks required information.
+type EngineClient struct {
+	cli         *CLIClient
+	instanceDir string
+}
+
+// NewEngineClient returns new EngineClient that falls back to passed cli.
+func NewEngineClient(cli *CLIClient) *EngineClient {
+	dir, err := ociInstanceDir()
+	if err != nil {
+		glog.Warningf("Could not locate instance files, signals will be sent with CLI: %v", err)
+	}
+	return &EngineClient{
+		cli:         cli,
+		instanceDir: dir,
+	}
+}
+
+// Start asks engine of a created container with passed id and state to start it.
+func (e *EngineClient) Start(id string, state *ociruntime.State) error {
+	if state == nil || state.ControlSocket == "" {
+		return e.cli.Start(id)
+	}
+	ctrl := ociruntime.Control{
+		StartContainer: true,
+	}
+	if err := Control(state.ControlSocket, ctrl); err != nil {
+		return fmt.Errorf("could not start container: %v", err)
+	}
+	return nil
+}
+
+// Signal sends passed sig, e.g. SIGTERM, to the process of a container with
+// passed id. Container state is read from its instance file right before
+// signalling, so that signal is never sent by PID of a container that has
+// exited, since PID may be reused by an unrelated process. Container that
+// has already exited is not an error.
+func (e *EngineClient) Signal(id string, sig string) error {
+	num := sysunix.SignalNum(sig)
+	if num == 0 {
+		return fmt.Errorf("unknown signal %q", sig)
+	}
+	if e.instanceDir == "" {
+		return e.cli.Signal(id, sig)
+	}
+	state, err := readInstanceState(filepath.Join(e.instanceDir, id, id+".json"))
+	if err != nil {
+		glog.V(4).Infof("Could not read state of %s, falling back to CLI: %v", id, err)
+		return e.cli.Signal(id, sig)
+	}
+	if StatusToState(state.Status) == StateExited {
+		return nil
+	}
+	if state.Pid <= 0 {
+		return e.cli.Signal(id, sig)
+	}
+	err = sysunix.Kill(state.Pid, num)
+	if err != nil && err != sysunix.ESRCH {
+		return fmt.Errorf("could not send %s to container: %v", sig, err)
+	}
+	return nil
+}
+
+// Kill sends SIGINT to the process of a container with passed id.
+// If force is true that SIGKILL is sent instead.
+func (e *EngineClient) Kill(id string, force bool) error {
+	sig := "SIGINT"
+	if force {
+		sig = "SIGKILL"
+	}
+	return e.Signal(id, sig)
+}
+
+// Control sends ctrl request to engine listening on passed control
+// socket and waits until engine handles it.
+func Control(socket string, ctrl ociruntime.Control) error {
+	conn, err := unix.Dial(socket)
+	if err != nil {
+		return fmt.Errorf("could not connect to control socket: %v", err)
+	}
+	defer conn.Close()
+
+	if err := json.NewEncoder(conn).Encode(&ctrl); err != nil {
+		return fmt.Errorf("could not send control request: %v", err)
+	}
+	buf := make([]byte, 1)
+	_, err = conn.Read(buf)
+	if err != nil && err != io.EOF {
+		return fmt.Errorf("could not wait for control request: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+// Copyright (c) 2018-2019 Sylabs, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runtime
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/sylabs/singularity/pkg/ociruntime"
+)
+
+func TestControl(t *testing.T) {
+	socket := filepath.Join(os.TempDir(), fmt.Sprintf("cri-test-%s.sock", t.Name()))
+	ln, err := net.Listen("unix", socket)
+	require.NoError(t, err, "could not listen on socket")
+	defer ln.Close()
+
+	received := make(chan ociruntime.Control, 1)
+	go func() {
+		c, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		var ctrl ociruntime.Control
+		if err := json.NewDecoder(c).Decode(&ctrl); err == nil {
+			received <- ctrl
+		}
+	}()
+
+	err = Control(socket, ociruntime.Control{StartContainer: true})
+	require.NoError(t, err)
+	assert.Equal(t, ociruntime.Control{StartContainer: true}, <-received)
+
+	err = Control(filepath.Join(os.TempDir(), "cri-test-missing.sock"), ociruntime.Control{})
+	require.Error(t, err)
+}
+
+func TestEngineClient_Signal(t *testing.T) {
+	dir, err := ioutil.TempDir("", "instances")
+	require.NoError(t, err, "could not create temp dir")
+	defer os.RemoveAll(dir)
+
+	writeState := func(status string, pid int) {
+		config, err := json.Marshal(map[string]interface{}{
+			"engineConfig": map[string]interface{}{
+				"state": map[string]interface{}{
+					"status": status,
+					"pid":    pid,
+				},
+			},
+		})
+		require.NoError(t, err)
+		data, err := json.Marshal(instanceFile{Config: config})
+		require.NoError(t, err)
+		require.NoError(t, os.MkdirAll(filepath.Join(dir, "test"), 0755))
+		require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "test", "test.json"), data, 0644))
+	}
+
+	cmd := exec.Command("sleep", "60")
+	require.NoError(t, cmd.Start(), "could not start process")
+	pid := cmd.Process.Pid
+	defer cmd.Process.Kill()
+
+	engine := NewEngineClient(NewCLIClient())
+	engine.instanceDir = dir
+
+	require.Error(t, engine.Signal("test", "SIGUNKNOWN"), "unknown signal")
+
+	// process may have reused PID of exited container, it must not be signalled
+	writeState("stopped", pid)
+	require.NoError(t, engine.Signal("test", "SIGKILL"))
+	require.NoError(t, cmd.Process.Signal(syscall.Signal(0)), "process of stopped container is killed")
+
+	writeState("running", pid)
+	require.NoError(t, engine.Signal("test", "SIGKILL"))
+	err = cmd.Wait()
+	require.Error(t, err)
+	status := cmd.ProcessState.Sys().(syscall.WaitStatus)
+	require.True(t, status.Signaled())
+	require.Equal(t, syscall.SIGKILL, status.Signal())
+
+	// process is gone, signal should be ignored
+	require.NoError(t, engine.Signal("test", "SIGTERM"))
+}
@@ -25,12 +25,14 @@ import (
 	"os/exec"
 	"strings"
 	"syscall"
+	"time"
 
 	"github.com/creack/pty"
 	"github.com/golang/glog"
 	"github.com/opencontainers/runtime-spec/specs-go"
 	syio "github.com/sylabs/singularity-cri/pkg/io"
 	"github.com/sylabs/singularity/pkg/ociruntime"
+	"golang.org/x/sys/unix"
 )
 
 // ErrNotFound us returned when Singularity OCI engine responds with
@@ -42,28 +44,45 @@ type (
 	ExecResponse struct {
 		// Captured command stdout output.
 		Stdout []byte
-		// Captured command stderr output.
+		// Captured command stderr output. When command was terminated
+		// by a signal, it ends with a marker telling the signal name.
 		Stderr []byte
 		// Exit code the command finished with.
 		ExitCode int32
+		// Whether stdout or stderr was truncated.
+		Truncated bool
+		// Name of the signal that terminated the command, e.g. SIGKILL.
+		// When set, ExitCode is 128 plus signal number.
+		Signal string
 	}
 )
 
 // State returns state of a container with passed id. If runtime fails
 // to find object with given id, ErrNotFound is returned.
 func (c *CLIClient) State(id string) (*ociruntime.State, error) {
-	cmd := append(c.ociBaseCmd, "state", id)
-	stateCmd := exec.Command(cmd[0], cmd[1:]...)
+	var cliResp []byte
+	err := retry(func() error {
+		ctx, cancel := callContext()
+		defer cancel()
 
-	cliResp, err := stateCmd.Output()
-	if err != nil {
-		if eErr, ok := err.(*exec.ExitError); ok {
-			if strings.Contains(string(eErr.Stderr), "no instance found") {
-				return nil, ErrNotFound
+		cmd := append(c.ociBaseCmd, "state", id)
+		stateCmd := exec.CommandContext(ctx, cmd[0], cmd[1:]...)
+
+		var err error
+		cliResp, err = stateCmd.Output()
+		if err != nil {
+			if eErr, ok := err.(*exec.ExitError); ok {
+				if ctx.Err() == nil && strings.Contains(string(eErr.Stderr), "no instance found") {
+					return ErrNotFound
+				}
+				return Wrap(callError(ctx, err, eErr.Stderr), "could not query state")
 			}
-			return nil, fmt.Errorf("could not query state: %s", eErr.Stderr)
+			return fmt.Errorf("could not query state: %v", err)
 		}
-		return nil, fmt.Errorf("could not query state: %v", err)
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
 	var state *ociruntime.State
@@ -74,19 +93,34 @@ func (c *CLIClient) State(id string) (*ociruntime.State, error) {
 	return state, nil
 }
 
+// List returns states of all containers run by Singularity OCI engine
+// mapped by container ID. Singularity CLI queries state of one container
+// at a time, so states are read from instance files engine records them
+// to, the same as oci state command does, without forking CLI.
+func (c *CLIClient) List() (map[string]*ociruntime.State, error) {
+	dir, err := ociInstanceDir()
+	if err != nil {
+		return nil, err
+	}
+	return listInstances(dir)
+}
+
 // Delete asks runtime to delete container with passed id. If runtime fails
 // to find object with given id, ErrNotFound is returned.
 func (c *CLIClient) Delete(id string) error {
+	ctx, cancel := callContext()
+	defer cancel()
+
 	cmd := append(c.ociBaseCmd, "delete", id)
-	deleteCmd := exec.Command(cmd[0], cmd[1:]...)
+	deleteCmd := exec.CommandContext(ctx, cmd[0], cmd[1:]...)
 
 	_, err := deleteCmd.Output()
 	if err != nil {
 		if eErr, ok := err.(*exec.ExitError); ok {
-			if strings.Contains(string(eErr.Stderr), "no instance found") {
+			if ctx.Err() == nil && strings.Contains(string(eErr.Stderr), "no instance found") {
 				return ErrNotFound
 			}
-			return fmt.Errorf("could not delete instance %s: %s", id, eErr.Stderr)
+			return Wrap(callError(ctx, err, eErr.Stderr), "could not delete instance %s", id)
 		}
 		return fmt.Errorf("could not delete instance %s: %s", id, err)
 	}
@@ -107,22 +141,35 @@ func (c *CLIClient) Create(id, bundle string, stdin, tty bool, flags ...string)
 	cmd = append(cmd, flags...)
 	cmd = append(cmd, "-b", bundle, id)
 
-	createCmd := exec.Command(cmd[0], cmd[1:]...)
-	createCmd.Stderr = os.Stderr
+	ctx, cancel := callContext()
+	defer cancel()
+
+	// engine's stderr is captured to be attached to an error on failure
+	stderr := tailBuffer{limit: maxEngineMessage}
+	copied := make(chan struct{})
+	close(copied)
+
+	createCmd := exec.CommandContext(ctx, cmd[0], cmd[1:]...)
+	createCmd.Stderr = io.MultiWriter(os.Stderr, &stderr)
+	var slave *os.File
 	if !tty {
-		master, slave, err := pty.Open()
+		var master *os.File
+		var err error
+		master, slave, err = pty.Open()
 		if err != nil {
 			return nil, fmt.Errorf("could not allcate pty: %v", err)
 		}
 		createCmd.Stderr = slave
 		defer slave.Close()
 
-		ctx, cancel := context.WithCancel(context.Background())
-		defer cancel()
+		copyCtx, copyCancel := context.WithCancel(context.Background())
+		defer copyCancel()
+		copied = make(chan struct{})
 		go func() {
 			glog.V(5).Info("Starting stream copying from master to stderr")
-			_, err := io.Copy(os.Stderr, syio.NewContextReader(ctx, master))
+			_, err := io.Copy(io.MultiWriter(os.Stderr, &stderr), syio.NewContextReader(copyCtx, master))
 			glog.V(5).Infof("Stream copying returned: %v", err)
+			close(copied)
 			// we need to drain master to prevent buffer overflow,
 			// see https://github.com/sylabs/singularity-cri/pull/348
 			go io.Copy(ioutil.Discard, master)
@@ -137,7 +184,19 @@ func (c *CLIClient) Create(id, bundle string, stdin, tty bool, flags ...string)
 	glog.V(5).Infof("Executing %v", cmd)
 	err := createCmd.Run()
 	if err != nil {
-		return nil, fmt.Errorf("could not execute create container command: %v", err)
+		var message []byte
+		if slave != nil {
+			// closing slave end makes copying stop once
+			// the rest of engine's output is read from master
+			slave.Close()
+		}
+		select {
+		case <-copied:
+			message = stderr.Bytes()
+		case <-time.After(time.Second):
+			glog.V(4).Infof("Timed out waiting for create container command output")
+		}
+		return nil, Wrap(callError(ctx, err, message), "could not execute create container command")
 	}
 
 	return stdinWrite, nil
@@ -150,38 +209,55 @@ func (c *CLIClient) Start(id string) error {
 }
 
 // ExecSync executes a command inside a container synchronously until
-// context is done and returns the result.
-func (c *CLIClient) ExecSync(ctx context.Context, id string, args, envs []string) (*ExecResponse, error) {
+// context is done and returns the result. At most maxOutput bytes of each
+// output stream are captured, when it is 0 DefaultMaxExecSyncOutput is used.
+func (c *CLIClient) ExecSync(ctx context.Context, id string, args, envs []string, maxOutput int64) (*ExecResponse, error) {
 	cmd := append(c.ociBaseCmd, "exec", id)
 	cmd = append(cmd, args...)
 
-	var stdout bytes.Buffer
-	var stderr bytes.Buffer
-
 	runCmd := exec.CommandContext(ctx, cmd[0], cmd[1:]...)
+	runCmd.Env = envs
+	return execSync(runCmd, maxOutput)
+}
+
+// execSync runs prepared exec command capturing at most maxOutput bytes
+// of each output stream, see ExecSync. Marker of the signal that terminated
+// command is accounted in maxOutput of stderr.
+func execSync(runCmd *exec.Cmd, maxOutput int64) (*ExecResponse, error) {
+	if maxOutput == 0 {
+		maxOutput = DefaultMaxExecSyncOutput
+	}
+	stdout := limitedBuffer{limit: maxOutput}
+	stderr := limitedBuffer{limit: maxOutput}
 	runCmd.Stdout = &stdout
 	runCmd.Stderr = &stderr
-	runCmd.Env = envs
 
-	glog.V(5).Infof("Executing %v", cmd)
+	glog.V(5).Infof("Executing %v", runCmd.Args)
 	err := runCmd.Run()
 	var exitCode int32
+	var signal string
 	exitErr, ok := err.(*exec.ExitError)
 	if ok {
-		// TODO use unix package here
 		var waitStatus syscall.WaitStatus
 		waitStatus, ok = exitErr.Sys().(syscall.WaitStatus)
 		if ok {
-			exitCode = int32(waitStatus.ExitStatus())
+			exitCode, signal = exitStatus(waitStatus)
 		}
 	}
 	if !ok && err != nil {
 		return nil, fmt.Errorf("could not execute: %v", err)
 	}
+	var signalMarker string
+	if signal != "" {
+		signalMarker = fmt.Sprintf("\n[process terminated by %s]\n", signal)
+		stderr.Reserve(int64(len(signalMarker)))
+	}
 	return &ExecResponse{
-		Stdout:   stdout.Bytes(),
-		Stderr:   stderr.Bytes(),
-		ExitCode: exitCode,
+		Stdout:    stdout.Bytes(),
+		Stderr:    append(stderr.Bytes(), signalMarker...),
+		ExitCode:  exitCode,
+		Truncated: stdout.Truncated() || stderr.Truncated(),
+		Signal:    signal,
 	}, nil
 }
 
@@ -228,7 +304,9 @@ func (c *CLIClient) Kill(id string, force bool) error {
 // Signal asks runtime to send passed sig to container with passed id.
 func (c *CLIClient) Signal(id, sig string) error {
 	cmd := append(c.ociBaseCmd, "kill", "-s", sig, id)
-	return run(cmd)
+	return retry(func() error {
+		return run(cmd)
+	})
 }
 
 // UpdateContainerResources asks runtime to update container resources
@@ -241,14 +319,39 @@ func (c *CLIClient) UpdateContainerResources(id string, req *specs.LinuxResource
 	}
 
 	cmd := append(c.ociBaseCmd, "update", "--from-file", "-", id)
-	updCmd := exec.Command(cmd[0], cmd[1:]...)
-	updCmd.Stderr = os.Stderr
+	ctx, cancel := callContext()
+	defer cancel()
+
+	stderr := tailBuffer{limit: maxEngineMessage}
+	updCmd := exec.CommandContext(ctx, cmd[0], cmd[1:]...)
+	updCmd.Stderr = io.MultiWriter(os.Stderr, &stderr)
 	updCmd.Stdin = buf
 
 	glog.V(5).Infof("Executing %v", cmd)
 	err = updCmd.Run()
 	if err != nil {
-		return fmt.Errorf("could not execute: %v", err)
+		return Wrap(callError(ctx, err, stderr.Bytes()), "could not execute")
 	}
 	return nil
 }
+
+// exitStatus returns exit code of a process with passed wait status. Process
+// terminated by a signal is reported with 128 plus signal number as shells do,
+// along with signal name.
+func exitStatus(status syscall.WaitStatus) (int32, string) {
+	if status.Signaled() {
+		sig := status.Signal()
+		return 128 + int32(sig), unix.SignalName(sig)
+	}
+	return int32(status.ExitStatus()), ""
+}
+
+// ExitSignal returns name of the signal that terminated process with passed
+// exit code, assuming it follows 128 plus signal number convention, e.g.
+// SIGKILL for 137. For other codes empty string is returned.
+func ExitSignal(code int32) string {
+	if code <= 128 {
+		return ""
+	}
+	return unix.SignalName(unix.Signal(code - 128))
+}
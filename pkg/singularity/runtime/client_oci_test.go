@@ -0,0 +1,87 @@
+// Copyright (c) 2018-2019 Sylabs, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runtime
+
+import (
+	"os/exec"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestExitStatus(t *testing.T) {
+	tt := []struct {
+		name         string
+		cmd          []string
+		expectCode   int32
+		expectSignal string
+	}{
+		{
+			name:       "exit code",
+			cmd:        []string{"sh", "-c", "exit 3"},
+			expectCode: 3,
+		},
+		{
+			name:         "killed by signal",
+			cmd:          []string{"sh", "-c", "kill -KILL $$"},
+			expectCode:   137,
+			expectSignal: "SIGKILL",
+		},
+		{
+			name:         "terminated by signal",
+			cmd:          []string{"sh", "-c", "kill -TERM $$"},
+			expectCode:   143,
+			expectSignal: "SIGTERM",
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			err := exec.Command(tc.cmd[0], tc.cmd[1:]...).Run()
+			exitErr, ok := err.(*exec.ExitError)
+			require.True(t, ok, "unexpected error: %v", err)
+			code, sig := exitStatus(exitErr.Sys().(syscall.WaitStatus))
+			require.Equal(t, tc.expectCode, code)
+			require.Equal(t, tc.expectSignal, sig)
+		})
+	}
+}
+
+func TestExitSignal(t *testing.T) {
+	tt := []struct {
+		code   int32
+		expect string
+	}{
+		{code: 0, expect: ""},
+		{code: 1, expect: ""},
+		{code: 128, expect: ""},
+		{code: 130, expect: "SIGINT"},
+		{code: 137, expect: "SIGKILL"},
+		{code: 255, expect: ""},
+	}
+	for _, tc := range tt {
+		require.Equal(t, tc.expect, ExitSignal(tc.code), "exit code %d", tc.code)
+	}
+}
+
+func TestExecSync_SignalMarker(t *testing.T) {
+	cmd := exec.Command("sh", "-c", "printf 0123456789 >&2; kill -KILL $$")
+	resp, err := execSync(cmd, 40)
+	require.NoError(t, err)
+	require.Equal(t, "SIGKILL", resp.Signal)
+	require.True(t, resp.Truncated)
+	require.Equal(t, "0123456\n[output truncated: 3 bytes omitted]\n\n[process terminated by SIGKILL]\n", string(resp.Stderr))
+}
@@ -0,0 +1,605 @@
+// Copyright (c) 2018-2019 Sylabs, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runtime
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/sylabs/singularity/pkg/ociruntime"
+	"github.com/sylabs/singularity/pkg/util/unix"
+)
+
+const (
+	// runcExitFile is a file in container bundle
+	// monitor records container exit code to.
+	runcExitFile = "exit.json"
+	// runcPidFile is a file in container bundle
+	// runtime writes container process pid to.
+	runcPidFile = "container.pid"
+)
+
+type (
+	// RuncClient is a type for interaction with runc compatible
+	// OCI runtime, e.g. runc or crun, via CLI. Unlike Singularity OCI
+	// engine such runtimes neither report state changes and exit codes nor
+	// write container logs, so RuncClient does that itself for containers
+	// it created with help of monitor process, see RunMonitor.
+	RuncClient struct {
+		binary string
+
+		mu         sync.Mutex
+		containers map[string]*runcContainer
+	}
+
+	// runcContainer holds information about container that
+	// runtime doesn't keep track of.
+	runcContainer struct {
+		syncSocket string
+		log        *logWriter
+		exitFile   string
+		startedAt  *int64
+		finishedAt *int64
+		exitCode   *int
+		// exited is closed once monitor process exits.
+		exited chan struct{}
+		done   chan struct{}
+	}
+
+	// runcState is a state reported by runc compatible runtime.
+	runcState struct {
+		specs.State
+		Created time.Time `json:"created"`
+	}
+)
+
+// NewRuncClient returns new RuncClient that runs passed runtime binary.
+func NewRuncClient(binary string) *RuncClient {
+	return &RuncClient{
+		binary:     binary,
+		containers: make(map[string]*runcContainer),
+	}
+}
+
+// State returns state of a container with passed id. If runtime fails
+// to find object with given id, ErrNotFound is returned. Exit code is
+// only known for containers created by RuncClient.
+func (r *RuncClient) State(id string) (*ociruntime.State, error) {
+	var out []byte
+	err := retry(func() error {
+		var err error
+		out, err = r.output(nil, "state", id)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	state, err := parseRuncState(out)
+	if err != nil {
+		return nil, err
+	}
+	r.addTimes(state)
+	return state, nil
+}
+
+// List returns states of all containers known to runtime mapped by container ID.
+func (r *RuncClient) List() (map[string]*ociruntime.State, error) {
+	out, err := r.output(nil, "list", "--format", "json")
+	if err != nil {
+		return nil, err
+	}
+	var list []runcState
+	if err := json.Unmarshal(out, &list); err != nil {
+		return nil, fmt.Errorf("could not decode container list: %v", err)
+	}
+	states := make(map[string]*ociruntime.State, len(list))
+	for _, s := range list {
+		state := s.ociState()
+		r.addTimes(state)
+		states[state.ID] = state
+	}
+	return states, nil
+}
+
+// addTimes sets start and finish times and exit code of container
+// that RuncClient tracks itself, since runtime doesn't report them.
+func (r *RuncClient) addTimes(state *ociruntime.State) {
+	r.mu.Lock()
+	if cont, ok := r.containers[state.ID]; ok {
+		state.StartedAt = cont.startedAt
+		state.FinishedAt = cont.finishedAt
+		state.ExitCode = cont.exitCode
+	}
+	r.mu.Unlock()
+	if state.Status == "stopped" && state.FinishedAt == nil {
+		finishedAt := time.Now().UnixNano()
+		state.FinishedAt = &finishedAt
+	}
+}
+
+// Delete asks runtime to delete container with passed id. If runtime fails
+// to find object with given id, ErrNotFound is returned.
+func (r *RuncClient) Delete(id string) error {
+	_, err := r.output(nil, "delete", id)
+	r.mu.Lock()
+	cont, ok := r.containers[id]
+	delete(r.containers, id)
+	r.mu.Unlock()
+	if ok {
+		cont.stop()
+		if cont.log != nil {
+			cont.log.Close()
+		}
+	}
+	return err
+}
+
+// Create asks runtime to create a container with passed parameters.
+// Container output is written to the file passed with --log-path flag and
+// state changes are reported to the socket passed with --sync-socket flag,
+// see CLIClient.Create. When stdin is true, returned writer propagates any
+// input into container. TTY and empty process containers are not supported.
+func (r *RuncClient) Create(id, bundle string, stdin, tty bool, flags ...string) (io.WriteCloser, error) {
+	if tty {
+		return nil, &EngineError{Kind: KindInvalidSpec, Message: "tty is not supported by runtime"}
+	}
+	cont := &runcContainer{
+		exitFile: filepath.Join(bundle, runcExitFile),
+		exited:   make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	var logPath, logFormat string
+	for i := 0; i < len(flags); i++ {
+		var value string
+		if i+1 < len(flags) {
+			value = flags[i+1]
+		}
+		switch flags[i] {
+		case "--sync-socket":
+			cont.syncSocket = value
+		case "--log-path":
+			logPath = value
+		case "--log-format":
+			logFormat = value
+		default:
+			return nil, &EngineError{Kind: KindInvalidSpec, Message: fmt.Sprintf("%s is not supported by runtime", flags[i])}
+		}
+		i++
+	}
+	if logPath != "" && logFormat != LogFormatKubernetes {
+		return nil, &EngineError{Kind: KindInvalidSpec, Message: fmt.Sprintf("log format %q is not supported by runtime", logFormat)}
+	}
+
+	cont.notify("creating")
+	var err error
+	if logPath != "" {
+		cont.log, err = openLogWriter(logPath)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// exit file may be left from previous container in the same bundle
+	os.Remove(cont.exitFile)
+	pidFile := filepath.Join(bundle, runcPidFile)
+	createCmd := exec.Command(monitorBinary, MonitorCommand, cont.exitFile, pidFile,
+		r.binary, "create", "--bundle", bundle, "--pid-file", pidFile, id)
+	createCmd.SysProcAttr = &syscall.SysProcAttr{
+		// do not receive signals sent to sycri process group
+		Setpgid: true,
+	}
+
+	// container inherits stdio of runtime, so pipes are passed in order to
+	// write its output to the log file; our copies of container ends are
+	// closed once monitor reports creation so that output readers get EOF
+	// with container exit
+	var parentEnds, containerEnds []*os.File
+	created := false
+	defer func() {
+		closeFiles(containerEnds)
+		if !created {
+			closeFiles(parentEnds)
+			if cont.log != nil {
+				cont.log.Close()
+			}
+		}
+	}()
+	var stdinWrite io.WriteCloser
+	if stdin {
+		rd, wr, err := os.Pipe()
+		if err != nil {
+			return nil, fmt.Errorf("could not create pipe: %v", err)
+		}
+		parentEnds = append(parentEnds, wr)
+		containerEnds = append(containerEnds, rd)
+		createCmd.Stdin = rd
+		stdinWrite = wr
+	}
+	var outputs []*os.File
+	for i := 0; i < 2; i++ {
+		rd, wr, err := os.Pipe()
+		if err != nil {
+			return nil, fmt.Errorf("could not create pipe: %v", err)
+		}
+		parentEnds = append(parentEnds, rd)
+		containerEnds = append(containerEnds, wr)
+		outputs = append(outputs, rd)
+	}
+	createCmd.Stdout = containerEnds[len(containerEnds)-2]
+	createCmd.Stderr = containerEnds[len(containerEnds)-1]
+	readyRd, readyWr, err := os.Pipe()
+	if err != nil {
+		return nil, fmt.Errorf("could not create pipe: %v", err)
+	}
+	defer readyRd.Close()
+	createCmd.ExtraFiles = []*os.File{readyWr}
+
+	glog.V(5).Infof("Executing %v", createCmd.Args)
+	err = createCmd.Start()
+	readyWr.Close()
+	closeFiles(containerEnds)
+	containerEnds = nil
+	if err != nil {
+		return nil, fmt.Errorf("could not start monitor: %v", err)
+	}
+
+	ctx, cancel := callContext()
+	defer cancel()
+	ready := make(chan bool, 1)
+	go func() {
+		n, _ := readyRd.Read(make([]byte, 1))
+		ready <- n == 1
+	}()
+	var ok bool
+	select {
+	case ok = <-ready:
+	case <-ctx.Done():
+		createCmd.Process.Kill()
+	}
+	if !ok {
+		err := createCmd.Wait()
+		// runtime writes its errors to stderr which is container's stderr
+		var message []byte
+		stderr := tailBuffer{limit: maxEngineMessage}
+		copied := make(chan struct{})
+		go func() {
+			io.Copy(&stderr, outputs[1])
+			close(copied)
+		}()
+		select {
+		case <-copied:
+			message = stderr.Bytes()
+		case <-time.After(time.Second):
+			glog.V(4).Infof("Timed out waiting for create container command output")
+		}
+		if err == nil {
+			err = fmt.Errorf("monitor exited before container was created")
+		}
+		return nil, Wrap(callError(ctx, err, message), "could not execute create container command")
+	}
+	created = true
+	go func() {
+		err := createCmd.Wait()
+		glog.V(4).Infof("Monitor of container %s exited: %v", id, err)
+		close(cont.exited)
+	}()
+	go cont.log.copy("stdout", outputs[0])
+	go cont.log.copy("stderr", outputs[1])
+
+	r.mu.Lock()
+	r.containers[id] = cont
+	r.mu.Unlock()
+	cont.notify("created")
+	return stdinWrite, nil
+}
+
+// Start asks runtime to start container with passed id. Once container
+// is running its monitor is waited for in order to report its exit.
+func (r *RuncClient) Start(id string) error {
+	if _, err := r.output(nil, "start", id); err != nil {
+		return err
+	}
+	startedAt := time.Now().UnixNano()
+	r.mu.Lock()
+	cont, ok := r.containers[id]
+	if ok {
+		cont.startedAt = &startedAt
+	}
+	r.mu.Unlock()
+	if ok {
+		cont.notify("running")
+		go r.monitor(id, cont)
+	}
+	return nil
+}
+
+// ExecSync executes a command inside a container synchronously until
+// context is done and returns the result, see CLIClient.ExecSync.
+func (r *RuncClient) ExecSync(ctx context.Context, id string, args, envs []string, maxOutput int64) (*ExecResponse, error) {
+	return execSync(r.PrepareExec(ctx, id, args, envs), maxOutput)
+}
+
+// Exec executes passed command inside a container setting io streams to passed ones.
+func (r *RuncClient) Exec(ctx context.Context, id string,
+	stdin io.Reader, stdout, stderr io.Writer,
+	args, envs []string) error {
+
+	runCmd := r.PrepareExec(ctx, id, args, envs)
+	runCmd.Stdout = stdout
+	runCmd.Stderr = stderr
+	runCmd.Stdin = stdin
+
+	err := runCmd.Run()
+	_, ok := err.(*exec.ExitError)
+	if !ok && err != nil {
+		return fmt.Errorf("could not execute: %v", err)
+	}
+	return nil
+}
+
+// PrepareExec prepares command to call to execute inside a given container.
+// Unlike Singularity, runtime doesn't take environment of exec command from
+// its own environment, so passed envs are set with --env flags.
+func (r *RuncClient) PrepareExec(ctx context.Context, id string, args, envs []string) *exec.Cmd {
+	cmd := []string{"exec"}
+	for _, env := range envs {
+		cmd = append(cmd, "--env", env)
+	}
+	cmd = append(cmd, id)
+	cmd = append(cmd, args...)
+
+	execCmd := r.command(ctx, cmd...)
+	glog.V(5).Infof("Prepared %v", execCmd.Args)
+	return execCmd
+}
+
+// Kill asks runtime to send SIGINT to container with passed id.
+// If force is true that SIGKILL is sent instead.
+func (r *RuncClient) Kill(id string, force bool) error {
+	sig := "SIGINT"
+	if force {
+		sig = "SIGKILL"
+	}
+	return r.Signal(id, sig)
+}
+
+// Signal asks runtime to send passed sig to container with passed id.
+func (r *RuncClient) Signal(id, sig string) error {
+	return retry(func() error {
+		_, err := r.output(nil, "kill", id, sig)
+		return err
+	})
+}
+
+// UpdateContainerResources asks runtime to update container resources
+// according to the passed parameter.
+func (r *RuncClient) UpdateContainerResources(id string, req *specs.LinuxResources) error {
+	buf := bytes.NewBuffer(nil)
+	err := json.NewEncoder(buf).Encode(req)
+	if err != nil {
+		return fmt.Errorf("could not encode update request: %v", err)
+	}
+	_, err = r.output(buf, "update", "--resources", "-", id)
+	return err
+}
+
+// ReopenLog reopens log file of a container with passed id, e.g. after it was rotated.
+func (r *RuncClient) ReopenLog(id string) error {
+	r.mu.Lock()
+	cont, ok := r.containers[id]
+	r.mu.Unlock()
+	if !ok {
+		return ErrNotFound
+	}
+	if cont.log == nil {
+		return nil
+	}
+	return cont.log.Reopen()
+}
+
+// monitor waits for monitor process of running container with passed id
+// to exit and reports container exit to the sync socket. When monitor didn't
+// record exit code, e.g. it was killed, exit code is left unknown.
+func (r *RuncClient) monitor(id string, cont *runcContainer) {
+	select {
+	case <-cont.done:
+		return
+	case <-cont.exited:
+	}
+
+	finishedAt := time.Now().UnixNano()
+	code, err := readExitFile(cont.exitFile)
+	if err != nil {
+		glog.Errorf("Could not read exit code of container %s: %v", id, err)
+	}
+	r.mu.Lock()
+	cont.finishedAt = &finishedAt
+	if err == nil {
+		exitCode := int(code)
+		cont.exitCode = &exitCode
+	}
+	r.mu.Unlock()
+	cont.notify("stopped")
+}
+
+// command returns command that runs runtime with passed args.
+func (r *RuncClient) command(ctx context.Context, args ...string) *exec.Cmd {
+	return exec.CommandContext(ctx, r.binary, args...)
+}
+
+// output runs runtime with passed args and stdin and returns its output.
+// If runtime fails to find container, ErrNotFound is returned.
+func (r *RuncClient) output(stdin io.Reader, args ...string) ([]byte, error) {
+	ctx, cancel := callContext()
+	defer cancel()
+
+	stderr := tailBuffer{limit: maxEngineMessage}
+	cmd := r.command(ctx, args...)
+	cmd.Stdin = stdin
+	cmd.Stderr = io.MultiWriter(os.Stderr, &stderr)
+
+	glog.V(5).Infof("Executing %v", cmd.Args)
+	out, err := cmd.Output()
+	if err != nil {
+		if _, ok := err.(*exec.ExitError); ok && ctx.Err() == nil &&
+			strings.Contains(string(stderr.Bytes()), "does not exist") {
+			return nil, ErrNotFound
+		}
+		return nil, Wrap(callError(ctx, err, stderr.Bytes()), "could not execute %s", args[0])
+	}
+	return out, nil
+}
+
+func closeFiles(files []*os.File) {
+	for _, f := range files {
+		f.Close()
+	}
+}
+
+// parseRuncState converts state reported by runc compatible runtime.
+func parseRuncState(data []byte) (*ociruntime.State, error) {
+	var state runcState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("could not decode state: %v", err)
+	}
+	return state.ociState(), nil
+}
+
+func (s runcState) ociState() *ociruntime.State {
+	createdAt := s.Created.UnixNano()
+	return &ociruntime.State{
+		State:     s.State,
+		CreatedAt: &createdAt,
+	}
+}
+
+// notify reports passed status to container's sync socket.
+func (c *runcContainer) notify(status string) {
+	if c.syncSocket == "" {
+		return
+	}
+	conn, err := unix.Dial(c.syncSocket)
+	if err != nil {
+		glog.Errorf("Could not connect to sync socket %s: %v", c.syncSocket, err)
+		return
+	}
+	defer conn.Close()
+	msg := struct {
+		Status string `json:"status"`
+	}{status}
+	if err := json.NewEncoder(conn).Encode(&msg); err != nil {
+		glog.Errorf("Could not send %s status to sync socket: %v", status, err)
+	}
+}
+
+func (c *runcContainer) stop() {
+	select {
+	case <-c.done:
+	default:
+		close(c.done)
+	}
+}
+
+// logWriter writes container output to a file in kubernetes log format.
+type logWriter struct {
+	path string
+
+	mu   sync.Mutex
+	file *os.File
+}
+
+func openLogWriter(path string) (*logWriter, error) {
+	w := &logWriter{path: path}
+	if err := w.Reopen(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// Reopen closes log file and opens it again.
+func (w *logWriter) Reopen() error {
+	f, err := os.OpenFile(w.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0640)
+	if err != nil {
+		return fmt.Errorf("could not open log file: %v", err)
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.file != nil {
+		w.file.Close()
+	}
+	w.file = f
+	return nil
+}
+
+// Close closes log file.
+func (w *logWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.file == nil {
+		return nil
+	}
+	err := w.file.Close()
+	w.file = nil
+	return err
+}
+
+// WriteLine writes a single line of passed stream to the log. Partial lines
+// are the ones that do not end with a new line.
+func (w *logWriter) WriteLine(stream string, line []byte) error {
+	tag := "P"
+	if len(line) > 0 && line[len(line)-1] == '\n' {
+		tag = "F"
+		line = line[:len(line)-1]
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.file == nil {
+		return nil
+	}
+	_, err := fmt.Fprintf(w.file, "%s %s %s %s\n", time.Now().Format(time.RFC3339Nano), stream, tag, line)
+	return err
+}
+
+// copy writes lines read from r to the log until EOF and closes r.
+// When w is nil, r is drained.
+func (w *logWriter) copy(stream string, r io.ReadCloser) {
+	defer r.Close()
+	rd := bufio.NewReaderSize(r, 16<<10)
+	for {
+		line, err := rd.ReadSlice('\n')
+		if len(line) > 0 && w != nil {
+			if err := w.WriteLine(stream, line); err != nil {
+				glog.Errorf("Could not write container log: %v", err)
+			}
+		}
+		if err != nil && err != bufio.ErrBufferFull {
+			return
+		}
+	}
+}
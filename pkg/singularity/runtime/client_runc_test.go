@@ -0,0 +1,108 @@
+// Copyright (c) 2018-2019 Sylabs, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runtime
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/stretchr/testify/require"
+	"github.com/sylabs/singularity/pkg/ociruntime"
+)
+
+func TestParseRuncState(t *testing.T) {
+	created := time.Date(2019, 5, 20, 10, 15, 30, 500, time.UTC)
+	createdAt := created.UnixNano()
+
+	tt := []struct {
+		name        string
+		input       string
+		expectState *ociruntime.State
+		expectError bool
+	}{
+		{
+			name: "runc state",
+			input: `{"ociVersion":"1.0.1-dev","id":"abc","pid":1234,"status":"running",
+				"bundle":"/var/run/singularity/containers/abc/bundle",
+				"rootfs":"/var/run/singularity/containers/abc/bundle/rootfs",
+				"created":"2019-05-20T10:15:30.0000005Z","owner":""}`,
+			expectState: &ociruntime.State{
+				State: specs.State{
+					Version: "1.0.1-dev",
+					ID:      "abc",
+					Status:  "running",
+					Pid:     1234,
+					Bundle:  "/var/run/singularity/containers/abc/bundle",
+				},
+				CreatedAt: &createdAt,
+			},
+		},
+		{
+			name:        "invalid state",
+			input:       `{"id":`,
+			expectError: true,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			state, err := parseRuncState([]byte(tc.input))
+			if tc.expectError {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.expectState, state)
+		})
+	}
+}
+
+func TestLogWriter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	require.NoError(t, err, "could not create temp dir")
+	defer os.RemoveAll(dir)
+	logPath := filepath.Join(dir, "log")
+
+	w, err := openLogWriter(logPath)
+	require.NoError(t, err, "could not open log")
+	rd, wr, err := os.Pipe()
+	require.NoError(t, err, "could not create pipe")
+	done := make(chan struct{})
+	go func() {
+		w.copy("stdout", rd)
+		close(done)
+	}()
+	_, err = wr.Write([]byte("first line\nsecond"))
+	require.NoError(t, err, "could not write output")
+	require.NoError(t, wr.Close())
+	<-done
+
+	require.NoError(t, os.Rename(logPath, logPath+".1"))
+	require.NoError(t, w.Reopen(), "could not reopen log")
+	require.NoError(t, w.WriteLine("stderr", []byte("after rotation\n")))
+	require.NoError(t, w.Close())
+
+	rotated, err := ioutil.ReadFile(logPath + ".1")
+	require.NoError(t, err, "could not read rotated log")
+	require.Regexp(t, regexp.MustCompile(`^\S+ stdout F first line\n\S+ stdout P second\n$`), string(rotated))
+	current, err := ioutil.ReadFile(logPath)
+	require.NoError(t, err, "could not read log")
+	require.Regexp(t, regexp.MustCompile(`^\S+ stderr F after rotation\n$`), string(current))
+}
@@ -0,0 +1,181 @@
+// Copyright (c) 2018-2019 Sylabs, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runtime
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// maxEngineMessage is a maximum number of bytes of engine's
+// stderr output that is attached to EngineError.
+const maxEngineMessage = 4 << 10
+
+// ErrorKind classifies failures reported by Singularity OCI engine.
+type ErrorKind int
+
+const (
+	// KindUnknown means failure reason could not be determined.
+	KindUnknown ErrorKind = iota
+	// KindNotFound means container or its files could not be found.
+	KindNotFound
+	// KindPermission means engine lacks privileges to complete the request.
+	KindPermission
+	// KindOOM means engine or container ran out of memory.
+	KindOOM
+	// KindInvalidSpec means container OCI spec was rejected by engine.
+	KindInvalidSpec
+	// KindUnavailable means engine didn't respond in time.
+	KindUnavailable
+)
+
+// String returns a human readable representation of an ErrorKind.
+func (k ErrorKind) String() string {
+	switch k {
+	case KindNotFound:
+		return "not found"
+	case KindPermission:
+		return "permission denied"
+	case KindOOM:
+		return "out of memory"
+	case KindInvalidSpec:
+		return "invalid spec"
+	case KindUnavailable:
+		return "unavailable"
+	}
+	return "unknown"
+}
+
+// logLevelPrefix matches log level engine prefixes its messages with.
+var logLevelPrefix = regexp.MustCompile(`^(fatal|error|warning|info|verbose|debug):\s+`)
+
+// errorPatterns lists engine's own lower case messages for each kind,
+// kinds are matched in order. Patterns are matched against whole lines
+// of engine's output with log level prefix stripped, so that generic
+// errors merely mentioning e.g. a missing file are not reclassified.
+var errorPatterns = []struct {
+	kind     ErrorKind
+	patterns []*regexp.Regexp
+}{
+	{
+		kind: KindNotFound,
+		patterns: []*regexp.Regexp{
+			regexp.MustCompile(`^no instance found with name \S+$`),
+		},
+	},
+	{
+		kind: KindPermission,
+		patterns: []*regexp.Regexp{
+			regexp.MustCompile(`^permission denied$`),
+			regexp.MustCompile(`^operation not permitted$`),
+			regexp.MustCompile(`^\S+ must be run as root$`),
+		},
+	},
+	{
+		kind: KindOOM,
+		patterns: []*regexp.Regexp{
+			regexp.MustCompile(`^(fork|clone): cannot allocate memory$`),
+			regexp.MustCompile(`^out of memory$`),
+		},
+	},
+	{
+		kind: KindInvalidSpec,
+		patterns: []*regexp.Regexp{
+			regexp.MustCompile(`^failed to parse config\.json: .+$`),
+			regexp.MustCompile(`^json: unknown field "[^"]+"$`),
+		},
+	},
+}
+
+// EngineError is returned when Singularity OCI engine command fails.
+// It carries engine's stderr output so that actual failure reason is
+// not hidden behind exit status.
+type EngineError struct {
+	// Kind is a failure class deduced from engine's message.
+	Kind ErrorKind
+	// Message is engine's stderr output, it may be empty.
+	Message string
+	// Err is an error returned by command execution, e.g. exit status.
+	Err error
+
+	context string
+}
+
+// Error returns error message prefixed with context the error was wrapped with.
+func (e *EngineError) Error() string {
+	msg := e.Err.Error()
+	if e.Message != "" {
+		msg = fmt.Sprintf("%s: %s", msg, e.Message)
+	}
+	if e.context != "" {
+		msg = fmt.Sprintf("%s: %s", e.context, msg)
+	}
+	return msg
+}
+
+// newEngineError returns EngineError for failed command
+// execution err with passed stderr output of the engine.
+func newEngineError(err error, stderr []byte) *EngineError {
+	msg := strings.TrimSpace(string(stderr))
+	return &EngineError{
+		Kind:    classifyMessage(msg),
+		Message: msg,
+		Err:     err,
+	}
+}
+
+func classifyMessage(msg string) ErrorKind {
+	lines := strings.Split(strings.ToLower(msg), "\n")
+	for _, class := range errorPatterns {
+		for _, pattern := range class.patterns {
+			for _, line := range lines {
+				line = logLevelPrefix.ReplaceAllString(strings.TrimSpace(line), "")
+				if pattern.MatchString(line) {
+					return class.kind
+				}
+			}
+		}
+	}
+	return KindUnknown
+}
+
+// Wrap annotates err with a message made of format and args. Unlike fmt.Errorf,
+// it keeps EngineError type so that its kind is available with KindOf.
+func Wrap(err error, format string, args ...interface{}) error {
+	msg := fmt.Sprintf(format, args...)
+	eErr, ok := err.(*EngineError)
+	if !ok {
+		return fmt.Errorf("%s: %v", msg, err)
+	}
+	wrapped := *eErr
+	if wrapped.context != "" {
+		msg = fmt.Sprintf("%s: %s", msg, wrapped.context)
+	}
+	wrapped.context = msg
+	return &wrapped
+}
+
+// KindOf returns kind of failure reported by engine. Errors
+// that are not returned by engine are of KindUnknown.
+func KindOf(err error) ErrorKind {
+	if err == ErrNotFound {
+		return KindNotFound
+	}
+	if eErr, ok := err.(*EngineError); ok {
+		return eErr.Kind
+	}
+	return KindUnknown
+}
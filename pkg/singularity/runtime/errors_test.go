@@ -0,0 +1,163 @@
+// Copyright (c) 2018-2019 Sylabs, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runtime
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestClassifyMessage(t *testing.T) {
+	tt := []struct {
+		name   string
+		msg    string
+		expect ErrorKind
+	}{
+		{
+			name:   "empty",
+			expect: KindUnknown,
+		},
+		{
+			name:   "no instance",
+			msg:    "FATAL:   no instance found with name test",
+			expect: KindNotFound,
+		},
+		{
+			name:   "no instance after warning",
+			msg:    "WARNING: could not remove socket\nFATAL:   no instance found with name test",
+			expect: KindNotFound,
+		},
+		{
+			name:   "missing file",
+			msg:    "FATAL:   stat /var/lib/test/config.json: no such file or directory",
+			expect: KindUnknown,
+		},
+		{
+			name:   "missing path",
+			msg:    "ERROR:   mount source /data does not exist",
+			expect: KindUnknown,
+		},
+		{
+			name:   "file permission",
+			msg:    "ERROR:   open /var/lib/test: Permission denied",
+			expect: KindUnknown,
+		},
+		{
+			name:   "engine permission",
+			msg:    "FATAL:   permission denied",
+			expect: KindPermission,
+		},
+		{
+			name:   "fork oom",
+			msg:    "FATAL:   fork: cannot allocate memory",
+			expect: KindOOM,
+		},
+		{
+			name:   "invalid argument",
+			msg:    "FATAL:   write /sys/fs/cgroup/cpu/cpu.shares: invalid argument",
+			expect: KindUnknown,
+		},
+		{
+			name:   "unsupported",
+			msg:    "ERROR:   overlay is unsupported by kernel, using underlay",
+			expect: KindUnknown,
+		},
+		{
+			name:   "invalid config",
+			msg:    "FATAL:   failed to parse config.json: unexpected EOF",
+			expect: KindInvalidSpec,
+		},
+		{
+			name:   "unknown field",
+			msg:    "FATAL:   json: unknown field \"foo\"",
+			expect: KindInvalidSpec,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			require.Equal(t, tc.expect, classifyMessage(tc.msg))
+		})
+	}
+}
+
+func TestEngineError(t *testing.T) {
+	exitErr := fmt.Errorf("exit status 255")
+
+	tt := []struct {
+		name          string
+		err           error
+		expectKind    ErrorKind
+		expectMessage string
+	}{
+		{
+			name:          "no output",
+			err:           newEngineError(exitErr, nil),
+			expectKind:    KindUnknown,
+			expectMessage: "exit status 255",
+		},
+		{
+			name:          "not found",
+			err:           newEngineError(exitErr, []byte("FATAL:   no instance found with name test\n")),
+			expectKind:    KindNotFound,
+			expectMessage: "exit status 255: FATAL:   no instance found with name test",
+		},
+		{
+			name:          "permission",
+			err:           newEngineError(exitErr, []byte("FATAL:   oci must be run as root")),
+			expectKind:    KindPermission,
+			expectMessage: "exit status 255: FATAL:   oci must be run as root",
+		},
+		{
+			name:          "oom",
+			err:           newEngineError(exitErr, []byte("FATAL:   fork: cannot allocate memory")),
+			expectKind:    KindOOM,
+			expectMessage: "exit status 255: FATAL:   fork: cannot allocate memory",
+		},
+		{
+			name:          "invalid spec",
+			err:           newEngineError(exitErr, []byte("FATAL:   failed to parse config.json: unexpected EOF")),
+			expectKind:    KindInvalidSpec,
+			expectMessage: "exit status 255: FATAL:   failed to parse config.json: unexpected EOF",
+		},
+		{
+			name:          "wrapped twice",
+			err:           Wrap(Wrap(newEngineError(exitErr, []byte("Operation not permitted")), "could not start %s", "test"), "could not run"),
+			expectKind:    KindPermission,
+			expectMessage: "could not run: could not start test: exit status 255: Operation not permitted",
+		},
+		{
+			name:          "not engine error",
+			err:           Wrap(fmt.Errorf("permission denied"), "could not run"),
+			expectKind:    KindUnknown,
+			expectMessage: "could not run: permission denied",
+		},
+		{
+			name:          "instance not found",
+			err:           ErrNotFound,
+			expectKind:    KindNotFound,
+			expectMessage: "no instance found for provided name",
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			require.Equal(t, tc.expectKind, KindOf(tc.err))
+			require.Equal(t, tc.expectMessage, tc.err.Error())
+		})
+	}
+}
@@ -0,0 +1,105 @@
+// Copyright (c) 2018-2019 Sylabs, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runtime
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/user"
+	"path/filepath"
+
+	"github.com/sylabs/singularity/pkg/ociruntime"
+	"github.com/sylabs/singularity/pkg/syfs"
+)
+
+type (
+	// instanceFile mirrors parts of a file Singularity
+	// keeps for each running instance of an engine.
+	instanceFile struct {
+		Config []byte `json:"config"`
+	}
+
+	// ociEngineConfig mirrors parts of Singularity OCI engine
+	// config that engine records container state to.
+	ociEngineConfig struct {
+		EngineConfig struct {
+			State ociruntime.State `json:"state"`
+		} `json:"engineConfig"`
+	}
+)
+
+// ociInstanceDir returns directory Singularity keeps instance
+// files of OCI engine containers run by the current user in.
+func ociInstanceDir() (string, error) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		return "", fmt.Errorf("could not get hostname: %v", err)
+	}
+	u, err := user.Current()
+	if err != nil {
+		return "", fmt.Errorf("could not get current user: %v", err)
+	}
+	return filepath.Join(syfs.ConfigDir(), "instances", "oci", hostname, u.Username), nil
+}
+
+// listInstances reads states of all OCI engine containers which
+// instance files are located in dir and maps them by container ID.
+// Missing dir means that there are no containers.
+func listInstances(dir string) (map[string]*ociruntime.State, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*", "*.json"))
+	if err != nil {
+		return nil, fmt.Errorf("could not list instance files: %v", err)
+	}
+	states := make(map[string]*ociruntime.State, len(paths))
+	for _, path := range paths {
+		id := filepath.Base(filepath.Dir(path))
+		if filepath.Base(path) != id+".json" {
+			continue
+		}
+		state, err := readInstanceState(path)
+		if os.IsNotExist(err) {
+			// container was deleted meanwhile
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("could not read state of %s: %v", id, err)
+		}
+		states[id] = state
+	}
+	return states, nil
+}
+
+// readInstanceState reads container state recorded in instance file at path.
+func readInstanceState(path string) (*ociruntime.State, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var file instanceFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("could not decode instance file: %v", err)
+	}
+	var config ociEngineConfig
+	if err := json.Unmarshal(file.Config, &config); err != nil {
+		return nil, fmt.Errorf("could not decode engine config: %v", err)
+	}
+	state := config.EngineConfig.State
+	if state.Status == "" {
+		return nil, fmt.Errorf("engine config has no state")
+	}
+	return &state, nil
+}
@@ -0,0 +1,71 @@
+// Copyright (c) 2018-2019 Sylabs, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runtime
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/stretchr/testify/require"
+	"github.com/sylabs/singularity/pkg/ociruntime"
+)
+
+func TestListInstances(t *testing.T) {
+	dir, err := ioutil.TempDir("", "instances")
+	require.NoError(t, err, "could not create temp dir")
+	defer os.RemoveAll(dir)
+
+	writeInstance := func(name, file string, data []byte) {
+		require.NoError(t, os.MkdirAll(filepath.Join(dir, name), 0755))
+		require.NoError(t, ioutil.WriteFile(filepath.Join(dir, name, file), data, 0644))
+	}
+	instanceData := func(status string) []byte {
+		config, err := json.Marshal(map[string]interface{}{
+			"engineName": "oci",
+			"engineConfig": map[string]interface{}{
+				"state": map[string]interface{}{
+					"status": status,
+					"pid":    42,
+				},
+			},
+		})
+		require.NoError(t, err)
+		data, err := json.Marshal(instanceFile{Config: config})
+		require.NoError(t, err)
+		return data
+	}
+
+	states, err := listInstances(filepath.Join(dir, "missing"))
+	require.NoError(t, err)
+	require.Empty(t, states)
+
+	writeInstance("abc", "abc.json", instanceData("running"))
+	writeInstance("def", "def.json", instanceData("stopped"))
+	writeInstance("ghi", "other.json", instanceData("running"))
+	states, err = listInstances(dir)
+	require.NoError(t, err)
+	require.Equal(t, map[string]*ociruntime.State{
+		"abc": {State: specs.State{Status: "running", Pid: 42}},
+		"def": {State: specs.State{Status: "stopped", Pid: 42}},
+	}, states)
+
+	writeInstance("broken", "broken.json", []byte(`{"config":`))
+	_, err = listInstances(dir)
+	require.Error(t, err)
+}
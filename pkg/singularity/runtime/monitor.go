@@ -0,0 +1,153 @@
+// Copyright (c) 2018-2019 Sylabs, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runtime
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// MonitorCommand is a hidden sycri subcommand that creates containers of runc
+// compatible runtimes and waits for their exit, see RunMonitor.
+const MonitorCommand = "runc-monitor"
+
+// monitorBinary is a binary that is run with MonitorCommand to start monitor.
+var monitorBinary = "/proc/self/exe"
+
+// monitorExit is an exit status of container process recorded by monitor.
+type monitorExit struct {
+	ExitCode int32 `json:"exitCode"`
+}
+
+// RunMonitor implements MonitorCommand, which is run with paths to exit file
+// and pid file followed by runtime command that creates container and writes
+// its pid to pid file. Runtime is run with monitor's stdio, so any error is
+// reported as is. Once container is created monitor writes a byte to fd 3 and
+// closes its stdio. Monitor is a child subreaper, so container process is
+// reparented to it when runtime exits, and its exit code is recorded to exit
+// file. It returns process exit code, which is the one of runtime when
+// container could not be created.
+func RunMonitor(args []string) int {
+	ready := os.NewFile(3, "ready")
+	return monitor(args, func() {
+		ready.Write([]byte{0})
+		ready.Close()
+		if null, err := os.OpenFile(os.DevNull, os.O_RDWR, 0); err == nil {
+			for _, fd := range []int{0, 1, 2} {
+				unix.Dup2(int(null.Fd()), fd)
+			}
+			null.Close()
+		}
+	})
+}
+
+// monitor implements RunMonitor calling created once container is created.
+func monitor(args []string, created func()) int {
+	if len(args) < 3 {
+		fmt.Fprintf(os.Stderr, "usage: %s <exit file> <pid file> <runtime> [args...]\n", MonitorCommand)
+		return 2
+	}
+	exitFile, pidFile := args[0], args[1]
+	if err := unix.Prctl(unix.PR_SET_CHILD_SUBREAPER, 1, 0, 0, 0); err != nil {
+		fmt.Fprintf(os.Stderr, "could not become subreaper: %v\n", err)
+		return 1
+	}
+
+	cmd := exec.Command(args[2], args[3:]...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		if eErr, ok := err.(*exec.ExitError); ok {
+			code, _ := exitStatus(eErr.Sys().(syscall.WaitStatus))
+			return int(code)
+		}
+		fmt.Fprintf(os.Stderr, "could not run runtime: %v\n", err)
+		return 1
+	}
+	data, err := ioutil.ReadFile(pidFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "could not read container pid: %v\n", err)
+		return 1
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "could not parse container pid: %v\n", err)
+		return 1
+	}
+	created()
+
+	status, err := waitProcess(pid)
+	if err != nil {
+		return 1
+	}
+	code, _ := exitStatus(status)
+	if err := writeExitFile(exitFile, code); err != nil {
+		return 1
+	}
+	return 0
+}
+
+// waitProcess waits for child process with passed pid to exit and returns its
+// status. Any other child, e.g. orphaned descendant of container, is reaped.
+func waitProcess(pid int) (syscall.WaitStatus, error) {
+	for {
+		var status unix.WaitStatus
+		wpid, err := unix.Wait4(-1, &status, 0, nil)
+		if err == unix.EINTR {
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+		if wpid == pid {
+			return syscall.WaitStatus(status), nil
+		}
+	}
+}
+
+// writeExitFile records exit code of container process to file at path.
+func writeExitFile(path string, code int32) error {
+	data, err := json.Marshal(monitorExit{ExitCode: code})
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// readExitFile returns exit code of container process recorded by monitor.
+func readExitFile(path string) (int32, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	var exit monitorExit
+	if err := json.Unmarshal(data, &exit); err != nil {
+		return 0, fmt.Errorf("could not decode exit file: %v", err)
+	}
+	return exit.ExitCode, nil
+}
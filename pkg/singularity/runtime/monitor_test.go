@@ -0,0 +1,57 @@
+// Copyright (c) 2018-2019 Sylabs, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runtime
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMonitor(t *testing.T) {
+	dir, err := ioutil.TempDir("", "monitor")
+	require.NoError(t, err, "could not create temp dir")
+	defer os.RemoveAll(dir)
+
+	exitFile := filepath.Join(dir, runcExitFile)
+	pidFile := filepath.Join(dir, runcPidFile)
+
+	// runtime leaves container process running in background
+	// and exits, so that monitor has to adopt the process
+	var created bool
+	code := monitor([]string{exitFile, pidFile,
+		"/bin/sh", "-c", `sh -c 'sleep 0.1; exit 3' & echo $! > "$0"`, pidFile,
+	}, func() {
+		created = true
+	})
+	require.Equal(t, 0, code)
+	require.True(t, created, "container was not reported as created")
+	exitCode, err := readExitFile(exitFile)
+	require.NoError(t, err, "could not read exit file")
+	require.Equal(t, int32(3), exitCode)
+
+	require.NoError(t, os.Remove(exitFile))
+	created = false
+	code = monitor([]string{exitFile, pidFile, "/bin/sh", "-c", "exit 5"}, func() {
+		created = true
+	})
+	require.Equal(t, 5, code)
+	require.False(t, created, "container was reported as created")
+	_, err = readExitFile(exitFile)
+	require.True(t, os.IsNotExist(err), "unexpected exit file: %v", err)
+}
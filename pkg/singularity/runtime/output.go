@@ -0,0 +1,97 @@
+// Copyright (c) 2018-2019 Sylabs, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runtime
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// DefaultMaxExecSyncOutput is a default maximum number of bytes
+// of each output stream captured by ExecSync.
+const DefaultMaxExecSyncOutput = 16 << 20
+
+// limitedBuffer keeps at most limit bytes written to it and discards the rest
+// so that commands with huge output cannot exhaust memory.
+type limitedBuffer struct {
+	buf       bytes.Buffer
+	limit     int64
+	discarded int64
+}
+
+// Write writes p into the buffer until limit is reached. It never fails
+// so that command is not interrupted when its output is truncated.
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	n := len(p)
+	if room := b.limit - int64(b.buf.Len()); room < int64(n) {
+		if room < 0 {
+			room = 0
+		}
+		b.discarded += int64(n) - room
+		p = p[:room]
+	}
+	b.buf.Write(p)
+	return n, nil
+}
+
+// Truncated returns true when any output was discarded.
+func (b *limitedBuffer) Truncated() bool {
+	return b.discarded > 0
+}
+
+// Reserve makes room for n bytes within limit, e.g. for a marker appended
+// to captured output, discarding the last captured bytes when needed.
+func (b *limitedBuffer) Reserve(n int64) {
+	b.limit -= n
+	if b.limit < 0 {
+		b.limit = 0
+	}
+	if extra := int64(b.buf.Len()) - b.limit; extra > 0 {
+		b.buf.Truncate(int(b.limit))
+		b.discarded += extra
+	}
+}
+
+// Bytes returns captured output. When output is truncated,
+// it ends with a marker telling how many bytes were discarded.
+func (b *limitedBuffer) Bytes() []byte {
+	if !b.Truncated() {
+		return b.buf.Bytes()
+	}
+	marker := fmt.Sprintf("\n[output truncated: %d bytes omitted]\n", b.discarded)
+	return append(b.buf.Bytes(), marker...)
+}
+
+// tailBuffer keeps last limit bytes written to it, since engine
+// reports failure reason at the end of its output.
+type tailBuffer struct {
+	buf   []byte
+	limit int
+}
+
+// Write appends p to the buffer discarding the oldest bytes
+// that exceed limit. It never fails.
+func (b *tailBuffer) Write(p []byte) (int, error) {
+	b.buf = append(b.buf, p...)
+	if extra := len(b.buf) - b.limit; extra > 0 {
+		b.buf = append(b.buf[:0], b.buf[extra:]...)
+	}
+	return len(p), nil
+}
+
+// Bytes returns captured output.
+func (b *tailBuffer) Bytes() []byte {
+	return b.buf
+}
@@ -0,0 +1,127 @@
+// Copyright (c) 2018-2019 Sylabs, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runtime
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLimitedBuffer(t *testing.T) {
+	tt := []struct {
+		name            string
+		limit           int64
+		writes          []string
+		expectOutput    string
+		expectTruncated bool
+	}{
+		{
+			name:         "under limit",
+			limit:        10,
+			writes:       []string{"foo", "bar"},
+			expectOutput: "foobar",
+		},
+		{
+			name:         "exactly limit",
+			limit:        6,
+			writes:       []string{"foo", "bar"},
+			expectOutput: "foobar",
+		},
+		{
+			name:            "over limit",
+			limit:           4,
+			writes:          []string{"foo", "bar", "baz"},
+			expectOutput:    "foob\n[output truncated: 5 bytes omitted]\n",
+			expectTruncated: true,
+		},
+		{
+			name:            "zero limit",
+			limit:           0,
+			writes:          []string{"foo"},
+			expectOutput:    "\n[output truncated: 3 bytes omitted]\n",
+			expectTruncated: true,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			b := &limitedBuffer{limit: tc.limit}
+			for _, w := range tc.writes {
+				n, err := b.Write([]byte(w))
+				require.NoError(t, err)
+				require.Equal(t, len(w), n)
+			}
+			require.Equal(t, tc.expectTruncated, b.Truncated())
+			require.Equal(t, tc.expectOutput, string(b.Bytes()))
+		})
+	}
+}
+
+func TestLimitedBuffer_Reserve(t *testing.T) {
+	tt := []struct {
+		name            string
+		limit           int64
+		write           string
+		reserve         int64
+		expectOutput    string
+		expectTruncated bool
+	}{
+		{
+			name:         "enough room",
+			limit:        10,
+			write:        "foobar",
+			reserve:      4,
+			expectOutput: "foobar",
+		},
+		{
+			name:            "output cut",
+			limit:           8,
+			write:           "foobar",
+			reserve:         4,
+			expectOutput:    "foob\n[output truncated: 2 bytes omitted]\n",
+			expectTruncated: true,
+		},
+		{
+			name:            "reserve over limit",
+			limit:           4,
+			write:           "foobar",
+			reserve:         6,
+			expectOutput:    "\n[output truncated: 6 bytes omitted]\n",
+			expectTruncated: true,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			b := &limitedBuffer{limit: tc.limit}
+			_, err := b.Write([]byte(tc.write))
+			require.NoError(t, err)
+			b.Reserve(tc.reserve)
+			require.Equal(t, tc.expectTruncated, b.Truncated())
+			require.Equal(t, tc.expectOutput, string(b.Bytes()))
+		})
+	}
+}
+
+func TestTailBuffer(t *testing.T) {
+	buf := tailBuffer{limit: 8}
+	for _, s := range []string{"debug", " output\n", "FATAL"} {
+		n, err := buf.Write([]byte(s))
+		require.NoError(t, err)
+		require.Equal(t, len(s), n)
+	}
+	require.Equal(t, "ut\nFATAL", string(buf.Bytes()))
+}
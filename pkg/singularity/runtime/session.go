@@ -0,0 +1,102 @@
+// Copyright (c) 2018-2019 Sylabs, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runtime
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/sylabs/singularity/pkg/ociruntime"
+)
+
+// ControlSession is a long-lived handle to the engine of a single container.
+// Engine serves one request per control socket connection, so instead of
+// keeping a connection open session remembers everything needed to reach
+// the engine and serializes requests to it. Once container has stopped its
+// state can no longer change and is served from cache without forking
+// Singularity CLI.
+type ControlSession struct {
+	id     string
+	engine *EngineClient
+
+	mu    sync.Mutex
+	state *ociruntime.State
+}
+
+// Session returns new control session for a container with passed id.
+func (e *EngineClient) Session(id string) *ControlSession {
+	return &ControlSession{
+		id:     id,
+		engine: e,
+	}
+}
+
+// State returns current state of the container.
+func (s *ControlSession) State() (*ociruntime.State, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.state != nil && StatusToState(s.state.Status) == StateExited {
+		return s.state, nil
+	}
+	state, err := s.engine.cli.State(s.id)
+	if err != nil {
+		return nil, err
+	}
+	s.state = state
+	return state, nil
+}
+
+// Observe records state of the container queried elsewhere, e.g. listed
+// along with other containers, so that session doesn't query it again.
+func (s *ControlSession) Observe(state *ociruntime.State) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.state != nil && StatusToState(s.state.Status) == StateExited {
+		return
+	}
+	s.state = state
+}
+
+// Start asks engine to start the container.
+func (s *ControlSession) Start() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.engine.Start(s.id, s.state)
+}
+
+// Signal sends passed sig, e.g. SIGTERM, to the container process.
+func (s *ControlSession) Signal(sig string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.engine.Signal(s.id, sig)
+}
+
+// ReopenLog asks engine to reopen container log file, e.g. after it was rotated.
+func (s *ControlSession) ReopenLog() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.state == nil || s.state.ControlSocket == "" {
+		return fmt.Errorf("container didn't provide control socket")
+	}
+	ctrl := ociruntime.Control{
+		ReopenLog: true,
+	}
+	return Control(s.state.ControlSocket, ctrl)
+}
@@ -0,0 +1,72 @@
+// Copyright (c) 2018-2019 Sylabs, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runtime
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/sylabs/singularity/pkg/ociruntime"
+)
+
+func TestControlSession_State(t *testing.T) {
+	session := NewEngineClient(NewCLIClient()).Session("test")
+	stopped := &ociruntime.State{}
+	stopped.Status = "stopped"
+	session.state = stopped
+
+	// state of stopped container is final and must not be queried again
+	state, err := session.State()
+	require.NoError(t, err)
+	require.True(t, state == stopped)
+}
+
+func TestControlSession_ReopenLog(t *testing.T) {
+	session := NewEngineClient(NewCLIClient()).Session("test")
+	require.Error(t, session.ReopenLog(), "reopen without control socket")
+
+	socket := filepath.Join(os.TempDir(), fmt.Sprintf("cri-test-%s.sock", t.Name()))
+	ln, err := net.Listen("unix", socket)
+	require.NoError(t, err, "could not listen on socket")
+	defer ln.Close()
+
+	received := make(chan ociruntime.Control, 2)
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			var ctrl ociruntime.Control
+			if err := json.NewDecoder(c).Decode(&ctrl); err == nil {
+				received <- ctrl
+			}
+			c.Close()
+		}
+	}()
+
+	session.state = &ociruntime.State{
+		ControlSocket: socket,
+	}
+	for i := 0; i < 2; i++ {
+		require.NoError(t, session.ReopenLog())
+		require.Equal(t, ociruntime.Control{ReopenLog: true}, <-received)
+	}
+}
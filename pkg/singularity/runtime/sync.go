@@ -20,6 +20,8 @@ import (
 	"fmt"
 	"io"
 	"net"
+	"sync"
+	"time"
 
 	"github.com/golang/glog"
 	"github.com/sylabs/singularity/pkg/util/unix"
@@ -149,3 +151,65 @@ func StatusToState(status string) State {
 	}
 	return state
 }
+
+// StateTracker follows container state changes received on sync socket so
+// that container state is queried from runtime only when it has changed,
+// instead of on every request. Tracker considers state outdated when sync
+// socket stops delivering changes before container exits, as well as after
+// maxAge passes since the last query of not exited container in case some
+// change was missed.
+type StateTracker struct {
+	maxAge time.Duration
+
+	mu        sync.Mutex
+	version   uint64
+	queried   uint64
+	queriedAt time.Time
+	last      State
+	lost      bool
+}
+
+// TrackState forwards state changes received from events to the returned
+// channel and records them in the returned tracker. The returned channel
+// has the same capacity as events and is closed once events is closed.
+func TrackState(events <-chan State, maxAge time.Duration) (*StateTracker, <-chan State) {
+	t := &StateTracker{
+		maxAge:  maxAge,
+		version: 1,
+	}
+	out := make(chan State, cap(events))
+	go func() {
+		defer close(out)
+		for state := range events {
+			t.mu.Lock()
+			t.version++
+			t.last = state
+			t.mu.Unlock()
+			out <- state
+		}
+		t.mu.Lock()
+		t.lost = t.last != StateExited
+		t.mu.Unlock()
+	}()
+	return t, out
+}
+
+// Outdated reports whether previously queried state may be outdated. The returned
+// version should be passed to Queried once state is successfully queried.
+func (t *StateTracker) Outdated() (uint64, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	expired := t.maxAge > 0 && time.Since(t.queriedAt) > t.maxAge
+	outdated := t.lost || t.queried != t.version || (expired && t.last != StateExited)
+	return t.version, outdated
+}
+
+// Queried records that state of passed version was queried from runtime.
+func (t *StateTracker) Queried(version uint64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.queried = version
+	t.queriedAt = time.Now()
+}
@@ -105,3 +105,56 @@ func TestObserveState_AllWithDelay(t *testing.T) {
 	cancel()
 	assert.True(t, os.IsNotExist(os.Remove(socket)))
 }
+
+func TestTrackState(t *testing.T) {
+	events := make(chan State, 4)
+	tracker, states := TrackState(events, 0)
+
+	version, outdated := tracker.Outdated()
+	require.True(t, outdated, "state was never queried")
+	tracker.Queried(version)
+	_, outdated = tracker.Outdated()
+	require.False(t, outdated)
+
+	events <- StateRunning
+	require.Equal(t, StateRunning, <-states)
+	version, outdated = tracker.Outdated()
+	require.True(t, outdated, "state has changed")
+	tracker.Queried(version)
+	_, outdated = tracker.Outdated()
+	require.False(t, outdated)
+
+	close(events)
+	_, ok := <-states
+	require.False(t, ok)
+	version, outdated = tracker.Outdated()
+	require.True(t, outdated, "sync socket was lost before container exited")
+	tracker.Queried(version)
+	_, outdated = tracker.Outdated()
+	require.True(t, outdated, "sync socket was lost before container exited")
+}
+
+func TestTrackState_Exited(t *testing.T) {
+	events := make(chan State, 4)
+	tracker, states := TrackState(events, time.Nanosecond)
+
+	version, _ := tracker.Outdated()
+	tracker.Queried(version)
+	time.Sleep(time.Millisecond)
+	version, outdated := tracker.Outdated()
+	require.True(t, outdated, "queried state has expired")
+	tracker.Queried(version)
+
+	events <- StateExited
+	close(events)
+	require.Equal(t, StateExited, <-states)
+	_, ok := <-states
+	require.False(t, ok)
+
+	version, outdated = tracker.Outdated()
+	require.True(t, outdated, "container has exited")
+	tracker.Queried(version)
+	time.Sleep(time.Millisecond)
+	_, outdated = tracker.Outdated()
+	require.False(t, outdated, "state of exited container never expires")
+}
@@ -26,6 +26,25 @@ const (
 	// for a pre-pulled SIF images.
 	LocalFileDomain = "local.file"
 
+	// LocalDefinitionDomain is a special case domain that should be used
+	// for images built on the node from Singularity definition files,
+	// e.g. local.def/srv/recipes/app.def.
+	LocalDefinitionDomain = "local.def"
+
+	// LocalOCIDomain is a special case domain that should be used for local
+	// OCI image layout directories, e.g. local.oci/srv/images/busybox:1.30.
+	// Note that kubelet appends :latest tag to references without one.
+	LocalOCIDomain = "local.oci"
+
+	// OCILayoutScheme is a build source protocol of local OCI image layouts.
+	OCILayoutScheme = "oci"
+
+	// HTTPSScheme is a special case scheme that should be used for SIF images
+	// downloaded from web servers, e.g. https://images.example.com/app.sif,
+	// optionally pinned to sha256 checksum with URL fragment, e.g.
+	// https://images.example.com/app.sif#sha256=<hash>.
+	HTTPSScheme = "https"
+
 	// DockerDomain holds docker primary domain to pull images from.
 	DockerDomain = "docker.io"
 
@@ -50,4 +69,12 @@ const (
 	// EnvDockerPassword should be used to set Docker password for
 	// build engine when building from a private registry.
 	EnvDockerPassword = "SINGULARITY_DOCKER_PASSWORD"
+
+	// EnvCacheDir should be used to set directory build engine
+	// caches OCI blobs of images built from docker registries in.
+	EnvCacheDir = "SINGULARITY_CACHEDIR"
+
+	// EnvTmpDir should be used to set directory build
+	// engine creates its temporary files in.
+	EnvTmpDir = "SINGULARITY_TMPDIR"
 )
@@ -113,7 +113,8 @@ func (idx *TruncIndex) Delete(key string) error {
 }
 
 // Get retrieves an item from the TruncIndex by key or its prefix.
-// If there are multiple keys with the given prefix, an error is returned.
+// Key that matches exactly takes precedence over prefix search. If there
+// are multiple keys with the given prefix, an error is returned.
 func (idx *TruncIndex) Get(key string) (interface{}, error) {
 	if key == "" {
 		return nil, ErrEmptyPrefix
@@ -133,6 +134,9 @@ func (idx *TruncIndex) Get(key string) (interface{}, error) {
 
 	idx.RLock()
 	defer idx.RUnlock()
+	if _, exists := idx.keys[key]; exists {
+		return idx.trie.Get(patricia.Prefix(key)), nil
+	}
 	if err := idx.trie.VisitSubtree(patricia.Prefix(key), findByKey); err != nil {
 		return nil, err
 	}
@@ -61,6 +61,16 @@ func TestTruncIndex(t *testing.T) {
 	assertIndexGet(t, index, id[:7], id, nil)
 	assertIndexGet(t, index, id2[:7], id2, nil)
 
+	id3 := id[:6]
+	if err := index.Add(id3, id3); err != nil {
+		require.NoError(t, err)
+	}
+	assertIndexGet(t, index, id3, id3, nil)
+	assertIndexGet(t, index, id[:4], nil, ErrAmbiguousPrefix{id[:4]})
+	require.NoError(t, index.Delete(id3))
+	assertIndexGet(t, index, id, id, nil)
+	assertIndexGet(t, index, id3, nil, ErrAmbiguousPrefix{id3})
+
 	err := index.Delete("non-existing")
 	require.Equal(t, ErrNotFound, err)
 
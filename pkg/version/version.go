@@ -0,0 +1,72 @@
+// Copyright (c) 2018-2019 Sylabs, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package version holds Singularity-CRI build information. Variables
+// are set at build time with -ldflags, see Makefile.
+package version
+
+import (
+	"fmt"
+	"io"
+	"runtime"
+	"strings"
+)
+
+var (
+	version            = "unknown"
+	gitCommit          = "unknown"
+	buildDate          = "unknown"
+	singularityVersion = "unknown"
+)
+
+// CRIVersions are versions of CRI API that are served.
+var CRIVersions = []string{"v1alpha2"}
+
+// Info holds Singularity-CRI build information.
+type Info struct {
+	Version            string   `json:"version"`
+	GitCommit          string   `json:"gitCommit"`
+	BuildDate          string   `json:"buildDate"`
+	GoVersion          string   `json:"goVersion"`
+	Platform           string   `json:"platform"`
+	CRIVersions        []string `json:"criVersions"`
+	SingularityVersion string   `json:"singularityVersion"`
+}
+
+// Get returns build information of the running binary.
+func Get() Info {
+	return Info{
+		Version:            version,
+		GitCommit:          gitCommit,
+		BuildDate:          buildDate,
+		GoVersion:          runtime.Version(),
+		Platform:           runtime.GOOS + "/" + runtime.GOARCH,
+		CRIVersions:        CRIVersions,
+		SingularityVersion: singularityVersion,
+	}
+}
+
+// WriteText writes info to w in human readable form.
+func (i Info) WriteText(w io.Writer) error {
+	_, err := fmt.Fprintf(w, `Version:              %s
+Git commit:           %s
+Build date:           %s
+Go version:           %s
+Platform:             %s
+CRI API versions:     %s
+Singularity library:  %s
+`, i.Version, i.GitCommit, i.BuildDate, i.GoVersion, i.Platform,
+		strings.Join(i.CRIVersions, ", "), i.SingularityVersion)
+	return err
+}
@@ -0,0 +1,45 @@
+// Copyright (c) 2018-2019 Sylabs, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package version
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteText(t *testing.T) {
+	info := Info{
+		Version:            "1.0.0-beta.6",
+		GitCommit:          "5d9975e",
+		BuildDate:          "2019-09-20T10:00:00Z",
+		GoVersion:          "go1.11.5",
+		Platform:           "linux/amd64",
+		CRIVersions:        []string{"v1alpha2"},
+		SingularityVersion: "v3.4.1",
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, info.WriteText(&buf))
+	require.Equal(t, `Version:              1.0.0-beta.6
+Git commit:           5d9975e
+Build date:           2019-09-20T10:00:00Z
+Go version:           go1.11.5
+Platform:             linux/amd64
+CRI API versions:     v1alpha2
+Singularity library:  v3.4.1
+`, buf.String())
+}